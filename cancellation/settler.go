@@ -0,0 +1,107 @@
+// Package cancellation settles the reservations once they are cancelled or
+// their passengers denied boarding: what was paid for them is refunded, the
+// points they earned taken back and their seats offered to the users waiting
+// for one. A reservation stays unsettled until all of it is carried out, and
+// the ones left unsettled by a failure are settled again later.
+package cancellation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fabrizioperria/goflight/db"
+	"github.com/fabrizioperria/goflight/loyalty"
+	"github.com/fabrizioperria/goflight/payments"
+	"github.com/fabrizioperria/goflight/types"
+	"github.com/fabrizioperria/goflight/waitlist"
+)
+
+type Settler struct {
+	store     db.Store
+	processor *payments.Processor
+	loyalty   *loyalty.Program
+	waitlist  *waitlist.Queue
+}
+
+func NewSettler(store db.Store, processor *payments.Processor, program *loyalty.Program, queue *waitlist.Queue) *Settler {
+	return &Settler{
+		store:     store,
+		processor: processor,
+		loyalty:   program,
+		waitlist:  queue,
+	}
+}
+
+// RefundError is returned when the refund of a reservation failed at the
+// provider. The reservation stays unsettled, and the refund is retried by
+// SettlePending.
+type RefundError struct {
+	Err error
+}
+
+func (err *RefundError) Error() string {
+	return "refund failed, it will be retried: " + err.Err.Error()
+}
+
+func (err *RefundError) Unwrap() error {
+	return err.Err
+}
+
+// Settle refunds reservation, just ended, takes back the points it earned
+// and offers its seat to the first user waiting for it, then records it as
+// settled. The points and the seat are taken care of even when the refund
+// fails, in which case a *RefundError is returned along with the reservation
+// as it is. Settling a reservation again changes nothing.
+func (s *Settler) Settle(ctx context.Context, reservation *types.Reservation, now time.Time) (*types.Reservation, error) {
+	var refundErr error
+	refunded, err := s.processor.Refund(ctx, reservation)
+	if err != nil {
+		refunded, refundErr = reservation, &RefundError{Err: err}
+	}
+	if err := s.loyalty.Settle(ctx, []*types.Reservation{refunded}); err != nil {
+		return refunded, errors.Join(err, refundErr)
+	}
+	if err := s.offerSeat(ctx, refunded, now); err != nil {
+		return refunded, errors.Join(err, refundErr)
+	}
+	if refundErr != nil {
+		return refunded, refundErr
+	}
+	return s.store.Reservation.SettleReservation(ctx, db.ReservationFilter{Id: refunded.Id})
+}
+
+// SettlePending settles again the reservations left unsettled by a failure
+// and returns the ones settled now.
+func (s *Settler) SettlePending(ctx context.Context, now time.Time) ([]*types.Reservation, error) {
+	reservations, err := s.store.Reservation.GetReservations(ctx, db.ReservationFilter{Unsettled: true}, &db.Pagination{Limit: "0"})
+	if err != nil {
+		return nil, err
+	}
+	settled := []*types.Reservation{}
+	errs := []error{}
+	for _, reservation := range reservations {
+		updated, err := s.Settle(ctx, reservation, now)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("settling %s: %w", reservation.Id.Hex(), err))
+			continue
+		}
+		settled = append(settled, updated)
+	}
+	return settled, errors.Join(errs...)
+}
+
+// offerSeat offers the seat of reservation, given back to its flight, to the
+// first user waiting for it. The reservations without a seat give none back.
+func (s *Settler) offerSeat(ctx context.Context, reservation *types.Reservation, now time.Time) error {
+	if !reservation.IsAssigned() {
+		return nil
+	}
+	seat, err := s.store.Seat.GetSeat(ctx, db.SeatFilter{Id: reservation.SeatId})
+	if err != nil {
+		return err
+	}
+	_, err = s.waitlist.Offer(ctx, seat, now)
+	return err
+}
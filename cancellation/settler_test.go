@@ -0,0 +1,97 @@
+package cancellation
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fabrizioperria/goflight/db"
+	"github.com/fabrizioperria/goflight/db/memory"
+	"github.com/fabrizioperria/goflight/loyalty"
+	"github.com/fabrizioperria/goflight/payments"
+	"github.com/fabrizioperria/goflight/types"
+	"github.com/fabrizioperria/goflight/waitlist"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// unreachableGateway fails the refunds while down.
+type unreachableGateway struct {
+	*payments.FakeGateway
+	down bool
+}
+
+func (g *unreachableGateway) Refund(ctx context.Context, reference string, amount types.Money) (payments.Result, error) {
+	if g.down {
+		return payments.Result{}, errors.New("gateway unreachable")
+	}
+	return g.FakeGateway.Refund(ctx, reference, amount)
+}
+
+func TestSettle(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	gateway := &unreachableGateway{FakeGateway: payments.NewFakeGateway()}
+	processor := payments.NewProcessor(gateway, store.Reservation, store.Credit)
+	program := loyalty.NewProgram(*store, loyalty.DefaultRules())
+	queue := waitlist.NewQueue(*store, program, waitlist.LogNotifier{}, waitlist.DefaultOfferTTL)
+	settler := NewSettler(*store, processor, program, queue)
+
+	flight, err := store.Flight.CreateFlightWithSeats(ctx,
+		&types.Flight{Airline: "Delta", Departure: "JFK", Arrival: "LAX", DepartureTime: time.Now().Add(24 * time.Hour)},
+		[]*types.Seat{{Class: types.Economy, Available: true, Price: types.MustParseMoney("100", "USD")}})
+	require.NoError(t, err)
+	userId := primitive.NewObjectID()
+	reservation, err := store.Reservation.CreateReservation(ctx, db.SeatFilter{FlightId: flight.Id}, userId, nil, "", nil)
+	require.NoError(t, err)
+	paid, err := processor.Checkout(ctx, []*types.Reservation{reservation}, "")
+	require.NoError(t, err)
+	require.NoError(t, program.Settle(ctx, paid))
+	account, err := program.Account(ctx, userId)
+	require.NoError(t, err)
+	require.Positive(t, account.Points)
+	waiting, err := queue.Join(ctx, flight, types.Economy, primitive.NewObjectID(), time.Now())
+	require.NoError(t, err)
+
+	refund, err := types.NewRefund(paid[0].AmountRefundable(), types.MustParseMoney("0", "USD"), types.RefundFreeWindow, time.Now())
+	require.NoError(t, err)
+	filter := db.ReservationFilter{Id: reservation.Id}
+	cancelled, err := store.Reservation.CancelReservation(ctx, filter, refund, nil)
+	require.NoError(t, err)
+	require.True(t, cancelled.Unsettled)
+
+	// the points and the seat are taken care of even when the refund fails
+	gateway.down = true
+	unsettled, err := settler.Settle(ctx, cancelled, time.Now())
+	var refundErr *RefundError
+	require.ErrorAs(t, err, &refundErr)
+	assert.Equal(t, types.ReservationCancelled, unsettled.Status)
+	account, err = program.Account(ctx, userId)
+	require.NoError(t, err)
+	assert.Zero(t, account.Points)
+	entries, err := queue.Entries(ctx, db.WaitlistFilter{Id: waiting.Id}, &db.Pagination{})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, types.WaitlistOffered, entries[0].Status)
+	pending, err := store.Reservation.GetReservations(ctx, db.ReservationFilter{Unsettled: true}, &db.Pagination{})
+	require.NoError(t, err)
+	assert.Len(t, pending, 1)
+
+	// the refund is retried until it goes through, once
+	_, err = settler.SettlePending(ctx, time.Now())
+	assert.ErrorAs(t, err, &refundErr)
+	gateway.down = false
+	settled, err := settler.SettlePending(ctx, time.Now())
+	require.NoError(t, err)
+	require.Len(t, settled, 1)
+	assert.Equal(t, types.ReservationRefunded, settled[0].Status)
+	assert.False(t, settled[0].Unsettled)
+	settled, err = settler.SettlePending(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Len(t, settled, 0)
+	account, err = program.Account(ctx, userId)
+	require.NoError(t, err)
+	assert.Zero(t, account.Points)
+}
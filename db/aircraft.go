@@ -0,0 +1,104 @@
+package db
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"os"
+
+	"github.com/fabrizioperria/goflight/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type AircraftStorer interface {
+	GetAircraft(ctx context.Context, filter AircraftFilter) (*types.Aircraft, error)
+	// GetAircraftTypes lists the aircraft by code.
+	GetAircraftTypes(ctx context.Context, pagination *Pagination) ([]*types.Aircraft, error)
+	// PutAircraft inserts the aircraft, replacing the ones with the same code.
+	PutAircraft(ctx context.Context, aircraft []*types.Aircraft) error
+	Dropper
+}
+
+const (
+	aircraftCollection = "aircraft"
+)
+
+//go:embed aircraft.json
+var bundledAircraft []byte
+
+// BundledAircraft returns the aircraft types shipped with the service.
+func BundledAircraft() ([]*types.Aircraft, error) {
+	aircraft := []*types.Aircraft{}
+	if err := json.Unmarshal(bundledAircraft, &aircraft); err != nil {
+		return nil, err
+	}
+	for _, a := range aircraft {
+		if err := a.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return aircraft, nil
+}
+
+// LoadBundledAircraft puts the bundled aircraft types in store.
+func LoadBundledAircraft(ctx context.Context, store AircraftStorer) error {
+	aircraft, err := BundledAircraft()
+	if err != nil {
+		return err
+	}
+	return store.PutAircraft(ctx, aircraft)
+}
+
+type MongoDbAircraftStore struct {
+	client     *mongo.Client
+	collection *mongo.Collection
+}
+
+func NewMongoDbAircraftStore(client *mongo.Client) *MongoDbAircraftStore {
+	dbName := os.Getenv("DB_NAME")
+	return &MongoDbAircraftStore{
+		client:     client,
+		collection: client.Database(dbName).Collection(aircraftCollection),
+	}
+}
+
+func (db *MongoDbAircraftStore) GetAircraft(ctx context.Context, filter AircraftFilter) (*types.Aircraft, error) {
+	aircraft := &types.Aircraft{}
+	if err := db.collection.FindOne(ctx, filter.toBson()).Decode(aircraft); err != nil {
+		return nil, err
+	}
+	return aircraft, nil
+}
+
+func (db *MongoDbAircraftStore) GetAircraftTypes(ctx context.Context, pagination *Pagination) ([]*types.Aircraft, error) {
+	opts := pagination.ToFindOptions().SetSort(bson.D{{Key: "_id", Value: 1}})
+	cursor, err := db.collection.Find(ctx, Map{}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*types.Aircraft, 0)
+	err = cursor.All(ctx, &results)
+
+	return results, err
+}
+
+func (db *MongoDbAircraftStore) PutAircraft(ctx context.Context, aircraft []*types.Aircraft) error {
+	if len(aircraft) == 0 {
+		return nil
+	}
+	models := make([]mongo.WriteModel, 0, len(aircraft))
+	for _, a := range aircraft {
+		models = append(models, mongo.NewReplaceOneModel().
+			SetFilter(Map{"_id": a.Code}).
+			SetReplacement(a).
+			SetUpsert(true))
+	}
+	_, err := db.collection.BulkWrite(ctx, models)
+	return err
+}
+
+func (db *MongoDbAircraftStore) Drop(ctx context.Context) error {
+	return db.collection.Drop(ctx)
+}
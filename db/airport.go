@@ -0,0 +1,157 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"fmt"
+	"os"
+
+	"github.com/fabrizioperria/goflight/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type AirportStorer interface {
+	GetAirport(ctx context.Context, filter AirportFilter) (*types.Airport, error)
+	// GetAirports lists the airports matching filter by IATA code, with the
+	// airport whose IATA code is the query first.
+	GetAirports(ctx context.Context, filter AirportFilter, pagination *Pagination) ([]*types.Airport, error)
+	// PutAirports inserts the airports, replacing the ones with the same
+	// IATA code.
+	PutAirports(ctx context.Context, airports []*types.Airport) error
+	Dropper
+}
+
+const (
+	airportCollection = "airports"
+)
+
+//go:embed airports.csv
+var bundledAirports []byte
+
+// BundledAirports returns the airports of the dataset shipped with the
+// service.
+func BundledAirports() ([]*types.Airport, error) {
+	return types.ReadAirportsCSV(bytes.NewReader(bundledAirports))
+}
+
+// LoadBundledAirports puts the bundled airports in store.
+func LoadBundledAirports(ctx context.Context, store AirportStorer) error {
+	airports, err := BundledAirports()
+	if err != nil {
+		return err
+	}
+	return store.PutAirports(ctx, airports)
+}
+
+// ResolveFlightAirports normalizes the airport codes of params and checks
+// that both airports exist. Missing time zones are taken from the airports.
+func ResolveFlightAirports(ctx context.Context, store AirportStorer, params *types.CreateFlightParams) error {
+	params.Departure = types.NormalizeAirportCode(params.Departure)
+	params.Arrival = types.NormalizeAirportCode(params.Arrival)
+
+	departure, err := store.GetAirport(ctx, AirportFilter{IATA: params.Departure})
+	if err != nil {
+		return fmt.Errorf("unknown departure airport %q", params.Departure)
+	}
+	arrival, err := store.GetAirport(ctx, AirportFilter{IATA: params.Arrival})
+	if err != nil {
+		return fmt.Errorf("unknown arrival airport %q", params.Arrival)
+	}
+	if params.Departure == params.Arrival {
+		return fmt.Errorf("departure and arrival airports must differ")
+	}
+
+	if params.DepartureTimeZone == "" {
+		params.DepartureTimeZone = departure.TimeZone
+	}
+	if params.ArrivalTimeZone == "" {
+		params.ArrivalTimeZone = arrival.TimeZone
+	}
+	return nil
+}
+
+// FlightMiles returns the distance between the airports of flight.
+func FlightMiles(ctx context.Context, store AirportStorer, flight *types.Flight) (float64, error) {
+	departure, err := store.GetAirport(ctx, AirportFilter{IATA: flight.Departure})
+	if err != nil {
+		return 0, err
+	}
+	arrival, err := store.GetAirport(ctx, AirportFilter{IATA: flight.Arrival})
+	if err != nil {
+		return 0, err
+	}
+	return departure.MilesTo(*arrival), nil
+}
+
+type MongoDbAirportStore struct {
+	client     *mongo.Client
+	collection *mongo.Collection
+}
+
+func NewMongoDbAirportStore(client *mongo.Client) *MongoDbAirportStore {
+	dbName := os.Getenv("DB_NAME")
+	return &MongoDbAirportStore{
+		client:     client,
+		collection: client.Database(dbName).Collection(airportCollection),
+	}
+}
+
+func (db *MongoDbAirportStore) EnsureIndexes(ctx context.Context) error {
+	_, err := db.collection.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "icao", Value: 1}}})
+	return err
+}
+
+func (db *MongoDbAirportStore) GetAirport(ctx context.Context, filter AirportFilter) (*types.Airport, error) {
+	airport := &types.Airport{}
+	if err := db.collection.FindOne(ctx, filter.toBson()).Decode(airport); err != nil {
+		return nil, err
+	}
+	return airport, nil
+}
+
+func (db *MongoDbAirportStore) GetAirports(ctx context.Context, filter AirportFilter, pagination *Pagination) ([]*types.Airport, error) {
+	exact := Map{"$cond": []any{Map{"$eq": []string{"$_id", types.NormalizeAirportCode(filter.Query)}}, 0, 1}}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter.toBson()}},
+		{{Key: "$addFields", Value: Map{"exact": exact}}},
+		{{Key: "$sort", Value: bson.D{{Key: "exact", Value: 1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$unset", Value: "exact"}},
+		{{Key: "$skip", Value: pagination.GetSkip()}},
+	}
+	if limit := pagination.GetLimit(); limit > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: limit}})
+	}
+
+	cursor, err := db.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*types.Airport, 0)
+	err = cursor.All(ctx, &results)
+
+	return results, err
+}
+
+func (db *MongoDbAirportStore) PutAirports(ctx context.Context, airports []*types.Airport) error {
+	if len(airports) == 0 {
+		return nil
+	}
+	models := make([]mongo.WriteModel, 0, len(airports))
+	for _, airport := range airports {
+		airport := *airport
+		airport.IATA = types.NormalizeAirportCode(airport.IATA)
+		models = append(models, mongo.NewReplaceOneModel().
+			SetFilter(Map{"_id": airport.IATA}).
+			SetReplacement(&airport).
+			SetUpsert(true))
+	}
+	_, err := db.collection.BulkWrite(ctx, models)
+	return err
+}
+
+func (db *MongoDbAirportStore) Drop(ctx context.Context) error {
+	return db.collection.Drop(ctx)
+}
@@ -0,0 +1,103 @@
+package db
+
+import (
+	"context"
+	"os"
+
+	"github.com/fabrizioperria/goflight/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type CreditStorer interface {
+	CreateCredit(ctx context.Context, credit *types.Credit) (*types.Credit, error)
+	GetCredit(ctx context.Context, filter CreditFilter) (*types.Credit, error)
+	GetCredits(ctx context.Context, filter CreditFilter, pagination *Pagination) ([]*types.Credit, error)
+	// RestoreCredit gives the Amount of redemption back to the credit it was
+	// spent from, as types.Credit.Restore does, unless it was already.
+	RestoreCredit(ctx context.Context, redemption *types.CreditRedemption) (*types.Credit, error)
+	Dropper
+}
+
+const (
+	creditCollection = "credits"
+)
+
+type MongoDbCreditStore struct {
+	client     *mongo.Client
+	collection *mongo.Collection
+}
+
+func NewMongoDbCreditStore(client *mongo.Client) *MongoDbCreditStore {
+	dbName := os.Getenv("DB_NAME")
+	return &MongoDbCreditStore{
+		client:     client,
+		collection: client.Database(dbName).Collection(creditCollection),
+	}
+}
+
+func (db *MongoDbCreditStore) EnsureIndexes(ctx context.Context) error {
+	_, err := db.collection.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "user_id", Value: 1}}})
+	return err
+}
+
+func (db *MongoDbCreditStore) CreateCredit(ctx context.Context, credit *types.Credit) (*types.Credit, error) {
+	if credit.Redemptions == nil {
+		credit.Redemptions = []types.CreditRedemption{}
+	}
+	result, err := db.collection.InsertOne(ctx, credit)
+	if err != nil {
+		return nil, err
+	}
+	credit.Id = result.InsertedID.(primitive.ObjectID)
+	return credit, nil
+}
+
+func (db *MongoDbCreditStore) GetCredit(ctx context.Context, filter CreditFilter) (*types.Credit, error) {
+	credit := &types.Credit{}
+	if err := db.collection.FindOne(ctx, filter.toBson()).Decode(credit); err != nil {
+		return nil, err
+	}
+	return credit, nil
+}
+
+func (db *MongoDbCreditStore) GetCredits(ctx context.Context, filter CreditFilter, pagination *Pagination) ([]*types.Credit, error) {
+	cursor, err := db.collection.Find(ctx, filter.toBson(), pagination.ToFindOptions())
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*types.Credit, 0)
+	err = cursor.All(ctx, &results)
+	return results, err
+}
+
+// RestoreCredit reads and updates the credit in one transaction, which
+// concurrent restorations and reservations spending it retry on conflict.
+func (db *MongoDbCreditStore) RestoreCredit(ctx context.Context, redemption *types.CreditRedemption) (*types.Credit, error) {
+	callback := func(sessionContext mongo.SessionContext) (interface{}, error) {
+		credit, err := db.GetCredit(sessionContext, CreditFilter{Id: redemption.CreditId})
+		if err != nil {
+			return nil, err
+		}
+		restored, err := credit.Restore(redemption.ReservationId, redemption.Amount)
+		if err != nil || !restored {
+			return credit, err
+		}
+		update := Map{"$set": Map{"balance": credit.Balance, "redemptions": credit.Redemptions}}
+		if _, err := db.collection.UpdateOne(sessionContext, Map{"_id": credit.Id}, update); err != nil {
+			return nil, err
+		}
+		return credit, nil
+	}
+
+	credit, err := withSnapshotTxn(ctx, db.client, callback)
+	if err != nil {
+		return nil, err
+	}
+	return credit.(*types.Credit), nil
+}
+
+func (db *MongoDbCreditStore) Drop(ctx context.Context) error {
+	return db.collection.Drop(ctx)
+}
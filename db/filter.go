@@ -0,0 +1,305 @@
+package db
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/fabrizioperria/goflight/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Filters select documents by value. Zero-valued fields are ignored, so the
+// zero filter matches everything.
+
+type UserFilter struct {
+	Id    primitive.ObjectID
+	Email string
+}
+
+type TimeRange struct {
+	From time.Time
+	To   time.Time
+}
+
+func (r TimeRange) IsZero() bool {
+	return r.From.IsZero() && r.To.IsZero()
+}
+
+func (r TimeRange) Contains(t time.Time) bool {
+	if !r.From.IsZero() && t.Before(r.From) {
+		return false
+	}
+	if !r.To.IsZero() && t.After(r.To) {
+		return false
+	}
+	return true
+}
+
+type FlightFilter struct {
+	Id                primitive.ObjectID
+	Departure         string
+	Arrival           string
+	Airline           string
+	DepartureBetween  TimeRange
+	MinAvailableSeats int
+}
+
+type SeatFilter struct {
+	Id       primitive.ObjectID
+	FlightId primitive.ObjectID
+	// FlightIds matches the seats of any of these flights.
+	FlightIds []primitive.ObjectID
+	// Available matches the seats for which types.Seat.IsAvailable holds.
+	Available *bool
+	Class     types.SeatClass
+}
+
+type ReservationFilter struct {
+	Id        primitive.ObjectID
+	Locator   string
+	UserId    primitive.ObjectID
+	SeatId    primitive.ObjectID
+	FlightId  primitive.ObjectID
+	BookingId primitive.ObjectID
+	// PaymentReference matches the reservations paid for by the payment with
+	// this reference at the provider.
+	PaymentReference string
+	// PaymentExpiredBy matches the reservations whose payment is still
+	// awaited past its expiry at this time.
+	PaymentExpiredBy time.Time
+	// Unsettled matches the reservations ended but not settled yet.
+	Unsettled bool
+}
+
+type CreditFilter struct {
+	Id     primitive.ObjectID
+	UserId primitive.ObjectID
+}
+
+// PromotionFilter matches Code case-insensitively.
+type PromotionFilter struct {
+	Id   primitive.ObjectID
+	Code string
+}
+
+// WaitlistFilter matches SeatId against the seat offered to the entries.
+type WaitlistFilter struct {
+	Id       primitive.ObjectID
+	FlightId primitive.ObjectID
+	Class    types.SeatClass
+	UserId   primitive.ObjectID
+	Status   types.WaitlistStatus
+	SeatId   primitive.ObjectID
+}
+
+type AirportFilter struct {
+	IATA string
+	// Query matches the airports with a code, name or city word starting
+	// with it, case-insensitively.
+	Query string
+}
+
+// QueryPattern is the regular expression, to be matched case-insensitively,
+// that selects the airports for Query.
+func (f AirportFilter) QueryPattern() string {
+	return `\b` + regexp.QuoteMeta(strings.TrimSpace(f.Query))
+}
+
+type AircraftFilter struct {
+	Code string
+}
+
+type BookingFilter struct {
+	Id      primitive.ObjectID
+	Locator string
+	UserId  primitive.ObjectID
+}
+
+func (f UserFilter) toBson() Map {
+	filter := Map{}
+	if !f.Id.IsZero() {
+		filter["_id"] = f.Id
+	}
+	if f.Email != "" {
+		filter["email"] = f.Email
+	}
+	return filter
+}
+
+func (f FlightFilter) toBson() Map {
+	filter := Map{}
+	if !f.Id.IsZero() {
+		filter["_id"] = f.Id
+	}
+	if f.Departure != "" {
+		filter["departure"] = f.Departure
+	}
+	if f.Arrival != "" {
+		filter["arrival"] = f.Arrival
+	}
+	if f.Airline != "" {
+		filter["airline"] = f.Airline
+	}
+	if !f.DepartureBetween.IsZero() {
+		between := Map{}
+		if !f.DepartureBetween.From.IsZero() {
+			between["$gte"] = f.DepartureBetween.From
+		}
+		if !f.DepartureBetween.To.IsZero() {
+			between["$lte"] = f.DepartureBetween.To
+		}
+		filter["departure_time"] = between
+	}
+	if f.MinAvailableSeats > 0 {
+		// seats only holds the ids of the seats that are still available
+		filter[fmt.Sprintf("seats.%d", f.MinAvailableSeats-1)] = Map{"$exists": true}
+	}
+	return filter
+}
+
+func (f SeatFilter) toBson() Map {
+	filter := Map{}
+	if !f.Id.IsZero() {
+		filter["_id"] = f.Id
+	}
+	if !f.FlightId.IsZero() {
+		filter["flight_id"] = f.FlightId
+	}
+	if f.FlightIds != nil {
+		filter["flight_id"] = Map{"$in": f.FlightIds}
+	}
+	if f.Available != nil {
+		// a seat whose hold expired is available even before the sweeper
+		// releases it
+		expiredHold := Map{"held_until": Map{"$lte": time.Now()}}
+		if *f.Available {
+			filter["$or"] = []Map{{"available": true}, expiredHold}
+		} else {
+			filter["available"] = false
+			filter["$nor"] = []Map{expiredHold}
+		}
+	}
+	if f.Class != 0 {
+		filter["class"] = f.Class
+	}
+	return filter
+}
+
+func (f ReservationFilter) toBson() Map {
+	filter := Map{}
+	if !f.Id.IsZero() {
+		filter["_id"] = f.Id
+	}
+	if f.Locator != "" {
+		filter["locator"] = f.Locator
+	}
+	if !f.UserId.IsZero() {
+		filter["user_id"] = f.UserId
+	}
+	if !f.SeatId.IsZero() {
+		filter["seat_id"] = f.SeatId
+	}
+	if !f.FlightId.IsZero() {
+		filter["flight_id"] = f.FlightId
+	}
+	if !f.BookingId.IsZero() {
+		filter["booking_id"] = f.BookingId
+	}
+	if f.PaymentReference != "" {
+		filter["payment.reference"] = f.PaymentReference
+	}
+	if !f.PaymentExpiredBy.IsZero() {
+		filter["payment.status"] = Map{"$in": []types.PaymentStatus{types.PaymentPending, types.PaymentAuthorized}}
+		filter["payment.expires_at"] = Map{"$lte": f.PaymentExpiredBy}
+	}
+	if f.Unsettled {
+		filter["unsettled"] = true
+	}
+	return filter
+}
+
+func (f BookingFilter) toBson() Map {
+	filter := Map{}
+	if !f.Id.IsZero() {
+		filter["_id"] = f.Id
+	}
+	if f.Locator != "" {
+		filter["locator"] = f.Locator
+	}
+	if !f.UserId.IsZero() {
+		filter["user_id"] = f.UserId
+	}
+	return filter
+}
+
+func (f CreditFilter) toBson() Map {
+	filter := Map{}
+	if !f.Id.IsZero() {
+		filter["_id"] = f.Id
+	}
+	if !f.UserId.IsZero() {
+		filter["user_id"] = f.UserId
+	}
+	return filter
+}
+
+func (f PromotionFilter) toBson() Map {
+	filter := Map{}
+	if !f.Id.IsZero() {
+		filter["_id"] = f.Id
+	}
+	if f.Code != "" {
+		filter["code"] = types.NormalizePromoCode(f.Code)
+	}
+	return filter
+}
+
+func (f WaitlistFilter) toBson() Map {
+	filter := Map{}
+	if !f.Id.IsZero() {
+		filter["_id"] = f.Id
+	}
+	if !f.FlightId.IsZero() {
+		filter["flight_id"] = f.FlightId
+	}
+	if f.Class != 0 {
+		filter["class"] = f.Class
+	}
+	if !f.UserId.IsZero() {
+		filter["user_id"] = f.UserId
+	}
+	if f.Status != "" {
+		filter["status"] = f.Status
+	}
+	if !f.SeatId.IsZero() {
+		filter["offer.seat_id"] = f.SeatId
+	}
+	return filter
+}
+
+func (f AirportFilter) toBson() Map {
+	filter := Map{}
+	if f.IATA != "" {
+		filter["_id"] = f.IATA
+	}
+	if f.Query != "" {
+		query := primitive.Regex{Pattern: f.QueryPattern(), Options: "i"}
+		filter["$or"] = []Map{
+			{"_id": query},
+			{"icao": query},
+			{"name": query},
+			{"city": query},
+		}
+	}
+	return filter
+}
+
+func (f AircraftFilter) toBson() Map {
+	filter := Map{}
+	if f.Code != "" {
+		filter["_id"] = f.Code
+	}
+	return filter
+}
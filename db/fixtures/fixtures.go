@@ -54,6 +54,9 @@ func AddFlight(store *db.Store, airline, departure, arrival, departureTime, arri
 		ArrivalTime:   arrivalTime,
 		NumberOfSeats: numSeats,
 	}
+	if err := db.ResolveFlightAirports(context.Background(), store.Airport, &flightParams); err != nil {
+		return nil, err
+	}
 	flight, err := types.NewFlightFromParams(flightParams)
 	if err != nil {
 		return nil, err
@@ -62,11 +65,8 @@ func AddFlight(store *db.Store, airline, departure, arrival, departureTime, arri
 }
 
 func AddSeat(store *db.Store, price money.Amount, number int, class types.SeatClass, location types.SeatLocation, available bool, flightId primitive.ObjectID) (*types.Seat, error) {
-	price = price.Round(2)
-	priceFloat, _ := price.Float64()
-
 	seat := types.Seat{
-		Price:     priceFloat,
+		Price:     types.MoneyFromAmount(price.RoundToCurr()),
 		Number:    number,
 		Class:     class,
 		Location:  location,
@@ -77,7 +77,7 @@ func AddSeat(store *db.Store, price money.Amount, number int, class types.SeatCl
 }
 
 func AddSeatsToFlight(store *db.Store, flightId primitive.ObjectID, seats []primitive.ObjectID) error {
-	filter := db.Map{"_id": flightId}
+	filter := db.FlightFilter{Id: flightId}
 	flight, err := store.Flight.GetFlight(context.Background(), filter)
 	if err != nil {
 		return err
@@ -92,6 +92,12 @@ func AddSeatsToFlight(store *db.Store, flightId primitive.ObjectID, seats []prim
 	return err
 }
 
+// AddReservation reserves the seat for the user and confirms it as if it was
+// paid for.
 func AddReservation(store *db.Store, seatId primitive.ObjectID, userId primitive.ObjectID) (*types.Reservation, error) {
-	return store.Reservation.CreateReservation(context.Background(), db.Map{"_id": seatId}, userId)
+	reservation, err := store.Reservation.CreateReservation(context.Background(), db.SeatFilter{Id: seatId}, userId, nil, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	return store.Reservation.UpdateReservationStatus(context.Background(), db.ReservationFilter{Id: reservation.Id}, types.ReservationConfirmed)
 }
@@ -6,18 +6,42 @@ import (
 	"os"
 
 	"github.com/fabrizioperria/goflight/types"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type FlightStorer interface {
 	CreateFlight(ctx context.Context, flight *types.Flight) (*types.Flight, error)
-	GetFlight(ctx context.Context, filter Map) (*types.Flight, error)
-	GetFlights(ctx context.Context, pagination *Pagination) ([]*types.Flight, error)
-	UpdateFlight(ctx context.Context, filter Map, values types.UpdateFlightParams) (string, error)
+	// CreateFlightWithSeats creates the flight along with its seats, all or
+	// nothing. The seats are assigned to the flight and listed in its seats.
+	CreateFlightWithSeats(ctx context.Context, flight *types.Flight, seats []*types.Seat) (*types.Flight, error)
+	GetFlight(ctx context.Context, filter FlightFilter) (*types.Flight, error)
+	GetFlights(ctx context.Context, filter FlightFilter, sort FlightSort, pagination *Pagination) ([]*types.Flight, error)
+	UpdateFlight(ctx context.Context, filter FlightFilter, values types.UpdateFlightParams) (string, error)
 	Dropper
 }
 
+// FlightSort orders the flights found. SortByLowestPrice only compares the
+// prices in the same currency: the flights are sorted by the currency of
+// their lowest price, then by the price.
+type FlightSort string
+
+const (
+	SortByNone          FlightSort = ""
+	SortByDepartureTime FlightSort = "departure"
+	SortByDuration      FlightSort = "duration"
+	SortByLowestPrice   FlightSort = "price"
+)
+
+func (sort FlightSort) IsValid() bool {
+	switch sort {
+	case SortByNone, SortByDepartureTime, SortByDuration, SortByLowestPrice:
+		return true
+	}
+	return false
+}
+
 const (
 	flightCollection = "flights"
 )
@@ -35,18 +59,61 @@ func NewMongoDbFlightStore(client *mongo.Client) *MongoDbFlightStore {
 	}
 }
 
-func (db *MongoDbFlightStore) GetFlight(ctx context.Context, filter Map) (*types.Flight, error) {
+func (db *MongoDbFlightStore) GetFlight(ctx context.Context, filter FlightFilter) (*types.Flight, error) {
 	var flight types.Flight
-	err := db.collection.FindOne(ctx, filter).Decode(&flight)
+	err := db.collection.FindOne(ctx, filter.toBson()).Decode(&flight)
 	if err != nil {
 		return nil, err
 	}
 	return &flight, nil
 }
 
-func (db *MongoDbFlightStore) GetFlights(ctx context.Context, pagination *Pagination) ([]*types.Flight, error) {
-	var cursor *mongo.Cursor
-	cursor, err := db.collection.Find(ctx, Map{}, pagination.ToFindOptions())
+func (db *MongoDbFlightStore) EnsureIndexes(ctx context.Context) error {
+	_, err := db.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "departure", Value: 1}, {Key: "arrival", Value: 1}, {Key: "departure_time", Value: 1}}},
+		{Keys: bson.D{{Key: "airline", Value: 1}, {Key: "departure_time", Value: 1}}},
+		{Keys: bson.D{{Key: "departure_time", Value: 1}}},
+	})
+	return err
+}
+
+func (db *MongoDbFlightStore) GetFlights(ctx context.Context, filter FlightFilter, sort FlightSort, pagination *Pagination) ([]*types.Flight, error) {
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: filter.toBson()}}}
+	switch sort {
+	case SortByDepartureTime:
+		pipeline = append(pipeline, bson.D{{Key: "$sort", Value: bson.D{{Key: "departure_time", Value: 1}, {Key: "_id", Value: 1}}}})
+	case SortByDuration:
+		duration := Map{"$subtract": []string{"$arrival_time", "$departure_time"}}
+		pipeline = append(pipeline,
+			bson.D{{Key: "$addFields", Value: Map{"duration": duration}}},
+			bson.D{{Key: "$sort", Value: bson.D{{Key: "duration", Value: 1}, {Key: "_id", Value: 1}}}},
+			bson.D{{Key: "$unset", Value: "duration"}},
+		)
+	case SortByLowestPrice:
+		// the prices are compared as {currency, amount} documents, so that
+		// the amounts in different currencies are never compared with each
+		// other, and flights without available seats have no price and go
+		// last
+		prices := Map{"$map": Map{
+			"input": Map{"$filter": Map{"input": "$available_seats", "as": "seat", "cond": Map{"$ne": []any{"$$seat.price", nil}}}},
+			"as":    "seat",
+			"in":    bson.D{{Key: "currency", Value: "$$seat.price.currency"}, {Key: "amount", Value: "$$seat.price.amount"}},
+		}}
+		unpriced := Map{"$cond": []any{Map{"$ifNull": []any{"$lowest_price", false}}, 0, 1}}
+		pipeline = append(pipeline,
+			bson.D{{Key: "$lookup", Value: Map{"from": seatCollection, "localField": "seats", "foreignField": "_id", "as": "available_seats"}}},
+			bson.D{{Key: "$addFields", Value: Map{"lowest_price": Map{"$min": prices}}}},
+			bson.D{{Key: "$addFields", Value: Map{"unpriced": unpriced}}},
+			bson.D{{Key: "$sort", Value: bson.D{{Key: "unpriced", Value: 1}, {Key: "lowest_price", Value: 1}, {Key: "_id", Value: 1}}}},
+			bson.D{{Key: "$unset", Value: []string{"available_seats", "lowest_price", "unpriced"}}},
+		)
+	}
+	pipeline = append(pipeline, bson.D{{Key: "$skip", Value: pagination.GetSkip()}})
+	if limit := pagination.GetLimit(); limit > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: limit}})
+	}
+
+	cursor, err := db.collection.Aggregate(ctx, pipeline)
 	if err != nil {
 		return nil, err
 	}
@@ -59,28 +126,62 @@ func (db *MongoDbFlightStore) GetFlights(ctx context.Context, pagination *Pagina
 
 func (db *MongoDbFlightStore) CreateFlight(ctx context.Context, flight *types.Flight) (*types.Flight, error) {
 	result, err := db.collection.InsertOne(ctx, flight)
+	if err != nil {
+		return nil, err
+	}
 	flight.Id = result.InsertedID.(primitive.ObjectID)
-	return flight, err
+	return flight, nil
+}
+
+func (db *MongoDbFlightStore) CreateFlightWithSeats(ctx context.Context, flight *types.Flight, seats []*types.Seat) (*types.Flight, error) {
+	// the ids are chosen upfront so that the flight is written once, already
+	// listing its seats
+	if flight.Id.IsZero() {
+		flight.Id = primitive.NewObjectID()
+	}
+	flight.Seats = make([]primitive.ObjectID, 0, len(seats))
+	for _, seat := range seats {
+		if seat.Id.IsZero() {
+			seat.Id = primitive.NewObjectID()
+		}
+		seat.FlightId = flight.Id
+		flight.Seats = append(flight.Seats, seat.Id)
+	}
+
+	callback := func(sessionContext mongo.SessionContext) (interface{}, error) {
+		if _, err := db.collection.InsertOne(sessionContext, flight); err != nil {
+			return nil, err
+		}
+		return nil, insertSeats(sessionContext, db.collection.Database().Collection(seatCollection), seats)
+	}
+
+	if _, err := withSnapshotTxn(ctx, db.client, callback); err != nil {
+		return nil, err
+	}
+	return flight, nil
 }
 
 func (db *MongoDbFlightStore) Drop(ctx context.Context) error {
 	return db.collection.Drop(ctx)
 }
 
-func (db *MongoDbFlightStore) UpdateFlight(ctx context.Context, filter Map, values types.UpdateFlightParams) (string, error) {
+func (db *MongoDbFlightStore) UpdateFlight(ctx context.Context, filter FlightFilter, values types.UpdateFlightParams) (string, error) {
 	thinValues := Map{}
-	if values.ArrivalTime != "" {
+	if !values.ArrivalTime.IsZero() {
 		thinValues["arrival_time"] = values.ArrivalTime
 	}
-	if values.DepartureTime != "" {
+	if !values.DepartureTime.IsZero() {
 		thinValues["departure_time"] = values.DepartureTime
 	}
 	if len(values.Seats) > 0 {
 		thinValues["seats"] = values.Seats
 	}
+	if values.Overbooking != nil {
+		thinValues["overbooking"] = *values.Overbooking
+	}
 	update := Map{"$set": thinValues}
-	result, err := db.collection.UpdateOne(ctx, filter, update)
-	if err != nil || result.ModifiedCount == 0 {
+	result, err := db.collection.UpdateOne(ctx, filter.toBson(), update)
+	if err != nil || result.MatchedCount == 0 {
 		return "", fmt.Errorf("flight not found")
 	}
 	return "", nil
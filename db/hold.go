@@ -0,0 +1,131 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/fabrizioperria/goflight/types"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// A hold takes a seat out of its flight's available seats, like a
+// reservation, until it is confirmed or it expires. Expired holds keep the
+// seat unavailable in storage until ReleaseExpiredHolds runs, but
+// SeatFilter.Available and reserveSeat already treat those seats as free.
+
+func (db *MongoDbReservationStore) clearHold(ctx context.Context, seatId primitive.ObjectID) error {
+	_, err := db.seatStore.collection.UpdateOne(ctx, Map{"_id": seatId}, Map{"$unset": Map{"held_by": "", "held_until": ""}})
+	return err
+}
+
+func (db *MongoDbReservationStore) HoldSeat(ctx context.Context, filter SeatFilter, userId primitive.ObjectID, until time.Time) (*types.Seat, error) {
+	callback := func(sessionContext mongo.SessionContext) (interface{}, error) {
+		seat, err := db.seatStore.GetSeat(sessionContext, filter)
+		if err != nil {
+			return nil, err
+		}
+
+		now := time.Now()
+		if !seat.IsAvailable(now) && !seat.IsHeldBy(userId, now) {
+			return nil, fmt.Errorf("seat not available")
+		}
+
+		update := Map{"$set": Map{"available": false, "held_by": userId, "held_until": until}}
+		if _, err = db.seatStore.collection.UpdateOne(sessionContext, Map{"_id": seat.Id}, update); err != nil {
+			return nil, err
+		}
+
+		flightFilter := FlightFilter{Id: seat.FlightId}
+		_, err = db.flightStore.collection.UpdateOne(sessionContext, flightFilter.toBson(), Map{"$pull": Map{"seats": seat.Id}})
+		if err != nil {
+			return nil, err
+		}
+		return seat.Id, nil
+	}
+
+	seatId, err := withSnapshotTxn(ctx, db.client, callback)
+	if err != nil {
+		return nil, err
+	}
+	return db.seatStore.GetSeat(ctx, SeatFilter{Id: seatId.(primitive.ObjectID)})
+}
+
+func (db *MongoDbReservationStore) ConfirmHold(ctx context.Context, filter SeatFilter, userId primitive.ObjectID, passenger *types.Passenger, spending *Spending) (*types.Reservation, error) {
+	callback := func(sessionContext mongo.SessionContext) (interface{}, error) {
+		seat, err := db.seatStore.GetSeat(sessionContext, filter)
+		if err != nil {
+			return nil, err
+		}
+		if !seat.IsHeldBy(userId, time.Now()) {
+			return nil, fmt.Errorf("no active hold on seat")
+		}
+
+		reservation, err := db.reserveSeat(sessionContext, SeatFilter{Id: seat.Id}, userId, primitive.NilObjectID, passenger)
+		if err != nil {
+			return nil, err
+		}
+		if spending != nil {
+			if err = db.spend(sessionContext, reservation, spending); err != nil {
+				return nil, err
+			}
+		}
+		return reservation.Id, nil
+	}
+
+	reservationId, err := withSnapshotTxn(ctx, db.client, callback)
+	if err != nil {
+		return nil, err
+	}
+	return db.GetReservation(ctx, ReservationFilter{Id: reservationId.(primitive.ObjectID)})
+}
+
+// ReleaseExpiredHolds gives the seats whose hold expired by now back to their
+// flights and returns how many were released.
+func (db *MongoDbReservationStore) ReleaseExpiredHolds(ctx context.Context, now time.Time) (int, error) {
+	expired := Map{"held_until": Map{"$lte": now}}
+	var seats []*types.Seat
+	cursor, err := db.seatStore.collection.Find(ctx, expired)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+	if err = cursor.All(ctx, &seats); err != nil {
+		return 0, err
+	}
+
+	released := 0
+	for _, seat := range seats {
+		callback := func(sessionContext mongo.SessionContext) (interface{}, error) {
+			// the hold may have been confirmed or renewed since the seats
+			// were listed
+			filter := Map{"_id": seat.Id, "held_until": Map{"$lte": now}}
+			update := Map{"$set": Map{"available": true}, "$unset": Map{"held_by": "", "held_until": ""}}
+			result, err := db.seatStore.collection.UpdateOne(sessionContext, filter, update)
+			if err != nil {
+				return false, err
+			}
+			if result.ModifiedCount == 0 {
+				return false, nil
+			}
+
+			flightFilter := FlightFilter{Id: seat.FlightId}
+			_, err = db.flightStore.collection.UpdateOne(sessionContext, flightFilter.toBson(), Map{"$push": Map{"seats": seat.Id}})
+			if err != nil {
+				return false, err
+			}
+			return true, nil
+		}
+
+		ok, err := withSnapshotTxn(ctx, db.client, callback)
+		if err != nil {
+			return released, err
+		}
+		if ok.(bool) {
+			released++
+		}
+	}
+	return released, nil
+}
@@ -0,0 +1,119 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/fabrizioperria/goflight/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type LoyaltyStorer interface {
+	// GetLoyaltyAccount returns the loyalty account of the user with userId,
+	// a new one when they have none yet.
+	GetLoyaltyAccount(ctx context.Context, userId primitive.ObjectID) (*types.LoyaltyAccount, error)
+	// UpdateLoyaltyAccount calls update on the loyalty account of the user
+	// with userId and stores what it changed, unless it reports no change.
+	// Concurrent updates of an account are applied one after the other, so
+	// update may be called more than once. It gives up with
+	// ErrLoyaltyContention when the account keeps changing under it.
+	UpdateLoyaltyAccount(ctx context.Context, userId primitive.ObjectID, update func(account *types.LoyaltyAccount) (bool, error)) (*types.LoyaltyAccount, error)
+	Dropper
+}
+
+const (
+	loyaltyCollection = "loyalty"
+	// maxLoyaltyUpdateAttempts is how many times an update of an account is
+	// tried while other updates keep getting in first.
+	maxLoyaltyUpdateAttempts = 20
+)
+
+var ErrLoyaltyContention = errors.New("loyalty account updated concurrently, try again")
+
+type MongoDbLoyaltyStore struct {
+	client     *mongo.Client
+	collection *mongo.Collection
+}
+
+func NewMongoDbLoyaltyStore(client *mongo.Client) *MongoDbLoyaltyStore {
+	dbName := os.Getenv("DB_NAME")
+	return &MongoDbLoyaltyStore{
+		client:     client,
+		collection: client.Database(dbName).Collection(loyaltyCollection),
+	}
+}
+
+func (db *MongoDbLoyaltyStore) EnsureIndexes(ctx context.Context) error {
+	_, err := db.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+func (db *MongoDbLoyaltyStore) GetLoyaltyAccount(ctx context.Context, userId primitive.ObjectID) (*types.LoyaltyAccount, error) {
+	account := &types.LoyaltyAccount{}
+	err := db.collection.FindOne(ctx, Map{"user_id": userId}).Decode(account)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return types.NewLoyaltyAccount(userId, time.Now()), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// UpdateLoyaltyAccount only appends to the activity of the account while it
+// has as many entries as it was read with, and tries again otherwise, so
+// that the points and the activity stay in step without a transaction.
+func (db *MongoDbLoyaltyStore) UpdateLoyaltyAccount(ctx context.Context, userId primitive.ObjectID, update func(account *types.LoyaltyAccount) (bool, error)) (*types.LoyaltyAccount, error) {
+	for attempt := 0; attempt < maxLoyaltyUpdateAttempts; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		account, err := db.GetLoyaltyAccount(ctx, userId)
+		if err != nil {
+			return nil, err
+		}
+		read := len(account.Activity)
+		changed, err := update(account)
+		if err != nil {
+			return nil, err
+		}
+		if !changed {
+			return account, nil
+		}
+
+		if account.Id.IsZero() {
+			result, err := db.collection.InsertOne(ctx, account)
+			if mongo.IsDuplicateKeyError(err) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			account.Id = result.InsertedID.(primitive.ObjectID)
+			return account, nil
+		}
+		result, err := db.collection.UpdateOne(ctx, Map{"_id": account.Id, "activity": Map{"$size": read}}, Map{
+			"$set":  Map{"points": account.Points, "qualifying_points": account.QualifyingPoints},
+			"$push": Map{"activity": Map{"$each": account.Activity[read:]}},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if result.MatchedCount == 1 {
+			return account, nil
+		}
+	}
+	return nil, ErrLoyaltyContention
+}
+
+func (db *MongoDbLoyaltyStore) Drop(ctx context.Context) error {
+	return db.collection.Drop(ctx)
+}
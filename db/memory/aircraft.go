@@ -0,0 +1,79 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/fabrizioperria/goflight/db"
+	"github.com/fabrizioperria/goflight/types"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type AircraftStore struct {
+	mu       sync.RWMutex
+	aircraft []*types.Aircraft
+}
+
+func NewAircraftStore() *AircraftStore {
+	return &AircraftStore{
+		aircraft: []*types.Aircraft{},
+	}
+}
+
+func copyAircraft(aircraft *types.Aircraft) *types.Aircraft {
+	copied := *aircraft
+	copied.Zones = slices.Clone(aircraft.Zones)
+	copied.ExitRows = slices.Clone(aircraft.ExitRows)
+	copied.BlockedSeats = slices.Clone(aircraft.BlockedSeats)
+	return &copied
+}
+
+func (s *AircraftStore) GetAircraft(ctx context.Context, filter db.AircraftFilter) (*types.Aircraft, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, aircraft := range s.aircraft {
+		if filter.Code == "" || aircraft.Code == filter.Code {
+			return copyAircraft(aircraft), nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (s *AircraftStore) GetAircraftTypes(ctx context.Context, pagination *db.Pagination) ([]*types.Aircraft, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	results := make([]*types.Aircraft, 0)
+	for _, aircraft := range paginate(s.aircraft, pagination) {
+		results = append(results, copyAircraft(aircraft))
+	}
+	return results, nil
+}
+
+func (s *AircraftStore) PutAircraft(ctx context.Context, aircraft []*types.Aircraft) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, a := range aircraft {
+		i, found := slices.BinarySearchFunc(s.aircraft, a.Code, func(a *types.Aircraft, code string) int {
+			return strings.Compare(a.Code, code)
+		})
+		if found {
+			s.aircraft[i] = copyAircraft(a)
+		} else {
+			s.aircraft = slices.Insert(s.aircraft, i, copyAircraft(a))
+		}
+	}
+	return nil
+}
+
+func (s *AircraftStore) Drop(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.aircraft = []*types.Aircraft{}
+	return nil
+}
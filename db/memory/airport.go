@@ -0,0 +1,107 @@
+package memory
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/fabrizioperria/goflight/db"
+	"github.com/fabrizioperria/goflight/types"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type AirportStore struct {
+	mu       sync.RWMutex
+	airports []*types.Airport
+}
+
+func NewAirportStore() *AirportStore {
+	return &AirportStore{
+		airports: []*types.Airport{},
+	}
+}
+
+// matching returns the airports matching filter, sorted by IATA code.
+func (s *AirportStore) matching(filter db.AirportFilter) []*types.Airport {
+	var query *regexp.Regexp
+	if filter.Query != "" {
+		query = regexp.MustCompile("(?i)" + filter.QueryPattern())
+	}
+	results := []*types.Airport{}
+	for _, airport := range s.airports {
+		if filter.IATA != "" && airport.IATA != filter.IATA {
+			continue
+		}
+		if query != nil && !query.MatchString(airport.IATA) && !query.MatchString(airport.ICAO) &&
+			!query.MatchString(airport.Name) && !query.MatchString(airport.City) {
+			continue
+		}
+		results = append(results, airport)
+	}
+	return results
+}
+
+func (s *AirportStore) GetAirport(ctx context.Context, filter db.AirportFilter) (*types.Airport, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	matching := s.matching(filter)
+	if len(matching) == 0 {
+		return nil, mongo.ErrNoDocuments
+	}
+	airport := *matching[0]
+	return &airport, nil
+}
+
+func (s *AirportStore) GetAirports(ctx context.Context, filter db.AirportFilter, pagination *db.Pagination) ([]*types.Airport, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	code := types.NormalizeAirportCode(filter.Query)
+	matching := s.matching(filter)
+	slices.SortStableFunc(matching, func(a, b *types.Airport) int {
+		if (a.IATA == code) != (b.IATA == code) {
+			if a.IATA == code {
+				return -1
+			}
+			return 1
+		}
+		return 0
+	})
+
+	results := make([]*types.Airport, 0)
+	for _, airport := range paginate(matching, pagination) {
+		airport := *airport
+		results = append(results, &airport)
+	}
+	return results, nil
+}
+
+func (s *AirportStore) PutAirports(ctx context.Context, airports []*types.Airport) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, airport := range airports {
+		airport := *airport
+		airport.IATA = types.NormalizeAirportCode(airport.IATA)
+		i, found := slices.BinarySearchFunc(s.airports, airport.IATA, func(a *types.Airport, code string) int {
+			return strings.Compare(a.IATA, code)
+		})
+		if found {
+			s.airports[i] = &airport
+		} else {
+			s.airports = slices.Insert(s.airports, i, &airport)
+		}
+	}
+	return nil
+}
+
+func (s *AirportStore) Drop(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.airports = []*types.Airport{}
+	return nil
+}
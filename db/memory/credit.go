@@ -0,0 +1,132 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/fabrizioperria/goflight/db"
+	"github.com/fabrizioperria/goflight/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type CreditStore struct {
+	mu      sync.RWMutex
+	credits []*types.Credit
+}
+
+func NewCreditStore() *CreditStore {
+	return &CreditStore{
+		credits: []*types.Credit{},
+	}
+}
+
+func copyCredit(credit *types.Credit) *types.Credit {
+	copied := *credit
+	copied.Redemptions = slices.Clone(credit.Redemptions)
+	if copied.Redemptions == nil {
+		copied.Redemptions = []types.CreditRedemption{}
+	}
+	return &copied
+}
+
+func (s *CreditStore) find(filter db.CreditFilter) (int, error) {
+	for i, credit := range s.credits {
+		if matchCredit(filter, credit) {
+			return i, nil
+		}
+	}
+	return -1, mongo.ErrNoDocuments
+}
+
+func (s *CreditStore) CreateCredit(ctx context.Context, credit *types.Credit) (*types.Credit, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkNew(credit); err != nil {
+		return nil, err
+	}
+	s.insert(credit)
+	return credit, nil
+}
+
+// checkNew fails when credit has the id of a credit already issued.
+func (s *CreditStore) checkNew(credit *types.Credit) error {
+	if credit.Id.IsZero() {
+		return nil
+	}
+	if _, err := s.find(db.CreditFilter{Id: credit.Id}); err == nil {
+		return fmt.Errorf("duplicate key: %s", credit.Id.Hex())
+	}
+	return nil
+}
+
+// insert issues credit, which checkNew accepted.
+func (s *CreditStore) insert(credit *types.Credit) {
+	if credit.Id.IsZero() {
+		credit.Id = primitive.NewObjectID()
+	}
+	if credit.Redemptions == nil {
+		credit.Redemptions = []types.CreditRedemption{}
+	}
+	s.credits = append(s.credits, copyCredit(credit))
+}
+
+// replace stores credit in place of the credit with its id.
+func (s *CreditStore) replace(credit *types.Credit) {
+	if i, err := s.find(db.CreditFilter{Id: credit.Id}); err == nil {
+		s.credits[i] = copyCredit(credit)
+	}
+}
+
+func (s *CreditStore) GetCredit(ctx context.Context, filter db.CreditFilter) (*types.Credit, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	i, err := s.find(filter)
+	if err != nil {
+		return nil, err
+	}
+	return copyCredit(s.credits[i]), nil
+}
+
+func (s *CreditStore) GetCredits(ctx context.Context, filter db.CreditFilter, pagination *db.Pagination) ([]*types.Credit, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	matching := []*types.Credit{}
+	for _, credit := range s.credits {
+		if matchCredit(filter, credit) {
+			matching = append(matching, credit)
+		}
+	}
+	results := make([]*types.Credit, 0)
+	for _, credit := range paginate(matching, pagination) {
+		results = append(results, copyCredit(credit))
+	}
+	return results, nil
+}
+
+func (s *CreditStore) RestoreCredit(ctx context.Context, redemption *types.CreditRedemption) (*types.Credit, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, err := s.find(db.CreditFilter{Id: redemption.CreditId})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.credits[i].Restore(redemption.ReservationId, redemption.Amount); err != nil {
+		return nil, err
+	}
+	return copyCredit(s.credits[i]), nil
+}
+
+func (s *CreditStore) Drop(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.credits = []*types.Credit{}
+	return nil
+}
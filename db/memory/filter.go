@@ -0,0 +1,165 @@
+package memory
+
+import (
+	"slices"
+	"time"
+
+	"github.com/fabrizioperria/goflight/db"
+	"github.com/fabrizioperria/goflight/types"
+)
+
+func matchUser(filter db.UserFilter, user *types.User) bool {
+	if !filter.Id.IsZero() && filter.Id != user.Id {
+		return false
+	}
+	if filter.Email != "" && filter.Email != user.Email {
+		return false
+	}
+	return true
+}
+
+func matchFlight(filter db.FlightFilter, flight *types.Flight) bool {
+	if !filter.Id.IsZero() && filter.Id != flight.Id {
+		return false
+	}
+	if filter.Departure != "" && filter.Departure != flight.Departure {
+		return false
+	}
+	if filter.Arrival != "" && filter.Arrival != flight.Arrival {
+		return false
+	}
+	if filter.Airline != "" && filter.Airline != flight.Airline {
+		return false
+	}
+	if !filter.DepartureBetween.IsZero() {
+		if !filter.DepartureBetween.Contains(flight.DepartureTime) {
+			return false
+		}
+	}
+	if len(flight.Seats) < filter.MinAvailableSeats {
+		return false
+	}
+	return true
+}
+
+func matchSeat(filter db.SeatFilter, seat *types.Seat) bool {
+	if !filter.Id.IsZero() && filter.Id != seat.Id {
+		return false
+	}
+	if !filter.FlightId.IsZero() && filter.FlightId != seat.FlightId {
+		return false
+	}
+	if filter.FlightIds != nil && !slices.Contains(filter.FlightIds, seat.FlightId) {
+		return false
+	}
+	if filter.Available != nil && *filter.Available != seat.IsAvailable(time.Now()) {
+		return false
+	}
+	if filter.Class != 0 && filter.Class != seat.Class {
+		return false
+	}
+	return true
+}
+
+func matchReservation(filter db.ReservationFilter, reservation *types.Reservation) bool {
+	if !filter.Id.IsZero() && filter.Id != reservation.Id {
+		return false
+	}
+	if filter.Locator != "" && filter.Locator != reservation.Locator {
+		return false
+	}
+	if !filter.UserId.IsZero() && filter.UserId != reservation.UserId {
+		return false
+	}
+	if !filter.SeatId.IsZero() && filter.SeatId != reservation.SeatId {
+		return false
+	}
+	if !filter.FlightId.IsZero() && filter.FlightId != reservation.FlightId {
+		return false
+	}
+	if !filter.BookingId.IsZero() && filter.BookingId != reservation.BookingId {
+		return false
+	}
+	if filter.PaymentReference != "" && (reservation.Payment == nil || filter.PaymentReference != reservation.Payment.Reference) {
+		return false
+	}
+	if !filter.PaymentExpiredBy.IsZero() && (reservation.Payment == nil || !reservation.Payment.IsExpired(filter.PaymentExpiredBy)) {
+		return false
+	}
+	if filter.Unsettled && !reservation.Unsettled {
+		return false
+	}
+	return true
+}
+
+func matchBooking(filter db.BookingFilter, booking *types.Booking) bool {
+	if !filter.Id.IsZero() && filter.Id != booking.Id {
+		return false
+	}
+	if filter.Locator != "" && filter.Locator != booking.Locator {
+		return false
+	}
+	if !filter.UserId.IsZero() && filter.UserId != booking.UserId {
+		return false
+	}
+	return true
+}
+
+func matchCredit(filter db.CreditFilter, credit *types.Credit) bool {
+	if !filter.Id.IsZero() && filter.Id != credit.Id {
+		return false
+	}
+	if !filter.UserId.IsZero() && filter.UserId != credit.UserId {
+		return false
+	}
+	return true
+}
+
+func matchPromotion(filter db.PromotionFilter, promotion *types.Promotion) bool {
+	if !filter.Id.IsZero() && filter.Id != promotion.Id {
+		return false
+	}
+	if filter.Code != "" && types.NormalizePromoCode(filter.Code) != promotion.Code {
+		return false
+	}
+	return true
+}
+
+func matchWaitlistEntry(filter db.WaitlistFilter, entry *types.WaitlistEntry) bool {
+	if !filter.Id.IsZero() && filter.Id != entry.Id {
+		return false
+	}
+	if !filter.FlightId.IsZero() && filter.FlightId != entry.FlightId {
+		return false
+	}
+	if filter.Class != 0 && filter.Class != entry.Class {
+		return false
+	}
+	if !filter.UserId.IsZero() && filter.UserId != entry.UserId {
+		return false
+	}
+	if filter.Status != "" && filter.Status != entry.Status {
+		return false
+	}
+	if !filter.SeatId.IsZero() && (entry.Offer == nil || filter.SeatId != entry.Offer.SeatId) {
+		return false
+	}
+	return true
+}
+
+func paginate[T any](items []T, pagination *db.Pagination) []T {
+	limit := pagination.GetLimit()
+	if limit < 0 {
+		limit = -limit
+	}
+	skip := pagination.GetSkip()
+
+	if skip >= int64(len(items)) {
+		return items[:0]
+	}
+	items = items[skip:]
+	if limit > 0 && limit < int64(len(items)) {
+		items = items[:limit]
+	}
+	return items
+}
@@ -0,0 +1,206 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/fabrizioperria/goflight/db"
+	"github.com/fabrizioperria/goflight/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type FlightStore struct {
+	mu        sync.RWMutex
+	flights   []*types.Flight
+	seatStore *SeatStore
+}
+
+func NewFlightStore(seatStore *SeatStore) *FlightStore {
+	s := &FlightStore{
+		flights:   []*types.Flight{},
+		seatStore: seatStore,
+	}
+	seatStore.flightStore = s
+	return s
+}
+
+func copyFlight(flight *types.Flight) *types.Flight {
+	copied := *flight
+	copied.Seats = slices.Clone(flight.Seats)
+	return &copied
+}
+
+func (s *FlightStore) find(filter db.FlightFilter) (int, error) {
+	for i, flight := range s.flights {
+		if matchFlight(filter, flight) {
+			return i, nil
+		}
+	}
+	return -1, mongo.ErrNoDocuments
+}
+
+func (s *FlightStore) GetFlight(ctx context.Context, filter db.FlightFilter) (*types.Flight, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	i, err := s.find(filter)
+	if err != nil {
+		return nil, err
+	}
+	return copyFlight(s.flights[i]), nil
+}
+
+func (s *FlightStore) GetFlights(ctx context.Context, filter db.FlightFilter, sort db.FlightSort, pagination *db.Pagination) ([]*types.Flight, error) {
+	s.mu.RLock()
+	matched := []*types.Flight{}
+	for _, flight := range s.flights {
+		if matchFlight(filter, flight) {
+			matched = append(matched, copyFlight(flight))
+		}
+	}
+	s.mu.RUnlock()
+
+	switch sort {
+	case db.SortByDepartureTime:
+		slices.SortStableFunc(matched, func(a, b *types.Flight) int {
+			return a.DepartureTime.Compare(b.DepartureTime)
+		})
+	case db.SortByDuration:
+		slices.SortStableFunc(matched, func(a, b *types.Flight) int {
+			return cmp.Compare(a.Duration(), b.Duration())
+		})
+	case db.SortByLowestPrice:
+		// the seat store is read after releasing s.mu so that the lock order
+		// used by the reservation store is never inverted
+		// flights without a price go last
+		prices := map[primitive.ObjectID]types.Money{}
+		for _, flight := range matched {
+			if price, ok := s.seatStore.lowestPrice(flight.Seats); ok {
+				prices[flight.Id] = price
+			}
+		}
+		slices.SortStableFunc(matched, func(a, b *types.Flight) int {
+			priceA, okA := prices[a.Id]
+			priceB, okB := prices[b.Id]
+			switch {
+			case okA && okB:
+				return comparePrices(priceA, priceB)
+			case okA:
+				return -1
+			case okB:
+				return 1
+			}
+			return 0
+		})
+	}
+
+	return append([]*types.Flight{}, paginate(matched, pagination)...), nil
+}
+
+func (s *FlightStore) CreateFlight(ctx context.Context, flight *types.Flight) (*types.Flight, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if flight.Id.IsZero() {
+		flight.Id = primitive.NewObjectID()
+	} else if _, err := s.find(db.FlightFilter{Id: flight.Id}); err == nil {
+		return flight, fmt.Errorf("duplicate key: %s", flight.Id.Hex())
+	}
+	s.flights = append(s.flights, copyFlight(flight))
+	return flight, nil
+}
+
+func (s *FlightStore) CreateFlightWithSeats(ctx context.Context, flight *types.Flight, seats []*types.Seat) (*types.Flight, error) {
+	// seats before flights, the lock order of the reservation store
+	s.seatStore.mu.Lock()
+	defer s.seatStore.mu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if flight.Id.IsZero() {
+		flight.Id = primitive.NewObjectID()
+	} else if _, err := s.find(db.FlightFilter{Id: flight.Id}); err == nil {
+		return nil, fmt.Errorf("duplicate key: %s", flight.Id.Hex())
+	}
+	for _, seat := range seats {
+		seat.FlightId = flight.Id
+	}
+	if err := s.seatStore.insertSeats(seats); err != nil {
+		return nil, err
+	}
+
+	flight.Seats = make([]primitive.ObjectID, 0, len(seats))
+	for _, seat := range seats {
+		flight.Seats = append(flight.Seats, seat.Id)
+	}
+	s.flights = append(s.flights, copyFlight(flight))
+	return flight, nil
+}
+
+func (s *FlightStore) Drop(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.flights = []*types.Flight{}
+	return nil
+}
+
+func (s *FlightStore) UpdateFlight(ctx context.Context, filter db.FlightFilter, values types.UpdateFlightParams) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, err := s.find(filter)
+	if err != nil {
+		return "", fmt.Errorf("flight not found")
+	}
+	flight := s.flights[i]
+	if !values.ArrivalTime.IsZero() {
+		flight.ArrivalTime = values.ArrivalTime
+	}
+	if !values.DepartureTime.IsZero() {
+		flight.DepartureTime = values.DepartureTime
+	}
+	if len(values.Seats) > 0 {
+		flight.Seats = slices.Clone(values.Seats)
+	}
+	if values.Overbooking != nil {
+		flight.Overbooking = *values.Overbooking
+	}
+	return "", nil
+}
+
+// pullSeat and pushSeat mirror the $pull/$push updates issued on the flight's
+// seats array by the reservation store. The caller must hold s.mu.
+func (s *FlightStore) pullSeat(flightId primitive.ObjectID, seatId primitive.ObjectID) {
+	i, err := s.find(db.FlightFilter{Id: flightId})
+	if err != nil {
+		return
+	}
+	s.flights[i].Seats = slices.DeleteFunc(s.flights[i].Seats, func(id primitive.ObjectID) bool {
+		return id == seatId
+	})
+}
+
+func (s *FlightStore) pushSeat(flightId primitive.ObjectID, seatId primitive.ObjectID) {
+	i, err := s.find(db.FlightFilter{Id: flightId})
+	if err != nil {
+		return
+	}
+	if !slices.Contains(s.flights[i].Seats, seatId) {
+		s.flights[i].Seats = append(s.flights[i].Seats, seatId)
+	}
+}
+
+// oversell mirrors the $inc updates issued on the flight's oversold count by
+// the reservation store. The caller must hold s.mu.
+func (s *FlightStore) oversell(flightId primitive.ObjectID, delta int) {
+	i, err := s.find(db.FlightFilter{Id: flightId})
+	if err != nil {
+		return
+	}
+	s.flights[i].Oversold += delta
+}
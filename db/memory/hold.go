@@ -0,0 +1,82 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/fabrizioperria/goflight/db"
+	"github.com/fabrizioperria/goflight/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (s *ReservationStore) HoldSeat(ctx context.Context, filter db.SeatFilter, userId primitive.ObjectID, until time.Time) (*types.Seat, error) {
+	s.lock()
+	defer s.unlock()
+
+	seat, err := s.seatStore.getSeat(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if !seat.IsAvailable(now) && !seat.IsHeldBy(userId, now) {
+		return nil, fmt.Errorf("seat not available")
+	}
+
+	if _, err = s.seatStore.updateSeat(db.SeatFilter{Id: seat.Id}, types.UpdateSeatParams{Available: false, Price: seat.Price}); err != nil {
+		return nil, err
+	}
+	s.seatStore.setHold(seat.Id, userId, &until)
+	s.flightStore.pullSeat(seat.FlightId, seat.Id)
+
+	return s.seatStore.getSeat(db.SeatFilter{Id: seat.Id})
+}
+
+func (s *ReservationStore) ConfirmHold(ctx context.Context, filter db.SeatFilter, userId primitive.ObjectID, passenger *types.Passenger, spending *db.Spending) (*types.Reservation, error) {
+	s.lock()
+	defer s.unlock()
+
+	seat, err := s.seatStore.getSeat(filter)
+	if err != nil {
+		return nil, err
+	}
+	if !seat.IsHeldBy(userId, time.Now()) {
+		return nil, fmt.Errorf("no active hold on seat")
+	}
+
+	heldUntil := seat.HeldUntil
+	reservation, err := s.reserveSeat(db.SeatFilter{Id: seat.Id}, userId, primitive.NilObjectID, passenger)
+	if err != nil {
+		return nil, err
+	}
+	confirmed, err := s.withSpending(reservation, "", spending)
+	if err != nil {
+		// the seat stays held, as when the mongo transaction aborts
+		if _, holdErr := s.seatStore.updateSeat(db.SeatFilter{Id: seat.Id}, types.UpdateSeatParams{Available: false, Price: seat.Price}); holdErr != nil {
+			return nil, holdErr
+		}
+		s.seatStore.setHold(seat.Id, userId, heldUntil)
+		s.flightStore.pullSeat(seat.FlightId, seat.Id)
+		return nil, err
+	}
+	return confirmed, nil
+}
+
+func (s *ReservationStore) ReleaseExpiredHolds(ctx context.Context, now time.Time) (int, error) {
+	s.lock()
+	defer s.unlock()
+
+	released := 0
+	for _, seat := range s.seatStore.seats {
+		if seat.HeldUntil == nil || now.Before(*seat.HeldUntil) {
+			continue
+		}
+		seat.Available = true
+		seat.HeldBy = primitive.NilObjectID
+		seat.HeldUntil = nil
+		s.flightStore.pushSeat(seat.FlightId, seat.Id)
+		released++
+	}
+	return released, nil
+}
@@ -0,0 +1,88 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fabrizioperria/goflight/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type LoyaltyStore struct {
+	mu       sync.RWMutex
+	accounts []*types.LoyaltyAccount
+}
+
+func NewLoyaltyStore() *LoyaltyStore {
+	return &LoyaltyStore{
+		accounts: []*types.LoyaltyAccount{},
+	}
+}
+
+func copyLoyaltyAccount(account *types.LoyaltyAccount) *types.LoyaltyAccount {
+	copied := *account
+	copied.Activity = slices.Clone(account.Activity)
+	if copied.Activity == nil {
+		copied.Activity = []types.LoyaltyEntry{}
+	}
+	return &copied
+}
+
+func (s *LoyaltyStore) find(userId primitive.ObjectID) int {
+	return slices.IndexFunc(s.accounts, func(account *types.LoyaltyAccount) bool {
+		return account.UserId == userId
+	})
+}
+
+// replace stores account in place of the account of its user.
+func (s *LoyaltyStore) replace(account *types.LoyaltyAccount) {
+	if i := s.find(account.UserId); i >= 0 {
+		s.accounts[i] = copyLoyaltyAccount(account)
+	}
+}
+
+func (s *LoyaltyStore) GetLoyaltyAccount(ctx context.Context, userId primitive.ObjectID) (*types.LoyaltyAccount, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	i := s.find(userId)
+	if i < 0 {
+		return types.NewLoyaltyAccount(userId, time.Now()), nil
+	}
+	return copyLoyaltyAccount(s.accounts[i]), nil
+}
+
+func (s *LoyaltyStore) UpdateLoyaltyAccount(ctx context.Context, userId primitive.ObjectID, update func(account *types.LoyaltyAccount) (bool, error)) (*types.LoyaltyAccount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.find(userId)
+	account := types.NewLoyaltyAccount(userId, time.Now())
+	if i >= 0 {
+		account = copyLoyaltyAccount(s.accounts[i])
+	}
+	changed, err := update(account)
+	if err != nil {
+		return nil, err
+	}
+	if !changed {
+		return account, nil
+	}
+	if i < 0 {
+		account.Id = primitive.NewObjectID()
+		s.accounts = append(s.accounts, copyLoyaltyAccount(account))
+	} else {
+		s.accounts[i] = copyLoyaltyAccount(account)
+	}
+	return account, nil
+}
+
+func (s *LoyaltyStore) Drop(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.accounts = []*types.LoyaltyAccount{}
+	return nil
+}
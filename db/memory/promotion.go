@@ -0,0 +1,122 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/fabrizioperria/goflight/db"
+	"github.com/fabrizioperria/goflight/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// PromotionStore keeps the promotions whose redemptions the reservation store
+// counts. The reservation store locks it after the flight store.
+type PromotionStore struct {
+	mu         sync.RWMutex
+	promotions []*types.Promotion
+}
+
+func NewPromotionStore() *PromotionStore {
+	return &PromotionStore{
+		promotions: []*types.Promotion{},
+	}
+}
+
+func copyPromotion(promotion *types.Promotion) *types.Promotion {
+	copied := *promotion
+	copied.Routes = slices.Clone(promotion.Routes)
+	copied.Airlines = slices.Clone(promotion.Airlines)
+	copied.Classes = slices.Clone(promotion.Classes)
+	copied.RedeemedBy = maps.Clone(promotion.RedeemedBy)
+	return &copied
+}
+
+// find returns the index of the first promotion matching filter. The caller
+// must hold s.mu.
+func (s *PromotionStore) find(filter db.PromotionFilter) (int, error) {
+	for i, promotion := range s.promotions {
+		if matchPromotion(filter, promotion) {
+			return i, nil
+		}
+	}
+	return -1, mongo.ErrNoDocuments
+}
+
+func (s *PromotionStore) CreatePromotion(ctx context.Context, promotion *types.Promotion) (*types.Promotion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	promotion.Code = types.NormalizePromoCode(promotion.Code)
+	if _, err := s.find(db.PromotionFilter{Code: promotion.Code}); err == nil {
+		return nil, fmt.Errorf("duplicate key: %s", promotion.Code)
+	}
+	if promotion.Id.IsZero() {
+		promotion.Id = primitive.NewObjectID()
+	} else if _, err := s.find(db.PromotionFilter{Id: promotion.Id}); err == nil {
+		return nil, fmt.Errorf("duplicate key: %s", promotion.Id.Hex())
+	}
+	s.promotions = append(s.promotions, copyPromotion(promotion))
+	return promotion, nil
+}
+
+func (s *PromotionStore) GetPromotion(ctx context.Context, filter db.PromotionFilter) (*types.Promotion, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	i, err := s.find(filter)
+	if err != nil {
+		return nil, err
+	}
+	return copyPromotion(s.promotions[i]), nil
+}
+
+func (s *PromotionStore) GetPromotions(ctx context.Context, pagination *db.Pagination) ([]*types.Promotion, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	results := make([]*types.Promotion, 0)
+	for _, promotion := range paginate(s.promotions, pagination) {
+		results = append(results, copyPromotion(promotion))
+	}
+	return results, nil
+}
+
+func (s *PromotionStore) UpdatePromotion(ctx context.Context, filter db.PromotionFilter, params types.PromotionParams) (*types.Promotion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, err := s.find(filter)
+	if err != nil {
+		return nil, err
+	}
+	code := types.NormalizePromoCode(params.Code)
+	if j, err := s.find(db.PromotionFilter{Code: code}); err == nil && j != i {
+		return nil, fmt.Errorf("duplicate key: %s", code)
+	}
+	params.Apply(s.promotions[i])
+	return copyPromotion(s.promotions[i]), nil
+}
+
+func (s *PromotionStore) DeletePromotion(ctx context.Context, filter db.PromotionFilter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, err := s.find(filter)
+	if err != nil {
+		return fmt.Errorf("promotion not found")
+	}
+	s.promotions = append(s.promotions[:i], s.promotions[i+1:]...)
+	return nil
+}
+
+func (s *PromotionStore) Drop(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.promotions = []*types.Promotion{}
+	return nil
+}
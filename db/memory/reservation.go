@@ -0,0 +1,635 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fabrizioperria/goflight/db"
+	"github.com/fabrizioperria/goflight/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ReservationStore keeps the flight and seat stores it was built with in sync
+// with its own reservations, counts the redemptions of the promotions of its
+// promotion store, and issues and spends the credits of its credit store and
+// the points of its loyalty store. Every mutation locks the reservation,
+// seat, flight, promotion, credit and loyalty stores, in that order, for its
+// whole duration so that it is applied atomically, like the snapshot
+// transactions of the mongo store.
+type ReservationStore struct {
+	mu             sync.RWMutex
+	reservations   []*types.Reservation
+	bookings       []*types.Booking
+	flightStore    *FlightStore
+	seatStore      *SeatStore
+	promotionStore *PromotionStore
+	creditStore    *CreditStore
+	loyaltyStore   *LoyaltyStore
+}
+
+func NewReservationStore(flightStore *FlightStore, seatStore *SeatStore, promotionStore *PromotionStore, creditStore *CreditStore, loyaltyStore *LoyaltyStore) *ReservationStore {
+	return &ReservationStore{
+		reservations:   []*types.Reservation{},
+		bookings:       []*types.Booking{},
+		flightStore:    flightStore,
+		seatStore:      seatStore,
+		promotionStore: promotionStore,
+		creditStore:    creditStore,
+		loyaltyStore:   loyaltyStore,
+	}
+}
+
+func copyReservation(reservation *types.Reservation) *types.Reservation {
+	copied := *reservation
+	copied.History = slices.Clone(reservation.History)
+	copied.SeatChanges = slices.Clone(reservation.SeatChanges)
+	if reservation.Payment != nil {
+		payment := *reservation.Payment
+		copied.Payment = &payment
+	}
+	if reservation.Refund != nil {
+		refund := *reservation.Refund
+		copied.Refund = &refund
+	}
+	if reservation.Promotion != nil {
+		promotion := *reservation.Promotion
+		copied.Promotion = &promotion
+	}
+	if reservation.Credit != nil {
+		credit := *reservation.Credit
+		copied.Credit = &credit
+	}
+	if reservation.Loyalty != nil {
+		loyalty := *reservation.Loyalty
+		copied.Loyalty = &loyalty
+	}
+	return &copied
+}
+
+func (s *ReservationStore) lock() {
+	s.mu.Lock()
+	s.seatStore.mu.Lock()
+	s.flightStore.mu.Lock()
+	s.promotionStore.mu.Lock()
+	s.creditStore.mu.Lock()
+	s.loyaltyStore.mu.Lock()
+}
+
+func (s *ReservationStore) unlock() {
+	s.loyaltyStore.mu.Unlock()
+	s.creditStore.mu.Unlock()
+	s.promotionStore.mu.Unlock()
+	s.flightStore.mu.Unlock()
+	s.seatStore.mu.Unlock()
+	s.mu.Unlock()
+}
+
+func (s *ReservationStore) find(filter db.ReservationFilter) (int, error) {
+	for i, reservation := range s.reservations {
+		if matchReservation(filter, reservation) {
+			return i, nil
+		}
+	}
+	return -1, mongo.ErrNoDocuments
+}
+
+// newLocator returns a record locator used by no reservation nor booking.
+// The caller must hold s.mu.
+func (s *ReservationStore) newLocator() string {
+	for {
+		locator := types.NewLocator()
+		_, err := s.find(db.ReservationFilter{Locator: locator})
+		if err == nil {
+			continue
+		}
+		if _, err = s.getBooking(db.BookingFilter{Locator: locator}); err != nil {
+			return locator
+		}
+	}
+}
+
+// reserveSeat takes the seat matching filter out of the flight's available
+// seats and records a reservation for passenger on it, pending until it is
+// paid for. The caller must hold
+// the locks taken by lock.
+func (s *ReservationStore) reserveSeat(filter db.SeatFilter, userId primitive.ObjectID, bookingId primitive.ObjectID, passenger *types.Passenger) (*types.Reservation, error) {
+	seat, err := s.seatStore.getSeat(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if !seat.IsAvailable(now) && !seat.IsHeldBy(userId, now) {
+		return nil, fmt.Errorf("seat not available")
+	}
+	if err = s.takeSeat(seat); err != nil {
+		return nil, err
+	}
+
+	reservationParams := types.CreateReservationParams{
+		UserId:    userId,
+		SeatId:    seat.Id,
+		FlightId:  seat.FlightId,
+		Passenger: passenger,
+		Price:     seat.Price,
+		Fare:      seat.Fare,
+	}
+	return s.recordReservation(&reservationParams, bookingId), nil
+}
+
+// takeSeat marks seat as taken, clearing its hold, and takes it out of the
+// flight's available seats. The caller must hold the locks taken by lock.
+func (s *ReservationStore) takeSeat(seat *types.Seat) error {
+	if _, err := s.seatStore.updateSeat(db.SeatFilter{Id: seat.Id}, types.UpdateSeatParams{Available: false, Price: seat.Price}); err != nil {
+		return err
+	}
+	s.seatStore.setHold(seat.Id, primitive.NilObjectID, nil)
+	s.flightStore.pullSeat(seat.FlightId, seat.Id)
+	return nil
+}
+
+// freeSeat undoes takeSeat for the seat with seatId. The caller must hold
+// the locks taken by lock.
+func (s *ReservationStore) freeSeat(seatId primitive.ObjectID) error {
+	seatFilter := db.SeatFilter{Id: seatId}
+	seat, err := s.seatStore.getSeat(seatFilter)
+	if err != nil {
+		return err
+	}
+	if _, err = s.seatStore.updateSeat(seatFilter, types.UpdateSeatParams{Available: true, Price: seat.Price}); err != nil {
+		return err
+	}
+	s.flightStore.pushSeat(seat.FlightId, seat.Id)
+	return nil
+}
+
+// oversell records a reservation for passenger in class on the flight with
+// flightId, beyond its seats, priced like the priciest seat of the class.
+// The caller must hold the locks taken by lock.
+func (s *ReservationStore) oversell(flightId primitive.ObjectID, class types.SeatClass, userId primitive.ObjectID, passenger *types.Passenger) (*types.Reservation, error) {
+	seats := []*types.Seat{}
+	for _, seat := range s.seatStore.seats {
+		if matchSeat(db.SeatFilter{FlightId: flightId, Class: class}, seat) {
+			seats = append(seats, seat)
+		}
+	}
+	if len(seats) == 0 {
+		return nil, types.ErrClassNotOffered
+	}
+	now := time.Now()
+	for _, seat := range seats {
+		if seat.IsAvailable(now) {
+			return nil, types.ErrSeatsAvailable
+		}
+	}
+
+	i, err := s.flightStore.find(db.FlightFilter{Id: flightId})
+	if err != nil {
+		return nil, err
+	}
+	if flight := s.flightStore.flights[i]; flight.Oversold >= flight.Overbooking {
+		return nil, types.ErrOverbookingExhausted
+	}
+	s.flightStore.oversell(flightId, 1)
+
+	priciest := types.PriciestSeat(seats)
+	reservationParams := types.CreateReservationParams{
+		UserId:    userId,
+		Class:     class,
+		FlightId:  flightId,
+		Passenger: passenger,
+		Price:     priciest.Price,
+		Fare:      priciest.Fare,
+	}
+	return s.recordReservation(&reservationParams, primitive.NilObjectID), nil
+}
+
+// recordReservation records a reservation made from params, pending until it
+// is paid for. The caller must hold s.mu.
+func (s *ReservationStore) recordReservation(params *types.CreateReservationParams, bookingId primitive.ObjectID) *types.Reservation {
+	reservation := types.ReservationFromParams(params)
+	reservation.Id = primitive.NewObjectID()
+	reservation.BookingId = bookingId
+	reservation.ReservationDate = time.Now().UTC()
+	reservation.Locator = s.newLocator()
+	reservation.CancellationDate = nil
+	reservation.Status = types.ReservationPending
+	reservation.History = []types.StatusChange{{To: types.ReservationPending, At: reservation.ReservationDate}}
+	s.reservations = append(s.reservations, reservation)
+
+	return reservation
+}
+
+// releaseSeat undoes reserveSeat, or oversell, for reservation, which must be
+// the last one recorded. The caller must hold the locks taken by lock.
+func (s *ReservationStore) releaseSeat(reservation *types.Reservation) {
+	if reservation.IsAssigned() {
+		s.freeSeat(reservation.SeatId)
+	} else {
+		s.flightStore.oversell(reservation.FlightId, -1)
+	}
+	s.reservations = s.reservations[:len(s.reservations)-1]
+}
+
+func (s *ReservationStore) CreateReservation(ctx context.Context, filter db.SeatFilter, userId primitive.ObjectID, passenger *types.Passenger, promoCode string, spending *db.Spending) (*types.Reservation, error) {
+	s.lock()
+	defer s.unlock()
+
+	reservation, err := s.reserveSeat(filter, userId, primitive.NilObjectID, passenger)
+	if err != nil {
+		return nil, err
+	}
+	return s.withSpending(reservation, promoCode, spending)
+}
+
+func (s *ReservationStore) CreateUnassignedReservation(ctx context.Context, flightId primitive.ObjectID, class types.SeatClass, userId primitive.ObjectID, passenger *types.Passenger, promoCode string, spending *db.Spending) (*types.Reservation, error) {
+	s.lock()
+	defer s.unlock()
+
+	reservation, err := s.oversell(flightId, class, userId, passenger)
+	if err != nil {
+		return nil, err
+	}
+	return s.withSpending(reservation, promoCode, spending)
+}
+
+// withSpending applies the promotion with promoCode, if any, to
+// reservation, which must be the last one recorded, then spends what
+// spending says on it, and returns a copy of it. Nothing is redeemed, and
+// the reservation is undone, when any of them cannot be. The caller must
+// hold the locks taken by lock.
+func (s *ReservationStore) withSpending(reservation *types.Reservation, promoCode string, spending *db.Spending) (*types.Reservation, error) {
+	var (
+		promotion *types.Promotion
+		credit    *types.Credit
+		account   *types.LoyaltyAccount
+		err       error
+	)
+	applied := copyReservation(reservation)
+	if promoCode != "" {
+		promotion, err = s.applyPromotion(applied, promoCode)
+	}
+	if err == nil && spending != nil && spending.Credit != nil {
+		credit, err = s.spendCredit(applied, *spending.Credit)
+	}
+	if err == nil && spending != nil && spending.Points > 0 {
+		account, err = s.spendPoints(applied, spending)
+	}
+	if err != nil {
+		s.releaseSeat(reservation)
+		return nil, err
+	}
+
+	if promotion != nil {
+		promotion.Redeem(applied.UserId)
+	}
+	if credit != nil {
+		s.creditStore.replace(credit)
+	}
+	if account != nil {
+		s.loyaltyStore.replace(account)
+	}
+	*reservation = *applied
+	return copyReservation(reservation), nil
+}
+
+// applyPromotion takes the discount of the promotion with code off
+// reservation and returns the promotion, for its redemption to be counted.
+// The caller must hold the locks taken by lock.
+func (s *ReservationStore) applyPromotion(reservation *types.Reservation, code string) (*types.Promotion, error) {
+	i, err := s.promotionStore.find(db.PromotionFilter{Code: code})
+	if err != nil {
+		return nil, fmt.Errorf("%w: unknown code %s", types.ErrPromotionNotApplicable, types.NormalizePromoCode(code))
+	}
+	promotion := s.promotionStore.promotions[i]
+	j, err := s.flightStore.find(db.FlightFilter{Id: reservation.FlightId})
+	if err != nil {
+		return nil, err
+	}
+	// the reservations without a seat are discounted like any seat of their
+	// class
+	seat := &types.Seat{Class: reservation.Class}
+	if reservation.IsAssigned() {
+		if seat, err = s.seatStore.getSeat(db.SeatFilter{Id: reservation.SeatId}); err != nil {
+			return nil, err
+		}
+	}
+	discount, err := promotion.Discount(s.flightStore.flights[j], seat, reservation.BaseFare(), reservation.UserId, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	reservation.Promotion = &types.AppliedPromotion{PromotionId: promotion.Id, Code: promotion.Code, Discount: discount}
+	return promotion, nil
+}
+
+// spendCredit spends the credit matching filter on reservation and returns
+// a copy of the credit, for it to be stored. The caller must hold the locks
+// taken by lock.
+func (s *ReservationStore) spendCredit(reservation *types.Reservation, filter db.CreditFilter) (*types.Credit, error) {
+	i, err := s.creditStore.find(filter)
+	if err != nil {
+		return nil, err
+	}
+	credit := copyCredit(s.creditStore.credits[i])
+	if reservation.Credit, err = credit.Redeem(reservation.AmountDue(), reservation.Id, time.Now()); err != nil {
+		return nil, err
+	}
+	return credit, nil
+}
+
+// spendPoints spends the loyalty points of the user of reservation on it as
+// spending says, and returns a copy of their account, for it to be stored.
+// The caller must hold the locks taken by lock.
+func (s *ReservationStore) spendPoints(reservation *types.Reservation, spending *db.Spending) (*types.LoyaltyAccount, error) {
+	i := s.loyaltyStore.find(reservation.UserId)
+	if i < 0 {
+		return nil, types.ErrPointsUnavailable
+	}
+	account := copyLoyaltyAccount(s.loyaltyStore.accounts[i])
+	var err error
+	if reservation.Loyalty, err = account.Pay(spending.Points, spending.PointValue, reservation.AmountDue(), reservation.Id, time.Now()); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+func (s *ReservationStore) CreateBooking(ctx context.Context, seats []db.PassengerSeat, userId primitive.ObjectID) (*types.Booking, error) {
+	s.lock()
+	defer s.unlock()
+
+	booking := &types.Booking{
+		Id:             primitive.NewObjectID(),
+		UserId:         userId,
+		ReservationIds: []primitive.ObjectID{},
+		BookingDate:    time.Now().UTC(),
+		Locator:        s.newLocator(),
+	}
+	reserved := []*types.Reservation{}
+	for _, seat := range seats {
+		reservation, err := s.reserveSeat(seat.Seat, userId, booking.Id, seat.Passenger)
+		if err != nil {
+			// roll back in reverse order so that every release pops the
+			// reservation it created
+			for i := len(reserved) - 1; i >= 0; i-- {
+				s.releaseSeat(reserved[i])
+			}
+			return nil, err
+		}
+		reserved = append(reserved, reservation)
+		booking.ReservationIds = append(booking.ReservationIds, reservation.Id)
+	}
+	s.bookings = append(s.bookings, booking)
+
+	return s.getBooking(db.BookingFilter{Id: booking.Id})
+}
+
+func (s *ReservationStore) GetBooking(ctx context.Context, filter db.BookingFilter) (*types.Booking, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.getBooking(filter)
+}
+
+// getBooking returns a copy of the first booking matching filter along with
+// its reservations. The caller must hold s.mu.
+func (s *ReservationStore) getBooking(filter db.BookingFilter) (*types.Booking, error) {
+	for _, booking := range s.bookings {
+		if !matchBooking(filter, booking) {
+			continue
+		}
+		found := *booking
+		found.ReservationIds = slices.Clone(booking.ReservationIds)
+		found.Reservations = []*types.Reservation{}
+		for _, reservation := range s.reservations {
+			if reservation.BookingId == booking.Id {
+				found.Reservations = append(found.Reservations, copyReservation(reservation))
+			}
+		}
+		return &found, nil
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (s *ReservationStore) GetReservations(ctx context.Context, filter db.ReservationFilter, pagination *db.Pagination) ([]*types.Reservation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	matched := []*types.Reservation{}
+	for _, reservation := range s.reservations {
+		if matchReservation(filter, reservation) {
+			matched = append(matched, reservation)
+		}
+	}
+
+	results := []*types.Reservation{}
+	for _, reservation := range paginate(matched, pagination) {
+		results = append(results, copyReservation(reservation))
+	}
+	return results, nil
+}
+
+func (s *ReservationStore) GetReservation(ctx context.Context, filter db.ReservationFilter) (*types.Reservation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	i, err := s.find(filter)
+	if err != nil {
+		return nil, err
+	}
+	return copyReservation(s.reservations[i]), nil
+}
+
+func (s *ReservationStore) CancelReservation(ctx context.Context, filter db.ReservationFilter, refund *types.Refund, credit *types.Credit) (*types.Reservation, error) {
+	return s.endReservation(filter, types.ReservationCancelled, refund, credit)
+}
+
+func (s *ReservationStore) DenyBoarding(ctx context.Context, filter db.ReservationFilter, refund *types.Refund, credit *types.Credit) (*types.Reservation, error) {
+	return s.endReservation(filter, types.ReservationDeniedBoarding, refund, credit)
+}
+
+// endReservation moves the reservation matching filter to status, which
+// releases its seat, records refund on it and issues credit, if any.
+func (s *ReservationStore) endReservation(filter db.ReservationFilter, status types.ReservationStatus, refund *types.Refund, credit *types.Credit) (*types.Reservation, error) {
+	s.lock()
+	defer s.unlock()
+
+	// the credit is checked first so that nothing changes when it cannot be
+	// issued
+	if credit != nil {
+		if err := s.creditStore.checkNew(credit); err != nil {
+			return nil, err
+		}
+	}
+	ended, err := s.transitionReservation(filter, status)
+	if err != nil {
+		return nil, err
+	}
+	if credit != nil {
+		s.creditStore.insert(credit)
+	}
+	if refund == nil {
+		return ended, nil
+	}
+	i, err := s.find(db.ReservationFilter{Id: ended.Id})
+	if err != nil {
+		return nil, err
+	}
+	recorded := *refund
+	s.reservations[i].Refund = &recorded
+	return copyReservation(s.reservations[i]), nil
+}
+
+func (s *ReservationStore) SettleReservation(ctx context.Context, filter db.ReservationFilter) (*types.Reservation, error) {
+	s.lock()
+	defer s.unlock()
+
+	i, err := s.find(filter)
+	if err != nil {
+		return nil, err
+	}
+	s.reservations[i].Unsettled = false
+	return copyReservation(s.reservations[i]), nil
+}
+
+func (s *ReservationStore) UpdateReservationStatus(ctx context.Context, filter db.ReservationFilter, status types.ReservationStatus) (*types.Reservation, error) {
+	s.lock()
+	defer s.unlock()
+
+	return s.transitionReservation(filter, status)
+}
+
+func (s *ReservationStore) UpdateReservationPayment(ctx context.Context, filter db.ReservationFilter, payment *types.Payment) (*types.Reservation, error) {
+	s.lock()
+	defer s.unlock()
+
+	i, err := s.find(filter)
+	if err != nil {
+		return nil, err
+	}
+	reservation := s.reservations[i]
+	recorded := *payment
+	reservation.Payment = &recorded
+
+	status := payment.Status.ReservationStatus(reservation.CurrentStatus())
+	if status == "" {
+		return copyReservation(reservation), nil
+	}
+	return s.transitionReservation(db.ReservationFilter{Id: reservation.Id}, status)
+}
+
+// transitionReservation moves the reservation matching filter to status and
+// returns a copy of it, giving its seat back to the flight when status
+// releases it, or its place back to the overbooking allowance when it has
+// none. A reservation without a seat is assigned one when it checks in, and
+// one giving its seat back is left unsettled. The caller must hold the locks
+// taken by lock.
+func (s *ReservationStore) transitionReservation(filter db.ReservationFilter, status types.ReservationStatus) (*types.Reservation, error) {
+	i, err := s.find(filter)
+	if err != nil {
+		return nil, err
+	}
+	reservation := s.reservations[i]
+
+	from := reservation.CurrentStatus()
+	if !from.CanTransitionTo(status) {
+		return nil, &types.TransitionError{From: from, To: status}
+	}
+
+	switch {
+	case status.ReleasesSeat() && !reservation.IsAssigned():
+		s.flightStore.oversell(reservation.FlightId, -1)
+	case status.ReleasesSeat():
+		if err = s.freeSeat(reservation.SeatId); err != nil {
+			return nil, err
+		}
+	case status == types.ReservationCheckedIn && !reservation.IsAssigned():
+		seatId, err := s.assignSeat(reservation)
+		if err != nil {
+			return nil, err
+		}
+		reservation.SeatId = seatId
+	}
+
+	change := types.StatusChange{From: from, To: status, At: time.Now().UTC()}
+	reservation.Status = status
+	if status.ReleasesSeat() {
+		reservation.Unsettled = true
+	}
+	reservation.History = append(reservation.History, change)
+	if status == types.ReservationCancelled {
+		reservation.CancellationDate = &change.At
+	}
+	return copyReservation(reservation), nil
+}
+
+// assignSeat takes an available seat of the class of reservation, which has
+// none, out of the flight's available seats, counting the reservation out of
+// the oversold ones, and returns its id. It fails with
+// types.ErrNoSeatToAssign when no seat of the class is left. The caller must
+// hold the locks taken by lock.
+func (s *ReservationStore) assignSeat(reservation *types.Reservation) (primitive.ObjectID, error) {
+	available := true
+	seat, err := s.seatStore.getSeat(db.SeatFilter{FlightId: reservation.FlightId, Class: reservation.Class, Available: &available})
+	if err != nil {
+		return primitive.NilObjectID, types.ErrNoSeatToAssign
+	}
+	if err = s.takeSeat(seat); err != nil {
+		return primitive.NilObjectID, err
+	}
+	s.flightStore.oversell(seat.FlightId, -1)
+	return seat.Id, nil
+}
+
+func (s *ReservationStore) ChangeSeat(ctx context.Context, filter db.ReservationFilter, seatFilter db.SeatFilter, payment *types.Payment) (*types.Reservation, error) {
+	s.lock()
+	defer s.unlock()
+
+	i, err := s.find(filter)
+	if err != nil {
+		return nil, err
+	}
+	reservation := s.reservations[i]
+	if !reservation.CurrentStatus().CanChangeSeat() {
+		return nil, types.ErrSeatNotChangeable
+	}
+	seatFilter.FlightId = reservation.FlightId
+	seat, err := s.seatStore.getSeat(seatFilter)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if seat.Id == reservation.SeatId || (!seat.IsAvailable(now) && !seat.IsHeldBy(reservation.UserId, now)) {
+		return nil, fmt.Errorf("seat not available")
+	}
+
+	// change a copy so that a failure leaves the reservation as it was
+	changed := copyReservation(reservation)
+	if _, err = changed.ChangeSeat(seat, payment, now); err != nil {
+		return nil, err
+	}
+	if reservation.IsAssigned() {
+		if err = s.freeSeat(reservation.SeatId); err != nil {
+			return nil, err
+		}
+	} else {
+		s.flightStore.oversell(reservation.FlightId, -1)
+	}
+	if err = s.takeSeat(seat); err != nil {
+		return nil, err
+	}
+	s.reservations[i] = changed
+	return copyReservation(changed), nil
+}
+
+func (s *ReservationStore) Drop(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.reservations = []*types.Reservation{}
+	s.bookings = []*types.Booking{}
+	return nil
+}
@@ -0,0 +1,65 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/fabrizioperria/goflight/db"
+	"github.com/fabrizioperria/goflight/types"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestConcurrentReservationsOfSameSeat(t *testing.T) {
+	store := NewStore()
+	ctx := context.Background()
+
+	flight, err := store.Flight.CreateFlight(ctx, &types.Flight{Airline: "Delta", Seats: []primitive.ObjectID{}})
+	assert.NoError(t, err)
+	seat, err := store.Seat.CreateSeat(ctx, &types.Seat{FlightId: flight.Id, Price: types.MustParseMoney("100", "USD"), Available: true})
+	assert.NoError(t, err)
+	_, err = store.Flight.UpdateFlight(ctx, db.FlightFilter{Id: flight.Id}, types.UpdateFlightParams{Seats: []primitive.ObjectID{seat.Id}})
+	assert.NoError(t, err)
+
+	const attempts = 20
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		succeeded int
+	)
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := store.Reservation.CreateReservation(ctx, db.SeatFilter{Id: seat.Id}, primitive.NewObjectID(), nil, "", nil)
+			if err == nil {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, succeeded)
+	reservations, err := store.Reservation.GetReservations(ctx, db.ReservationFilter{}, &db.Pagination{})
+	assert.NoError(t, err)
+	assert.Len(t, reservations, 1)
+
+	flight, err = store.Flight.GetFlight(ctx, db.FlightFilter{Id: flight.Id})
+	assert.NoError(t, err)
+	assert.Empty(t, flight.Seats)
+
+	_, err = store.Reservation.CancelReservation(ctx, db.ReservationFilter{Id: reservations[0].Id}, nil, nil)
+	assert.NoError(t, err)
+	_, err = store.Reservation.CancelReservation(ctx, db.ReservationFilter{Id: reservations[0].Id}, nil, nil)
+	assert.Error(t, err)
+
+	seat, err = store.Seat.GetSeat(ctx, db.SeatFilter{Id: seat.Id})
+	assert.NoError(t, err)
+	assert.True(t, seat.Available)
+	flight, err = store.Flight.GetFlight(ctx, db.FlightFilter{Id: flight.Id})
+	assert.NoError(t, err)
+	assert.Equal(t, []primitive.ObjectID{seat.Id}, flight.Seats)
+}
@@ -0,0 +1,204 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fabrizioperria/goflight/db"
+	"github.com/fabrizioperria/goflight/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type SeatStore struct {
+	mu    sync.RWMutex
+	seats []*types.Seat
+	// flightStore lists the seats created one by one in their flight, once
+	// NewFlightStore links it.
+	flightStore *FlightStore
+}
+
+func NewSeatStore() *SeatStore {
+	return &SeatStore{
+		seats: []*types.Seat{},
+	}
+}
+
+func (s *SeatStore) find(filter db.SeatFilter) (int, error) {
+	for i, seat := range s.seats {
+		if matchSeat(filter, seat) {
+			return i, nil
+		}
+	}
+	return -1, mongo.ErrNoDocuments
+}
+
+func (s *SeatStore) CreateSeat(ctx context.Context, seat *types.Seat) (*types.Seat, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.insertSeats([]*types.Seat{seat}); err != nil {
+		return nil, err
+	}
+	if s.flightStore != nil && !seat.FlightId.IsZero() {
+		// seats before flights, the lock order of the reservation store
+		s.flightStore.mu.Lock()
+		defer s.flightStore.mu.Unlock()
+		s.flightStore.pushSeat(seat.FlightId, seat.Id)
+	}
+	return seat, nil
+}
+
+func (s *SeatStore) CreateSeats(ctx context.Context, seats []*types.Seat) ([]*types.Seat, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.insertSeats(seats); err != nil {
+		return nil, err
+	}
+	return seats, nil
+}
+
+// insertSeats gives the seats without an id one and stores copies of them,
+// or none if one of the ids is taken. The caller must hold s.mu.
+func (s *SeatStore) insertSeats(seats []*types.Seat) error {
+	ids := map[primitive.ObjectID]bool{}
+	for _, seat := range seats {
+		if seat.Id.IsZero() {
+			continue
+		}
+		if _, err := s.find(db.SeatFilter{Id: seat.Id}); err == nil || ids[seat.Id] {
+			return fmt.Errorf("duplicate key: %s", seat.Id.Hex())
+		}
+		ids[seat.Id] = true
+	}
+
+	for _, seat := range seats {
+		if seat.Id.IsZero() {
+			seat.Id = primitive.NewObjectID()
+		}
+		stored := *seat
+		s.seats = append(s.seats, &stored)
+	}
+	return nil
+}
+
+func (s *SeatStore) UpdateSeatPrices(ctx context.Context, seats []*types.Seat) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	available := true
+	for _, seat := range seats {
+		if i, err := s.find(db.SeatFilter{Id: seat.Id, Available: &available}); err == nil {
+			s.seats[i].Price = seat.Price
+			s.seats[i].Fare = seat.Fare
+		}
+	}
+	return nil
+}
+
+func (s *SeatStore) UpdateSeat(ctx context.Context, filter db.SeatFilter, values types.UpdateSeatParams) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.updateSeat(filter, values)
+}
+
+// updateSeat applies values to the first seat matching filter. The caller must
+// hold s.mu.
+func (s *SeatStore) updateSeat(filter db.SeatFilter, values types.UpdateSeatParams) (string, error) {
+	i, err := s.find(filter)
+	if err != nil {
+		return "", fmt.Errorf("seat not found")
+	}
+	s.seats[i].Price = values.Price
+	s.seats[i].Available = values.Available
+	return "", nil
+}
+
+// setHold records userId's hold on the seat until the given time, or clears
+// it when until is nil. The caller must hold s.mu.
+func (s *SeatStore) setHold(seatId primitive.ObjectID, userId primitive.ObjectID, until *time.Time) {
+	i, err := s.find(db.SeatFilter{Id: seatId})
+	if err != nil {
+		return
+	}
+	s.seats[i].HeldBy = userId
+	s.seats[i].HeldUntil = until
+}
+
+func (s *SeatStore) Drop(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seats = []*types.Seat{}
+	return nil
+}
+
+func (s *SeatStore) GetSeats(ctx context.Context, filter db.SeatFilter, pagination *db.Pagination) ([]*types.Seat, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	matched := []*types.Seat{}
+	for _, seat := range s.seats {
+		if matchSeat(filter, seat) {
+			matched = append(matched, seat)
+		}
+	}
+
+	results := make([]*types.Seat, 0)
+	for _, seat := range paginate(matched, pagination) {
+		seat := *seat
+		results = append(results, &seat)
+	}
+	return results, nil
+}
+
+func (s *SeatStore) GetSeat(ctx context.Context, filter db.SeatFilter) (*types.Seat, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.getSeat(filter)
+}
+
+// lowestPrice returns the cheapest price among seatIds, and false when none
+// of them exists or has a price. Like the database, it takes the prices in
+// the first currency in alphabetical order, never comparing amounts in
+// different currencies.
+func (s *SeatStore) lowestPrice(seatIds []primitive.ObjectID) (types.Money, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	lowest, found := types.Money{}, false
+	for _, seat := range s.seats {
+		if slices.Contains(seatIds, seat.Id) && seat.Price.IsSet() {
+			if !found || comparePrices(seat.Price, lowest) < 0 {
+				lowest, found = seat.Price, true
+			}
+		}
+	}
+	return lowest, found
+}
+
+// comparePrices orders a and b by currency, then by amount.
+func comparePrices(a, b types.Money) int {
+	if c := cmp.Compare(a.Currency(), b.Currency()); c != 0 {
+		return c
+	}
+	return a.Decimal().Cmp(b.Decimal())
+}
+
+// getSeat returns a copy of the first seat matching filter. The caller must
+// hold s.mu.
+func (s *SeatStore) getSeat(filter db.SeatFilter) (*types.Seat, error) {
+	i, err := s.find(filter)
+	if err != nil {
+		return nil, err
+	}
+	seat := *s.seats[i]
+	return &seat, nil
+}
@@ -0,0 +1,34 @@
+// Package memory implements the db storers in process, without a database.
+// The stores understand the same typed filters and db.Pagination semantics
+// as the mongo ones and are safe for concurrent use.
+package memory
+
+import (
+	"context"
+
+	"github.com/fabrizioperria/goflight/db"
+)
+
+// NewStore returns empty stores, except for the airports and the aircraft
+// which hold the bundled datasets.
+func NewStore() *db.Store {
+	var (
+		userStore        = NewUserStore()
+		seatStore        = NewSeatStore()
+		flightStore      = NewFlightStore(seatStore)
+		promotionStore   = NewPromotionStore()
+		creditStore      = NewCreditStore()
+		loyaltyStore     = NewLoyaltyStore()
+		reservationStore = NewReservationStore(flightStore, seatStore, promotionStore, creditStore, loyaltyStore)
+		airportStore     = NewAirportStore()
+		aircraftStore    = NewAircraftStore()
+		waitlistStore    = NewWaitlistStore()
+	)
+	if err := db.LoadBundledAirports(context.Background(), airportStore); err != nil {
+		panic(err)
+	}
+	if err := db.LoadBundledAircraft(context.Background(), aircraftStore); err != nil {
+		panic(err)
+	}
+	return db.NewStore(userStore, flightStore, seatStore, reservationStore, airportStore, aircraftStore, creditStore, promotionStore, loyaltyStore, waitlistStore)
+}
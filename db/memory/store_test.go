@@ -0,0 +1,14 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/fabrizioperria/goflight/db"
+	"github.com/fabrizioperria/goflight/db/storetest"
+)
+
+func TestConformance(t *testing.T) {
+	storetest.RunConformance(t, func(t *testing.T) *db.Store {
+		return NewStore()
+	})
+}
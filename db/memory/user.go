@@ -0,0 +1,103 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/fabrizioperria/goflight/db"
+	"github.com/fabrizioperria/goflight/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type UserStore struct {
+	mu    sync.RWMutex
+	users []*types.User
+}
+
+func NewUserStore() *UserStore {
+	return &UserStore{
+		users: []*types.User{},
+	}
+}
+
+func (s *UserStore) find(filter db.UserFilter) (int, error) {
+	for i, user := range s.users {
+		if matchUser(filter, user) {
+			return i, nil
+		}
+	}
+	return -1, mongo.ErrNoDocuments
+}
+
+func (s *UserStore) GetUser(ctx context.Context, filter db.UserFilter) (*types.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	i, err := s.find(filter)
+	if err != nil {
+		return nil, err
+	}
+	user := *s.users[i]
+	return &user, nil
+}
+
+func (s *UserStore) GetUsers(ctx context.Context, pagination *db.Pagination) ([]*types.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	results := make([]*types.User, 0)
+	for _, user := range paginate(s.users, pagination) {
+		user := *user
+		results = append(results, &user)
+	}
+	return results, nil
+}
+
+func (s *UserStore) CreateUser(ctx context.Context, user *types.User) (*types.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if user.Id.IsZero() {
+		user.Id = primitive.NewObjectID()
+	} else if _, err := s.find(db.UserFilter{Id: user.Id}); err == nil {
+		return nil, fmt.Errorf("duplicate key: %s", user.Id.Hex())
+	}
+	stored := *user
+	s.users = append(s.users, &stored)
+	return user, nil
+}
+
+func (s *UserStore) DeleteUser(ctx context.Context, filter db.UserFilter) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, err := s.find(filter)
+	if err != nil {
+		return "", fmt.Errorf("user not found")
+	}
+	s.users = append(s.users[:i], s.users[i+1:]...)
+	return "", nil
+}
+
+func (s *UserStore) Drop(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users = []*types.User{}
+	return nil
+}
+
+func (s *UserStore) UpdateUser(ctx context.Context, filter db.UserFilter, values types.UpdateUserParams) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, err := s.find(filter)
+	if err != nil {
+		return "", fmt.Errorf("user not found")
+	}
+	s.users[i].FirstName = values.FirstName
+	s.users[i].LastName = values.LastName
+	return "", nil
+}
@@ -0,0 +1,129 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/fabrizioperria/goflight/db"
+	"github.com/fabrizioperria/goflight/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type WaitlistStore struct {
+	mu      sync.RWMutex
+	entries []*types.WaitlistEntry
+}
+
+func NewWaitlistStore() *WaitlistStore {
+	return &WaitlistStore{
+		entries: []*types.WaitlistEntry{},
+	}
+}
+
+func copyWaitlistEntry(entry *types.WaitlistEntry) *types.WaitlistEntry {
+	copied := *entry
+	if entry.Offer != nil {
+		offer := *entry.Offer
+		copied.Offer = &offer
+	}
+	return &copied
+}
+
+// find returns the index of the first entry matching filter. The caller must
+// hold s.mu.
+func (s *WaitlistStore) find(filter db.WaitlistFilter) (int, error) {
+	for i, entry := range s.entries {
+		if matchWaitlistEntry(filter, entry) {
+			return i, nil
+		}
+	}
+	return -1, mongo.ErrNoDocuments
+}
+
+func (s *WaitlistStore) JoinWaitlist(ctx context.Context, entry *types.WaitlistEntry) (*types.WaitlistEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, status := range []types.WaitlistStatus{types.WaitlistWaiting, types.WaitlistOffered} {
+		filter := db.WaitlistFilter{FlightId: entry.FlightId, Class: entry.Class, UserId: entry.UserId, Status: status}
+		if _, err := s.find(filter); err == nil {
+			return nil, types.ErrAlreadyWaitlisted
+		}
+	}
+	if entry.Id.IsZero() {
+		entry.Id = primitive.NewObjectID()
+	} else if _, err := s.find(db.WaitlistFilter{Id: entry.Id}); err == nil {
+		return nil, fmt.Errorf("duplicate key: %s", entry.Id.Hex())
+	}
+	s.entries = append(s.entries, copyWaitlistEntry(entry))
+	return entry, nil
+}
+
+func (s *WaitlistStore) GetWaitlistEntry(ctx context.Context, filter db.WaitlistFilter) (*types.WaitlistEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	i, err := s.find(filter)
+	if err != nil {
+		return nil, err
+	}
+	return copyWaitlistEntry(s.entries[i]), nil
+}
+
+func (s *WaitlistStore) GetWaitlist(ctx context.Context, filter db.WaitlistFilter, pagination *db.Pagination) ([]*types.WaitlistEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	matching := []*types.WaitlistEntry{}
+	for _, entry := range s.entries {
+		if matchWaitlistEntry(filter, entry) {
+			matching = append(matching, entry)
+		}
+	}
+	slices.SortFunc(matching, types.CompareWaitlistEntries)
+	results := make([]*types.WaitlistEntry, 0)
+	for _, entry := range paginate(matching, pagination) {
+		results = append(results, copyWaitlistEntry(entry))
+	}
+	return results, nil
+}
+
+func (s *WaitlistStore) UpdateWaitlistEntry(ctx context.Context, id primitive.ObjectID, from, to types.WaitlistStatus, offer *types.WaitlistOffer) (*types.WaitlistEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, err := s.find(db.WaitlistFilter{Id: id, Status: from})
+	if err != nil {
+		return nil, err
+	}
+	s.entries[i].Status = to
+	s.entries[i].Offer = nil
+	if offer != nil {
+		recorded := *offer
+		s.entries[i].Offer = &recorded
+	}
+	return copyWaitlistEntry(s.entries[i]), nil
+}
+
+func (s *WaitlistStore) DeleteWaitlistEntry(ctx context.Context, filter db.WaitlistFilter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, err := s.find(filter)
+	if err != nil {
+		return fmt.Errorf("waitlist entry not found")
+	}
+	s.entries = append(s.entries[:i], s.entries[i+1:]...)
+	return nil
+}
+
+func (s *WaitlistStore) Drop(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries = []*types.WaitlistEntry{}
+	return nil
+}
@@ -0,0 +1,68 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// stringTimestamps lists, per collection, the fields that used to be stored
+// as RFC3339 strings and are now BSON dates.
+var stringTimestamps = map[string][]string{
+	flightCollection:      {"departure_time", "arrival_time"},
+	reservationCollection: {"reservation_date", "cancellation_date"},
+	bookingCollection:     {"booking_date"},
+}
+
+// MigrateStringTimestamps converts the timestamps stored as RFC3339 strings
+// into BSON dates and gives the flights without time zones the UTC one. It
+// only touches documents still in the old format, so it can be run more than
+// once.
+func MigrateStringTimestamps(ctx context.Context, database *mongo.Database) error {
+	for collection, fields := range stringTimestamps {
+		for _, field := range fields {
+			filter := Map{field: Map{"$type": "string"}}
+			update := []Map{{"$set": Map{field: Map{"$toDate": "$" + field}}}}
+			result, err := database.Collection(collection).UpdateMany(ctx, filter, update)
+			if err != nil {
+				return fmt.Errorf("migrating %s.%s: %w", collection, field, err)
+			}
+			log.Printf("migrated %d %s.%s", result.ModifiedCount, collection, field)
+		}
+	}
+
+	// the history of the status changes holds a timestamp per entry
+	filter := Map{"history.at": Map{"$type": "string"}}
+	at := Map{"$mergeObjects": []any{"$$change", Map{"at": Map{"$toDate": "$$change.at"}}}}
+	update := []Map{{"$set": Map{"history": Map{"$map": Map{"input": "$history", "as": "change", "in": at}}}}}
+	if _, err := database.Collection(reservationCollection).UpdateMany(ctx, filter, update); err != nil {
+		return fmt.Errorf("migrating %s.history: %w", reservationCollection, err)
+	}
+
+	for _, field := range []string{"departure_time_zone", "arrival_time_zone"} {
+		filter := Map{field: Map{"$exists": false}}
+		if _, err := database.Collection(flightCollection).UpdateMany(ctx, filter, Map{"$set": Map{field: "UTC"}}); err != nil {
+			return fmt.Errorf("migrating %s.%s: %w", flightCollection, field, err)
+		}
+	}
+	return nil
+}
+
+// MigrateFloatPrices converts the prices stored as plain numbers into exact
+// amounts in currency, rounded to cents. Like MigrateStringTimestamps, it
+// only touches documents still in the old format.
+func MigrateFloatPrices(ctx context.Context, database *mongo.Database, currency string) error {
+	filter := Map{"price": Map{"$type": []string{"double", "int", "long"}}}
+	amount := Map{"$round": []any{Map{"$toDecimal": "$price"}, 2}}
+	update := []Map{{"$set": Map{"price": Map{"amount": amount, "currency": currency}}}}
+	for _, collection := range []string{seatCollection, reservationCollection} {
+		result, err := database.Collection(collection).UpdateMany(ctx, filter, update)
+		if err != nil {
+			return fmt.Errorf("migrating %s.price: %w", collection, err)
+		}
+		log.Printf("migrated %d %s.price", result.ModifiedCount, collection)
+	}
+	return nil
+}
@@ -27,11 +27,17 @@ func (pagination *Pagination) GetLimit() int64 {
 	return limitNumber
 }
 
+func (pagination *Pagination) GetSkip() int64 {
+	skip := (pagination.GetPage() - 1) * pagination.GetLimit()
+	if skip < 0 {
+		return 0
+	}
+	return skip
+}
+
 func (pagination *Pagination) ToFindOptions() *options.FindOptions {
-	pageNumber := pagination.GetPage()
-	limitNumber := pagination.GetLimit()
 	opts := options.Find()
-	opts.SetLimit(limitNumber)
-	opts.SetSkip((pageNumber - 1) * limitNumber)
+	opts.SetLimit(pagination.GetLimit())
+	opts.SetSkip(pagination.GetSkip())
 	return opts
 }
@@ -0,0 +1,120 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/fabrizioperria/goflight/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PromotionStorer manages the promotions. Their redemptions are counted by
+// the reservation store, in the same transaction as the reservations made
+// with them.
+type PromotionStorer interface {
+	CreatePromotion(ctx context.Context, promotion *types.Promotion) (*types.Promotion, error)
+	GetPromotion(ctx context.Context, filter PromotionFilter) (*types.Promotion, error)
+	GetPromotions(ctx context.Context, pagination *Pagination) ([]*types.Promotion, error)
+	// UpdatePromotion sets params on the promotion matching filter, keeping
+	// its redemptions.
+	UpdatePromotion(ctx context.Context, filter PromotionFilter, params types.PromotionParams) (*types.Promotion, error)
+	DeletePromotion(ctx context.Context, filter PromotionFilter) error
+	Dropper
+}
+
+const (
+	promotionCollection = "promotions"
+)
+
+type MongoDbPromotionStore struct {
+	client     *mongo.Client
+	collection *mongo.Collection
+}
+
+func NewMongoDbPromotionStore(client *mongo.Client) *MongoDbPromotionStore {
+	dbName := os.Getenv("DB_NAME")
+	return &MongoDbPromotionStore{
+		client:     client,
+		collection: client.Database(dbName).Collection(promotionCollection),
+	}
+}
+
+func (db *MongoDbPromotionStore) EnsureIndexes(ctx context.Context) error {
+	_, err := db.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "code", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+func (db *MongoDbPromotionStore) CreatePromotion(ctx context.Context, promotion *types.Promotion) (*types.Promotion, error) {
+	promotion.Code = types.NormalizePromoCode(promotion.Code)
+	result, err := db.collection.InsertOne(ctx, promotion)
+	if err != nil {
+		return nil, err
+	}
+	promotion.Id = result.InsertedID.(primitive.ObjectID)
+	return promotion, nil
+}
+
+func (db *MongoDbPromotionStore) GetPromotion(ctx context.Context, filter PromotionFilter) (*types.Promotion, error) {
+	promotion := &types.Promotion{}
+	if err := db.collection.FindOne(ctx, filter.toBson()).Decode(promotion); err != nil {
+		return nil, err
+	}
+	return promotion, nil
+}
+
+func (db *MongoDbPromotionStore) GetPromotions(ctx context.Context, pagination *Pagination) ([]*types.Promotion, error) {
+	cursor, err := db.collection.Find(ctx, Map{}, pagination.ToFindOptions())
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*types.Promotion, 0)
+	err = cursor.All(ctx, &results)
+	return results, err
+}
+
+func (db *MongoDbPromotionStore) UpdatePromotion(ctx context.Context, filter PromotionFilter, params types.PromotionParams) (*types.Promotion, error) {
+	promotion, err := db.GetPromotion(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	params.Apply(promotion)
+	update := Map{"$set": Map{
+		"code":            promotion.Code,
+		"discount_type":   promotion.DiscountType,
+		"percent":         promotion.Percent,
+		"amount":          promotion.Amount,
+		"routes":          promotion.Routes,
+		"airlines":        promotion.Airlines,
+		"classes":         promotion.Classes,
+		"valid_from":      promotion.ValidFrom,
+		"valid_until":     promotion.ValidUntil,
+		"max_redemptions": promotion.MaxRedemptions,
+		"max_per_user":    promotion.MaxPerUser,
+	}}
+	if _, err := db.collection.UpdateOne(ctx, Map{"_id": promotion.Id}, update); err != nil {
+		return nil, err
+	}
+	return db.GetPromotion(ctx, PromotionFilter{Id: promotion.Id})
+}
+
+func (db *MongoDbPromotionStore) DeletePromotion(ctx context.Context, filter PromotionFilter) error {
+	result, err := db.collection.DeleteOne(ctx, filter.toBson())
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("promotion not found")
+	}
+	return nil
+}
+
+func (db *MongoDbPromotionStore) Drop(ctx context.Context) error {
+	return db.collection.Drop(ctx)
+}
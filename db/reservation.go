@@ -2,36 +2,105 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"time"
 
 	"github.com/fabrizioperria/goflight/types"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
-	"go.mongodb.org/mongo-driver/mongo/readconcern"
-	"go.mongodb.org/mongo-driver/mongo/writeconcern"
 )
 
 type ReservationStorer interface {
-	CreateReservation(ctx context.Context, filter Map, userId primitive.ObjectID) (*types.Reservation, error)
-	GetReservations(ctx context.Context, filter Map, pagination *Pagination) ([]*types.Reservation, error)
-	GetReservation(ctx context.Context, filter Map) (*types.Reservation, error)
-	DeleteReservation(ctx context.Context, filter Map) error
+	// CreateReservation reserves the seat matching filter for passenger,
+	// taking off the discount of the promotion with promoCode, if any, then
+	// what spending says, if anything. The promotion fails the reservation
+	// with types.ErrPromotionNotApplicable or types.ErrPromotionExhausted
+	// when it cannot be redeemed, and the spending with
+	// types.ErrCreditUnavailable or types.ErrPointsUnavailable.
+	CreateReservation(ctx context.Context, filter SeatFilter, userId primitive.ObjectID, passenger *types.Passenger, promoCode string, spending *Spending) (*types.Reservation, error)
+	// CreateUnassignedReservation reserves a seat of class on the flight with
+	// flightId beyond its seats, within its overbooking allowance, priced
+	// like the priciest seat of the class. The seat is assigned when the
+	// passenger checks in. It fails with types.ErrClassNotOffered when the
+	// flight has no seat in class, types.ErrSeatsAvailable when one of them
+	// is still available and types.ErrOverbookingExhausted past the
+	// allowance. The promotion and the spending are applied as by
+	// CreateReservation.
+	CreateUnassignedReservation(ctx context.Context, flightId primitive.ObjectID, class types.SeatClass, userId primitive.ObjectID, passenger *types.Passenger, promoCode string, spending *Spending) (*types.Reservation, error)
+	GetReservations(ctx context.Context, filter ReservationFilter, pagination *Pagination) ([]*types.Reservation, error)
+	GetReservation(ctx context.Context, filter ReservationFilter) (*types.Reservation, error)
+	// CancelReservation cancels the reservation matching filter, giving its
+	// seat back, and records what is refunded for it, issuing credit along
+	// with it. The refund is nil when nothing was paid, and the credit when
+	// none is given.
+	CancelReservation(ctx context.Context, filter ReservationFilter, refund *types.Refund, credit *types.Credit) (*types.Reservation, error)
+	// DenyBoarding denies boarding to the passenger of the reservation
+	// matching filter the same way.
+	DenyBoarding(ctx context.Context, filter ReservationFilter, refund *types.Refund, credit *types.Credit) (*types.Reservation, error)
+	// SettleReservation records that the refund of the reservation matching
+	// filter, the points it earned and the offer of its seat were carried
+	// out after it gave its seat back, which left it unsettled.
+	SettleReservation(ctx context.Context, filter ReservationFilter) (*types.Reservation, error)
+	// UpdateReservationStatus moves the reservation matching filter to
+	// status. Checking in a reservation without a seat assigns it one, and
+	// fails with types.ErrNoSeatToAssign when none is left.
+	UpdateReservationStatus(ctx context.Context, filter ReservationFilter, status types.ReservationStatus) (*types.Reservation, error)
+	// ChangeSeat moves the reservation matching filter to the seat of its
+	// flight matching seatFilter, giving its seat back to the flight, and
+	// prices it like the new seat, recording the difference along with
+	// payment, its charge when the new seat costs more. It fails with
+	// types.ErrSeatNotChangeable when the reservation cannot change seat
+	// anymore, and with types.ErrFareChanged when payment is not for the
+	// difference.
+	ChangeSeat(ctx context.Context, filter ReservationFilter, seatFilter SeatFilter, payment *types.Payment) (*types.Reservation, error)
+	// UpdateReservationPayment records payment on the reservation matching
+	// filter and moves it to the status the payment leads to, if any.
+	UpdateReservationPayment(ctx context.Context, filter ReservationFilter, payment *types.Payment) (*types.Reservation, error)
+	CreateBooking(ctx context.Context, seats []PassengerSeat, userId primitive.ObjectID) (*types.Booking, error)
+	GetBooking(ctx context.Context, filter BookingFilter) (*types.Booking, error)
+	HoldSeat(ctx context.Context, filter SeatFilter, userId primitive.ObjectID, until time.Time) (*types.Seat, error)
+	// ConfirmHold reserves the seat matching filter held by the user with
+	// userId, spending on it as CreateReservation does.
+	ConfirmHold(ctx context.Context, filter SeatFilter, userId primitive.ObjectID, passenger *types.Passenger, spending *Spending) (*types.Reservation, error)
+	ReleaseExpiredHolds(ctx context.Context, now time.Time) (int, error)
 	Dropper
 }
 
+// PassengerSeat is a seat to reserve along with who travels on it.
+type PassengerSeat struct {
+	Seat      SeatFilter
+	Passenger *types.Passenger
+}
+
+// Spending is what a user spends on a reservation as it is made, before
+// paying for the rest: the credit matching Credit, if any, as much of it as
+// the reservation costs, then up to Points of their loyalty points, each
+// taking PointValue off it.
+type Spending struct {
+	Credit     *CreditFilter
+	Points     int
+	PointValue types.Money
+}
+
 type MongoDbReservationStore struct {
 	client      *mongo.Client
 	collection  *mongo.Collection
+	bookings    *mongo.Collection
+	promotions  *mongo.Collection
+	credits     *mongo.Collection
+	loyalty     *mongo.Collection
 	flightStore MongoDbFlightStore
 	seatStore   MongoDbSeatStore
 }
 
 const (
 	reservationCollection = "reservations"
+	bookingCollection     = "bookings"
 )
 
 func NewMongoDbReservationStore(client *mongo.Client, flightStore MongoDbFlightStore, seatStore MongoDbSeatStore) *MongoDbReservationStore {
@@ -39,65 +108,232 @@ func NewMongoDbReservationStore(client *mongo.Client, flightStore MongoDbFlightS
 	return &MongoDbReservationStore{
 		client:      client,
 		collection:  client.Database(dbName).Collection(reservationCollection),
+		bookings:    client.Database(dbName).Collection(bookingCollection),
+		promotions:  client.Database(dbName).Collection(promotionCollection),
+		credits:     client.Database(dbName).Collection(creditCollection),
+		loyalty:     client.Database(dbName).Collection(loyaltyCollection),
 		flightStore: flightStore,
 		seatStore:   seatStore,
 	}
 }
 
-func (db *MongoDbReservationStore) CreateReservation(ctx context.Context, filter Map, userId primitive.ObjectID) (*types.Reservation, error) {
-	session, err := db.client.StartSession()
+func (db *MongoDbReservationStore) EnsureIndexes(ctx context.Context) error {
+	// reservations made before record locators existed have none
+	locatorIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "locator", Value: 1}},
+		Options: options.Index().SetUnique(true).SetSparse(true),
+	}
+	_, err := db.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "flight_id", Value: 1}}},
+		{Keys: bson.D{{Key: "payment.reference", Value: 1}}, Options: options.Index().SetSparse(true)},
+		locatorIndex,
+	})
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer session.EndSession(ctx)
-
-	wc := writeconcern.New(writeconcern.WMajority())
-	rc := readconcern.Snapshot()
-	txnOpts := options.Transaction().SetWriteConcern(wc).SetReadConcern(rc)
+	_, err = db.bookings.Indexes().CreateOne(ctx, locatorIndex)
+	return err
+}
 
-	callback := func(sessionContext mongo.SessionContext) (interface{}, error) {
-		seat, err := db.seatStore.GetSeat(sessionContext, filter)
+// newLocator returns a record locator used by no reservation nor booking. The
+// unique indexes still guard against a concurrent transaction picking the
+// same one.
+func (db *MongoDbReservationStore) newLocator(ctx context.Context) (string, error) {
+	for {
+		locator := types.NewLocator()
+		reservations, err := db.collection.CountDocuments(ctx, Map{"locator": locator})
 		if err != nil {
-			return nil, err
+			return "", err
 		}
-
-		if !seat.Available {
-			return nil, fmt.Errorf("seat not available")
+		bookings, err := db.bookings.CountDocuments(ctx, Map{"locator": locator})
+		if err != nil {
+			return "", err
 		}
-
-		if _, err = db.seatStore.UpdateSeat(sessionContext, filter, types.UpdateSeatParams{Available: false, Price: seat.Price}); err != nil {
-			return nil, err
+		if reservations+bookings == 0 {
+			return locator, nil
 		}
+	}
+}
 
-		filter = Map{"_id": seat.FlightId}
-		update := Map{"$pull": Map{"seats": seat.Id}}
-		_, err = db.flightStore.collection.UpdateOne(sessionContext, filter, update)
-		if err != nil {
-			return nil, err
+// reserveSeat takes the seat matching filter out of the flight's available
+// seats and records a reservation for passenger on it, pending until it is
+// paid for. It must run inside a
+// transaction.
+func (db *MongoDbReservationStore) reserveSeat(sessionContext mongo.SessionContext, filter SeatFilter, userId primitive.ObjectID, bookingId primitive.ObjectID, passenger *types.Passenger) (*types.Reservation, error) {
+	seat, err := db.seatStore.GetSeat(sessionContext, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if !seat.IsAvailable(now) && !seat.IsHeldBy(userId, now) {
+		return nil, fmt.Errorf("seat not available")
+	}
+	if err = db.takeSeat(sessionContext, seat); err != nil {
+		return nil, err
+	}
+
+	reservationParams := types.CreateReservationParams{
+		UserId:    userId,
+		SeatId:    seat.Id,
+		FlightId:  seat.FlightId,
+		Passenger: passenger,
+		Price:     seat.Price,
+		Fare:      seat.Fare,
+	}
+	return db.recordReservation(sessionContext, &reservationParams, bookingId)
+}
+
+// takeSeat marks seat as taken, clearing its hold, and takes it out of the
+// flight's available seats. It must run inside a transaction.
+func (db *MongoDbReservationStore) takeSeat(sessionContext mongo.SessionContext, seat *types.Seat) error {
+	if _, err := db.seatStore.UpdateSeat(sessionContext, SeatFilter{Id: seat.Id}, types.UpdateSeatParams{Available: false, Price: seat.Price}); err != nil {
+		return err
+	}
+	if seat.HeldUntil != nil {
+		if err := db.clearHold(sessionContext, seat.Id); err != nil {
+			return err
 		}
+	}
+
+	flightFilter := FlightFilter{Id: seat.FlightId}
+	update := Map{"$pull": Map{"seats": seat.Id}}
+	_, err := db.flightStore.collection.UpdateOne(sessionContext, flightFilter.toBson(), update)
+	return err
+}
+
+// freeSeat undoes takeSeat for the seat with seatId. It must run inside a
+// transaction.
+func (db *MongoDbReservationStore) freeSeat(sessionContext mongo.SessionContext, seatId primitive.ObjectID) error {
+	seatFilter := SeatFilter{Id: seatId}
+	seat, err := db.seatStore.GetSeat(sessionContext, seatFilter)
+	if err != nil {
+		return err
+	}
+	if _, err = db.seatStore.UpdateSeat(sessionContext, seatFilter, types.UpdateSeatParams{Available: true, Price: seat.Price}); err != nil {
+		return err
+	}
+
+	flightFilter := FlightFilter{Id: seat.FlightId}
+	update := Map{"$push": Map{"seats": seat.Id}}
+	_, err = db.flightStore.collection.UpdateOne(sessionContext, flightFilter.toBson(), update)
+	return err
+}
 
-		reservationParams := types.CreateReservationParams{
-			UserId: userId,
-			SeatId: seat.Id,
+// oversell records a reservation for passenger in class on the flight with
+// flightId, beyond its seats, priced like the priciest seat of the class.
+// The flight's oversold count is only incremented while it is below the
+// allowance, and concurrent reservations conflict on it, so that the
+// allowance holds. It must run inside a transaction.
+func (db *MongoDbReservationStore) oversell(sessionContext mongo.SessionContext, flightId primitive.ObjectID, class types.SeatClass, userId primitive.ObjectID, passenger *types.Passenger) (*types.Reservation, error) {
+	cursor, err := db.seatStore.collection.Find(sessionContext, SeatFilter{FlightId: flightId, Class: class}.toBson())
+	if err != nil {
+		return nil, err
+	}
+	seats := []*types.Seat{}
+	if err = cursor.All(sessionContext, &seats); err != nil {
+		return nil, err
+	}
+	if len(seats) == 0 {
+		return nil, types.ErrClassNotOffered
+	}
+	now := time.Now()
+	for _, seat := range seats {
+		if seat.IsAvailable(now) {
+			return nil, types.ErrSeatsAvailable
 		}
-		reservation := types.ReservationFromParams(&reservationParams)
+	}
 
-		reservation.ReservationDate = time.Now().Format(time.RFC3339)
-		reservation.CancellationDate = ""
-		result, err := db.collection.InsertOne(ctx, reservation)
+	flight, err := db.flightStore.GetFlight(sessionContext, FlightFilter{Id: flightId})
+	if err != nil {
+		return nil, err
+	}
+	if flight.Oversold >= flight.Overbooking {
+		return nil, types.ErrOverbookingExhausted
+	}
+	filter := Map{"_id": flight.Id, "oversold": Map{"$not": Map{"$gte": flight.Overbooking}}}
+	result, err := db.flightStore.collection.UpdateOne(sessionContext, filter, Map{"$inc": Map{"oversold": 1}})
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		return nil, types.ErrOverbookingExhausted
+	}
+
+	priciest := types.PriciestSeat(seats)
+	reservationParams := types.CreateReservationParams{
+		UserId:    userId,
+		Class:     class,
+		FlightId:  flightId,
+		Passenger: passenger,
+		Price:     priciest.Price,
+		Fare:      priciest.Fare,
+	}
+	return db.recordReservation(sessionContext, &reservationParams, primitive.NilObjectID)
+}
+
+// recordReservation records a reservation made from params, pending until it
+// is paid for. It must run inside a transaction.
+func (db *MongoDbReservationStore) recordReservation(sessionContext mongo.SessionContext, params *types.CreateReservationParams, bookingId primitive.ObjectID) (*types.Reservation, error) {
+	reservation := types.ReservationFromParams(params)
+
+	var err error
+	reservation.BookingId = bookingId
+	reservation.ReservationDate = time.Now().UTC()
+	if reservation.Locator, err = db.newLocator(sessionContext); err != nil {
+		return nil, err
+	}
+	reservation.CancellationDate = nil
+	reservation.Status = types.ReservationPending
+	reservation.History = []types.StatusChange{{To: types.ReservationPending, At: reservation.ReservationDate}}
+	result, err := db.collection.InsertOne(sessionContext, reservation)
+	if err != nil {
+		return nil, err
+	}
+	reservation.Id = result.InsertedID.(primitive.ObjectID)
+
+	return reservation, nil
+}
+
+func (db *MongoDbReservationStore) CreateReservation(ctx context.Context, filter SeatFilter, userId primitive.ObjectID, passenger *types.Passenger, promoCode string, spending *Spending) (*types.Reservation, error) {
+	return db.createReservation(ctx, promoCode, spending, func(sessionContext mongo.SessionContext) (*types.Reservation, error) {
+		return db.reserveSeat(sessionContext, filter, userId, primitive.NilObjectID, passenger)
+	})
+}
+
+func (db *MongoDbReservationStore) CreateUnassignedReservation(ctx context.Context, flightId primitive.ObjectID, class types.SeatClass, userId primitive.ObjectID, passenger *types.Passenger, promoCode string, spending *Spending) (*types.Reservation, error) {
+	return db.createReservation(ctx, promoCode, spending, func(sessionContext mongo.SessionContext) (*types.Reservation, error) {
+		return db.oversell(sessionContext, flightId, class, userId, passenger)
+	})
+}
+
+// createReservation records the reservation made by reserve, applies the
+// promotion with promoCode to it, if any, and spends what spending says on
+// it, in one transaction.
+func (db *MongoDbReservationStore) createReservation(ctx context.Context, promoCode string, spending *Spending, reserve func(mongo.SessionContext) (*types.Reservation, error)) (*types.Reservation, error) {
+	callback := func(sessionContext mongo.SessionContext) (interface{}, error) {
+		reservation, err := reserve(sessionContext)
 		if err != nil {
 			return nil, err
 		}
-		reservation.Id = result.InsertedID.(primitive.ObjectID)
-
+		if promoCode != "" {
+			if err = db.applyPromotion(sessionContext, reservation, promoCode); err != nil {
+				return nil, err
+			}
+		}
+		if spending != nil {
+			if err = db.spend(sessionContext, reservation, spending); err != nil {
+				return nil, err
+			}
+		}
 		return reservation.Id, nil
 	}
 
-	reservationId, err := session.WithTransaction(ctx, callback, txnOpts)
+	reservationId, err := withSnapshotTxn(ctx, db.client, callback)
 	if err != nil {
 		return nil, err
 	}
-	reservation, err := db.GetReservation(ctx, Map{"_id": reservationId.(primitive.ObjectID)})
+	reservation, err := db.GetReservation(ctx, ReservationFilter{Id: reservationId.(primitive.ObjectID)})
 	if err != nil {
 		return nil, err
 	}
@@ -105,9 +341,117 @@ func (db *MongoDbReservationStore) CreateReservation(ctx context.Context, filter
 	return reservation, nil
 }
 
-func (db *MongoDbReservationStore) GetReservations(ctx context.Context, filter Map, pagination *Pagination) ([]*types.Reservation, error) {
+// applyPromotion takes the discount of the promotion with code off
+// reservation and counts its redemption. The update only matches while the
+// promotion is below its caps, and concurrent redemptions conflict on it, so
+// that the caps hold. It must run inside a transaction.
+func (db *MongoDbReservationStore) applyPromotion(sessionContext mongo.SessionContext, reservation *types.Reservation, code string) error {
+	promotion := &types.Promotion{}
+	err := db.promotions.FindOne(sessionContext, PromotionFilter{Code: code}.toBson()).Decode(promotion)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return fmt.Errorf("%w: unknown code %s", types.ErrPromotionNotApplicable, types.NormalizePromoCode(code))
+	}
+	if err != nil {
+		return err
+	}
+	flight, err := db.flightStore.GetFlight(sessionContext, FlightFilter{Id: reservation.FlightId})
+	if err != nil {
+		return err
+	}
+	// the reservations without a seat are discounted like any seat of their
+	// class
+	seat := &types.Seat{Class: reservation.Class}
+	if reservation.IsAssigned() {
+		if seat, err = db.seatStore.GetSeat(sessionContext, SeatFilter{Id: reservation.SeatId}); err != nil {
+			return err
+		}
+	}
+	discount, err := promotion.Discount(flight, seat, reservation.BaseFare(), reservation.UserId, time.Now())
+	if err != nil {
+		return err
+	}
+
+	redeemedBy := "redeemed_by." + reservation.UserId.Hex()
+	filter := Map{"_id": promotion.Id}
+	if promotion.MaxRedemptions > 0 {
+		filter["redemptions"] = Map{"$lt": promotion.MaxRedemptions}
+	}
+	if promotion.MaxPerUser > 0 {
+		filter[redeemedBy] = Map{"$not": Map{"$gte": promotion.MaxPerUser}}
+	}
+	result, err := db.promotions.UpdateOne(sessionContext, filter, Map{"$inc": Map{"redemptions": 1, redeemedBy: 1}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return types.ErrPromotionExhausted
+	}
+
+	reservation.Promotion = &types.AppliedPromotion{PromotionId: promotion.Id, Code: promotion.Code, Discount: discount}
+	_, err = db.collection.UpdateOne(sessionContext, Map{"_id": reservation.Id}, Map{"$set": Map{"promotion": reservation.Promotion}})
+	return err
+}
+
+// spend spends what spending says on reservation and records it on it. The
+// credit and the loyalty account are read and written in the transaction,
+// so that concurrent spendings conflict on them. It must run inside a
+// transaction.
+func (db *MongoDbReservationStore) spend(sessionContext mongo.SessionContext, reservation *types.Reservation, spending *Spending) error {
+	now := time.Now()
+	spent := Map{}
+	if spending.Credit != nil {
+		credit := &types.Credit{}
+		if err := db.credits.FindOne(sessionContext, spending.Credit.toBson()).Decode(credit); err != nil {
+			return err
+		}
+		redemption, err := credit.Redeem(reservation.AmountDue(), reservation.Id, now)
+		if err != nil {
+			return err
+		}
+		update := Map{
+			"$set":  Map{"balance": credit.Balance},
+			"$push": Map{"redemptions": redemption},
+		}
+		if _, err = db.credits.UpdateOne(sessionContext, Map{"_id": credit.Id}, update); err != nil {
+			return err
+		}
+		reservation.Credit = redemption
+		spent["credit"] = redemption
+	}
+	if spending.Points > 0 {
+		account := &types.LoyaltyAccount{}
+		err := db.loyalty.FindOne(sessionContext, Map{"user_id": reservation.UserId}).Decode(account)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return types.ErrPointsUnavailable
+		}
+		if err != nil {
+			return err
+		}
+		read := len(account.Activity)
+		redemption, err := account.Pay(spending.Points, spending.PointValue, reservation.AmountDue(), reservation.Id, now)
+		if err != nil {
+			return err
+		}
+		update := Map{
+			"$set":  Map{"points": account.Points},
+			"$push": Map{"activity": Map{"$each": account.Activity[read:]}},
+		}
+		if _, err = db.loyalty.UpdateOne(sessionContext, Map{"_id": account.Id}, update); err != nil {
+			return err
+		}
+		reservation.Loyalty = redemption
+		spent["loyalty"] = redemption
+	}
+	if len(spent) == 0 {
+		return nil
+	}
+	_, err := db.collection.UpdateOne(sessionContext, Map{"_id": reservation.Id}, Map{"$set": spent})
+	return err
+}
+
+func (db *MongoDbReservationStore) GetReservations(ctx context.Context, filter ReservationFilter, pagination *Pagination) ([]*types.Reservation, error) {
 	var reservations []*types.Reservation
-	cursor, err := db.collection.Find(ctx, filter, pagination.ToFindOptions())
+	cursor, err := db.collection.Find(ctx, filter.toBson(), pagination.ToFindOptions())
 	if err != nil {
 		return nil, err
 	}
@@ -118,63 +462,290 @@ func (db *MongoDbReservationStore) GetReservations(ctx context.Context, filter M
 	return reservations, nil
 }
 
-func (db *MongoDbReservationStore) GetReservation(ctx context.Context, filter Map) (*types.Reservation, error) {
+func (db *MongoDbReservationStore) GetReservation(ctx context.Context, filter ReservationFilter) (*types.Reservation, error) {
 	var reservation *types.Reservation
-	err := db.collection.FindOne(ctx, filter).Decode(&reservation)
+	err := db.collection.FindOne(ctx, filter.toBson()).Decode(&reservation)
 	if err != nil {
 		return nil, err
 	}
 	return reservation, nil
 }
 
-func (db *MongoDbReservationStore) DeleteReservation(ctx context.Context, filter Map) error {
-	session, err := db.client.StartSession()
+func (db *MongoDbReservationStore) CancelReservation(ctx context.Context, filter ReservationFilter, refund *types.Refund, credit *types.Credit) (*types.Reservation, error) {
+	return db.endReservation(ctx, filter, types.ReservationCancelled, refund, credit)
+}
+
+func (db *MongoDbReservationStore) DenyBoarding(ctx context.Context, filter ReservationFilter, refund *types.Refund, credit *types.Credit) (*types.Reservation, error) {
+	return db.endReservation(ctx, filter, types.ReservationDeniedBoarding, refund, credit)
+}
+
+// endReservation moves the reservation matching filter to status, which
+// releases its seat, records refund on it and issues credit, if any, in one
+// transaction.
+func (db *MongoDbReservationStore) endReservation(ctx context.Context, filter ReservationFilter, status types.ReservationStatus, refund *types.Refund, credit *types.Credit) (*types.Reservation, error) {
+	callback := func(sessionContext mongo.SessionContext) (interface{}, error) {
+		reservation, err := db.transitionReservation(sessionContext, filter, status)
+		if err != nil {
+			return nil, err
+		}
+		if credit != nil {
+			if credit.Redemptions == nil {
+				credit.Redemptions = []types.CreditRedemption{}
+			}
+			if _, err = db.credits.InsertOne(sessionContext, credit); err != nil {
+				return nil, err
+			}
+		}
+		if refund == nil {
+			return reservation, nil
+		}
+		if _, err = db.collection.UpdateOne(sessionContext, Map{"_id": reservation.Id}, Map{"$set": Map{"refund": refund}}); err != nil {
+			return nil, err
+		}
+		return db.GetReservation(sessionContext, ReservationFilter{Id: reservation.Id})
+	}
+	reservation, err := withSnapshotTxn(ctx, db.client, callback)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer session.EndSession(ctx)
+	return reservation.(*types.Reservation), nil
+}
 
-	wc := writeconcern.New(writeconcern.WMajority())
-	rc := readconcern.Snapshot()
-	txnOpts := options.Transaction().SetWriteConcern(wc).SetReadConcern(rc)
+func (db *MongoDbReservationStore) SettleReservation(ctx context.Context, filter ReservationFilter) (*types.Reservation, error) {
+	var reservation *types.Reservation
+	update := Map{"$unset": Map{"unsettled": ""}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := db.collection.FindOneAndUpdate(ctx, filter.toBson(), update, opts).Decode(&reservation)
+	if err != nil {
+		return nil, err
+	}
+	return reservation, nil
+}
 
+func (db *MongoDbReservationStore) UpdateReservationStatus(ctx context.Context, filter ReservationFilter, status types.ReservationStatus) (*types.Reservation, error) {
 	callback := func(sessionContext mongo.SessionContext) (interface{}, error) {
-		reservation, err := db.GetReservation(ctx, filter)
+		return db.transitionReservation(sessionContext, filter, status)
+	}
+	reservation, err := withSnapshotTxn(ctx, db.client, callback)
+	if err != nil {
+		return nil, err
+	}
+	return reservation.(*types.Reservation), nil
+}
+
+func (db *MongoDbReservationStore) UpdateReservationPayment(ctx context.Context, filter ReservationFilter, payment *types.Payment) (*types.Reservation, error) {
+	callback := func(sessionContext mongo.SessionContext) (interface{}, error) {
+		reservation, err := db.GetReservation(sessionContext, filter)
 		if err != nil {
 			return nil, err
 		}
-
-		if reservation.CancellationDate != "" {
-			return nil, fmt.Errorf("reservation already cancelled")
+		if _, err = db.collection.UpdateOne(sessionContext, Map{"_id": reservation.Id}, Map{"$set": Map{"payment": payment}}); err != nil {
+			return nil, err
+		}
+		status := payment.Status.ReservationStatus(reservation.CurrentStatus())
+		if status == "" {
+			return db.GetReservation(sessionContext, ReservationFilter{Id: reservation.Id})
 		}
+		return db.transitionReservation(sessionContext, ReservationFilter{Id: reservation.Id}, status)
+	}
+	reservation, err := withSnapshotTxn(ctx, db.client, callback)
+	if err != nil {
+		return nil, err
+	}
+	return reservation.(*types.Reservation), nil
+}
 
-		seatFilter := Map{"_id": reservation.SeatId}
-		seat, err := db.seatStore.GetSeat(ctx, seatFilter)
+// transitionReservation moves the reservation matching filter to status,
+// giving its seat back to the flight when status releases it, or its place
+// back to the overbooking allowance when it has none. A reservation without
+// a seat is assigned one when it checks in, and one giving its seat back is
+// left unsettled. It fails with a *types.TransitionError when the move is not
+// allowed. It must run inside a transaction.
+func (db *MongoDbReservationStore) transitionReservation(sessionContext mongo.SessionContext, filter ReservationFilter, status types.ReservationStatus) (*types.Reservation, error) {
+	reservation, err := db.GetReservation(sessionContext, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	from := reservation.CurrentStatus()
+	if !from.CanTransitionTo(status) {
+		return nil, &types.TransitionError{From: from, To: status}
+	}
+
+	set := Map{"status": status}
+	switch {
+	case status.ReleasesSeat() && !reservation.IsAssigned():
+		if err = db.unoversell(sessionContext, reservation.FlightId); err != nil {
+			return nil, err
+		}
+	case status.ReleasesSeat():
+		if err = db.freeSeat(sessionContext, reservation.SeatId); err != nil {
+			return nil, err
+		}
+	case status == types.ReservationCheckedIn && !reservation.IsAssigned():
+		seatId, err := db.assignSeat(sessionContext, reservation)
 		if err != nil {
 			return nil, err
 		}
+		set["seat_id"] = seatId
+	}
+
+	if status.ReleasesSeat() {
+		set["unsettled"] = true
+	}
+	change := types.StatusChange{From: from, To: status, At: time.Now().UTC()}
+	if status == types.ReservationCancelled {
+		set["cancellation_date"] = change.At
+	}
+	update := Map{"$set": set, "$push": Map{"history": change}}
+	if _, err = db.collection.UpdateOne(sessionContext, Map{"_id": reservation.Id}, update); err != nil {
+		return nil, err
+	}
+	return db.GetReservation(sessionContext, ReservationFilter{Id: reservation.Id})
+}
+
+// assignSeat takes an available seat of the class of reservation, which has
+// none, out of the flight's available seats, counting the reservation out of
+// the oversold ones, and returns its id. It fails with
+// types.ErrNoSeatToAssign when no seat of the class is left. It must run
+// inside a transaction.
+func (db *MongoDbReservationStore) assignSeat(sessionContext mongo.SessionContext, reservation *types.Reservation) (primitive.ObjectID, error) {
+	available := true
+	seatFilter := SeatFilter{FlightId: reservation.FlightId, Class: reservation.Class, Available: &available}
+	seat, err := db.seatStore.GetSeat(sessionContext, seatFilter)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return primitive.NilObjectID, types.ErrNoSeatToAssign
+	}
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
 
-		if _, err = db.seatStore.UpdateSeat(ctx, seatFilter, types.UpdateSeatParams{Available: true, Price: seat.Price}); err != nil {
+	if err = db.takeSeat(sessionContext, seat); err != nil {
+		return primitive.NilObjectID, err
+	}
+	if err = db.unoversell(sessionContext, reservation.FlightId); err != nil {
+		return primitive.NilObjectID, err
+	}
+	return seat.Id, nil
+}
+
+// unoversell gives the place of a reservation sold beyond the seats of the
+// flight with flightId back to its overbooking allowance. It must run inside
+// a transaction.
+func (db *MongoDbReservationStore) unoversell(sessionContext mongo.SessionContext, flightId primitive.ObjectID) error {
+	flightFilter := FlightFilter{Id: flightId}
+	_, err := db.flightStore.collection.UpdateOne(sessionContext, flightFilter.toBson(), Map{"$inc": Map{"oversold": -1}})
+	return err
+}
+
+func (db *MongoDbReservationStore) ChangeSeat(ctx context.Context, filter ReservationFilter, seatFilter SeatFilter, payment *types.Payment) (*types.Reservation, error) {
+	callback := func(sessionContext mongo.SessionContext) (interface{}, error) {
+		reservation, err := db.GetReservation(sessionContext, filter)
+		if err != nil {
+			return nil, err
+		}
+		if !reservation.CurrentStatus().CanChangeSeat() {
+			return nil, types.ErrSeatNotChangeable
+		}
+		seatFilter.FlightId = reservation.FlightId
+		seat, err := db.seatStore.GetSeat(sessionContext, seatFilter)
+		if err != nil {
 			return nil, err
 		}
+		now := time.Now()
+		if seat.Id == reservation.SeatId || (!seat.IsAvailable(now) && !seat.IsHeldBy(reservation.UserId, now)) {
+			return nil, fmt.Errorf("seat not available")
+		}
 
-		flightFilter := Map{"_id": seat.FlightId}
-		update := Map{"$push": Map{"seats": seat.Id}}
-		_, err = db.flightStore.collection.UpdateOne(sessionContext, flightFilter, update)
+		from := reservation.SeatId
+		change, err := reservation.ChangeSeat(seat, payment, now)
 		if err != nil {
 			return nil, err
 		}
+		if from.IsZero() {
+			err = db.unoversell(sessionContext, reservation.FlightId)
+		} else {
+			err = db.freeSeat(sessionContext, from)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err = db.takeSeat(sessionContext, seat); err != nil {
+			return nil, err
+		}
 
-		result, err := db.collection.UpdateOne(ctx, filter, Map{"$set": Map{"cancellation_date": time.Now().Format(time.RFC3339)}})
+		set := Map{"seat_id": reservation.SeatId, "price": reservation.Price, "fare": reservation.Fare}
+		if reservation.Class != 0 {
+			set["class"] = reservation.Class
+		}
+		update := Map{"$set": set, "$push": Map{"seat_changes": change}}
+		if _, err = db.collection.UpdateOne(sessionContext, Map{"_id": reservation.Id}, update); err != nil {
+			return nil, err
+		}
+		return db.GetReservation(sessionContext, ReservationFilter{Id: reservation.Id})
+	}
+	reservation, err := withSnapshotTxn(ctx, db.client, callback)
+	if err != nil {
+		return nil, err
+	}
+	return reservation.(*types.Reservation), nil
+}
+
+func (db *MongoDbReservationStore) CreateBooking(ctx context.Context, seats []PassengerSeat, userId primitive.ObjectID) (*types.Booking, error) {
+	callback := func(sessionContext mongo.SessionContext) (interface{}, error) {
+		booking := &types.Booking{
+			Id:             primitive.NewObjectID(),
+			UserId:         userId,
+			ReservationIds: []primitive.ObjectID{},
+			BookingDate:    time.Now().UTC(),
+		}
+		locator, err := db.newLocator(sessionContext)
 		if err != nil {
 			return nil, err
 		}
-		return result.UpsertedID, nil
+		booking.Locator = locator
+		for _, seat := range seats {
+			reservation, err := db.reserveSeat(sessionContext, seat.Seat, userId, booking.Id, seat.Passenger)
+			if err != nil {
+				return nil, err
+			}
+			booking.ReservationIds = append(booking.ReservationIds, reservation.Id)
+		}
+
+		if _, err := db.bookings.InsertOne(sessionContext, booking); err != nil {
+			return nil, err
+		}
+		return booking.Id, nil
 	}
-	_, err = session.WithTransaction(ctx, callback, txnOpts)
-	return err
+
+	bookingId, err := withSnapshotTxn(ctx, db.client, callback)
+	if err != nil {
+		return nil, err
+	}
+	return db.GetBooking(ctx, BookingFilter{Id: bookingId.(primitive.ObjectID)})
+}
+
+func (db *MongoDbReservationStore) GetBooking(ctx context.Context, filter BookingFilter) (*types.Booking, error) {
+	var booking types.Booking
+	if err := db.bookings.FindOne(ctx, filter.toBson()).Decode(&booking); err != nil {
+		return nil, err
+	}
+
+	cursor, err := db.collection.Find(ctx, ReservationFilter{BookingId: booking.Id}.toBson())
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	booking.Reservations = []*types.Reservation{}
+	if err = cursor.All(ctx, &booking.Reservations); err != nil {
+		return nil, err
+	}
+	return &booking, nil
 }
 
 func (db *MongoDbReservationStore) Drop(ctx context.Context) error {
+	if err := db.bookings.Drop(ctx); err != nil {
+		return err
+	}
 	return db.collection.Drop(ctx)
 }
@@ -2,18 +2,28 @@ package db
 
 import (
 	"context"
+	"fmt"
 	"os"
 
 	"github.com/fabrizioperria/goflight/types"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type SeatStorer interface {
-	CreateSeat(ctx context.Context, user *types.Seat) (*types.Seat, error)
-	UpdateSeat(ctx context.Context, filter Map, values types.UpdateSeatParams) (string, error)
-	GetSeats(ctx context.Context, filter Map, pagination *Pagination) ([]*types.Seat, error)
-	GetSeat(ctx context.Context, filter Map) (*types.Seat, error)
+	// CreateSeat creates the seat and lists it in its flight.
+	CreateSeat(ctx context.Context, seat *types.Seat) (*types.Seat, error)
+	// CreateSeats creates the seats in a single write, all or nothing. It
+	// does not list them in their flights.
+	CreateSeats(ctx context.Context, seats []*types.Seat) ([]*types.Seat, error)
+	UpdateSeat(ctx context.Context, filter SeatFilter, values types.UpdateSeatParams) (string, error)
+	// UpdateSeatPrices sets the prices and fares of the seats by id in a
+	// single write, skipping the seats that are no longer available.
+	UpdateSeatPrices(ctx context.Context, seats []*types.Seat) error
+	GetSeats(ctx context.Context, filter SeatFilter, pagination *Pagination) ([]*types.Seat, error)
+	GetSeat(ctx context.Context, filter SeatFilter) (*types.Seat, error)
 	Dropper
 }
 
@@ -36,29 +46,85 @@ func NewMongoDbSeatStore(client *mongo.Client, flightStore MongoDbFlightStore) *
 	}
 }
 
+func (db *MongoDbSeatStore) EnsureIndexes(ctx context.Context) error {
+	_, err := db.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "flight_id", Value: 1}, {Key: "available", Value: 1}}},
+		// the hold sweeper only looks at held seats
+		{Keys: bson.D{{Key: "held_until", Value: 1}}, Options: options.Index().SetSparse(true)},
+	})
+	return err
+}
+
 func (db *MongoDbSeatStore) CreateSeat(ctx context.Context, seat *types.Seat) (*types.Seat, error) {
-	result, err := db.collection.InsertOne(ctx, seat)
-	if err != nil {
+	callback := func(sessionContext mongo.SessionContext) (interface{}, error) {
+		if err := insertSeats(sessionContext, db.collection, []*types.Seat{seat}); err != nil {
+			return nil, err
+		}
+		update := Map{"$addToSet": Map{"seats": seat.Id}}
+		return db.flightStore.collection.UpdateOne(sessionContext, Map{"_id": seat.FlightId}, update)
+	}
+
+	if _, err := withSnapshotTxn(ctx, db.client, callback); err != nil {
 		return nil, err
 	}
-	seat.Id = result.InsertedID.(primitive.ObjectID)
+	return seat, nil
+}
 
-	filter := Map{"_id": result.InsertedID}
-	update := Map{"$addToSet": Map{"seats": seat}}
-	_, err = db.flightStore.collection.UpdateOne(ctx, filter, update)
-	if err != nil {
+// insertSeats gives the seats without an id one and inserts them with a
+// single InsertMany.
+func insertSeats(ctx context.Context, collection *mongo.Collection, seats []*types.Seat) error {
+	if len(seats) == 0 {
+		return nil
+	}
+	documents := make([]interface{}, 0, len(seats))
+	for _, seat := range seats {
+		if seat.Id.IsZero() {
+			seat.Id = primitive.NewObjectID()
+		}
+		documents = append(documents, seat)
+	}
+	_, err := collection.InsertMany(ctx, documents)
+	return err
+}
+
+func (db *MongoDbSeatStore) CreateSeats(ctx context.Context, seats []*types.Seat) ([]*types.Seat, error) {
+	// a failed InsertMany may leave the seats before the failing one, unless
+	// it runs in a transaction
+	callback := func(sessionContext mongo.SessionContext) (interface{}, error) {
+		return nil, insertSeats(sessionContext, db.collection, seats)
+	}
+
+	if _, err := withSnapshotTxn(ctx, db.client, callback); err != nil {
 		return nil, err
 	}
+	return seats, nil
+}
 
-	return seat, err
+func (db *MongoDbSeatStore) UpdateSeatPrices(ctx context.Context, seats []*types.Seat) error {
+	if len(seats) == 0 {
+		return nil
+	}
+	available := true
+	models := make([]mongo.WriteModel, 0, len(seats))
+	for _, seat := range seats {
+		filter := SeatFilter{Id: seat.Id, Available: &available}
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(filter.toBson()).
+			SetUpdate(Map{"$set": Map{"price": seat.Price, "fare": seat.Fare}}))
+	}
+	_, err := db.collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	return err
 }
 
-func (db *MongoDbSeatStore) UpdateSeat(ctx context.Context, filter Map, values types.UpdateSeatParams) (string, error) {
+func (db *MongoDbSeatStore) UpdateSeat(ctx context.Context, filter SeatFilter, values types.UpdateSeatParams) (string, error) {
 	update := Map{"$set": values}
-	result, err := db.collection.UpdateOne(ctx, filter, update)
-	if err != nil || result.ModifiedCount == 0 {
+	result, err := db.collection.UpdateOne(ctx, filter.toBson(), update)
+	if err != nil {
 		return "", err
 	}
+	if result.MatchedCount == 0 {
+		return "", fmt.Errorf("seat not found")
+	}
 
 	return "", nil
 }
@@ -67,9 +133,9 @@ func (db *MongoDbSeatStore) Drop(ctx context.Context) error {
 	return db.collection.Drop(ctx)
 }
 
-func (db *MongoDbSeatStore) GetSeats(ctx context.Context, filter Map, pagination *Pagination) ([]*types.Seat, error) {
+func (db *MongoDbSeatStore) GetSeats(ctx context.Context, filter SeatFilter, pagination *Pagination) ([]*types.Seat, error) {
 	var cursor *mongo.Cursor
-	cursor, err := db.collection.Find(ctx, filter, pagination.ToFindOptions())
+	cursor, err := db.collection.Find(ctx, filter.toBson(), pagination.ToFindOptions())
 	if err != nil {
 		return nil, err
 	}
@@ -80,9 +146,9 @@ func (db *MongoDbSeatStore) GetSeats(ctx context.Context, filter Map, pagination
 	return results, err
 }
 
-func (db *MongoDbSeatStore) GetSeat(ctx context.Context, filter Map) (*types.Seat, error) {
+func (db *MongoDbSeatStore) GetSeat(ctx context.Context, filter SeatFilter) (*types.Seat, error) {
 	var seat types.Seat
-	err := db.collection.FindOne(ctx, filter).Decode(&seat)
+	err := db.collection.FindOne(ctx, filter.toBson()).Decode(&seat)
 	if err != nil {
 		return nil, err
 	}
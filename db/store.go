@@ -5,13 +5,25 @@ type Store struct {
 	Flight      FlightStorer
 	Seat        SeatStorer
 	Reservation ReservationStorer
+	Airport     AirportStorer
+	Aircraft    AircraftStorer
+	Credit      CreditStorer
+	Promotion   PromotionStorer
+	Loyalty     LoyaltyStorer
+	Waitlist    WaitlistStorer
 }
 
-func NewStore(user UserStorer, flight FlightStorer, seat SeatStorer, reservation ReservationStorer) *Store {
+func NewStore(user UserStorer, flight FlightStorer, seat SeatStorer, reservation ReservationStorer, airport AirportStorer, aircraft AircraftStorer, credit CreditStorer, promotion PromotionStorer, loyalty LoyaltyStorer, waitlist WaitlistStorer) *Store {
 	return &Store{
 		User:        user,
 		Flight:      flight,
 		Seat:        seat,
 		Reservation: reservation,
+		Airport:     airport,
+		Aircraft:    aircraft,
+		Credit:      credit,
+		Promotion:   promotion,
+		Loyalty:     loyalty,
+		Waitlist:    waitlist,
 	}
 }
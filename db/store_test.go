@@ -0,0 +1,63 @@
+package db_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/fabrizioperria/goflight/db"
+	"github.com/fabrizioperria/goflight/db/storetest"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	testUri    = "mongodb://localhost:27017"
+	testDbName = "goflight_test"
+)
+
+// TestMongoDbConformance runs against the replica set started by `make run`
+// and is skipped when no mongo instance is reachable, unless MONGO_TEST_URL
+// points at one as it does in CI.
+func TestMongoDbConformance(t *testing.T) {
+	uri := os.Getenv("MONGO_TEST_URL")
+	skip := t.Fatalf
+	if uri == "" {
+		uri = testUri
+		skip = t.Skipf
+	}
+	t.Setenv("DB_NAME", testDbName)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri).SetServerSelectionTimeout(2*time.Second))
+	if err != nil {
+		skip("mongo not available: %v", err)
+	}
+	defer client.Disconnect(context.Background())
+	if err := client.Ping(ctx, nil); err != nil {
+		skip("mongo not available: %v", err)
+	}
+
+	storetest.RunConformance(t, func(t *testing.T) *db.Store {
+		userStore := db.NewMongoDbUserStore(client)
+		flightStore := db.NewMongoDbFlightStore(client)
+		seatStore := db.NewMongoDbSeatStore(client, *flightStore)
+		reservationStore := db.NewMongoDbReservationStore(client, *flightStore, *seatStore)
+		airportStore := db.NewMongoDbAirportStore(client)
+		aircraftStore := db.NewMongoDbAircraftStore(client)
+		creditStore := db.NewMongoDbCreditStore(client)
+		promotionStore := db.NewMongoDbPromotionStore(client)
+		loyaltyStore := db.NewMongoDbLoyaltyStore(client)
+		waitlistStore := db.NewMongoDbWaitlistStore(client)
+		// the stores are dropped after each test, their indexes along
+		if err := promotionStore.EnsureIndexes(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if err := loyaltyStore.EnsureIndexes(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return db.NewStore(userStore, flightStore, seatStore, reservationStore, airportStore, aircraftStore, creditStore, promotionStore, loyaltyStore, waitlistStore)
+	})
+}
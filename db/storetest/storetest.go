@@ -0,0 +1,1590 @@
+// Package storetest holds the behavioral spec every db.Store backend has to
+// satisfy. A backend proves it is interchangeable with the mongo one by
+// calling RunConformance from its own tests.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fabrizioperria/goflight/db"
+	"github.com/fabrizioperria/goflight/types"
+	"github.com/govalues/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Factory returns an empty store, apart from reference data such as the
+// airports which the store may come loaded with. It is called once per test case and the
+// store is dropped when the case ends.
+type Factory func(t *testing.T) *db.Store
+
+func RunConformance(t *testing.T, factory Factory) {
+	tests := map[string]func(t *testing.T, store *db.Store){
+		"Users":             testUsers,
+		"Flights":           testFlights,
+		"FlightFilters":     testFlightFilters,
+		"FlightSearch":      testFlightSearch,
+		"Seats":             testSeats,
+		"FlightWithSeats":   testFlightWithSeats,
+		"Reservations":      testReservations,
+		"ReservationStatus": testReservationStatus,
+		"Payments":          testPayments,
+		"Credits":           testCredits,
+		"Promotions":        testPromotions,
+		"Loyalty":           testLoyalty,
+		"Waitlist":          testWaitlist,
+		"Overbooking":       testOverbooking,
+		"SeatChange":        testSeatChange,
+		"Bookings":          testBookings,
+		"Holds":             testHolds,
+		"Airports":          testAirports,
+		"Aircraft":          testAircraft,
+		"Pagination":        testPagination,
+		"Drop":              testDrop,
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			store := factory(t)
+			defer drop(t, store)
+			test(t, store)
+		})
+	}
+}
+
+func drop(t *testing.T, store *db.Store) {
+	ctx := context.Background()
+	for _, dropper := range []db.Dropper{store.User, store.Flight, store.Seat, store.Reservation, store.Airport, store.Aircraft, store.Credit, store.Promotion, store.Loyalty, store.Waitlist} {
+		if err := dropper.Drop(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func newUser(t *testing.T, store *db.Store, email string) *types.User {
+	user, err := store.User.CreateUser(context.Background(), &types.User{
+		FirstName: "Frank",
+		LastName:  "Potato",
+		Email:     email,
+		Phone:     "123456789",
+	})
+	require.NoError(t, err)
+	return user
+}
+
+func newFlight(t *testing.T, store *db.Store, numberOfSeats int) (*types.Flight, []*types.Seat) {
+	prices := make([]string, numberOfSeats)
+	for i := range prices {
+		prices[i] = "100"
+	}
+	return newFlightWithPrices(t, store, types.CreateFlightParams{
+		Airline:       "Delta",
+		Departure:     "JFK",
+		Arrival:       "LAX",
+		DepartureTime: time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339),
+		ArrivalTime:   time.Now().Add(30 * time.Hour).UTC().Format(time.RFC3339),
+	}, prices)
+}
+
+func usd(amount string) types.Money {
+	return types.MustParseMoney(amount, "USD")
+}
+
+func fareOf(t *testing.T, price types.Money) *types.FareBreakdown {
+	tax, err := price.Mul(decimal.MustParse("0.075"))
+	require.NoError(t, err)
+	fare, err := types.NewFareBreakdown(price,
+		[]types.FareComponent{{Code: "US", Name: "Transportation tax", Amount: tax}},
+		nil,
+		[]types.FareComponent{{Code: "OB", Name: "Booking fee", Amount: usd("5")}})
+	require.NoError(t, err)
+	return fare
+}
+
+func newFlightWithPrices(t *testing.T, store *db.Store, params types.CreateFlightParams, prices []string) (*types.Flight, []*types.Seat) {
+	ctx := context.Background()
+	flight, err := types.NewFlightFromParams(params)
+	require.NoError(t, err)
+	flight, err = store.Flight.CreateFlight(ctx, flight)
+	require.NoError(t, err)
+
+	seats := []*types.Seat{}
+	seatIds := []primitive.ObjectID{}
+	for i, price := range prices {
+		seat, err := store.Seat.CreateSeat(ctx, &types.Seat{
+			FlightId:  flight.Id,
+			Number:    i,
+			Price:     usd(price),
+			Class:     types.Economy,
+			Location:  types.Aisle,
+			Available: true,
+		})
+		require.NoError(t, err)
+		seats = append(seats, seat)
+		seatIds = append(seatIds, seat.Id)
+	}
+
+	// each seat is listed in the flight as it is created
+	flight, err = store.Flight.GetFlight(ctx, db.FlightFilter{Id: flight.Id})
+	require.NoError(t, err)
+	require.ElementsMatch(t, seatIds, flight.Seats)
+	return flight, seats
+}
+
+func testUsers(t *testing.T, store *db.Store) {
+	ctx := context.Background()
+	user := newUser(t, store, "fp@test.com")
+	assert.False(t, user.Id.IsZero())
+
+	byId, err := store.User.GetUser(ctx, db.UserFilter{Id: user.Id})
+	require.NoError(t, err)
+	assert.Equal(t, *user, *byId)
+
+	byEmail, err := store.User.GetUser(ctx, db.UserFilter{Email: user.Email})
+	require.NoError(t, err)
+	assert.Equal(t, user.Id, byEmail.Id)
+
+	_, err = store.User.GetUser(ctx, db.UserFilter{Id: primitive.NewObjectID()})
+	assert.Error(t, err)
+
+	_, err = store.User.UpdateUser(ctx, db.UserFilter{Id: user.Id}, types.UpdateUserParams{FirstName: "Franky", LastName: "Tomato"})
+	assert.NoError(t, err)
+	updated, err := store.User.GetUser(ctx, db.UserFilter{Id: user.Id})
+	require.NoError(t, err)
+	assert.Equal(t, "Franky", updated.FirstName)
+	assert.Equal(t, "Tomato", updated.LastName)
+	assert.Equal(t, user.Email, updated.Email)
+
+	_, err = store.User.UpdateUser(ctx, db.UserFilter{Id: primitive.NewObjectID()}, types.UpdateUserParams{FirstName: "Franky", LastName: "Tomato"})
+	assert.Error(t, err)
+
+	_, err = store.User.DeleteUser(ctx, db.UserFilter{Id: user.Id})
+	assert.NoError(t, err)
+	_, err = store.User.GetUser(ctx, db.UserFilter{Id: user.Id})
+	assert.Error(t, err)
+	_, err = store.User.DeleteUser(ctx, db.UserFilter{Id: user.Id})
+	assert.Error(t, err)
+}
+
+func testFlights(t *testing.T, store *db.Store) {
+	ctx := context.Background()
+	flight, _ := newFlight(t, store, 0)
+	assert.False(t, flight.Id.IsZero())
+
+	fetched, err := store.Flight.GetFlight(ctx, db.FlightFilter{Id: flight.Id})
+	require.NoError(t, err)
+	assert.Equal(t, flight.Airline, fetched.Airline)
+	assert.Equal(t, flight.Departure, fetched.Departure)
+	assert.Equal(t, flight.Arrival, fetched.Arrival)
+	assert.True(t, flight.DepartureTime.Equal(fetched.DepartureTime))
+	assert.Equal(t, flight.DepartureTimeZone, fetched.DepartureTimeZone)
+	assert.Empty(t, fetched.Seats)
+
+	_, err = store.Flight.GetFlight(ctx, db.FlightFilter{Id: primitive.NewObjectID()})
+	assert.Error(t, err)
+
+	departure := time.Now().Add(48 * time.Hour).UTC().Truncate(time.Second)
+	_, err = store.Flight.UpdateFlight(ctx, db.FlightFilter{Id: flight.Id}, types.UpdateFlightParams{DepartureTime: departure})
+	assert.NoError(t, err)
+	fetched, err = store.Flight.GetFlight(ctx, db.FlightFilter{Id: flight.Id})
+	require.NoError(t, err)
+	assert.True(t, departure.Equal(fetched.DepartureTime))
+	assert.True(t, flight.ArrivalTime.Equal(fetched.ArrivalTime))
+
+	_, err = store.Flight.UpdateFlight(ctx, db.FlightFilter{Id: primitive.NewObjectID()}, types.UpdateFlightParams{DepartureTime: departure})
+	assert.Error(t, err)
+
+	// local times are read in the zones of the airports
+	zoned, _ := newFlightWithPrices(t, store, types.CreateFlightParams{
+		Airline: "Delta", Departure: "JFK", Arrival: "LAX",
+		DepartureTime: "2030-07-01T09:30", DepartureTimeZone: "America/New_York",
+		ArrivalTime: "2030-07-01T12:45", ArrivalTimeZone: "America/Los_Angeles",
+	}, nil)
+	fetched, err = store.Flight.GetFlight(ctx, db.FlightFilter{Id: zoned.Id})
+	require.NoError(t, err)
+	assert.True(t, time.Date(2030, 7, 1, 13, 30, 0, 0, time.UTC).Equal(fetched.DepartureTime))
+	assert.Equal(t, "09:30", fetched.LocalDepartureTime().Format("15:04"))
+	assert.Equal(t, "12:45", fetched.LocalArrivalTime().Format("15:04"))
+	assert.Equal(t, 6*time.Hour+15*time.Minute, fetched.Duration())
+}
+
+func testFlightSearch(t *testing.T, store *db.Store) {
+	ctx := context.Background()
+	tomorrow := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Hour)
+	at := func(hours int) string {
+		return tomorrow.Add(time.Duration(hours) * time.Hour).Format(time.RFC3339)
+	}
+	// early, long and expensive; late, short and cheap; middle with a single seat
+	early, _ := newFlightWithPrices(t, store, types.CreateFlightParams{
+		Airline: "Delta", Departure: "JFK", Arrival: "LAX", DepartureTime: at(0), ArrivalTime: at(8),
+	}, []string{"500", "400"})
+	late, _ := newFlightWithPrices(t, store, types.CreateFlightParams{
+		Airline: "United", Departure: "JFK", Arrival: "LAX", DepartureTime: at(10), ArrivalTime: at(15),
+	}, []string{"90", "300"})
+	middle, _ := newFlightWithPrices(t, store, types.CreateFlightParams{
+		Airline: "Delta", Departure: "JFK", Arrival: "LAX", DepartureTime: at(5), ArrivalTime: at(11),
+	}, []string{"200"})
+	full, _ := newFlightWithPrices(t, store, types.CreateFlightParams{
+		Airline: "Delta", Departure: "JFK", Arrival: "LAX", DepartureTime: at(7), ArrivalTime: at(14),
+	}, []string{})
+	newFlightWithPrices(t, store, types.CreateFlightParams{
+		Airline: "Delta", Departure: "LAX", Arrival: "JFK", DepartureTime: at(1), ArrivalTime: at(6),
+	}, []string{"50"})
+
+	ids := func(flights []*types.Flight) []primitive.ObjectID {
+		result := []primitive.ObjectID{}
+		for _, flight := range flights {
+			result = append(result, flight.Id)
+		}
+		return result
+	}
+	route := db.FlightFilter{Departure: "JFK", Arrival: "LAX"}
+	searches := []struct {
+		filter   db.FlightFilter
+		sort     db.FlightSort
+		expected []primitive.ObjectID
+	}{
+		{route, db.SortByDepartureTime, []primitive.ObjectID{early.Id, middle.Id, full.Id, late.Id}},
+		{route, db.SortByDuration, []primitive.ObjectID{late.Id, middle.Id, full.Id, early.Id}},
+		{route, db.SortByLowestPrice, []primitive.ObjectID{late.Id, middle.Id, early.Id, full.Id}},
+		{db.FlightFilter{Departure: "JFK", Arrival: "LAX", MinAvailableSeats: 2}, db.SortByDepartureTime, []primitive.ObjectID{early.Id, late.Id}},
+		{db.FlightFilter{Departure: "JFK", Arrival: "LAX", Airline: "Delta", MinAvailableSeats: 1}, db.SortByDepartureTime, []primitive.ObjectID{early.Id, middle.Id}},
+		{db.FlightFilter{Departure: "JFK", DepartureBetween: db.TimeRange{From: tomorrow.Add(4 * time.Hour), To: tomorrow.Add(8 * time.Hour)}}, db.SortByDepartureTime, []primitive.ObjectID{middle.Id, full.Id}},
+	}
+	for _, search := range searches {
+		flights, err := store.Flight.GetFlights(ctx, search.filter, search.sort, &db.Pagination{})
+		require.NoError(t, err)
+		assert.Equal(t, search.expected, ids(flights), "search %+v sorted by %q", search.filter, search.sort)
+	}
+
+	page, err := store.Flight.GetFlights(ctx, route, db.SortByLowestPrice, &db.Pagination{Page: "2", Limit: "2"})
+	require.NoError(t, err)
+	assert.Equal(t, []primitive.ObjectID{early.Id, full.Id}, ids(page))
+
+	// the amounts in different currencies are not compared
+	yen, _ := newFlightWithPrices(t, store, types.CreateFlightParams{
+		Airline: "ANA", Departure: "JFK", Arrival: "LAX", DepartureTime: at(3), ArrivalTime: at(9),
+	}, []string{})
+	_, err = store.Seat.CreateSeat(ctx, &types.Seat{FlightId: yen.Id, Price: types.MustParseMoney("15000", "JPY"), Class: types.Economy, Available: true})
+	require.NoError(t, err)
+	flights, err := store.Flight.GetFlights(ctx, route, db.SortByLowestPrice, &db.Pagination{})
+	require.NoError(t, err)
+	assert.Equal(t, []primitive.ObjectID{yen.Id, late.Id, middle.Id, early.Id, full.Id}, ids(flights))
+}
+
+func testSeats(t *testing.T, store *db.Store) {
+	ctx := context.Background()
+	flight, seats := newFlight(t, store, 3)
+	other, _ := newFlight(t, store, 2)
+
+	fetched, err := store.Seat.GetSeat(ctx, db.SeatFilter{Id: seats[1].Id, FlightId: flight.Id})
+	require.NoError(t, err)
+	assert.Equal(t, *seats[1], *fetched)
+
+	_, err = store.Seat.GetSeat(ctx, db.SeatFilter{Id: seats[1].Id, FlightId: other.Id})
+	assert.Error(t, err)
+
+	_, err = store.Seat.UpdateSeat(ctx, db.SeatFilter{Id: seats[0].Id}, types.UpdateSeatParams{Price: usd("250"), Available: false})
+	assert.NoError(t, err)
+	fetched, err = store.Seat.GetSeat(ctx, db.SeatFilter{Id: seats[0].Id})
+	require.NoError(t, err)
+	assert.Equal(t, "USD 250.00", fetched.Price.String())
+	assert.False(t, fetched.Available)
+
+	_, err = store.Seat.UpdateSeat(ctx, db.SeatFilter{Id: primitive.NewObjectID()}, types.UpdateSeatParams{Price: usd("250"), Available: true})
+	assert.Error(t, err)
+
+	isAvailable := true
+	available, err := store.Seat.GetSeats(ctx, db.SeatFilter{FlightId: flight.Id, Available: &isAvailable}, &db.Pagination{})
+	require.NoError(t, err)
+	assert.Len(t, available, 2)
+	for _, seat := range available {
+		assert.Equal(t, flight.Id, seat.FlightId)
+		assert.True(t, seat.Available)
+	}
+
+	all, err := store.Seat.GetSeats(ctx, db.SeatFilter{FlightId: flight.Id}, &db.Pagination{})
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	business, err := store.Seat.GetSeats(ctx, db.SeatFilter{FlightId: flight.Id, Class: types.Business}, &db.Pagination{})
+	require.NoError(t, err)
+	assert.Empty(t, business)
+
+	both, err := store.Seat.GetSeats(ctx, db.SeatFilter{FlightIds: []primitive.ObjectID{flight.Id, other.Id}}, &db.Pagination{})
+	require.NoError(t, err)
+	assert.Len(t, both, 5)
+	none, err := store.Seat.GetSeats(ctx, db.SeatFilter{FlightIds: []primitive.ObjectID{}}, &db.Pagination{})
+	require.NoError(t, err)
+	assert.Empty(t, none)
+
+	// only the available seats are repriced
+	repriced := []*types.Seat{
+		{Id: seats[0].Id, Price: usd("10"), Fare: fareOf(t, usd("10"))},
+		{Id: seats[1].Id, Price: usd("20.5"), Fare: fareOf(t, usd("20.5"))},
+		{Id: primitive.NewObjectID(), Price: usd("30")},
+	}
+	err = store.Seat.UpdateSeatPrices(ctx, repriced)
+	require.NoError(t, err)
+	fetched, err = store.Seat.GetSeat(ctx, db.SeatFilter{Id: seats[0].Id})
+	require.NoError(t, err)
+	assert.Equal(t, "USD 250.00", fetched.Price.String())
+	assert.Nil(t, fetched.Fare)
+	fetched, err = store.Seat.GetSeat(ctx, db.SeatFilter{Id: seats[1].Id})
+	require.NoError(t, err)
+	assert.Equal(t, "USD 20.50", fetched.Price.String())
+	assert.True(t, repriced[1].Fare.Equal(fetched.Fare))
+	assert.Equal(t, "USD 27.04", fetched.Fare.Total.String())
+}
+
+func testFlightWithSeats(t *testing.T, store *db.Store) {
+	ctx := context.Background()
+	flight, err := types.NewFlightFromParams(types.CreateFlightParams{
+		Airline:       "Delta",
+		Departure:     "JFK",
+		Arrival:       "LAX",
+		DepartureTime: "2030-01-01T10:00:00Z",
+		ArrivalTime:   "2030-01-01T16:00:00Z",
+	})
+	require.NoError(t, err)
+	seats := types.GenericSeatMap(primitive.NilObjectID, 300)
+
+	created, err := store.Flight.CreateFlightWithSeats(ctx, flight, seats)
+	require.NoError(t, err)
+	require.False(t, created.Id.IsZero())
+	require.Len(t, created.Seats, 300)
+
+	fetched, err := store.Flight.GetFlight(ctx, db.FlightFilter{Id: created.Id})
+	require.NoError(t, err)
+	assert.Equal(t, created.Seats, fetched.Seats)
+	stored, err := store.Seat.GetSeats(ctx, db.SeatFilter{FlightId: created.Id}, &db.Pagination{Limit: "0"})
+	require.NoError(t, err)
+	require.Len(t, stored, 300)
+	for i, seat := range seats {
+		assert.Equal(t, created.Seats[i], seat.Id)
+		assert.Equal(t, created.Id, seat.FlightId)
+	}
+
+	// a seat that cannot be inserted leaves neither the flight nor the other
+	// seats behind
+	failing, err := types.NewFlightFromParams(types.CreateFlightParams{
+		Airline:       "Delta",
+		Departure:     "LAX",
+		Arrival:       "JFK",
+		DepartureTime: "2030-01-02T10:00:00Z",
+		ArrivalTime:   "2030-01-02T16:00:00Z",
+	})
+	require.NoError(t, err)
+	failing.Id = primitive.NewObjectID()
+	failingSeats := types.GenericSeatMap(primitive.NilObjectID, 10)
+	failingSeats[5].Id = seats[0].Id
+	_, err = store.Flight.CreateFlightWithSeats(ctx, failing, failingSeats)
+	require.Error(t, err)
+	_, err = store.Flight.GetFlight(ctx, db.FlightFilter{Id: failing.Id})
+	assert.Error(t, err)
+	left, err := store.Seat.GetSeats(ctx, db.SeatFilter{FlightId: failing.Id}, &db.Pagination{Limit: "0"})
+	require.NoError(t, err)
+	assert.Empty(t, left)
+
+	// seats on their own
+	extra := types.GenericSeatMap(created.Id, 3)
+	_, err = store.Seat.CreateSeats(ctx, extra)
+	require.NoError(t, err)
+	for _, seat := range extra {
+		fetched, err := store.Seat.GetSeat(ctx, db.SeatFilter{Id: seat.Id, FlightId: created.Id})
+		require.NoError(t, err)
+		assert.Equal(t, *seat, *fetched)
+	}
+	duplicate := types.GenericSeatMap(created.Id, 2)
+	duplicate[1].Id = extra[0].Id
+	_, err = store.Seat.CreateSeats(ctx, duplicate)
+	assert.Error(t, err)
+	all, err := store.Seat.GetSeats(ctx, db.SeatFilter{FlightId: created.Id}, &db.Pagination{Limit: "0"})
+	require.NoError(t, err)
+	assert.Len(t, all, 303)
+}
+
+func testFlightFilters(t *testing.T, store *db.Store) {
+	ctx := context.Background()
+	flight, _ := newFlight(t, store, 0)
+	departure := flight.DepartureTime
+
+	filters := []struct {
+		filter   db.FlightFilter
+		expected int
+	}{
+		{db.FlightFilter{}, 1},
+		{db.FlightFilter{Departure: "JFK", Arrival: "LAX"}, 1},
+		{db.FlightFilter{Departure: "LAX"}, 0},
+		{db.FlightFilter{Airline: "Delta"}, 1},
+		{db.FlightFilter{Airline: "United"}, 0},
+		{db.FlightFilter{DepartureBetween: db.TimeRange{From: departure.Add(-time.Hour), To: departure.Add(time.Hour)}}, 1},
+		{db.FlightFilter{DepartureBetween: db.TimeRange{From: departure.Add(-time.Hour)}}, 1},
+		{db.FlightFilter{DepartureBetween: db.TimeRange{From: departure.Add(time.Hour)}}, 0},
+		{db.FlightFilter{DepartureBetween: db.TimeRange{To: departure.Add(-time.Hour)}}, 0},
+	}
+	for _, f := range filters {
+		flights, err := store.Flight.GetFlights(ctx, f.filter, db.SortByNone, &db.Pagination{})
+		require.NoError(t, err)
+		assert.Len(t, flights, f.expected, "filter %+v", f.filter)
+	}
+}
+
+func testReservations(t *testing.T, store *db.Store) {
+	ctx := context.Background()
+	user := newUser(t, store, "fp@test.com")
+	flight, seats := newFlight(t, store, 2)
+	seat := seats[0]
+	seat.Fare = fareOf(t, seat.Price)
+	require.NoError(t, store.Seat.UpdateSeatPrices(ctx, []*types.Seat{seat}))
+
+	passenger := &types.Passenger{
+		FirstName:   "Jane",
+		LastName:    "Potato",
+		DateOfBirth: "1990-01-01",
+		Type:        types.Adult,
+		Document:    &types.TravelDocument{Type: "passport", Number: "X123", IssuingCountry: "IT", ExpiryDate: "2035-01-01"},
+	}
+	reservation, err := store.Reservation.CreateReservation(ctx, db.SeatFilter{Id: seat.Id}, user.Id, passenger, "", nil)
+	require.NoError(t, err)
+	assert.False(t, reservation.Id.IsZero())
+	assert.Equal(t, seat.Id, reservation.SeatId)
+	assert.Equal(t, flight.Id, reservation.FlightId)
+	assert.Equal(t, user.Id, reservation.UserId)
+	assert.Equal(t, passenger, reservation.Passenger)
+	assert.Equal(t, seat.Price, reservation.Price)
+	assert.True(t, seat.Fare.Equal(reservation.Fare))
+	assert.True(t, types.IsValidLocator(reservation.Locator))
+	located, err := store.Reservation.GetReservation(ctx, db.ReservationFilter{Locator: reservation.Locator})
+	require.NoError(t, err)
+	assert.Equal(t, reservation.Id, located.Id)
+	assert.True(t, seat.Fare.Equal(located.Fare))
+	assert.False(t, reservation.ReservationDate.IsZero())
+	assert.Nil(t, reservation.CancellationDate)
+	assert.Equal(t, types.ReservationPending, reservation.Status)
+	assert.Len(t, reservation.History, 1)
+
+	reservedSeat, err := store.Seat.GetSeat(ctx, db.SeatFilter{Id: seat.Id})
+	require.NoError(t, err)
+	assert.False(t, reservedSeat.Available)
+	fetchedFlight, err := store.Flight.GetFlight(ctx, db.FlightFilter{Id: flight.Id})
+	require.NoError(t, err)
+	assert.Equal(t, []primitive.ObjectID{seats[1].Id}, fetchedFlight.Seats)
+
+	_, err = store.Reservation.CreateReservation(ctx, db.SeatFilter{Id: seat.Id}, user.Id, nil, "", nil)
+	assert.Error(t, err)
+	_, err = store.Reservation.CreateReservation(ctx, db.SeatFilter{Id: primitive.NewObjectID()}, user.Id, nil, "", nil)
+	assert.Error(t, err)
+
+	mine, err := store.Reservation.GetReservations(ctx, db.ReservationFilter{UserId: user.Id}, &db.Pagination{})
+	require.NoError(t, err)
+	assert.Len(t, mine, 1)
+	theirs, err := store.Reservation.GetReservations(ctx, db.ReservationFilter{UserId: primitive.NewObjectID()}, &db.Pagination{})
+	require.NoError(t, err)
+	assert.Len(t, theirs, 0)
+
+	refund, err := types.NewRefund(usd("100"), usd("25"), types.RefundFeeSchedule, time.Now())
+	require.NoError(t, err)
+	credit := &types.Credit{Id: primitive.NewObjectID(), UserId: user.Id, Balance: usd("25"), IssuedFor: reservation.Id, ExpiresAt: time.Now().AddDate(1, 0, 0), CreatedAt: time.Now()}
+	refund.CreditId = credit.Id
+	_, err = store.Reservation.CancelReservation(ctx, db.ReservationFilter{Id: reservation.Id}, refund, credit)
+	require.NoError(t, err)
+	issued, err := store.Credit.GetCredit(ctx, db.CreditFilter{Id: credit.Id})
+	require.NoError(t, err)
+	assert.Equal(t, reservation.Id, issued.IssuedFor)
+	assert.True(t, usd("25").Equal(issued.Balance))
+
+	cancelled, err := store.Reservation.GetReservation(ctx, db.ReservationFilter{Id: reservation.Id})
+	require.NoError(t, err)
+	require.NotNil(t, cancelled.Refund)
+	assert.True(t, usd("75").Equal(cancelled.Refund.Amount))
+	assert.True(t, usd("25").Equal(cancelled.Refund.Fee))
+	assert.Equal(t, types.RefundFeeSchedule, cancelled.Refund.Policy)
+	assert.NotEmpty(t, cancelled.CancellationDate)
+	assert.Equal(t, types.ReservationCancelled, cancelled.Status)
+	require.Len(t, cancelled.History, 2)
+	require.NotNil(t, cancelled.CancellationDate)
+	assert.Equal(t, types.ReservationPending, cancelled.History[1].From)
+	assert.Equal(t, types.ReservationCancelled, cancelled.History[1].To)
+	assert.True(t, cancelled.CancellationDate.Equal(cancelled.History[1].At))
+	freedSeat, err := store.Seat.GetSeat(ctx, db.SeatFilter{Id: seat.Id})
+	require.NoError(t, err)
+	assert.True(t, freedSeat.Available)
+	fetchedFlight, err = store.Flight.GetFlight(ctx, db.FlightFilter{Id: flight.Id})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []primitive.ObjectID{seats[0].Id, seats[1].Id}, fetchedFlight.Seats)
+
+	assert.True(t, cancelled.Unsettled)
+	unsettled, err := store.Reservation.GetReservations(ctx, db.ReservationFilter{Unsettled: true}, &db.Pagination{})
+	require.NoError(t, err)
+	require.Len(t, unsettled, 1)
+	assert.Equal(t, reservation.Id, unsettled[0].Id)
+	settled, err := store.Reservation.SettleReservation(ctx, db.ReservationFilter{Id: reservation.Id})
+	require.NoError(t, err)
+	assert.False(t, settled.Unsettled)
+	assert.Equal(t, types.ReservationCancelled, settled.Status)
+	unsettled, err = store.Reservation.GetReservations(ctx, db.ReservationFilter{Unsettled: true}, &db.Pagination{})
+	require.NoError(t, err)
+	assert.Len(t, unsettled, 0)
+
+	// the credit is only issued along with the cancellation
+	again := &types.Credit{Id: primitive.NewObjectID(), UserId: user.Id, Balance: usd("25"), ExpiresAt: time.Now().AddDate(1, 0, 0), CreatedAt: time.Now()}
+	_, err = store.Reservation.CancelReservation(ctx, db.ReservationFilter{Id: reservation.Id}, nil, again)
+	var transitionErr *types.TransitionError
+	assert.ErrorAs(t, err, &transitionErr)
+	_, err = store.Credit.GetCredit(ctx, db.CreditFilter{Id: again.Id})
+	assert.ErrorIs(t, err, mongo.ErrNoDocuments)
+	_, err = store.Reservation.CancelReservation(ctx, db.ReservationFilter{Id: primitive.NewObjectID()}, nil, nil)
+	assert.Error(t, err)
+}
+
+func testReservationStatus(t *testing.T, store *db.Store) {
+	ctx := context.Background()
+	user := newUser(t, store, "fp@test.com")
+	flight, seats := newFlight(t, store, 2)
+
+	reservation, err := store.Reservation.CreateReservation(ctx, db.SeatFilter{Id: seats[0].Id}, user.Id, nil, "", nil)
+	require.NoError(t, err)
+	filter := db.ReservationFilter{Id: reservation.Id}
+
+	// boarding is only allowed after check-in
+	_, err = store.Reservation.UpdateReservationStatus(ctx, filter, types.ReservationBoarded)
+	var transitionErr *types.TransitionError
+	require.ErrorAs(t, err, &transitionErr)
+	assert.Equal(t, types.ReservationPending, transitionErr.From)
+	assert.Equal(t, types.ReservationBoarded, transitionErr.To)
+
+	for _, status := range []types.ReservationStatus{types.ReservationConfirmed, types.ReservationTicketed, types.ReservationCheckedIn, types.ReservationNoShow, types.ReservationRefunded} {
+		reservation, err = store.Reservation.UpdateReservationStatus(ctx, filter, status)
+		require.NoError(t, err, status)
+		assert.Equal(t, status, reservation.Status)
+	}
+	assert.Len(t, reservation.History, 6)
+	assert.Equal(t, types.ReservationNoShow, reservation.History[5].From)
+
+	// a no-show does not give the seat back, nor is it left to settle
+	fetchedFlight, err := store.Flight.GetFlight(ctx, db.FlightFilter{Id: flight.Id})
+	require.NoError(t, err)
+	assert.Equal(t, []primitive.ObjectID{seats[1].Id}, fetchedFlight.Seats)
+	assert.False(t, reservation.Unsettled)
+
+	// any move giving the seat back leaves the reservation to settle
+	other, err := store.Reservation.CreateReservation(ctx, db.SeatFilter{Id: seats[1].Id}, user.Id, nil, "", nil)
+	require.NoError(t, err)
+	other, err = store.Reservation.UpdateReservationStatus(ctx, db.ReservationFilter{Id: other.Id}, types.ReservationCancelled)
+	require.NoError(t, err)
+	assert.True(t, other.Unsettled)
+
+	_, err = store.Reservation.CancelReservation(ctx, filter, nil, nil)
+	assert.ErrorAs(t, err, &transitionErr)
+	_, err = store.Reservation.UpdateReservationStatus(ctx, db.ReservationFilter{Id: primitive.NewObjectID()}, types.ReservationTicketed)
+	assert.Error(t, err)
+}
+
+func testPayments(t *testing.T, store *db.Store) {
+	ctx := context.Background()
+	user := newUser(t, store, "fp@test.com")
+	flight, seats := newFlight(t, store, 3)
+
+	reserve := func(seat *types.Seat) *types.Reservation {
+		reservation, err := store.Reservation.CreateReservation(ctx, db.SeatFilter{Id: seat.Id}, user.Id, nil, "", nil)
+		require.NoError(t, err)
+		return reservation
+	}
+	pay := func(reservation *types.Reservation, reference string, status types.PaymentStatus) *types.Reservation {
+		payment := &types.Payment{Provider: "test", Reference: reference, Status: status, Amount: usd("100"), UpdatedAt: time.Now().UTC()}
+		paid, err := store.Reservation.UpdateReservationPayment(ctx, db.ReservationFilter{Id: reservation.Id}, payment)
+		require.NoError(t, err)
+		require.NotNil(t, paid.Payment)
+		assert.Equal(t, reference, paid.Payment.Reference)
+		assert.Equal(t, status, paid.Payment.Status)
+		assert.True(t, usd("100").Equal(paid.Payment.Amount))
+		return paid
+	}
+
+	// a pending payment leaves the reservation pending, capturing it confirms
+	// the reservation
+	captured := reserve(seats[0])
+	assert.Equal(t, types.ReservationPending, pay(captured, "ref-1", types.PaymentPending).Status)
+	assert.Equal(t, types.ReservationConfirmed, pay(captured, "ref-1", types.PaymentCaptured).Status)
+	located, err := store.Reservation.GetReservations(ctx, db.ReservationFilter{PaymentReference: "ref-1"}, &db.Pagination{})
+	require.NoError(t, err)
+	require.Len(t, located, 1)
+	assert.Equal(t, captured.Id, located[0].Id)
+
+	// a failed payment cancels the reservation and gives its seat back
+	failed := reserve(seats[1])
+	assert.Equal(t, types.ReservationCancelled, pay(failed, "ref-2", types.PaymentFailed).Status)
+	fetchedFlight, err := store.Flight.GetFlight(ctx, db.FlightFilter{Id: flight.Id})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []primitive.ObjectID{seats[1].Id, seats[2].Id}, fetchedFlight.Seats)
+
+	// only pending reservations move with their payment
+	assert.Equal(t, types.ReservationConfirmed, pay(captured, "ref-1", types.PaymentVoided).Status)
+
+	_, err = store.Reservation.UpdateReservationPayment(ctx, db.ReservationFilter{Id: primitive.NewObjectID()}, &types.Payment{Status: types.PaymentCaptured})
+	assert.Error(t, err)
+	none, err := store.Reservation.GetReservations(ctx, db.ReservationFilter{PaymentReference: "ref-3"}, &db.Pagination{})
+	require.NoError(t, err)
+	assert.Len(t, none, 0)
+
+	// the payments still awaited past their expiry are found
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	pending := reserve(seats[2])
+	_, err = store.Reservation.UpdateReservationPayment(ctx, db.ReservationFilter{Id: pending.Id}, &types.Payment{Provider: "test", Reference: "ref-4", Status: types.PaymentPending, Amount: usd("100"), ExpiresAt: now, UpdatedAt: now})
+	require.NoError(t, err)
+	expired, err := store.Reservation.GetReservations(ctx, db.ReservationFilter{PaymentExpiredBy: now.Add(-time.Second)}, &db.Pagination{})
+	require.NoError(t, err)
+	assert.Len(t, expired, 0)
+	expired, err = store.Reservation.GetReservations(ctx, db.ReservationFilter{PaymentExpiredBy: now}, &db.Pagination{})
+	require.NoError(t, err)
+	require.Len(t, expired, 1)
+	assert.Equal(t, pending.Id, expired[0].Id)
+	assert.Equal(t, now, expired[0].Payment.ExpiresAt.UTC())
+}
+
+func testCredits(t *testing.T, store *db.Store) {
+	ctx := context.Background()
+	user := newUser(t, store, "fp@test.com")
+	other := newUser(t, store, "jt@test.com")
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	credit, err := store.Credit.CreateCredit(ctx, &types.Credit{UserId: user.Id, Balance: usd("250"), ExpiresAt: now.AddDate(1, 0, 0), CreatedAt: now})
+	require.NoError(t, err)
+	require.False(t, credit.Id.IsZero())
+	_, err = store.Credit.CreateCredit(ctx, &types.Credit{UserId: other.Id, Balance: usd("50"), ExpiresAt: now.AddDate(1, 0, 0), CreatedAt: now})
+	require.NoError(t, err)
+	credits, err := store.Credit.GetCredits(ctx, db.CreditFilter{UserId: user.Id}, &db.Pagination{})
+	require.NoError(t, err)
+	require.Len(t, credits, 1)
+	assert.Equal(t, credit.Id, credits[0].Id)
+	assert.True(t, usd("250").Equal(credits[0].Balance))
+	assert.Equal(t, now.AddDate(1, 0, 0), credits[0].ExpiresAt.UTC())
+	assert.Empty(t, credits[0].Redemptions)
+
+	// a credit pays for reservations up to its balance, and only its owner's
+	_, seats := newFlight(t, store, 12)
+	spend := func(seat *types.Seat, userId primitive.ObjectID, filter db.CreditFilter) (*types.Reservation, error) {
+		return store.Reservation.CreateReservation(ctx, db.SeatFilter{Id: seat.Id}, userId, nil, "", &db.Spending{Credit: &filter})
+	}
+	reservation, err := spend(seats[0], user.Id, db.CreditFilter{Id: credit.Id, UserId: user.Id})
+	require.NoError(t, err)
+	redemption := reservation.Credit
+	require.NotNil(t, redemption)
+	assert.Equal(t, credit.Id, redemption.CreditId)
+	assert.Equal(t, reservation.Id, redemption.ReservationId)
+	assert.True(t, usd("100").Equal(redemption.Amount), redemption.Amount)
+	assert.True(t, reservation.AmountDue().IsZero(), reservation.AmountDue())
+	fetched, err := store.Reservation.GetReservation(ctx, db.ReservationFilter{Id: reservation.Id})
+	require.NoError(t, err)
+	require.NotNil(t, fetched.Credit)
+	assert.True(t, usd("100").Equal(fetched.Credit.Amount), fetched.Credit.Amount)
+
+	// or not at all, along with the reservation
+	_, err = spend(seats[1], other.Id, db.CreditFilter{Id: credit.Id, UserId: other.Id})
+	assert.ErrorIs(t, err, mongo.ErrNoDocuments)
+	euros, err := store.Credit.CreateCredit(ctx, &types.Credit{UserId: user.Id, Balance: types.MustParseMoney("50", "EUR"), ExpiresAt: now.AddDate(1, 0, 0), CreatedAt: now})
+	require.NoError(t, err)
+	_, err = spend(seats[1], user.Id, db.CreditFilter{Id: euros.Id, UserId: user.Id})
+	assert.ErrorIs(t, err, types.ErrCreditUnavailable)
+	expired, err := store.Credit.CreateCredit(ctx, &types.Credit{UserId: user.Id, Balance: usd("50"), ExpiresAt: now.Add(-time.Hour), CreatedAt: now})
+	require.NoError(t, err)
+	_, err = spend(seats[1], user.Id, db.CreditFilter{Id: expired.Id, UserId: user.Id})
+	assert.ErrorIs(t, err, types.ErrCreditUnavailable)
+	seat, err := store.Seat.GetSeat(ctx, db.SeatFilter{Id: seats[1].Id})
+	require.NoError(t, err)
+	assert.True(t, seat.Available)
+
+	// concurrent reservations never spend more than what is left
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	spent := []types.Money{}
+	for _, seat := range seats[1:11] {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reservation, err := spend(seat, user.Id, db.CreditFilter{Id: credit.Id, UserId: user.Id})
+			if errors.Is(err, types.ErrCreditUnavailable) {
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			spent = append(spent, reservation.Credit.Amount)
+		}()
+	}
+	wg.Wait()
+	total, err := types.Sum(spent...)
+	require.NoError(t, err)
+	assert.True(t, usd("150").Equal(total), total)
+	spentCredit, err := store.Credit.GetCredit(ctx, db.CreditFilter{Id: credit.Id})
+	require.NoError(t, err)
+	assert.True(t, spentCredit.Balance.IsZero(), spentCredit.Balance)
+	assert.Len(t, spentCredit.Redemptions, len(spent)+1)
+	_, err = spend(seats[11], user.Id, db.CreditFilter{Id: credit.Id, UserId: user.Id})
+	assert.ErrorIs(t, err, types.ErrCreditUnavailable)
+
+	// a redemption is given back once
+	restored, err := store.Credit.RestoreCredit(ctx, redemption)
+	require.NoError(t, err)
+	assert.True(t, usd("100").Equal(restored.Balance), restored.Balance)
+	restored, err = store.Credit.RestoreCredit(ctx, redemption)
+	require.NoError(t, err)
+	assert.True(t, usd("100").Equal(restored.Balance), restored.Balance)
+	require.Len(t, restored.Redemptions, len(spent)+1)
+	assert.True(t, usd("100").Equal(restored.Redemptions[0].Restored), restored.Redemptions[0].Restored)
+	assert.False(t, restored.Redemptions[1].Restored.IsSet())
+
+	// part of a redemption can be given back, once
+	partial := &types.CreditRedemption{CreditId: credit.Id, ReservationId: spentCredit.Redemptions[1].ReservationId, Amount: usd("10")}
+	for i := 0; i < 2; i++ {
+		restored, err = store.Credit.RestoreCredit(ctx, partial)
+		require.NoError(t, err)
+		assert.True(t, usd("110").Equal(restored.Balance), restored.Balance)
+	}
+	assert.True(t, spentCredit.Redemptions[1].Amount.Equal(restored.Redemptions[1].Amount), restored.Redemptions[1].Amount)
+	assert.True(t, usd("10").Equal(restored.Redemptions[1].Restored), restored.Redemptions[1].Restored)
+
+	// concurrent restorations give back each redemption once
+	for _, redemption := range spentCredit.Redemptions[2:] {
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := store.Credit.RestoreCredit(ctx, &redemption)
+				assert.NoError(t, err)
+			}()
+		}
+	}
+	wg.Wait()
+	restored, err = store.Credit.GetCredit(ctx, db.CreditFilter{Id: credit.Id})
+	require.NoError(t, err)
+	want := usd("110")
+	for _, redemption := range spentCredit.Redemptions[2:] {
+		want, err = want.Add(redemption.Amount)
+		require.NoError(t, err)
+	}
+	assert.True(t, want.Equal(restored.Balance), restored.Balance)
+}
+
+func testPromotions(t *testing.T, store *db.Store) {
+	ctx := context.Background()
+	user := newUser(t, store, "fp@test.com")
+	other := newUser(t, store, "jt@test.com")
+
+	promotion, err := store.Promotion.CreatePromotion(ctx, &types.Promotion{
+		Code:         "summer10",
+		DiscountType: types.DiscountPercentage,
+		Percent:      10,
+		Routes:       []string{"JFK-LAX"},
+		MaxPerUser:   1,
+		CreatedAt:    time.Now().UTC(),
+	})
+	require.NoError(t, err)
+	require.False(t, promotion.Id.IsZero())
+	byCode, err := store.Promotion.GetPromotion(ctx, db.PromotionFilter{Code: "Summer10"})
+	require.NoError(t, err)
+	assert.Equal(t, promotion.Id, byCode.Id)
+	assert.Equal(t, "SUMMER10", byCode.Code)
+	_, err = store.Promotion.CreatePromotion(ctx, &types.Promotion{Code: "SUMMER10", DiscountType: types.DiscountFixed, Amount: usd("5")})
+	assert.Error(t, err)
+
+	// the discount comes off the base fare and is counted against the caps
+	_, seats := newFlight(t, store, 4)
+	reservation, err := store.Reservation.CreateReservation(ctx, db.SeatFilter{Id: seats[0].Id}, user.Id, nil, "summer10", nil)
+	require.NoError(t, err)
+	require.NotNil(t, reservation.Promotion)
+	assert.Equal(t, promotion.Id, reservation.Promotion.PromotionId)
+	assert.True(t, usd("10").Equal(reservation.Promotion.Discount), reservation.Promotion.Discount)
+	assert.True(t, usd("90").Equal(reservation.AmountDue()), reservation.AmountDue())
+	fetched, err := store.Reservation.GetReservation(ctx, db.ReservationFilter{Id: reservation.Id})
+	require.NoError(t, err)
+	require.NotNil(t, fetched.Promotion)
+	assert.True(t, usd("10").Equal(fetched.Promotion.Discount))
+	redeemed, err := store.Promotion.GetPromotion(ctx, db.PromotionFilter{Id: promotion.Id})
+	require.NoError(t, err)
+	assert.Equal(t, 1, redeemed.Redemptions)
+	assert.Equal(t, 1, redeemed.RedeemedBy[user.Id.Hex()])
+
+	// a failed redemption leaves the seat available
+	_, err = store.Reservation.CreateReservation(ctx, db.SeatFilter{Id: seats[1].Id}, user.Id, nil, "SUMMER10", nil)
+	assert.ErrorIs(t, err, types.ErrPromotionExhausted)
+	_, err = store.Reservation.CreateReservation(ctx, db.SeatFilter{Id: seats[1].Id}, user.Id, nil, "WINTER10", nil)
+	assert.ErrorIs(t, err, types.ErrPromotionNotApplicable)
+	seat, err := store.Seat.GetSeat(ctx, db.SeatFilter{Id: seats[1].Id})
+	require.NoError(t, err)
+	assert.True(t, seat.Available)
+
+	// updates keep the redemptions made so far
+	updated, err := store.Promotion.UpdatePromotion(ctx, db.PromotionFilter{Id: promotion.Id}, types.PromotionParams{
+		Code:           "SUMMER10",
+		DiscountType:   types.DiscountFixed,
+		Amount:         usd("150"),
+		Airlines:       []string{"Delta"},
+		MaxRedemptions: 2,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, types.DiscountFixed, updated.DiscountType)
+	assert.Equal(t, 1, updated.Redemptions)
+	reservation, err = store.Reservation.CreateReservation(ctx, db.SeatFilter{Id: seats[1].Id}, other.Id, nil, "SUMMER10", nil)
+	require.NoError(t, err)
+	assert.True(t, usd("100").Equal(reservation.Promotion.Discount), reservation.Promotion.Discount)
+	assert.True(t, reservation.AmountDue().IsZero(), reservation.AmountDue())
+	_, err = store.Reservation.CreateReservation(ctx, db.SeatFilter{Id: seats[2].Id}, other.Id, nil, "SUMMER10", nil)
+	assert.ErrorIs(t, err, types.ErrPromotionExhausted)
+
+	// concurrent reservations never redeem a promotion more than its cap
+	limited, err := store.Promotion.CreatePromotion(ctx, &types.Promotion{
+		Code:           "FLASH",
+		DiscountType:   types.DiscountFixed,
+		Amount:         usd("20"),
+		MaxRedemptions: 3,
+		ValidUntil:     time.Now().Add(time.Hour).UTC(),
+	})
+	require.NoError(t, err)
+	_, crowded := newFlight(t, store, 10)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	reserved := 0
+	for _, seat := range crowded {
+		wg.Add(1)
+		go func(seat *types.Seat) {
+			defer wg.Done()
+			_, err := store.Reservation.CreateReservation(ctx, db.SeatFilter{Id: seat.Id}, user.Id, nil, "FLASH", nil)
+			if errors.Is(err, types.ErrPromotionExhausted) {
+				return
+			}
+			assert.NoError(t, err)
+			mu.Lock()
+			defer mu.Unlock()
+			reserved++
+		}(seat)
+	}
+	wg.Wait()
+	assert.Equal(t, 3, reserved)
+	limited, err = store.Promotion.GetPromotion(ctx, db.PromotionFilter{Id: limited.Id})
+	require.NoError(t, err)
+	assert.Equal(t, 3, limited.Redemptions)
+
+	promotions, err := store.Promotion.GetPromotions(ctx, &db.Pagination{})
+	require.NoError(t, err)
+	assert.Len(t, promotions, 2)
+	require.NoError(t, store.Promotion.DeletePromotion(ctx, db.PromotionFilter{Id: limited.Id}))
+	assert.Error(t, store.Promotion.DeletePromotion(ctx, db.PromotionFilter{Id: limited.Id}))
+	_, err = store.Promotion.GetPromotion(ctx, db.PromotionFilter{Id: limited.Id})
+	assert.Error(t, err)
+}
+
+func testLoyalty(t *testing.T, store *db.Store) {
+	ctx := context.Background()
+	user := newUser(t, store, "fp@test.com")
+	now := time.Now().UTC()
+
+	account, err := store.Loyalty.GetLoyaltyAccount(ctx, user.Id)
+	require.NoError(t, err)
+	assert.Equal(t, user.Id, account.UserId)
+	assert.Zero(t, account.Points)
+	assert.Empty(t, account.Activity)
+
+	// concurrent updates are all applied, each reservation earning once
+	first := primitive.NewObjectID()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			reservationId := primitive.NewObjectID()
+			if i == 0 {
+				reservationId = first
+			}
+			_, err := store.Loyalty.UpdateLoyaltyAccount(ctx, user.Id, func(account *types.LoyaltyAccount) (bool, error) {
+				return account.Earn(100, reservationId, now), nil
+			})
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+	account, err = store.Loyalty.UpdateLoyaltyAccount(ctx, user.Id, func(account *types.LoyaltyAccount) (bool, error) {
+		return account.Earn(100, first, now), nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1000, account.Points)
+	assert.Equal(t, 1000, account.QualifyingPoints)
+	assert.Len(t, account.Activity, 10)
+
+	// points are spent up to the balance, and given back once
+	spentOn := primitive.NewObjectID()
+	_, err = store.Loyalty.UpdateLoyaltyAccount(ctx, user.Id, func(account *types.LoyaltyAccount) (bool, error) {
+		return true, account.Redeem(1001, spentOn, now)
+	})
+	assert.ErrorIs(t, err, types.ErrPointsUnavailable)
+	_, err = store.Loyalty.UpdateLoyaltyAccount(ctx, user.Id, func(account *types.LoyaltyAccount) (bool, error) {
+		return true, account.Redeem(900, spentOn, now)
+	})
+	require.NoError(t, err)
+	account, err = store.Loyalty.UpdateLoyaltyAccount(ctx, user.Id, func(account *types.LoyaltyAccount) (bool, error) {
+		return account.Reverse(first, now), nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 0, account.Points)
+	assert.Equal(t, 900, account.QualifyingPoints)
+	for i := 0; i < 2; i++ {
+		account, err = store.Loyalty.UpdateLoyaltyAccount(ctx, user.Id, func(account *types.LoyaltyAccount) (bool, error) {
+			return account.Restore(spentOn, now), nil
+		})
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 900, account.Points)
+	fetched, err := store.Loyalty.GetLoyaltyAccount(ctx, user.Id)
+	require.NoError(t, err)
+	assert.Equal(t, account.Id, fetched.Id)
+	assert.Equal(t, 900, fetched.Points)
+	require.Len(t, fetched.Activity, 13)
+	assert.Equal(t, types.PointsRestored, fetched.Activity[12].Kind)
+	assert.Equal(t, 900, fetched.Activity[12].Points)
+
+	// the points are spent along with the reservation, no more than it
+	// costs, or not at all
+	_, seats := newFlight(t, store, 3)
+	spending := &db.Spending{Points: 2500, PointValue: usd("0.01")}
+	reservation, err := store.Reservation.CreateReservation(ctx, db.SeatFilter{Id: seats[0].Id}, user.Id, nil, "", spending)
+	require.NoError(t, err)
+	require.NotNil(t, reservation.Loyalty)
+	assert.Equal(t, 900, reservation.Loyalty.Points)
+	assert.True(t, usd("91").Equal(reservation.AmountDue()), reservation.AmountDue())
+	account, err = store.Loyalty.GetLoyaltyAccount(ctx, user.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 0, account.Points)
+
+	credit, err := store.Credit.CreateCredit(ctx, &types.Credit{UserId: user.Id, Balance: usd("50"), ExpiresAt: now.AddDate(1, 0, 0), CreatedAt: now})
+	require.NoError(t, err)
+	spending.Credit = &db.CreditFilter{Id: credit.Id}
+	_, err = store.Reservation.CreateReservation(ctx, db.SeatFilter{Id: seats[1].Id}, user.Id, nil, "", spending)
+	assert.ErrorIs(t, err, types.ErrPointsUnavailable)
+	unspent, err := store.Credit.GetCredit(ctx, db.CreditFilter{Id: credit.Id})
+	require.NoError(t, err)
+	assert.True(t, usd("50").Equal(unspent.Balance), unspent.Balance)
+	assert.Empty(t, unspent.Redemptions)
+	seat, err := store.Seat.GetSeat(ctx, db.SeatFilter{Id: seats[1].Id})
+	require.NoError(t, err)
+	assert.True(t, seat.Available)
+	_, err = store.Reservation.CreateReservation(ctx, db.SeatFilter{Id: seats[2].Id}, primitive.NewObjectID(), nil, "", &db.Spending{Points: 1, PointValue: usd("0.01")})
+	assert.ErrorIs(t, err, types.ErrPointsUnavailable)
+}
+
+func testWaitlist(t *testing.T, store *db.Store) {
+	ctx := context.Background()
+	flight, seats := newFlight(t, store, 1)
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	join := func(userId primitive.ObjectID, tier types.LoyaltyTier, joinedAt time.Time) *types.WaitlistEntry {
+		entry, err := store.Waitlist.JoinWaitlist(ctx, &types.WaitlistEntry{
+			FlightId: flight.Id,
+			Class:    types.Economy,
+			UserId:   userId,
+			Tier:     tier,
+			Priority: tier.Rank(),
+			Status:   types.WaitlistWaiting,
+			JoinedAt: joinedAt,
+		})
+		require.NoError(t, err)
+		return entry
+	}
+	// the queue goes by join time, then by tier
+	member := join(primitive.NewObjectID(), types.LoyaltyMember, now)
+	gold := join(primitive.NewObjectID(), types.LoyaltyGold, now)
+	early := join(primitive.NewObjectID(), types.LoyaltyMember, now.Add(-time.Minute))
+	late := join(primitive.NewObjectID(), types.LoyaltyGold, now.Add(time.Minute))
+	_, err := store.Waitlist.JoinWaitlist(ctx, &types.WaitlistEntry{FlightId: flight.Id, Class: types.Economy, UserId: member.UserId, Status: types.WaitlistWaiting, JoinedAt: now})
+	assert.ErrorIs(t, err, types.ErrAlreadyWaitlisted)
+	_, err = store.Waitlist.JoinWaitlist(ctx, &types.WaitlistEntry{FlightId: flight.Id, Class: types.Business, UserId: member.UserId, Status: types.WaitlistWaiting, JoinedAt: now})
+	require.NoError(t, err)
+
+	queue, err := store.Waitlist.GetWaitlist(ctx, db.WaitlistFilter{FlightId: flight.Id, Class: types.Economy}, &db.Pagination{Limit: "0"})
+	require.NoError(t, err)
+	require.Len(t, queue, 4)
+	for i, entry := range []*types.WaitlistEntry{early, gold, member, late} {
+		assert.Equal(t, entry.Id, queue[i].Id, i)
+	}
+	assert.Equal(t, types.LoyaltyGold, queue[1].Tier)
+	assert.True(t, now.Equal(queue[1].JoinedAt))
+	page, err := store.Waitlist.GetWaitlist(ctx, db.WaitlistFilter{FlightId: flight.Id, Class: types.Economy}, &db.Pagination{Page: "2", Limit: "3"})
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	assert.Equal(t, late.Id, page[0].Id)
+
+	// an entry moves on from the status it is in only once
+	offer := &types.WaitlistOffer{SeatId: seats[0].Id, OfferedAt: now, ExpiresAt: now.Add(time.Hour)}
+	offered, err := store.Waitlist.UpdateWaitlistEntry(ctx, early.Id, types.WaitlistWaiting, types.WaitlistOffered, offer)
+	require.NoError(t, err)
+	assert.Equal(t, types.WaitlistOffered, offered.Status)
+	require.NotNil(t, offered.Offer)
+	assert.True(t, offer.ExpiresAt.Equal(offered.Offer.ExpiresAt))
+	_, err = store.Waitlist.UpdateWaitlistEntry(ctx, early.Id, types.WaitlistWaiting, types.WaitlistOffered, offer)
+	assert.ErrorIs(t, err, mongo.ErrNoDocuments)
+	fetched, err := store.Waitlist.GetWaitlistEntry(ctx, db.WaitlistFilter{SeatId: seats[0].Id, Status: types.WaitlistOffered})
+	require.NoError(t, err)
+	assert.Equal(t, early.Id, fetched.Id)
+	_, err = store.Waitlist.JoinWaitlist(ctx, &types.WaitlistEntry{FlightId: flight.Id, Class: types.Economy, UserId: early.UserId, Status: types.WaitlistWaiting, JoinedAt: now})
+	assert.ErrorIs(t, err, types.ErrAlreadyWaitlisted)
+
+	// users whose offer expired may join again
+	expired, err := store.Waitlist.UpdateWaitlistEntry(ctx, early.Id, types.WaitlistOffered, types.WaitlistExpired, offered.Offer)
+	require.NoError(t, err)
+	assert.Equal(t, types.WaitlistExpired, expired.Status)
+	join(early.UserId, types.LoyaltyMember, now.Add(2*time.Minute))
+	waiting, err := store.Waitlist.GetWaitlist(ctx, db.WaitlistFilter{FlightId: flight.Id, Class: types.Economy, Status: types.WaitlistWaiting}, &db.Pagination{Limit: "0"})
+	require.NoError(t, err)
+	require.Len(t, waiting, 4)
+	assert.Equal(t, early.UserId, waiting[3].UserId)
+
+	require.NoError(t, store.Waitlist.DeleteWaitlistEntry(ctx, db.WaitlistFilter{Id: gold.Id}))
+	assert.Error(t, store.Waitlist.DeleteWaitlistEntry(ctx, db.WaitlistFilter{Id: gold.Id}))
+	_, err = store.Waitlist.GetWaitlistEntry(ctx, db.WaitlistFilter{Id: gold.Id})
+	assert.ErrorIs(t, err, mongo.ErrNoDocuments)
+}
+
+func testOverbooking(t *testing.T, store *db.Store) {
+	ctx := context.Background()
+	user := newUser(t, store, "fp@test.com")
+	flight, seats := newFlightWithPrices(t, store, types.CreateFlightParams{
+		Airline:       "Delta",
+		Departure:     "JFK",
+		Arrival:       "LAX",
+		DepartureTime: time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339),
+		ArrivalTime:   time.Now().Add(30 * time.Hour).UTC().Format(time.RFC3339),
+	}, []string{"100", "150"})
+	overbooking := 1
+	_, err := store.Flight.UpdateFlight(ctx, db.FlightFilter{Id: flight.Id}, types.UpdateFlightParams{Overbooking: &overbooking})
+	require.NoError(t, err)
+	oversold := func() int {
+		fetched, err := store.Flight.GetFlight(ctx, db.FlightFilter{Id: flight.Id})
+		require.NoError(t, err)
+		assert.Equal(t, 1, fetched.Overbooking)
+		return fetched.Oversold
+	}
+
+	// nothing is sold beyond the seats while some are left
+	_, err = store.Reservation.CreateUnassignedReservation(ctx, flight.Id, types.Business, user.Id, nil, "", nil)
+	assert.ErrorIs(t, err, types.ErrClassNotOffered)
+	_, err = store.Reservation.CreateUnassignedReservation(ctx, flight.Id, types.Economy, user.Id, nil, "", nil)
+	assert.ErrorIs(t, err, types.ErrSeatsAvailable)
+	assigned := []*types.Reservation{}
+	for _, seat := range seats {
+		reservation, err := store.Reservation.CreateReservation(ctx, db.SeatFilter{Id: seat.Id}, user.Id, nil, "", nil)
+		require.NoError(t, err)
+		assigned = append(assigned, reservation)
+	}
+
+	// then up to the allowance, priced like the priciest seat of the class
+	unassigned, err := store.Reservation.CreateUnassignedReservation(ctx, flight.Id, types.Economy, user.Id, nil, "", nil)
+	require.NoError(t, err)
+	assert.False(t, unassigned.IsAssigned())
+	assert.Equal(t, types.Economy, unassigned.Class)
+	assert.Equal(t, flight.Id, unassigned.FlightId)
+	assert.Equal(t, types.ReservationPending, unassigned.Status)
+	assert.True(t, usd("150").Equal(unassigned.Price), unassigned.Price)
+	assert.NotEmpty(t, unassigned.Locator)
+	assert.Equal(t, 1, oversold())
+	_, err = store.Reservation.CreateUnassignedReservation(ctx, flight.Id, types.Economy, user.Id, nil, "", nil)
+	assert.ErrorIs(t, err, types.ErrOverbookingExhausted)
+	assert.Equal(t, 1, oversold())
+
+	// the seat is assigned at check-in, once one is given back
+	filter := db.ReservationFilter{Id: unassigned.Id}
+	for _, status := range []types.ReservationStatus{types.ReservationConfirmed, types.ReservationTicketed} {
+		_, err = store.Reservation.UpdateReservationStatus(ctx, filter, status)
+		require.NoError(t, err, status)
+	}
+	_, err = store.Reservation.UpdateReservationStatus(ctx, filter, types.ReservationCheckedIn)
+	assert.ErrorIs(t, err, types.ErrNoSeatToAssign)
+	fetched, err := store.Reservation.GetReservation(ctx, filter)
+	require.NoError(t, err)
+	assert.Equal(t, types.ReservationTicketed, fetched.Status)
+	assert.False(t, fetched.IsAssigned())
+
+	_, err = store.Reservation.CancelReservation(ctx, db.ReservationFilter{Id: assigned[0].Id}, nil, nil)
+	require.NoError(t, err)
+	checkedIn, err := store.Reservation.UpdateReservationStatus(ctx, filter, types.ReservationCheckedIn)
+	require.NoError(t, err)
+	assert.Equal(t, seats[0].Id, checkedIn.SeatId)
+	assert.Equal(t, 0, oversold())
+	seat, err := store.Seat.GetSeat(ctx, db.SeatFilter{Id: seats[0].Id})
+	require.NoError(t, err)
+	assert.False(t, seat.Available)
+	fetchedFlight, err := store.Flight.GetFlight(ctx, db.FlightFilter{Id: flight.Id})
+	require.NoError(t, err)
+	assert.Empty(t, fetchedFlight.Seats)
+
+	// the promotions apply like on any seat of the class
+	_, err = store.Promotion.CreatePromotion(ctx, &types.Promotion{
+		Code:         "ECONOMY10",
+		DiscountType: types.DiscountPercentage,
+		Percent:      10,
+		Classes:      []types.SeatClass{types.Economy},
+		CreatedAt:    time.Now().UTC(),
+	})
+	require.NoError(t, err)
+	unassigned, err = store.Reservation.CreateUnassignedReservation(ctx, flight.Id, types.Economy, user.Id, nil, "ECONOMY10", nil)
+	require.NoError(t, err)
+	require.NotNil(t, unassigned.Promotion)
+	assert.True(t, usd("15").Equal(unassigned.Promotion.Discount), unassigned.Promotion.Discount)
+	assert.Equal(t, 1, oversold())
+
+	// denying boarding gives the place back to the allowance, or the seat
+	// back to the flight, and records the refund
+	refund, err := types.NewRefund(usd("135"), usd("0"), types.RefundDeniedBoarding, time.Now())
+	require.NoError(t, err)
+	for _, status := range []types.ReservationStatus{types.ReservationConfirmed, types.ReservationTicketed} {
+		_, err = store.Reservation.UpdateReservationStatus(ctx, db.ReservationFilter{Id: unassigned.Id}, status)
+		require.NoError(t, err, status)
+	}
+	denied, err := store.Reservation.DenyBoarding(ctx, db.ReservationFilter{Id: unassigned.Id}, refund, nil)
+	require.NoError(t, err)
+	assert.Equal(t, types.ReservationDeniedBoarding, denied.Status)
+	require.NotNil(t, denied.Refund)
+	assert.Equal(t, types.RefundDeniedBoarding, denied.Refund.Policy)
+	assert.Equal(t, 0, oversold())
+
+	_, err = store.Reservation.UpdateReservationStatus(ctx, db.ReservationFilter{Id: assigned[1].Id}, types.ReservationConfirmed)
+	require.NoError(t, err)
+	_, err = store.Reservation.DenyBoarding(ctx, db.ReservationFilter{Id: assigned[1].Id}, nil, nil)
+	require.NoError(t, err)
+	fetchedFlight, err = store.Flight.GetFlight(ctx, db.FlightFilter{Id: flight.Id})
+	require.NoError(t, err)
+	assert.Equal(t, []primitive.ObjectID{seats[1].Id}, fetchedFlight.Seats)
+
+	// a cancelled reservation cannot be denied boarding
+	_, err = store.Reservation.DenyBoarding(ctx, db.ReservationFilter{Id: assigned[0].Id}, nil, nil)
+	var transitionErr *types.TransitionError
+	assert.ErrorAs(t, err, &transitionErr)
+}
+
+func testSeatChange(t *testing.T, store *db.Store) {
+	ctx := context.Background()
+	user := newUser(t, store, "fp@test.com")
+	params := types.CreateFlightParams{
+		Airline:       "Delta",
+		Departure:     "JFK",
+		Arrival:       "LAX",
+		DepartureTime: time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339),
+		ArrivalTime:   time.Now().Add(30 * time.Hour).UTC().Format(time.RFC3339),
+	}
+	flight, seats := newFlightWithPrices(t, store, params, []string{"100", "150", "80"})
+	_, others := newFlight(t, store, 1)
+	seatIds := func() []primitive.ObjectID {
+		fetched, err := store.Flight.GetFlight(ctx, db.FlightFilter{Id: flight.Id})
+		require.NoError(t, err)
+		return fetched.Seats
+	}
+	available := func(seat *types.Seat) bool {
+		fetched, err := store.Seat.GetSeat(ctx, db.SeatFilter{Id: seat.Id})
+		require.NoError(t, err)
+		return fetched.Available
+	}
+
+	reservation, err := store.Reservation.CreateReservation(ctx, db.SeatFilter{Id: seats[0].Id}, user.Id, nil, "", nil)
+	require.NoError(t, err)
+	filter := db.ReservationFilter{Id: reservation.Id}
+
+	// a dearer seat is only taken once the difference is charged
+	charge := &types.Payment{Provider: "fake", Reference: "fake_1", Status: types.PaymentCaptured, Amount: usd("40"), UpdatedAt: time.Now().UTC()}
+	_, err = store.Reservation.ChangeSeat(ctx, filter, db.SeatFilter{Id: seats[1].Id}, nil)
+	assert.ErrorIs(t, err, types.ErrFareChanged)
+	_, err = store.Reservation.ChangeSeat(ctx, filter, db.SeatFilter{Id: seats[1].Id}, charge)
+	assert.ErrorIs(t, err, types.ErrFareChanged)
+	assert.True(t, available(seats[1]))
+
+	// the old seat is given back and the new one taken, priced like it is
+	charge.Amount = usd("50")
+	changed, err := store.Reservation.ChangeSeat(ctx, filter, db.SeatFilter{Id: seats[1].Id}, charge)
+	require.NoError(t, err)
+	assert.Equal(t, seats[1].Id, changed.SeatId)
+	assert.True(t, usd("150").Equal(changed.Price), changed.Price)
+	require.Len(t, changed.SeatChanges, 1)
+	assert.Equal(t, seats[0].Id, changed.SeatChanges[0].FromSeatId)
+	assert.Equal(t, seats[1].Id, changed.SeatChanges[0].ToSeatId)
+	assert.True(t, usd("50").Equal(changed.SeatChanges[0].Difference), changed.SeatChanges[0].Difference)
+	if assert.NotNil(t, changed.SeatChanges[0].Payment) {
+		assert.Equal(t, "fake_1", changed.SeatChanges[0].Payment.Reference)
+	}
+	assert.True(t, available(seats[0]))
+	assert.False(t, available(seats[1]))
+	assert.ElementsMatch(t, []primitive.ObjectID{seats[0].Id, seats[2].Id}, seatIds())
+
+	_, err = store.Reservation.ChangeSeat(ctx, filter, db.SeatFilter{Id: seats[2].Id}, charge)
+	assert.ErrorIs(t, err, types.ErrFareChanged)
+	changed, err = store.Reservation.ChangeSeat(ctx, filter, db.SeatFilter{Id: seats[2].Id}, nil)
+	require.NoError(t, err)
+	require.Len(t, changed.SeatChanges, 2)
+	assert.Nil(t, changed.SeatChanges[1].Payment)
+	assert.True(t, usd("-70").Equal(changed.SeatChanges[1].Difference), changed.SeatChanges[1].Difference)
+	fetched, err := store.Reservation.GetReservation(ctx, filter)
+	require.NoError(t, err)
+	assert.Equal(t, seats[2].Id, fetched.SeatId)
+	assert.Len(t, fetched.SeatChanges, 2)
+	assert.True(t, available(seats[1]))
+	assert.ElementsMatch(t, []primitive.ObjectID{seats[0].Id, seats[1].Id}, seatIds())
+
+	// only free seats of the same flight can be taken, and nothing changes
+	// when they cannot
+	other, err := store.Reservation.CreateReservation(ctx, db.SeatFilter{Id: seats[0].Id}, user.Id, nil, "", nil)
+	require.NoError(t, err)
+	_, err = store.Reservation.ChangeSeat(ctx, filter, db.SeatFilter{Id: seats[0].Id}, nil)
+	assert.Error(t, err)
+	_, err = store.Reservation.ChangeSeat(ctx, filter, db.SeatFilter{Id: seats[2].Id}, nil)
+	assert.Error(t, err)
+	_, err = store.Reservation.ChangeSeat(ctx, filter, db.SeatFilter{Id: others[0].Id}, nil)
+	assert.ErrorIs(t, err, mongo.ErrNoDocuments)
+	_, err = store.Reservation.ChangeSeat(ctx, db.ReservationFilter{Id: primitive.NewObjectID()}, db.SeatFilter{Id: seats[1].Id}, nil)
+	assert.ErrorIs(t, err, mongo.ErrNoDocuments)
+	fetched, err = store.Reservation.GetReservation(ctx, filter)
+	require.NoError(t, err)
+	assert.Equal(t, seats[2].Id, fetched.SeatId)
+	assert.True(t, available(seats[1]))
+
+	// the cancelled reservations keep the seat they had
+	_, err = store.Reservation.CancelReservation(ctx, db.ReservationFilter{Id: other.Id}, nil, nil)
+	require.NoError(t, err)
+	_, err = store.Reservation.ChangeSeat(ctx, db.ReservationFilter{Id: other.Id}, db.SeatFilter{Id: seats[1].Id}, nil)
+	assert.ErrorIs(t, err, types.ErrSeatNotChangeable)
+	assert.True(t, available(seats[1]))
+
+	// the reservations sold beyond the seats are assigned the new one
+	overbooking := 1
+	_, err = store.Flight.UpdateFlight(ctx, db.FlightFilter{Id: flight.Id}, types.UpdateFlightParams{Overbooking: &overbooking})
+	require.NoError(t, err)
+	_, err = store.Reservation.CreateReservation(ctx, db.SeatFilter{Id: seats[0].Id}, user.Id, nil, "", nil)
+	require.NoError(t, err)
+	_, err = store.Reservation.CreateReservation(ctx, db.SeatFilter{Id: seats[1].Id}, user.Id, nil, "", nil)
+	require.NoError(t, err)
+	unassigned, err := store.Reservation.CreateUnassignedReservation(ctx, flight.Id, types.Economy, user.Id, nil, "", nil)
+	require.NoError(t, err)
+	_, err = store.Reservation.CancelReservation(ctx, filter, nil, nil)
+	require.NoError(t, err)
+	changed, err = store.Reservation.ChangeSeat(ctx, db.ReservationFilter{Id: unassigned.Id}, db.SeatFilter{Id: seats[2].Id}, nil)
+	require.NoError(t, err)
+	assert.True(t, changed.IsAssigned())
+	assert.Equal(t, types.Economy, changed.Class)
+	require.Len(t, changed.SeatChanges, 1)
+	assert.True(t, changed.SeatChanges[0].FromSeatId.IsZero())
+	assert.True(t, usd("-70").Equal(changed.SeatChanges[0].Difference), changed.SeatChanges[0].Difference)
+	fetchedFlight, err := store.Flight.GetFlight(ctx, db.FlightFilter{Id: flight.Id})
+	require.NoError(t, err)
+	assert.Equal(t, 0, fetchedFlight.Oversold)
+	assert.Empty(t, fetchedFlight.Seats)
+}
+
+func testBookings(t *testing.T, store *db.Store) {
+	ctx := context.Background()
+	user := newUser(t, store, "fp@test.com")
+	outbound, outboundSeats := newFlight(t, store, 3)
+	inbound, inboundSeats := newFlight(t, store, 2)
+
+	companion := &types.Passenger{FirstName: "Jane", LastName: "Potato", DateOfBirth: "2015-06-01", Type: types.Child}
+	booking, err := store.Reservation.CreateBooking(ctx, []db.PassengerSeat{
+		{Seat: db.SeatFilter{Id: outboundSeats[0].Id, FlightId: outbound.Id}},
+		{Seat: db.SeatFilter{Id: outboundSeats[1].Id, FlightId: outbound.Id}, Passenger: companion},
+		{Seat: db.SeatFilter{Id: inboundSeats[0].Id, FlightId: inbound.Id}},
+	}, user.Id)
+	require.NoError(t, err)
+	assert.False(t, booking.Id.IsZero())
+	assert.Equal(t, user.Id, booking.UserId)
+	assert.Len(t, booking.ReservationIds, 3)
+	require.Len(t, booking.Reservations, 3)
+	for _, reservation := range booking.Reservations {
+		assert.Equal(t, booking.Id, reservation.BookingId)
+		assert.Equal(t, user.Id, reservation.UserId)
+		assert.Contains(t, booking.ReservationIds, reservation.Id)
+	}
+
+	fetched, err := store.Reservation.GetBooking(ctx, db.BookingFilter{Id: booking.Id})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, booking.ReservationIds, fetched.ReservationIds)
+	assert.Len(t, fetched.Reservations, 3)
+
+	assert.True(t, types.IsValidLocator(booking.Locator))
+	locators := map[string]bool{booking.Locator: true}
+	for _, reservation := range booking.Reservations {
+		locators[reservation.Locator] = true
+	}
+	assert.Len(t, locators, 4)
+	located, err := store.Reservation.GetBooking(ctx, db.BookingFilter{Locator: booking.Locator})
+	require.NoError(t, err)
+	assert.Equal(t, booking.Id, located.Id)
+
+	onBoard, err := store.Reservation.GetReservations(ctx, db.ReservationFilter{FlightId: outbound.Id}, &db.Pagination{})
+	require.NoError(t, err)
+	require.Len(t, onBoard, 2)
+	passengers := []*types.Passenger{}
+	for _, reservation := range onBoard {
+		passengers = append(passengers, reservation.Passenger)
+	}
+	assert.Contains(t, passengers, companion)
+
+	fetchedFlight, err := store.Flight.GetFlight(ctx, db.FlightFilter{Id: outbound.Id})
+	require.NoError(t, err)
+	assert.Equal(t, []primitive.ObjectID{outboundSeats[2].Id}, fetchedFlight.Seats)
+
+	// the second inbound seat is free but the first one is already taken, so
+	// nothing must be reserved
+	_, err = store.Reservation.CreateBooking(ctx, []db.PassengerSeat{
+		{Seat: db.SeatFilter{Id: outboundSeats[2].Id, FlightId: outbound.Id}},
+		{Seat: db.SeatFilter{Id: inboundSeats[1].Id, FlightId: inbound.Id}},
+		{Seat: db.SeatFilter{Id: inboundSeats[0].Id, FlightId: inbound.Id}},
+	}, user.Id)
+	assert.Error(t, err)
+
+	for _, seat := range []*types.Seat{outboundSeats[2], inboundSeats[1]} {
+		fetchedSeat, err := store.Seat.GetSeat(ctx, db.SeatFilter{Id: seat.Id})
+		require.NoError(t, err)
+		assert.True(t, fetchedSeat.Available)
+	}
+	fetchedFlight, err = store.Flight.GetFlight(ctx, db.FlightFilter{Id: inbound.Id})
+	require.NoError(t, err)
+	assert.Equal(t, []primitive.ObjectID{inboundSeats[1].Id}, fetchedFlight.Seats)
+	reservations, err := store.Reservation.GetReservations(ctx, db.ReservationFilter{UserId: user.Id}, &db.Pagination{})
+	require.NoError(t, err)
+	assert.Len(t, reservations, 3)
+
+	_, err = store.Reservation.GetBooking(ctx, db.BookingFilter{Id: primitive.NewObjectID()})
+	assert.Error(t, err)
+}
+
+func testHolds(t *testing.T, store *db.Store) {
+	ctx := context.Background()
+	user := newUser(t, store, "fp@test.com")
+	other := newUser(t, store, "other@test.com")
+	flight, seats := newFlight(t, store, 3)
+	available := true
+
+	held, err := store.Reservation.HoldSeat(ctx, db.SeatFilter{Id: seats[0].Id}, user.Id, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.False(t, held.Available)
+	require.NotNil(t, held.HeldUntil)
+
+	// a held seat is taken for everybody but its holder
+	_, err = store.Reservation.HoldSeat(ctx, db.SeatFilter{Id: seats[0].Id}, other.Id, time.Now().Add(time.Minute))
+	assert.Error(t, err)
+	_, err = store.Reservation.CreateReservation(ctx, db.SeatFilter{Id: seats[0].Id}, other.Id, nil, "", nil)
+	assert.Error(t, err)
+	_, err = store.Reservation.ConfirmHold(ctx, db.SeatFilter{Id: seats[0].Id}, other.Id, nil, nil)
+	assert.Error(t, err)
+	fetchedSeats, err := store.Seat.GetSeats(ctx, db.SeatFilter{FlightId: flight.Id, Available: &available}, &db.Pagination{})
+	require.NoError(t, err)
+	assert.Len(t, fetchedSeats, 2)
+	fetchedFlight, err := store.Flight.GetFlight(ctx, db.FlightFilter{Id: flight.Id})
+	require.NoError(t, err)
+	assert.NotContains(t, fetchedFlight.Seats, seats[0].Id)
+
+	reservation, err := store.Reservation.ConfirmHold(ctx, db.SeatFilter{Id: seats[0].Id}, user.Id, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, user.Id, reservation.UserId)
+	assert.Equal(t, seats[0].Id, reservation.SeatId)
+	fetchedSeat, err := store.Seat.GetSeat(ctx, db.SeatFilter{Id: seats[0].Id})
+	require.NoError(t, err)
+	assert.False(t, fetchedSeat.Available)
+	assert.Nil(t, fetchedSeat.HeldUntil)
+	_, err = store.Reservation.ConfirmHold(ctx, db.SeatFilter{Id: seats[0].Id}, user.Id, nil, nil)
+	assert.Error(t, err)
+
+	// an expired hold frees the seat right away and is swept later
+	_, err = store.Reservation.HoldSeat(ctx, db.SeatFilter{Id: seats[1].Id}, user.Id, time.Now().Add(-time.Second))
+	require.NoError(t, err)
+	_, err = store.Reservation.ConfirmHold(ctx, db.SeatFilter{Id: seats[1].Id}, user.Id, nil, nil)
+	assert.Error(t, err)
+	fetchedSeats, err = store.Seat.GetSeats(ctx, db.SeatFilter{FlightId: flight.Id, Available: &available}, &db.Pagination{})
+	require.NoError(t, err)
+	assert.Len(t, fetchedSeats, 2)
+
+	_, err = store.Reservation.HoldSeat(ctx, db.SeatFilter{Id: seats[2].Id}, user.Id, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	released, err := store.Reservation.ReleaseExpiredHolds(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 1, released)
+	fetchedSeat, err = store.Seat.GetSeat(ctx, db.SeatFilter{Id: seats[1].Id})
+	require.NoError(t, err)
+	assert.True(t, fetchedSeat.Available)
+	assert.Nil(t, fetchedSeat.HeldUntil)
+	fetchedFlight, err = store.Flight.GetFlight(ctx, db.FlightFilter{Id: flight.Id})
+	require.NoError(t, err)
+	assert.Equal(t, []primitive.ObjectID{seats[1].Id}, fetchedFlight.Seats)
+
+	released, err = store.Reservation.ReleaseExpiredHolds(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 0, released)
+}
+
+func airportCodes(airports []*types.Airport) []string {
+	codes := []string{}
+	for _, airport := range airports {
+		codes = append(codes, airport.IATA)
+	}
+	return codes
+}
+
+func testAirports(t *testing.T, store *db.Store) {
+	ctx := context.Background()
+	require.NoError(t, store.Airport.Drop(ctx))
+	airports := []*types.Airport{
+		{IATA: "JFK", ICAO: "KJFK", Name: "John F. Kennedy International Airport", City: "New York", Country: "US", TimeZone: "America/New_York"},
+		{IATA: "LGA", ICAO: "KLGA", Name: "LaGuardia Airport", City: "New York", Country: "US", TimeZone: "America/New_York"},
+		{IATA: "AAA", ICAO: "NTGA", Name: "Zzz Field", City: "Anaa", Country: "PF", TimeZone: "Pacific/Tahiti"},
+		{IATA: "zzz", ICAO: "ZZZZ", Name: "Sleepy Airport", City: "Nowhere", Country: "US", TimeZone: "UTC"},
+	}
+	require.NoError(t, store.Airport.PutAirports(ctx, airports))
+
+	jfk, err := store.Airport.GetAirport(ctx, db.AirportFilter{IATA: "JFK"})
+	require.NoError(t, err)
+	assert.Equal(t, *airports[0], *jfk)
+	zzz, err := store.Airport.GetAirport(ctx, db.AirportFilter{IATA: "ZZZ"})
+	require.NoError(t, err, "codes are stored upper case")
+	assert.Equal(t, "Sleepy Airport", zzz.Name)
+	_, err = store.Airport.GetAirport(ctx, db.AirportFilter{IATA: "LAX"})
+	assert.Error(t, err)
+
+	queries := map[string][]string{
+		"":         {"AAA", "JFK", "LGA", "ZZZ"},
+		"new york": {"JFK", "LGA"},
+		"kenn":     {"JFK"},
+		"kjf":      {"JFK"},
+		"lag":      {"LGA"},
+		"ork":      {},
+		"zzz":      {"ZZZ", "AAA"},
+		"f.":       {"JFK"},
+	}
+	for query, expected := range queries {
+		found, err := store.Airport.GetAirports(ctx, db.AirportFilter{Query: query}, &db.Pagination{})
+		require.NoError(t, err)
+		assert.Equal(t, expected, airportCodes(found), query)
+	}
+
+	// putting an airport again replaces it
+	require.NoError(t, store.Airport.PutAirports(ctx, []*types.Airport{{IATA: "LGA", Name: "New LaGuardia", City: "New York", TimeZone: "America/New_York"}}))
+	all, err := store.Airport.GetAirports(ctx, db.AirportFilter{}, &db.Pagination{})
+	require.NoError(t, err)
+	assert.Len(t, all, 4)
+	lga, err := store.Airport.GetAirport(ctx, db.AirportFilter{IATA: "LGA"})
+	require.NoError(t, err)
+	assert.Equal(t, "New LaGuardia", lga.Name)
+	assert.Empty(t, lga.ICAO)
+}
+
+func testAircraft(t *testing.T, store *db.Store) {
+	ctx := context.Background()
+	require.NoError(t, store.Aircraft.Drop(ctx))
+	aircraft := []*types.Aircraft{
+		{
+			Code:         "B738",
+			Name:         "Boeing 737-800",
+			Zones:        []types.CabinZone{{Class: types.Economy, FromRow: 1, ToRow: 30, Layout: "ABC-DEF"}},
+			ExitRows:     []int{15, 16},
+			BlockedSeats: []string{},
+		},
+		{
+			Code:         "A320",
+			Name:         "Airbus A320",
+			Zones:        []types.CabinZone{{Class: types.Business, FromRow: 1, ToRow: 3, Layout: "AC-DF"}},
+			ExitRows:     []int{},
+			BlockedSeats: []string{"1A"},
+		},
+	}
+	require.NoError(t, store.Aircraft.PutAircraft(ctx, aircraft))
+
+	fetched, err := store.Aircraft.GetAircraft(ctx, db.AircraftFilter{Code: "A320"})
+	require.NoError(t, err)
+	assert.Equal(t, *aircraft[1], *fetched)
+	_, err = store.Aircraft.GetAircraft(ctx, db.AircraftFilter{Code: "B77W"})
+	assert.Error(t, err)
+
+	all, err := store.Aircraft.GetAircraftTypes(ctx, &db.Pagination{})
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+	assert.Equal(t, "A320", all[0].Code)
+	assert.Equal(t, "B738", all[1].Code)
+
+	// putting an aircraft again replaces it
+	replaced := *aircraft[0]
+	replaced.ExitRows = []int{14}
+	require.NoError(t, store.Aircraft.PutAircraft(ctx, []*types.Aircraft{&replaced}))
+	fetched, err = store.Aircraft.GetAircraft(ctx, db.AircraftFilter{Code: "B738"})
+	require.NoError(t, err)
+	assert.Equal(t, []int{14}, fetched.ExitRows)
+	all, err = store.Aircraft.GetAircraftTypes(ctx, &db.Pagination{})
+	require.NoError(t, err)
+	assert.Len(t, all, 2)
+}
+
+func testPagination(t *testing.T, store *db.Store) {
+	ctx := context.Background()
+	for i := 0; i < 15; i++ {
+		newUser(t, store, fmt.Sprintf("user%d@test.com", i))
+		newFlight(t, store, 0)
+	}
+
+	pages := []struct {
+		pagination db.Pagination
+		expected   int
+	}{
+		{db.Pagination{}, 10},
+		{db.Pagination{Page: "1", Limit: "10"}, 10},
+		{db.Pagination{Page: "2", Limit: "10"}, 5},
+		{db.Pagination{Page: "3", Limit: "10"}, 0},
+		{db.Pagination{Page: "2", Limit: "4"}, 4},
+		{db.Pagination{Page: "not a number", Limit: "not a number"}, 10},
+	}
+	for _, page := range pages {
+		users, err := store.User.GetUsers(ctx, &page.pagination)
+		require.NoError(t, err)
+		assert.Len(t, users, page.expected, "users page %+v", page.pagination)
+
+		flights, err := store.Flight.GetFlights(ctx, db.FlightFilter{}, db.SortByNone, &page.pagination)
+		require.NoError(t, err)
+		assert.Len(t, flights, page.expected, "flights page %+v", page.pagination)
+	}
+
+	first, err := store.User.GetUsers(ctx, &db.Pagination{Page: "1", Limit: "10"})
+	require.NoError(t, err)
+	second, err := store.User.GetUsers(ctx, &db.Pagination{Page: "2", Limit: "10"})
+	require.NoError(t, err)
+	seen := map[primitive.ObjectID]bool{}
+	for _, user := range append(first, second...) {
+		assert.False(t, seen[user.Id], "user %s returned twice", user.Id.Hex())
+		seen[user.Id] = true
+	}
+	assert.Len(t, seen, 15)
+}
+
+func testDrop(t *testing.T, store *db.Store) {
+	ctx := context.Background()
+	user := newUser(t, store, "fp@test.com")
+	_, seats := newFlight(t, store, 1)
+	_, err := store.Reservation.CreateReservation(ctx, db.SeatFilter{Id: seats[0].Id}, user.Id, nil, "", nil)
+	require.NoError(t, err)
+
+	drop(t, store)
+
+	users, err := store.User.GetUsers(ctx, &db.Pagination{})
+	require.NoError(t, err)
+	assert.Empty(t, users)
+	flights, err := store.Flight.GetFlights(ctx, db.FlightFilter{}, db.SortByNone, &db.Pagination{})
+	require.NoError(t, err)
+	assert.Empty(t, flights)
+	seatsLeft, err := store.Seat.GetSeats(ctx, db.SeatFilter{}, &db.Pagination{})
+	require.NoError(t, err)
+	assert.Empty(t, seatsLeft)
+	reservations, err := store.Reservation.GetReservations(ctx, db.ReservationFilter{}, &db.Pagination{})
+	require.NoError(t, err)
+	assert.Empty(t, reservations)
+
+	_, err = store.User.CreateUser(ctx, &types.User{Email: "after@drop.com"})
+	assert.NoError(t, err)
+}
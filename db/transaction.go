@@ -0,0 +1,26 @@
+package db
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+// withSnapshotTxn runs fn in a transaction of its own session, reading a
+// snapshot and writing to a majority of the replica set, and returns what fn
+// returned. fn may be retried on transient errors.
+func withSnapshotTxn(ctx context.Context, client *mongo.Client, fn func(mongo.SessionContext) (interface{}, error)) (interface{}, error) {
+	session, err := client.StartSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.EndSession(ctx)
+
+	txnOpts := options.Transaction().
+		SetWriteConcern(writeconcern.New(writeconcern.WMajority())).
+		SetReadConcern(readconcern.Snapshot())
+	return session.WithTransaction(ctx, fn, txnOpts)
+}
@@ -16,10 +16,10 @@ type Dropper interface {
 
 type UserStorer interface {
 	CreateUser(ctx context.Context, user *types.User) (*types.User, error)
-	GetUser(ctx context.Context, filter Map) (*types.User, error)
+	GetUser(ctx context.Context, filter UserFilter) (*types.User, error)
 	GetUsers(ctx context.Context, pagination *Pagination) ([]*types.User, error)
-	DeleteUser(ctx context.Context, filter Map) (string, error)
-	UpdateUser(ctx context.Context, filter Map, values types.UpdateUserParams) (string, error)
+	DeleteUser(ctx context.Context, filter UserFilter) (string, error)
+	UpdateUser(ctx context.Context, filter UserFilter, values types.UpdateUserParams) (string, error)
 	Dropper
 }
 
@@ -40,9 +40,9 @@ func NewMongoDbUserStore(client *mongo.Client) *MongoDbUserStore {
 	}
 }
 
-func (db *MongoDbUserStore) GetUser(ctx context.Context, filter Map) (*types.User, error) {
+func (db *MongoDbUserStore) GetUser(ctx context.Context, filter UserFilter) (*types.User, error) {
 	user := &types.User{}
-	if err := db.collection.FindOne(ctx, filter).Decode(&user); err != nil {
+	if err := db.collection.FindOne(ctx, filter.toBson()).Decode(&user); err != nil {
 		return nil, err
 	}
 
@@ -71,8 +71,8 @@ func (db *MongoDbUserStore) CreateUser(ctx context.Context, user *types.User) (*
 	return user, err
 }
 
-func (db *MongoDbUserStore) DeleteUser(ctx context.Context, filter Map) (string, error) {
-	res, err := db.collection.DeleteOne(ctx, filter)
+func (db *MongoDbUserStore) DeleteUser(ctx context.Context, filter UserFilter) (string, error) {
+	res, err := db.collection.DeleteOne(ctx, filter.toBson())
 	if err != nil || res.DeletedCount == 0 {
 		return "", fmt.Errorf("user not found")
 	}
@@ -85,9 +85,9 @@ func (db *MongoDbUserStore) Drop(ctx context.Context) error {
 	return err
 }
 
-func (db *MongoDbUserStore) UpdateUser(ctx context.Context, filter Map, values types.UpdateUserParams) (string, error) {
-	result, err := db.collection.UpdateOne(ctx, filter, Map{"$set": values})
-	if err != nil || result.ModifiedCount == 0 {
+func (db *MongoDbUserStore) UpdateUser(ctx context.Context, filter UserFilter, values types.UpdateUserParams) (string, error) {
+	result, err := db.collection.UpdateOne(ctx, filter.toBson(), Map{"$set": values})
+	if err != nil || result.MatchedCount == 0 {
 		return "", fmt.Errorf("user not found")
 	}
 	return "", nil
@@ -0,0 +1,136 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/fabrizioperria/goflight/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// WaitlistStorer manages the waitlists of the flights. The entries move
+// between statuses with UpdateWaitlistEntry only, which lets concurrent
+// offers of freed seats never pick the same entry.
+type WaitlistStorer interface {
+	// JoinWaitlist adds entry to the waitlist of its flight and class,
+	// failing with types.ErrAlreadyWaitlisted when the user is waiting or
+	// offered a seat there already.
+	JoinWaitlist(ctx context.Context, entry *types.WaitlistEntry) (*types.WaitlistEntry, error)
+	GetWaitlistEntry(ctx context.Context, filter WaitlistFilter) (*types.WaitlistEntry, error)
+	// GetWaitlist returns the entries matching filter in the order of the
+	// queue, as types.CompareWaitlistEntries sorts them.
+	GetWaitlist(ctx context.Context, filter WaitlistFilter, pagination *Pagination) ([]*types.WaitlistEntry, error)
+	// UpdateWaitlistEntry moves the entry with id from status from to status
+	// to, setting offer on it. It fails with mongo.ErrNoDocuments when the
+	// entry is not in status from anymore.
+	UpdateWaitlistEntry(ctx context.Context, id primitive.ObjectID, from, to types.WaitlistStatus, offer *types.WaitlistOffer) (*types.WaitlistEntry, error)
+	DeleteWaitlistEntry(ctx context.Context, filter WaitlistFilter) error
+	Dropper
+}
+
+const (
+	waitlistCollection = "waitlists"
+)
+
+type MongoDbWaitlistStore struct {
+	client     *mongo.Client
+	collection *mongo.Collection
+}
+
+func NewMongoDbWaitlistStore(client *mongo.Client) *MongoDbWaitlistStore {
+	dbName := os.Getenv("DB_NAME")
+	return &MongoDbWaitlistStore{
+		client:     client,
+		collection: client.Database(dbName).Collection(waitlistCollection),
+	}
+}
+
+func (db *MongoDbWaitlistStore) EnsureIndexes(ctx context.Context) error {
+	_, err := db.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "flight_id", Value: 1},
+			{Key: "class", Value: 1},
+			{Key: "joined_at", Value: 1},
+			{Key: "priority", Value: -1},
+		},
+	})
+	return err
+}
+
+// JoinWaitlist checks the user is not waiting already before adding the
+// entry, without a transaction: a user joining twice at the same time may
+// end up in the queue twice, and is offered a single seat all the same.
+func (db *MongoDbWaitlistStore) JoinWaitlist(ctx context.Context, entry *types.WaitlistEntry) (*types.WaitlistEntry, error) {
+	pending := Map{
+		"flight_id": entry.FlightId,
+		"class":     entry.Class,
+		"user_id":   entry.UserId,
+		"status":    Map{"$in": []types.WaitlistStatus{types.WaitlistWaiting, types.WaitlistOffered}},
+	}
+	count, err := db.collection.CountDocuments(ctx, pending)
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, types.ErrAlreadyWaitlisted
+	}
+	result, err := db.collection.InsertOne(ctx, entry)
+	if err != nil {
+		return nil, err
+	}
+	entry.Id = result.InsertedID.(primitive.ObjectID)
+	return entry, nil
+}
+
+func (db *MongoDbWaitlistStore) GetWaitlistEntry(ctx context.Context, filter WaitlistFilter) (*types.WaitlistEntry, error) {
+	entry := &types.WaitlistEntry{}
+	if err := db.collection.FindOne(ctx, filter.toBson()).Decode(entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func (db *MongoDbWaitlistStore) GetWaitlist(ctx context.Context, filter WaitlistFilter, pagination *Pagination) ([]*types.WaitlistEntry, error) {
+	opts := pagination.ToFindOptions().SetSort(bson.D{
+		{Key: "joined_at", Value: 1},
+		{Key: "priority", Value: -1},
+		{Key: "_id", Value: 1},
+	})
+	cursor, err := db.collection.Find(ctx, filter.toBson(), opts)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*types.WaitlistEntry, 0)
+	err = cursor.All(ctx, &results)
+	return results, err
+}
+
+func (db *MongoDbWaitlistStore) UpdateWaitlistEntry(ctx context.Context, id primitive.ObjectID, from, to types.WaitlistStatus, offer *types.WaitlistOffer) (*types.WaitlistEntry, error) {
+	update := Map{"$set": Map{"status": to, "offer": offer}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	entry := &types.WaitlistEntry{}
+	err := db.collection.FindOneAndUpdate(ctx, Map{"_id": id, "status": from}, update, opts).Decode(entry)
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func (db *MongoDbWaitlistStore) DeleteWaitlistEntry(ctx context.Context, filter WaitlistFilter) error {
+	result, err := db.collection.DeleteOne(ctx, filter.toBson())
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("waitlist entry not found")
+	}
+	return nil
+}
+
+func (db *MongoDbWaitlistStore) Drop(ctx context.Context) error {
+	return db.collection.Drop(ctx)
+}
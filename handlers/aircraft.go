@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/fabrizioperria/goflight/db"
+	"github.com/fabrizioperria/goflight/types"
+	"github.com/gofiber/fiber/v2"
+)
+
+type AircraftHandler struct {
+	store db.Store
+}
+
+func NewAircraftHandler(store db.Store) *AircraftHandler {
+	return &AircraftHandler{
+		store: store,
+	}
+}
+
+func (h *AircraftHandler) HandleGetAircraftTypesv1(ctx *fiber.Ctx) error {
+	pagination := db.Pagination{
+		Page:  ctx.Query("page"),
+		Limit: ctx.Query("limit"),
+	}
+	aircraft, err := h.store.Aircraft.GetAircraftTypes(ctx.Context(), &pagination)
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return ctx.JSON(aircraft)
+}
+
+func (h *AircraftHandler) HandleGetAircraftv1(ctx *fiber.Ctx) error {
+	code := strings.ToUpper(ctx.Params("code"))
+	aircraft, err := h.store.Aircraft.GetAircraft(ctx.Context(), db.AircraftFilter{Code: code})
+	if err != nil {
+		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	return ctx.JSON(aircraft)
+}
+
+// HandlePutAircraftv1 defines the seat-map template of an aircraft type. It
+// only applies to the flights created afterwards.
+func (h *AircraftHandler) HandlePutAircraftv1(ctx *fiber.Ctx) error {
+	aircraft := types.Aircraft{}
+	if err := ctx.BodyParser(&aircraft); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	aircraft.Code = strings.ToUpper(ctx.Params("code"))
+	if err := aircraft.Validate(); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := h.store.Aircraft.PutAircraft(ctx.Context(), []*types.Aircraft{&aircraft}); err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return ctx.JSON(aircraft)
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/fabrizioperria/goflight/db/memory"
+	"github.com/fabrizioperria/goflight/types"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestPutAircraftv1(t *testing.T) {
+	aircraftHandler := NewAircraftHandler(*memory.NewStore())
+	app := fiber.New()
+	app.Put("/aircraft/:code", aircraftHandler.HandlePutAircraftv1)
+	app.Get("/aircraft/:code", aircraftHandler.HandleGetAircraftv1)
+
+	put := func(aircraft types.Aircraft) int {
+		return send(t, app, "PUT", "/aircraft/crj9", aircraft, nil)
+	}
+
+	zone := types.CabinZone{Class: types.Economy, FromRow: 1, ToRow: 20, Layout: "AB-CD"}
+	invalid := []types.Aircraft{
+		{Name: "no zones"},
+		{Zones: []types.CabinZone{{Class: types.Economy, FromRow: 1, ToRow: 20, Layout: "AB--CD"}}},
+		{Zones: []types.CabinZone{{Class: types.Economy, FromRow: 1, ToRow: 20, Layout: "-ABCD"}}},
+		{Zones: []types.CabinZone{{Class: types.Economy, FromRow: 1, ToRow: 20, Layout: "ABA"}}},
+		{Zones: []types.CabinZone{zone, {Class: types.Business, FromRow: 20, ToRow: 21, Layout: "A-C"}}},
+		{Zones: []types.CabinZone{zone}, ExitRows: []int{21}},
+		{Zones: []types.CabinZone{zone}, BlockedSeats: []string{"1E"}},
+	}
+	for _, aircraft := range invalid {
+		assert.Equal(t, fiber.StatusBadRequest, put(aircraft), aircraft)
+	}
+
+	aircraft := types.Aircraft{Name: "Bombardier CRJ900", Zones: []types.CabinZone{zone}, ExitRows: []int{10}, BlockedSeats: []string{"20D"}}
+	assert.Equal(t, fiber.StatusOK, put(aircraft))
+
+	fetched := types.Aircraft{}
+	assert.Equal(t, fiber.StatusOK, send(t, app, "GET", "/aircraft/CRJ9", nil, &fetched))
+	assert.Equal(t, "CRJ9", fetched.Code)
+	assert.Len(t, fetched.SeatMap(primitive.NewObjectID()), 79)
+}
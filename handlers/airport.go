@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"github.com/fabrizioperria/goflight/db"
+	"github.com/fabrizioperria/goflight/types"
+	"github.com/gofiber/fiber/v2"
+)
+
+type AirportHandler struct {
+	store db.Store
+}
+
+func NewAirportHandler(store db.Store) *AirportHandler {
+	return &AirportHandler{
+		store: store,
+	}
+}
+
+// HandleGetAirportsv1 autocompletes the airports matching the q query on
+// their codes, names and cities.
+func (h *AirportHandler) HandleGetAirportsv1(ctx *fiber.Ctx) error {
+	filter := db.AirportFilter{Query: ctx.Query("q")}
+	pagination := db.Pagination{
+		Page:  ctx.Query("page"),
+		Limit: ctx.Query("limit"),
+	}
+	airports, err := h.store.Airport.GetAirports(ctx.Context(), filter, &pagination)
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return ctx.JSON(airports)
+}
+
+func (h *AirportHandler) HandleGetAirportv1(ctx *fiber.Ctx) error {
+	code := types.NormalizeAirportCode(ctx.Params("code"))
+	if !types.IsValidIATACode(code) {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid IATA code"})
+	}
+	airport, err := h.store.Airport.GetAirport(ctx.Context(), db.AirportFilter{IATA: code})
+	if err != nil {
+		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	return ctx.JSON(airport)
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/fabrizioperria/goflight/db/memory"
+	"github.com/fabrizioperria/goflight/types"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetAirportsv1(t *testing.T) {
+	airportHandler := NewAirportHandler(*memory.NewStore())
+	app := fiber.New()
+	app.Get("/airports", airportHandler.HandleGetAirportsv1)
+	app.Get("/airports/:code", airportHandler.HandleGetAirportv1)
+
+	airports := []types.Airport{}
+	assert.Equal(t, fiber.StatusOK, send(t, app, "GET", "/airports?q=london", nil, &airports))
+	if assert.Len(t, airports, 2) {
+		assert.Equal(t, "LGW", airports[0].IATA)
+		assert.Equal(t, "LHR", airports[1].IATA)
+		assert.Equal(t, "Europe/London", airports[1].TimeZone)
+	}
+
+	airport := types.Airport{}
+	assert.Equal(t, fiber.StatusOK, send(t, app, "GET", "/airports/jfk", nil, &airport))
+	assert.Equal(t, "KJFK", airport.ICAO)
+	assert.Equal(t, "New York", airport.City)
+
+	assert.Equal(t, fiber.StatusNotFound, send(t, app, "GET", "/airports/XXX", nil, nil))
+	assert.Equal(t, fiber.StatusBadRequest, send(t, app, "GET", "/airports/JFKX", nil, nil))
+}
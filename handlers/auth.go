@@ -35,7 +35,7 @@ func (h *AuthHandler) HandleAuthenticate(ctx *fiber.Ctx) error {
 		return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid credentials"})
 	}
 
-	filter := db.Map{"email": authParams.Email}
+	filter := db.UserFilter{Email: authParams.Email}
 	user, err := h.store.User.GetUser(ctx.Context(), filter)
 	if err != nil {
 		return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid credentials"})
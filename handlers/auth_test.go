@@ -11,30 +11,21 @@ import (
 
 	"github.com/fabrizioperria/goflight/db"
 	"github.com/fabrizioperria/goflight/db/fixtures"
+	"github.com/fabrizioperria/goflight/db/memory"
 	"github.com/fabrizioperria/goflight/types"
 	"github.com/gofiber/fiber/v2"
 	"github.com/stretchr/testify/assert"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 func setupAuthDb() (*testUserDb, error) {
-	client, err := mongo.Connect(context.TODO(), options.Client().ApplyURI(uri))
-	if err != nil {
-		return nil, err
-	}
-	userStore := db.NewMongoDbUserStore(client)
-	mainStore := db.Store{User: userStore}
-	return &testUserDb{Store: mainStore, Client: client}, nil
+	mainStore := db.Store{User: memory.NewUserStore()}
+	return &testUserDb{Store: mainStore}, nil
 }
 
 func teardownAuthDb(t *testing.T, db *testUserDb) {
 	if err := db.Store.User.Drop(context.Background()); err != nil {
 		t.Fatal(err)
 	}
-	if err := db.Client.Disconnect(context.TODO()); err != nil {
-		t.Fatal(err)
-	}
 }
 
 func TestAuthenticate(t *testing.T) {
@@ -42,7 +33,7 @@ func TestAuthenticate(t *testing.T) {
 	assert.NoError(t, err)
 	defer teardownAuthDb(t, db)
 
-	app := SetupRoutes(db.Store, fiber.Config{})
+	app := setupRoutes(db.Store)
 
 	user, _ := fixtures.AuthenticateUser(&db.Store)
 
@@ -89,7 +80,7 @@ func TestAuthenticateInvalidCredentials(t *testing.T) {
 	assert.NoError(t, err)
 	defer teardownAuthDb(t, db)
 
-	app := SetupRoutes(db.Store, fiber.Config{})
+	app := setupRoutes(db.Store)
 
 	user, _ := fixtures.AuthenticateUser(&db.Store)
 
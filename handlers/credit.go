@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"github.com/fabrizioperria/goflight/db"
+	"github.com/fabrizioperria/goflight/types"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type CreditHandler struct {
+	store db.Store
+}
+
+func NewCreditHandler(store db.Store) *CreditHandler {
+	return &CreditHandler{
+		store: store,
+	}
+}
+
+// HandleGetCreditsv1 lists the credits of a user, spent and expired ones
+// included, to the user and to admins.
+func (h *CreditHandler) HandleGetCreditsv1(ctx *fiber.Ctx) error {
+	uid, err := primitive.ObjectIDFromHex(ctx.Params("uid"))
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	user := ctx.Context().UserValue("user").(*types.User)
+	if uid != user.Id && !user.IsAdmin {
+		return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	pagination := db.Pagination{
+		Page:  ctx.Query("page"),
+		Limit: ctx.Query("limit"),
+	}
+	credits, err := h.store.Credit.GetCredits(ctx.Context(), db.CreditFilter{UserId: uid}, &pagination)
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return ctx.JSON(credits)
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fabrizioperria/goflight/cancellation"
+	"github.com/fabrizioperria/goflight/db"
+	"github.com/fabrizioperria/goflight/loyalty"
+	"github.com/fabrizioperria/goflight/payments"
+	"github.com/fabrizioperria/goflight/pricing"
+	"github.com/fabrizioperria/goflight/types"
+	"github.com/fabrizioperria/goflight/waitlist"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+type testCreditDb struct {
+	*testReservationDb
+
+	reservationHandler *ReservationHandler
+	creditHandler      *CreditHandler
+}
+
+// setupCreditDb sells the seats of the flight as non-refundable fares, which
+// are given back as credit when cancelled.
+func setupCreditDb() (*testCreditDb, error) {
+	testDb, err := setupReservationDb("100", "100", "100")
+	if err != nil {
+		return nil, err
+	}
+	config := pricing.DefaultConfig()
+	config.Airlines = map[string]pricing.Rules{
+		testDb.Flight.Airline: {Cancellation: &pricing.CancellationPolicy{NonRefundable: true, CreditValidityDays: 365}},
+	}
+	processor := payments.NewProcessor(payments.NewFakeGateway(), testDb.Store.Reservation, testDb.Store.Credit)
+	program := loyalty.NewProgram(*testDb.Store, loyalty.DefaultRules())
+	queue := waitlist.NewQueue(*testDb.Store, program, waitlist.LogNotifier{}, waitlist.DefaultOfferTTL)
+	settler := cancellation.NewSettler(*testDb.Store, processor, program, queue)
+	reservationHandler := NewReservationHandler(*testDb.Store, pricing.NewEngine(config), pricing.DefaultExchangeRates(), processor, program, queue, settler)
+	return &testCreditDb{
+		testReservationDb:  testDb,
+		reservationHandler: reservationHandler,
+		creditHandler:      NewCreditHandler(*testDb.Store),
+	}, nil
+}
+
+// as serves the credits, and the reservations that give and spend them, to
+// user.
+func (testDb *testCreditDb) as(user *types.User) *fiber.App {
+	app := fiber.New()
+	app.Use(authenticateAs(user))
+	app.Post("/flights/:fid/seats/:sid/reservations", testDb.reservationHandler.HandlePostCreateReservationv1)
+	app.Delete("/reservations/:rid", testDb.reservationHandler.HandleDeleteReservationv1)
+	app.Get("/users/:uid/credits", testDb.creditHandler.HandleGetCreditsv1)
+	return app
+}
+
+func TestCreditsv1(t *testing.T) {
+	testDb, err := setupCreditDb()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer teardownReservationDb(t, testDb.testReservationDb)
+	owner, seats := testDb.Owner, testDb.Seats
+	app := testDb.as(owner)
+	getCredits := func(user *types.User) (int, []*types.Credit) {
+		credits := []*types.Credit{}
+		status := send(t, testDb.as(user), "GET", "/users/"+owner.Id.Hex()+"/credits", nil, &credits)
+		return status, credits
+	}
+
+	// cancelling a non-refundable fare gives credit instead
+	status, reservation := reserve(t, app, seats[0], nil)
+	assert.Equal(t, fiber.StatusCreated, status)
+	cancelled := &types.Reservation{}
+	status = send(t, app, "DELETE", "/reservations/"+reservation.Id.Hex(), nil, cancelled)
+	assert.Equal(t, fiber.StatusOK, status)
+	if assert.NotNil(t, cancelled.Refund) {
+		assert.Equal(t, types.RefundNonRefundable, cancelled.Refund.Policy)
+		assert.False(t, cancelled.Refund.CreditId.IsZero())
+	}
+
+	status, credits := getCredits(owner)
+	assert.Equal(t, fiber.StatusOK, status)
+	if !assert.Len(t, credits, 1) {
+		return
+	}
+	assert.Equal(t, cancelled.Refund.CreditId, credits[0].Id)
+	assert.Equal(t, reservation.Id, credits[0].IssuedFor)
+	assert.True(t, types.MustParseMoney("100", "USD").Equal(credits[0].Balance))
+	status, _ = getCredits(testDb.Other)
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+
+	// the credit pays for a new reservation, once
+	status, reservation = reserve(t, app, seats[1], types.ReservationBody{CreditId: credits[0].Id.Hex()})
+	assert.Equal(t, fiber.StatusCreated, status)
+	assert.Equal(t, types.ReservationConfirmed, reservation.Status)
+	if assert.NotNil(t, reservation.Credit) {
+		assert.True(t, types.MustParseMoney("100", "USD").Equal(reservation.Credit.Amount))
+	}
+	assert.Nil(t, reservation.Payment)
+	status, _ = reserve(t, app, seats[2], types.ReservationBody{CreditId: credits[0].Id.Hex()})
+	assert.Equal(t, fiber.StatusConflict, status)
+	seat, err := testDb.Store.Seat.GetSeat(context.Background(), db.SeatFilter{Id: seats[2].Id})
+	assert.NoError(t, err)
+	assert.True(t, seat.Available)
+	status, _ = reserve(t, app, seats[2], types.ReservationBody{CreditId: "nonsense"})
+	assert.Equal(t, fiber.StatusBadRequest, status)
+}
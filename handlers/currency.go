@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/fabrizioperria/goflight/pricing"
+	"github.com/fabrizioperria/goflight/types"
+	"github.com/gofiber/fiber/v2"
+)
+
+// displayCurrency returns the currency asked with ?currency=, or "" to show
+// the prices in the currency they are stored in.
+func displayCurrency(ctx *fiber.Ctx) string {
+	return strings.ToUpper(strings.TrimSpace(ctx.Query("currency")))
+}
+
+// convertPrices converts prices in place to the display currency.
+func convertPrices(ctx *fiber.Ctx, rates pricing.ExchangeRates, prices ...*types.Money) error {
+	currency := displayCurrency(ctx)
+	if currency == "" {
+		return nil
+	}
+	for _, price := range prices {
+		converted, err := rates.Convert(*price, currency)
+		if err != nil {
+			return err
+		}
+		*price = converted
+	}
+	return nil
+}
+
+// convertFare returns fare in the display currency. The breakdown is copied
+// rather than converted in place since it may be shared with the store.
+func convertFare(ctx *fiber.Ctx, rates pricing.ExchangeRates, fare *types.FareBreakdown) (*types.FareBreakdown, error) {
+	currency := displayCurrency(ctx)
+	if currency == "" || fare == nil {
+		return fare, nil
+	}
+	return fare.Convert(func(amount types.Money) (types.Money, error) {
+		return rates.Convert(amount, currency)
+	})
+}
+
+func convertSeats(ctx *fiber.Ctx, rates pricing.ExchangeRates, seats ...*types.Seat) error {
+	for _, seat := range seats {
+		if err := convertPrices(ctx, rates, &seat.Price); err != nil {
+			return err
+		}
+		fare, err := convertFare(ctx, rates, seat.Fare)
+		if err != nil {
+			return err
+		}
+		seat.Fare = fare
+	}
+	return nil
+}
+
+// convertReservations converts every amount of reservations in place to the
+// display currency. What they point to is copied rather than converted in
+// place since it may be shared with the store.
+func convertReservations(ctx *fiber.Ctx, rates pricing.ExchangeRates, reservations ...*types.Reservation) error {
+	if displayCurrency(ctx) == "" {
+		return nil
+	}
+	for _, reservation := range reservations {
+		fare, err := convertFare(ctx, rates, reservation.Fare)
+		if err != nil {
+			return err
+		}
+		reservation.Fare = fare
+		amounts := []*types.Money{&reservation.Price}
+		if reservation.Payment != nil {
+			payment := *reservation.Payment
+			reservation.Payment = &payment
+			amounts = append(amounts, &payment.Amount)
+		}
+		if reservation.Refund != nil {
+			refund := *reservation.Refund
+			reservation.Refund = &refund
+			amounts = append(amounts, &refund.Amount, &refund.Fee)
+		}
+		if reservation.Promotion != nil {
+			promotion := *reservation.Promotion
+			reservation.Promotion = &promotion
+			amounts = append(amounts, &promotion.Discount)
+		}
+		if reservation.Credit != nil {
+			credit := *reservation.Credit
+			reservation.Credit = &credit
+			amounts = append(amounts, &credit.Amount, &credit.Restored)
+		}
+		if reservation.Loyalty != nil {
+			loyalty := *reservation.Loyalty
+			reservation.Loyalty = &loyalty
+			amounts = append(amounts, &loyalty.Amount)
+		}
+		if reservation.SeatChanges != nil {
+			reservation.SeatChanges = slices.Clone(reservation.SeatChanges)
+			for i := range reservation.SeatChanges {
+				change := &reservation.SeatChanges[i]
+				amounts = append(amounts, &change.Difference)
+				if change.Payment != nil {
+					payment := *change.Payment
+					change.Payment = &payment
+					amounts = append(amounts, &payment.Amount)
+				}
+			}
+		}
+		if err := convertPrices(ctx, rates, amounts...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
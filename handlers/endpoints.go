@@ -1,19 +1,43 @@
 package handlers
 
 import (
+	"github.com/fabrizioperria/goflight/cancellation"
 	"github.com/fabrizioperria/goflight/db"
 	"github.com/fabrizioperria/goflight/handlers/middleware"
+	"github.com/fabrizioperria/goflight/loyalty"
+	"github.com/fabrizioperria/goflight/payments"
+	"github.com/fabrizioperria/goflight/pricing"
+	"github.com/fabrizioperria/goflight/search"
+	"github.com/fabrizioperria/goflight/waitlist"
 	"github.com/gofiber/fiber/v2"
 )
 
-func SetupRoutes(mainStore db.Store, config fiber.Config) *fiber.App {
+// SetupRoutes serves the API on mainStore, pricing the seats and refunding
+// the reservations with engine and showing the amounts in other currencies
+// at rates. The engine, the payment processor, the loyalty program, the
+// waitlist queue and the settler of the cancellations are the ones the jobs
+// running alongside the API work with too.
+func SetupRoutes(mainStore db.Store, config fiber.Config, engine *pricing.Engine, rates pricing.ExchangeRates, searchConfig search.Config, processor *payments.Processor, program *loyalty.Program, queue *waitlist.Queue, settler *cancellation.Settler) *fiber.App {
 	userHandler := NewUserHandler(mainStore)
-	flightHandler := NewFlightHandler(mainStore)
+	flightHandler := NewFlightHandler(mainStore, engine, rates)
 	authHandler := NewAuthHandler(mainStore)
-	reservationHandler := NewReservationHandler(mainStore)
+	reservationHandler := NewReservationHandler(mainStore, engine, rates, processor, program, queue, settler)
+	paymentHandler := NewPaymentHandler(processor, program)
+	itineraryHandler := NewItineraryHandler(mainStore, searchConfig)
+	airportHandler := NewAirportHandler(mainStore)
+	aircraftHandler := NewAircraftHandler(mainStore)
+	creditHandler := NewCreditHandler(mainStore)
+	promotionHandler := NewPromotionHandler(mainStore)
+	loyaltyHandler := NewLoyaltyHandler(program)
+	waitlistHandler := NewWaitlistHandler(mainStore, queue)
 
 	app := fiber.New(config)
 	notAuth := app.Group("/api")
+	// registered before the apiv1 group so that its JWT middleware does not
+	// run for it
+	notAuth.Get("/v1/reservations/lookup", reservationHandler.HandleGetReservationLookupv1)
+	notAuth.Post("/v1/payments/webhook", paymentHandler.HandlePostWebhookv1)
+
 	apiv1 := app.Group("/api/v1/", middleware.JWTAuthentication(mainStore.User))
 	admin := apiv1.Group("/admin", middleware.AdminOnly())
 
@@ -25,23 +49,53 @@ func SetupRoutes(mainStore db.Store, config fiber.Config) *fiber.App {
 	admin.Delete("/users", userHandler.HandleDeleteAllUsersv1)
 	admin.Get("/users", userHandler.HandleGetUsersv1)
 	admin.Post("/flights", flightHandler.HandlePostCreateFlightv1)
+	admin.Put("/flights/:fid", flightHandler.HandlePutFlightv1)
+	admin.Put("/flights/:fid/overbooking", flightHandler.HandlePutOverbookingv1)
 	admin.Get("/reservations", reservationHandler.HandleGetAllReservationsv1)
+	admin.Get("/flights/:fid/manifest", reservationHandler.HandleGetFlightManifestv1)
+	admin.Put("/reservations/:rid/status", reservationHandler.HandlePutReservationStatusv1)
+	admin.Post("/reservations/:rid/denied-boarding", reservationHandler.HandlePostDenyBoardingv1)
+	admin.Put("/aircraft/:code", aircraftHandler.HandlePutAircraftv1)
+	admin.Post("/promotions", promotionHandler.HandlePostCreatePromotionv1)
+	admin.Get("/promotions", promotionHandler.HandleGetPromotionsv1)
+	admin.Get("/promotions/:pid", promotionHandler.HandleGetPromotionv1)
+	admin.Put("/promotions/:pid", promotionHandler.HandlePutPromotionv1)
+	admin.Delete("/promotions/:pid", promotionHandler.HandleDeletePromotionv1)
 
 	apiv1.Delete("/users/:uid", userHandler.HandleDeleteUserv1)
 	apiv1.Get("/users/:uid", userHandler.HandleGetUserv1)
 	apiv1.Put("/users/:uid", userHandler.HandlePutUserv1)
+	apiv1.Get("/users/:uid/credits", creditHandler.HandleGetCreditsv1)
+	apiv1.Get("/users/:uid/loyalty", loyaltyHandler.HandleGetLoyaltyv1)
 
 	apiv1.Get("/flights", flightHandler.HandleGetFlightsv1)
 	apiv1.Get("/flights/:fid", flightHandler.HandleGetFlightv1)
 	apiv1.Get("/flights/:fid/seats", flightHandler.HandleGetSeatsv1)
 	apiv1.Get("/flights/:fid/seats/:sid", flightHandler.HandleGetSeatv1)
 
+	apiv1.Get("/airports", airportHandler.HandleGetAirportsv1)
+	apiv1.Get("/airports/:code", airportHandler.HandleGetAirportv1)
+	apiv1.Get("/aircraft", aircraftHandler.HandleGetAircraftTypesv1)
+	apiv1.Get("/aircraft/:code", aircraftHandler.HandleGetAircraftv1)
+
+	apiv1.Get("/itineraries", itineraryHandler.HandleGetItinerariesv1)
+
+	apiv1.Post("/flights/:fid/reservations", reservationHandler.HandlePostCreateUnassignedReservationv1)
 	apiv1.Post("/flights/:fid/seats/:sid/reservations", reservationHandler.HandlePostCreateReservationv1)
+	apiv1.Post("/flights/:fid/seats/:sid/holds", reservationHandler.HandlePostCreateHoldv1)
+	apiv1.Post("/flights/:fid/seats/:sid/holds/confirm", reservationHandler.HandlePostConfirmHoldv1)
+	apiv1.Post("/flights/:fid/waitlist", waitlistHandler.HandlePostJoinWaitlistv1)
+	apiv1.Get("/flights/:fid/waitlist", waitlistHandler.HandleGetWaitlistv1)
+	apiv1.Delete("/flights/:fid/waitlist", waitlistHandler.HandleDeleteWaitlistv1)
+
+	apiv1.Post("/bookings", reservationHandler.HandlePostCreateBookingv1)
+	apiv1.Get("/bookings/:bid", reservationHandler.HandleGetBookingv1)
 
 	apiv1.Get("/reservations", reservationHandler.HandleGetMyReservationsv1)
 
 	apiv1.Get("/reservations/:rid", reservationHandler.HandleGetReservationv1)
 	apiv1.Delete("/reservations/:rid", reservationHandler.HandleDeleteReservationv1)
+	apiv1.Put("/reservations/:rid/seat", reservationHandler.HandlePutReservationSeatv1)
 
 	return app
 }
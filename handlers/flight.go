@@ -1,19 +1,29 @@
 package handlers
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/fabrizioperria/goflight/db"
+	"github.com/fabrizioperria/goflight/pricing"
 	"github.com/fabrizioperria/goflight/types"
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type FlightHandler struct {
-	store db.Store
+	store  db.Store
+	pricer pricing.Pricer
+	rates  pricing.ExchangeRates
 }
 
-func NewFlightHandler(store db.Store) *FlightHandler {
+func NewFlightHandler(store db.Store, pricer pricing.Pricer, rates pricing.ExchangeRates) *FlightHandler {
 	return &FlightHandler{
-		store: store,
+		store:  store,
+		pricer: pricer,
+		rates:  rates,
 	}
 }
 
@@ -23,7 +33,7 @@ func (h *FlightHandler) HandleGetFlightv1(ctx *fiber.Ctx) error {
 	if err != nil {
 		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
-	filter := db.Map{"_id": oid}
+	filter := db.FlightFilter{Id: oid}
 	flight, err := h.store.Flight.GetFlight(ctx.Context(), filter)
 	if err != nil {
 		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
@@ -37,7 +47,8 @@ func (h *FlightHandler) HandleGetSeatsv1(ctx *fiber.Ctx) error {
 	if err != nil {
 		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
-	filter := db.Map{"flight_id": oid, "available": true}
+	available := true
+	filter := db.SeatFilter{FlightId: oid, Available: &available}
 	pagination := db.Pagination{
 		Page:  ctx.Query("page"),
 		Limit: ctx.Query("limit"),
@@ -46,15 +57,112 @@ func (h *FlightHandler) HandleGetSeatsv1(ctx *fiber.Ctx) error {
 	if err != nil {
 		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
+	now := time.Now()
+	for _, seat := range seats {
+		hideExpiredHold(seat, now)
+	}
+	if err := h.fillFares(ctx, oid, seats...); err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := convertSeats(ctx, h.rates, seats...); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
 	return ctx.JSON(seats)
 }
 
+// fillFares breaks down the prices of the seats of flightId stored before
+// their fares were, which the next repricing will store.
+func (h *FlightHandler) fillFares(ctx *fiber.Ctx, flightId primitive.ObjectID, seats ...*types.Seat) error {
+	var flight *types.Flight
+	for _, seat := range seats {
+		if seat.Fare != nil || !seat.Price.IsSet() {
+			continue
+		}
+		if flight == nil {
+			var err error
+			if flight, err = h.store.Flight.GetFlight(ctx.Context(), db.FlightFilter{Id: flightId}); err != nil {
+				return err
+			}
+		}
+		fare, err := h.pricer.Breakdown(flight, seat.Price)
+		if err != nil {
+			return err
+		}
+		seat.Fare = fare
+	}
+	return nil
+}
+
+// hideExpiredHold shows a seat whose hold expired as available, the way it
+// will be stored once the hold sweeper has run.
+func hideExpiredHold(seat *types.Seat, now time.Time) {
+	if seat.HeldUntil != nil && seat.IsAvailable(now) {
+		seat.Available = true
+		seat.HeldUntil = nil
+	}
+}
+
+// parseSearchTime accepts either an RFC3339 timestamp or a plain date. A
+// plain date used as an upper bound covers the whole day.
+func parseSearchTime(value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q", value)
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Second)
+	}
+	return t, nil
+}
+
+func flightSearchFromQuery(ctx *fiber.Ctx) (db.FlightFilter, db.FlightSort, error) {
+	filter := db.FlightFilter{
+		Departure: ctx.Query("from"),
+		Arrival:   ctx.Query("to"),
+		Airline:   ctx.Query("airline"),
+	}
+	if after := ctx.Query("departure_after"); after != "" {
+		from, err := parseSearchTime(after, false)
+		if err != nil {
+			return filter, "", err
+		}
+		filter.DepartureBetween.From = from
+	}
+	if before := ctx.Query("departure_before"); before != "" {
+		to, err := parseSearchTime(before, true)
+		if err != nil {
+			return filter, "", err
+		}
+		filter.DepartureBetween.To = to
+	}
+	if minSeats := ctx.Query("min_seats"); minSeats != "" {
+		seats, err := strconv.Atoi(minSeats)
+		if err != nil || seats < 0 {
+			return filter, "", fmt.Errorf("invalid min_seats %q", minSeats)
+		}
+		filter.MinAvailableSeats = seats
+	}
+
+	sort := db.FlightSort(ctx.Query("sort"))
+	if !sort.IsValid() {
+		return filter, "", fmt.Errorf("invalid sort %q", sort)
+	}
+	return filter, sort, nil
+}
+
 func (h *FlightHandler) HandleGetFlightsv1(ctx *fiber.Ctx) error {
+	filter, sort, err := flightSearchFromQuery(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
 	pagination := db.Pagination{
 		Page:  ctx.Query("page"),
 		Limit: ctx.Query("limit"),
 	}
-	flights, err := h.store.Flight.GetFlights(ctx.Context(), &pagination)
+	flights, err := h.store.Flight.GetFlights(ctx.Context(), filter, sort, &pagination)
 	if err != nil {
 		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -67,35 +175,34 @@ func (h *FlightHandler) HandlePostCreateFlightv1(ctx *fiber.Ctx) error {
 	if err != nil {
 		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
+	if err := db.ResolveFlightAirports(ctx.Context(), h.store.Airport, &createFlightParams); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	var aircraft *types.Aircraft
+	if createFlightParams.Aircraft != "" {
+		createFlightParams.Aircraft = strings.ToUpper(strings.TrimSpace(createFlightParams.Aircraft))
+		aircraft, err = h.store.Aircraft.GetAircraft(ctx.Context(), db.AircraftFilter{Code: createFlightParams.Aircraft})
+		if err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("unknown aircraft %q", createFlightParams.Aircraft)})
+		}
+	}
 
 	flight, err := types.NewFlightFromParams(createFlightParams)
 	if err != nil {
 		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	_, err = h.store.Flight.CreateFlight(ctx.Context(), flight)
-	if err != nil {
+	// the store assigns the seats to the flight once it has an id
+	seats := types.GenericSeatMap(primitive.NilObjectID, createFlightParams.NumberOfSeats)
+	if aircraft != nil {
+		seats = aircraft.SeatMap(primitive.NilObjectID)
+	}
+	if _, err := pricing.PriceSeats(h.pricer, flight, seats, time.Now()); err != nil {
 		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
-
-	seatIDs := []primitive.ObjectID{}
-	for i := 0; i < createFlightParams.NumberOfSeats; i++ {
-		seat := types.Seat{
-			FlightId:  primitive.ObjectID(flight.Id),
-			Number:    i,
-			Price:     100,
-			Class:     types.SeatClass(i%3 + 1),
-			Location:  types.SeatLocation(i%3 + 1),
-			Available: true,
-		}
-		created, err := h.store.Seat.CreateSeat(ctx.Context(), &seat)
-		if err != nil {
-			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
-		}
-		seatIDs = append(seatIDs, created.Id)
+	if _, err := h.store.Flight.CreateFlightWithSeats(ctx.Context(), flight, seats); err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
-	h.store.Flight.UpdateFlight(ctx.Context(), db.Map{"_id": flight.Id}, types.UpdateFlightParams{Seats: seatIDs})
-	flight.Seats = seatIDs
 
 	return ctx.Status(fiber.StatusCreated).JSON(flight)
 }
@@ -106,7 +213,7 @@ func (h *FlightHandler) HandlePutFlightv1(ctx *fiber.Ctx) error {
 	if err != nil {
 		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
-	filter := db.Map{"_id": oid}
+	filter := db.FlightFilter{Id: oid}
 	updateFlightParams := types.UpdateFlightParams{}
 
 	err = ctx.BodyParser(&updateFlightParams)
@@ -114,6 +221,10 @@ func (h *FlightHandler) HandlePutFlightv1(ctx *fiber.Ctx) error {
 		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	if updateFlightParams.Overbooking != nil && *updateFlightParams.Overbooking < 0 {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "overbooking must not be negative"})
+	}
+
 	_, err = h.store.Flight.UpdateFlight(ctx.Context(), filter, updateFlightParams)
 	if err != nil {
 		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
@@ -121,6 +232,33 @@ func (h *FlightHandler) HandlePutFlightv1(ctx *fiber.Ctx) error {
 	return ctx.Status(fiber.StatusOK).SendString("Flight updated: " + flightID)
 }
 
+// HandlePutOverbookingv1 sets how many reservations may be sold beyond the
+// seats of a flight. Lowering it below the ones already sold only stops
+// selling more.
+func (h *FlightHandler) HandlePutOverbookingv1(ctx *fiber.Ctx) error {
+	fid, err := primitive.ObjectIDFromHex(ctx.Params("fid"))
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	params := types.OverbookingParams{}
+	if err := ctx.BodyParser(&params); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if errors := params.Validate(); len(errors) > 0 {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors})
+	}
+
+	filter := db.FlightFilter{Id: fid}
+	if _, err := h.store.Flight.UpdateFlight(ctx.Context(), filter, types.UpdateFlightParams{Overbooking: &params.Overbooking}); err != nil {
+		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	flight, err := h.store.Flight.GetFlight(ctx.Context(), filter)
+	if err != nil {
+		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	return ctx.JSON(flight)
+}
+
 func (h *FlightHandler) HandleDeleteAllFlightsv1(ctx *fiber.Ctx) error {
 	err := h.store.Flight.Drop(ctx.Context())
 	if err != nil {
@@ -140,10 +278,17 @@ func (h *FlightHandler) HandleGetSeatv1(ctx *fiber.Ctx) error {
 	if err != nil {
 		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
-	filter := db.Map{"_id": sid, "flight_id": fid}
+	filter := db.SeatFilter{Id: sid, FlightId: fid}
 	seat, err := h.store.Seat.GetSeat(ctx.Context(), filter)
 	if err != nil {
 		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
 	}
+	hideExpiredHold(seat, time.Now())
+	if err := h.fillFares(ctx, fid, seat); err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := convertSeats(ctx, h.rates, seat); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
 	return ctx.JSON(seat)
 }
@@ -8,32 +8,39 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/fabrizioperria/goflight/db"
+	"github.com/fabrizioperria/goflight/db/fixtures"
+	"github.com/fabrizioperria/goflight/db/memory"
+	"github.com/fabrizioperria/goflight/handlers/middleware"
+	"github.com/fabrizioperria/goflight/pricing"
 	"github.com/fabrizioperria/goflight/types"
 	"github.com/gofiber/fiber/v2"
+	"github.com/govalues/decimal"
 	"github.com/stretchr/testify/assert"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type testFlightDb struct {
-	Store  db.Store
-	Client *mongo.Client
+	Store db.Store
 }
 
 func setupFlightDb() (*testFlightDb, error) {
-	client, err := mongo.Connect(context.TODO(), options.Client().ApplyURI(uri))
-	if err != nil {
+	seatStore := memory.NewSeatStore()
+	flightStore := memory.NewFlightStore(seatStore)
+	reservationStore := memory.NewReservationStore(flightStore, seatStore, memory.NewPromotionStore(), memory.NewCreditStore(), memory.NewLoyaltyStore())
+	airportStore := memory.NewAirportStore()
+	if err := db.LoadBundledAirports(context.Background(), airportStore); err != nil {
+		return nil, err
+	}
+	aircraftStore := memory.NewAircraftStore()
+	if err := db.LoadBundledAircraft(context.Background(), aircraftStore); err != nil {
 		return nil, err
 	}
-	flightStore := db.NewMongoDbFlightStore(client)
-	seatStore := db.NewMongoDbSeatStore(client, *flightStore)
-	reservationStore := db.NewMongoDbReservationStore(client, *flightStore, *seatStore)
-	store := db.Store{Flight: flightStore, Seat: seatStore, Reservation: reservationStore}
+	store := db.Store{Flight: flightStore, Seat: seatStore, Reservation: reservationStore, Airport: airportStore, Aircraft: aircraftStore}
 	return &testFlightDb{
-		Client: client,
-		Store:  store,
+		Store: store,
 	}, nil
 }
 
@@ -44,9 +51,6 @@ func teardownFlightDb(t *testing.T, testDb *testFlightDb) {
 	if err := testDb.Store.Seat.Drop(context.Background()); err != nil {
 		t.Fatal(err)
 	}
-	if err := testDb.Client.Disconnect(context.Background()); err != nil {
-		t.Fatal(err)
-	}
 }
 
 func getValidFlight() types.CreateFlightParams {
@@ -84,7 +88,7 @@ func TestPostCreateFlightv1(t *testing.T) {
 	flightDb, err := setupFlightDb()
 	assert.NoError(t, err)
 	defer teardownFlightDb(t, flightDb)
-	flightHandler := FlightHandler{store: flightDb.Store}
+	flightHandler := *NewFlightHandler(flightDb.Store, pricing.NewEngine(pricing.DefaultConfig()), pricing.DefaultExchangeRates())
 
 	app := fiber.New()
 
@@ -102,29 +106,120 @@ func TestPostCreateFlightv1(t *testing.T) {
 	assert.Equal(t, flight.Airline, bodyT.Airline)
 	assert.Equal(t, flight.Departure, bodyT.Departure)
 	assert.Equal(t, flight.Arrival, bodyT.Arrival)
-	assert.Equal(t, flight.DepartureTime, bodyT.DepartureTime)
-	assert.Equal(t, flight.ArrivalTime, bodyT.ArrivalTime)
+	assert.Equal(t, flight.DepartureTime, bodyT.DepartureTime.Format(time.RFC3339))
+	assert.Equal(t, flight.ArrivalTime, bodyT.ArrivalTime.Format(time.RFC3339))
 
 	// check seats
 	assert.Len(t, bodyT.Seats, 50)
 
 	for i, seatId := range bodyT.Seats {
-		filter := db.Map{"_id": seatId}
+		filter := db.SeatFilter{Id: seatId}
 		seat, _ := flightDb.Store.Seat.GetSeat(context.Background(), filter)
 		assert.Equal(t, bodyT.Id, seat.FlightId)
 		assert.Equal(t, i, seat.Number)
 		assert.True(t, seat.Available)
-		assert.NotEqual(t, 0, seat.Price)
+		assert.True(t, seat.Price.IsPos())
 		assert.LessOrEqual(t, 1, seat.Class)
 		assert.LessOrEqual(t, 1, seat.Location)
 	}
 }
 
+func TestPostCreateFlightAirportsv1(t *testing.T) {
+	flightDb, err := setupFlightDb()
+	assert.NoError(t, err)
+	defer teardownFlightDb(t, flightDb)
+	flightHandler := *NewFlightHandler(flightDb.Store, pricing.NewEngine(pricing.DefaultConfig()), pricing.DefaultExchangeRates())
+	app := fiber.New()
+
+	for _, codes := range [][2]string{{"XXX", "LAX"}, {"JFK", "New York"}, {"JFK", "JFK"}} {
+		flight := getValidFlight()
+		flight.Departure, flight.Arrival = codes[0], codes[1]
+		response, err := createflight(&flightHandler, app, flight)
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusBadRequest, response.StatusCode, codes)
+	}
+
+	// the codes are normalized and the local times read in the zones of the
+	// airports
+	flight := getValidFlight()
+	flight.Departure, flight.Arrival = "jfk", " lax"
+	flight.DepartureTime, flight.ArrivalTime = "2021-01-01T09:00", "2021-01-01T12:00"
+	response, err := createflight(&flightHandler, app, flight)
+	assert.NoError(t, err)
+	assert.Equal(t, fiber.StatusCreated, response.StatusCode)
+
+	created := types.Flight{}
+	assert.NoError(t, json.NewDecoder(response.Body).Decode(&created))
+	assert.Equal(t, "JFK", created.Departure)
+	assert.Equal(t, "LAX", created.Arrival)
+	assert.Equal(t, "America/New_York", created.DepartureTimeZone)
+	assert.Equal(t, "America/Los_Angeles", created.ArrivalTimeZone)
+	assert.Equal(t, time.Date(2021, 1, 1, 14, 0, 0, 0, time.UTC), created.DepartureTime)
+	assert.Equal(t, 6*time.Hour, created.Duration())
+}
+
+func TestPostCreateFlightAircraftv1(t *testing.T) {
+	flightDb, err := setupFlightDb()
+	assert.NoError(t, err)
+	defer teardownFlightDb(t, flightDb)
+	flightHandler := *NewFlightHandler(flightDb.Store, pricing.NewEngine(pricing.DefaultConfig()), pricing.DefaultExchangeRates())
+	app := fiber.New()
+
+	flight := getValidFlight()
+	flight.Aircraft = "B747"
+	response, err := createflight(&flightHandler, app, flight)
+	assert.NoError(t, err)
+	assert.Equal(t, fiber.StatusBadRequest, response.StatusCode)
+
+	flight.Aircraft = "a320"
+	response, err = createflight(&flightHandler, app, flight)
+	assert.NoError(t, err)
+	assert.Equal(t, fiber.StatusCreated, response.StatusCode)
+	created := types.Flight{}
+	assert.NoError(t, json.NewDecoder(response.Body).Decode(&created))
+	assert.Equal(t, "A320", created.Aircraft)
+	// 3 business rows of 4 and 27 economy rows of 6, whatever number_of_seats
+	assert.Len(t, created.Seats, 3*4+27*6)
+
+	seats := map[string]*types.Seat{}
+	for _, seatId := range created.Seats {
+		seat, err := flightDb.Store.Seat.GetSeat(context.Background(), db.SeatFilter{Id: seatId})
+		assert.NoError(t, err)
+		seats[seat.Designator] = seat
+	}
+	expected := []struct {
+		designator string
+		class      types.SeatClass
+		location   types.SeatLocation
+		exitRow    bool
+	}{
+		{"1A", types.Business, types.Window, false},
+		{"1C", types.Business, types.Aisle, false},
+		{"3D", types.Business, types.Aisle, false},
+		{"4B", types.Economy, types.Middle, false},
+		{"12F", types.Economy, types.Window, true},
+		{"30C", types.Economy, types.Aisle, false},
+	}
+	for _, e := range expected {
+		seat, ok := seats[e.designator]
+		if !assert.True(t, ok, e.designator) {
+			continue
+		}
+		assert.Equal(t, e.class, seat.Class, e.designator)
+		assert.Equal(t, e.location, seat.Location, e.designator)
+		assert.Equal(t, e.exitRow, seat.ExitRow, e.designator)
+	}
+	assert.NotContains(t, seats, "1B")
+	assert.Equal(t, 0, seats["1A"].Number)
+	assert.Equal(t, 30, seats["30C"].Row)
+	assert.Equal(t, "C", seats["30C"].Letter)
+}
+
 func TestGetFlightsv1(t *testing.T) {
 	db, err := setupFlightDb()
 	assert.NoError(t, err)
 	defer teardownFlightDb(t, db)
-	flightHandler := FlightHandler{store: db.Store}
+	flightHandler := *NewFlightHandler(db.Store, pricing.NewEngine(pricing.DefaultConfig()), pricing.DefaultExchangeRates())
 
 	app := fiber.New()
 
@@ -148,7 +243,7 @@ func TestDeleteAllFlightsv1(t *testing.T) {
 	db, err := setupFlightDb()
 	assert.NoError(t, err)
 	defer teardownFlightDb(t, db)
-	flightHandler := FlightHandler{store: db.Store}
+	flightHandler := *NewFlightHandler(db.Store, pricing.NewEngine(pricing.DefaultConfig()), pricing.DefaultExchangeRates())
 
 	app := fiber.New()
 
@@ -180,7 +275,7 @@ func TestGetFlightByIdv1(t *testing.T) {
 	db, err := setupFlightDb()
 	assert.NoError(t, err)
 	defer teardownFlightDb(t, db)
-	flightHandler := FlightHandler{store: db.Store}
+	flightHandler := *NewFlightHandler(db.Store, pricing.NewEngine(pricing.DefaultConfig()), pricing.DefaultExchangeRates())
 
 	app := fiber.New()
 
@@ -210,60 +305,141 @@ func TestGetFlightByIdv1(t *testing.T) {
 	assert.Equal(t, flight.Airline, bodyT.Airline)
 	assert.Equal(t, flight.Departure, bodyT.Departure)
 	assert.Equal(t, flight.Arrival, bodyT.Arrival)
-	assert.Equal(t, flight.DepartureTime, bodyT.DepartureTime)
-	assert.Equal(t, flight.ArrivalTime, bodyT.ArrivalTime)
+	assert.Equal(t, flight.DepartureTime, bodyT.DepartureTime.Format(time.RFC3339))
+	assert.Equal(t, flight.ArrivalTime, bodyT.ArrivalTime.Format(time.RFC3339))
 }
 
 func TestPutFlightv1(t *testing.T) {
+	store := memory.NewStore()
+	app := setupRoutes(*store)
+	_, adminToken := fixtures.AuthenticateUser(store)
+	passenger, err := fixtures.AddUser(store, "jt@test.com", "password", "987654321", "Jane", "Tomato", false)
+	assert.NoError(t, err)
+	flight, err := fixtures.AddFlight(store, "Delta", "JFK", "LAX", "2021-01-01T00:00:00Z", "2021-01-01T08:00:00Z", 0)
+	assert.NoError(t, err)
+	put := func(token, id string, params types.UpdateFlightParams) int {
+		payload, err := json.Marshal(params)
+		assert.NoError(t, err)
+		req := httptest.NewRequest("PUT", "/api/v1/admin/flights/"+id, bytes.NewReader(payload))
+		req.Header.Add("Content-Type", "application/json")
+		req.Header.Add("X-Api-Token", token)
+		response, err := app.Test(req)
+		if !assert.NoError(t, err) {
+			return 0
+		}
+		return response.StatusCode
+	}
+
+	update := types.UpdateFlightParams{DepartureTime: time.Date(2021, 1, 1, 1, 0, 0, 0, time.UTC)}
+	assert.Equal(t, fiber.StatusUnauthorized, put(middleware.ProduceToken(passenger), flight.Id.Hex(), update))
+	assert.Equal(t, fiber.StatusBadRequest, put(adminToken, "nonsense", update))
+	assert.Equal(t, fiber.StatusNotFound, put(adminToken, primitive.NewObjectID().Hex(), update))
+	overbooking := -1
+	assert.Equal(t, fiber.StatusBadRequest, put(adminToken, flight.Id.Hex(), types.UpdateFlightParams{Overbooking: &overbooking}))
+	assert.Equal(t, fiber.StatusOK, put(adminToken, flight.Id.Hex(), update))
+
+	updated, err := store.Flight.GetFlight(context.Background(), db.FlightFilter{Id: flight.Id})
+	assert.NoError(t, err)
+	assert.Equal(t, update.DepartureTime, updated.DepartureTime.UTC())
+	assert.Equal(t, flight.ArrivalTime, updated.ArrivalTime)
+	assert.Equal(t, flight.Airline, updated.Airline)
+}
+
+func TestSearchFlightsv1(t *testing.T) {
 	db, err := setupFlightDb()
 	assert.NoError(t, err)
 	defer teardownFlightDb(t, db)
-	flightHandler := FlightHandler{store: db.Store}
+	flightHandler := *NewFlightHandler(db.Store, pricing.NewEngine(pricing.DefaultConfig()), pricing.DefaultExchangeRates())
 
 	app := fiber.New()
 
 	flight := getValidFlight()
-	response, error := createflight(&flightHandler, app, flight)
-	assert.NoError(t, error)
-	body, err := io.ReadAll(io.Reader(response.Body))
+	_, err = createflight(&flightHandler, app, flight)
 	assert.NoError(t, err)
-	bodyT := types.Flight{}
-	err = json.Unmarshal(body, &bodyT)
+	flight.Departure = "LAX"
+	flight.Arrival = "JFK"
+	flight.DepartureTime = "2021-01-02T00:00:00Z"
+	flight.ArrivalTime = "2021-01-02T08:00:00Z"
+	flight.NumberOfSeats = 1
+	_, err = createflight(&flightHandler, app, flight)
 	assert.NoError(t, err)
-	id := bodyT.Id.Hex()
 
-	updateFlight := types.UpdateFlightParams{
-		DepartureTime: "2024-01-01T01:00:00Z",
+	searches := []struct {
+		query    string
+		status   int
+		expected int
+	}{
+		{"", fiber.StatusOK, 2},
+		{"?from=JFK&to=LAX", fiber.StatusOK, 1},
+		{"?from=JFK&to=LAX&airline=United", fiber.StatusOK, 0},
+		{"?departure_after=2021-01-02", fiber.StatusOK, 1},
+		{"?departure_before=2021-01-01", fiber.StatusOK, 1},
+		{"?departure_after=2021-01-01T12:00:00Z&departure_before=2021-01-02", fiber.StatusOK, 1},
+		{"?min_seats=2", fiber.StatusOK, 1},
+		{"?sort=price", fiber.StatusOK, 2},
+		{"?sort=altitude", fiber.StatusBadRequest, 0},
+		{"?departure_after=yesterday", fiber.StatusBadRequest, 0},
+		{"?min_seats=many", fiber.StatusBadRequest, 0},
+	}
+	app.Get("/api/v1/flights", flightHandler.HandleGetFlightsv1)
+	for _, search := range searches {
+		req := httptest.NewRequest("GET", "/api/v1/flights"+search.query, nil)
+		response, err := app.Test(req)
+		assert.NoError(t, err)
+		assert.Equal(t, search.status, response.StatusCode, search.query)
+		if search.status != fiber.StatusOK {
+			continue
+		}
+
+		bodyT := []types.Flight{}
+		err = json.NewDecoder(response.Body).Decode(&bodyT)
+		assert.NoError(t, err)
+		assert.Len(t, bodyT, search.expected, search.query)
 	}
-	flight.DepartureTime = updateFlight.DepartureTime
+}
 
-	flightMarshal, err := json.Marshal(updateFlight)
+func TestGetSeatsCurrencyv1(t *testing.T) {
+	db, err := setupFlightDb()
 	assert.NoError(t, err)
+	defer teardownFlightDb(t, db)
+	rates := pricing.ExchangeRates{Base: "USD", Rates: map[string]decimal.Decimal{"EUR": decimal.MustParse("0.9")}}
+	flightHandler := *NewFlightHandler(db.Store, pricing.NewEngine(pricing.DefaultConfig()), rates)
 
-	req := httptest.NewRequest("PUT", "/api/v1/flights/"+id, bytes.NewReader(flightMarshal))
-	req.Header.Add("Content-Type", "application/json")
-	app.Put("/api/v1/flights/:fid", flightHandler.HandlePutFlightv1)
-
-	response, error = app.Test(req)
-	assert.NoError(t, error)
-	assert.Equal(t, fiber.StatusOK, response.StatusCode)
-
-	req = httptest.NewRequest("GET", "/api/v1/flights/"+id, nil)
-	req.Header.Add("Content-Type", "application/json")
-	app.Get("/api/v1/flights/:fid", flightHandler.HandleGetFlightv1)
-	response, error = app.Test(req)
-	assert.NoError(t, error)
-	assert.Equal(t, fiber.StatusOK, response.StatusCode)
-
-	body, err = io.ReadAll(io.Reader(response.Body))
+	ctx := context.Background()
+	flight, err := db.Store.Flight.CreateFlight(ctx, &types.Flight{Airline: "Delta", Departure: "JFK", Arrival: "LAX"})
 	assert.NoError(t, err)
-	bodyT = types.Flight{}
-	err = json.Unmarshal(body, &bodyT)
+	_, err = db.Store.Seat.CreateSeat(ctx, &types.Seat{FlightId: flight.Id, Price: types.MustParseMoney("100.15", "USD"), Available: true})
 	assert.NoError(t, err)
-	assert.NotEmpty(t, bodyT.Id)
-	assert.Equal(t, flight.Airline, bodyT.Airline)
-	assert.Equal(t, flight.Departure, bodyT.Departure)
-	assert.Equal(t, flight.Arrival, bodyT.Arrival)
-	assert.Equal(t, flight.DepartureTime, bodyT.DepartureTime)
-	assert.Equal(t, flight.ArrivalTime, bodyT.ArrivalTime)
+
+	app := fiber.New()
+	app.Get("/api/v1/flights/:fid/seats", flightHandler.HandleGetSeatsv1)
+	queries := []struct {
+		query    string
+		status   int
+		expected string
+	}{
+		{"", fiber.StatusOK, `{"amount":"100.15","currency":"USD"}`},
+		{"?currency=usd", fiber.StatusOK, `{"amount":"100.15","currency":"USD"}`},
+		{"?currency=EUR", fiber.StatusOK, `{"amount":"90.14","currency":"EUR"}`},
+		{"?currency=GBP", fiber.StatusBadRequest, ""},
+		{"?currency=dollars", fiber.StatusBadRequest, ""},
+	}
+	for _, query := range queries {
+		req := httptest.NewRequest("GET", "/api/v1/flights/"+flight.Id.Hex()+"/seats"+query.query, nil)
+		response, err := app.Test(req)
+		assert.NoError(t, err)
+		assert.Equal(t, query.status, response.StatusCode, query.query)
+		if query.status != fiber.StatusOK {
+			continue
+		}
+
+		seats := []map[string]json.RawMessage{}
+		assert.NoError(t, json.NewDecoder(response.Body).Decode(&seats))
+		assert.Len(t, seats, 1)
+		assert.JSONEq(t, query.expected, string(seats[0]["price"]), query.query)
+		// the seat was stored without a fare, which is broken down on the fly
+		fare := map[string]json.RawMessage{}
+		assert.NoError(t, json.Unmarshal(seats[0]["fare"], &fare))
+		assert.JSONEq(t, query.expected, string(fare["total"]), query.query)
+	}
 }
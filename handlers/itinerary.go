@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/fabrizioperria/goflight/db"
+	"github.com/fabrizioperria/goflight/pricing"
+	"github.com/fabrizioperria/goflight/search"
+	"github.com/fabrizioperria/goflight/types"
+	"github.com/gofiber/fiber/v2"
+)
+
+type ItineraryHandler struct {
+	searcher *search.ItinerarySearcher
+	rates    pricing.ExchangeRates
+}
+
+func NewItineraryHandler(store db.Store, config search.Config) *ItineraryHandler {
+	return &ItineraryHandler{
+		searcher: search.NewItinerarySearcher(store.Flight, store.Seat, config),
+		rates:    config.Rates,
+	}
+}
+
+func (h *ItineraryHandler) HandleGetItinerariesv1(ctx *fiber.Ctx) error {
+	date, err := time.Parse(time.DateOnly, ctx.Query("date"))
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "date must be formatted as YYYY-MM-DD"})
+	}
+	maxStops := search.MaxStops
+	if stops := ctx.Query("max_stops"); stops != "" {
+		if maxStops, err = strconv.Atoi(stops); err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
+	query := search.ItineraryQuery{
+		From:     ctx.Query("from"),
+		To:       ctx.Query("to"),
+		Date:     date,
+		MaxStops: maxStops,
+	}
+	itineraries, err := h.searcher.Search(ctx.Context(), query)
+	if errors.Is(err, search.ErrInvalidQuery) {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	prices := []*types.Money{}
+	for _, itinerary := range itineraries {
+		prices = append(prices, &itinerary.LowestPrice)
+	}
+	if err := convertPrices(ctx, h.rates, prices...); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return ctx.JSON(itineraries)
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"github.com/fabrizioperria/goflight/loyalty"
+	"github.com/fabrizioperria/goflight/types"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type LoyaltyHandler struct {
+	loyalty *loyalty.Program
+}
+
+func NewLoyaltyHandler(program *loyalty.Program) *LoyaltyHandler {
+	return &LoyaltyHandler{
+		loyalty: program,
+	}
+}
+
+// HandleGetLoyaltyv1 shows the loyalty account of a user, with their points,
+// their tier and the activity of the points, to the user and to admins.
+func (h *LoyaltyHandler) HandleGetLoyaltyv1(ctx *fiber.Ctx) error {
+	uid, err := primitive.ObjectIDFromHex(ctx.Params("uid"))
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	user := ctx.Context().UserValue("user").(*types.User)
+	if uid != user.Id && !user.IsAdmin {
+		return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	account, err := h.loyalty.Account(ctx.Context(), uid)
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return ctx.JSON(account)
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fabrizioperria/goflight/cancellation"
+	"github.com/fabrizioperria/goflight/db"
+	"github.com/fabrizioperria/goflight/loyalty"
+	"github.com/fabrizioperria/goflight/payments"
+	"github.com/fabrizioperria/goflight/pricing"
+	"github.com/fabrizioperria/goflight/types"
+	"github.com/fabrizioperria/goflight/waitlist"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+type testLoyaltyDb struct {
+	*testReservationDb
+
+	reservationHandler *ReservationHandler
+	loyaltyHandler     *LoyaltyHandler
+}
+
+func setupLoyaltyDb() (*testLoyaltyDb, error) {
+	testDb, err := setupReservationDb("10", "10", "10")
+	if err != nil {
+		return nil, err
+	}
+	processor := payments.NewProcessor(payments.NewFakeGateway(), testDb.Store.Reservation, testDb.Store.Credit)
+	program := loyalty.NewProgram(*testDb.Store, loyalty.DefaultRules())
+	queue := waitlist.NewQueue(*testDb.Store, program, waitlist.LogNotifier{}, waitlist.DefaultOfferTTL)
+	settler := cancellation.NewSettler(*testDb.Store, processor, program, queue)
+	return &testLoyaltyDb{
+		testReservationDb:  testDb,
+		reservationHandler: NewReservationHandler(*testDb.Store, pricing.NewEngine(pricing.DefaultConfig()), pricing.DefaultExchangeRates(), processor, program, queue, settler),
+		loyaltyHandler:     NewLoyaltyHandler(program),
+	}, nil
+}
+
+// as serves the loyalty accounts, and the reservations that earn and redeem
+// their points, to user.
+func (testDb *testLoyaltyDb) as(user *types.User) *fiber.App {
+	app := fiber.New()
+	app.Use(authenticateAs(user))
+	app.Post("/flights/:fid/seats/:sid/reservations", testDb.reservationHandler.HandlePostCreateReservationv1)
+	app.Delete("/reservations/:rid", testDb.reservationHandler.HandleDeleteReservationv1)
+	app.Get("/users/:uid/loyalty", testDb.loyaltyHandler.HandleGetLoyaltyv1)
+	return app
+}
+
+func TestLoyaltyv1(t *testing.T) {
+	testDb, err := setupLoyaltyDb()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer teardownReservationDb(t, testDb.testReservationDb)
+	owner, seats := testDb.Owner, testDb.Seats
+	reserveWith := func(user *types.User, seat *types.Seat, points int) (int, *types.Reservation) {
+		return reserve(t, testDb.as(user), seat, types.ReservationBody{LoyaltyPoints: points})
+	}
+	getAccount := func(user *types.User) (int, *types.LoyaltyAccount) {
+		account := &types.LoyaltyAccount{}
+		status := send(t, testDb.as(user), "GET", "/users/"+owner.Id.Hex()+"/loyalty", nil, account)
+		return status, account
+	}
+
+	status, account := getAccount(owner)
+	assert.Equal(t, fiber.StatusOK, status)
+	assert.Zero(t, account.Points)
+	assert.Equal(t, types.LoyaltyMember, account.Tier)
+	assert.Empty(t, account.Activity)
+	status, _ = getAccount(testDb.Other)
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+
+	// a confirmed reservation earns points on the distance flown
+	status, reservation := reserveWith(owner, seats[0], 0)
+	assert.Equal(t, fiber.StatusCreated, status)
+	assert.Equal(t, types.ReservationConfirmed, reservation.Status)
+	status, account = getAccount(testDb.Admin)
+	assert.Equal(t, fiber.StatusOK, status)
+	earned := account.Points
+	assert.InDelta(t, 2475, earned, 10)
+	if assert.Len(t, account.Activity, 1) {
+		assert.Equal(t, types.PointsEarned, account.Activity[0].Kind)
+		assert.Equal(t, reservation.Id, account.Activity[0].ReservationId)
+	}
+
+	// the points pay for the next one, which earns its own
+	status, spent := reserveWith(owner, seats[1], 500)
+	assert.Equal(t, fiber.StatusCreated, status)
+	if assert.NotNil(t, spent.Loyalty) && assert.NotNil(t, spent.Payment) {
+		assert.Equal(t, 500, spent.Loyalty.Points)
+		assert.True(t, types.MustParseMoney("5", "USD").Equal(spent.Payment.Amount), spent.Payment.Amount)
+	}
+	_, account = getAccount(owner)
+	assert.Equal(t, 2*earned-500, account.Points)
+	status, _ = reserveWith(testDb.Other, seats[2], 100)
+	assert.Equal(t, fiber.StatusConflict, status)
+	seat, err := testDb.Store.Seat.GetSeat(context.Background(), db.SeatFilter{Id: seats[2].Id})
+	assert.NoError(t, err)
+	assert.True(t, seat.Available)
+
+	// cancelling takes the points earned back and gives the ones spent back
+	assert.Equal(t, fiber.StatusOK, send(t, testDb.as(owner), "DELETE", "/reservations/"+spent.Id.Hex(), nil, nil))
+	_, account = getAccount(owner)
+	assert.Equal(t, earned, account.Points)
+	assert.Equal(t, earned, account.QualifyingPoints)
+}
@@ -35,7 +35,7 @@ func JWTAuthentication(userStore db.UserStorer) fiber.Handler {
 			return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
 		}
 
-		filter := db.Map{"_id": oid}
+		filter := db.UserFilter{Id: oid}
 		user, err := userStore.GetUser(ctx.Context(), filter)
 		if err != nil {
 			return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
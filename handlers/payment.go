@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+
+	"github.com/fabrizioperria/goflight/loyalty"
+	"github.com/fabrizioperria/goflight/payments"
+	"github.com/gofiber/fiber/v2"
+)
+
+type PaymentHandler struct {
+	processor *payments.Processor
+	loyalty   *loyalty.Program
+}
+
+func NewPaymentHandler(processor *payments.Processor, program *loyalty.Program) *PaymentHandler {
+	return &PaymentHandler{
+		processor: processor,
+		loyalty:   program,
+	}
+}
+
+// HandlePostWebhookv1 is called by the payment provider when a payment it
+// left pending goes through or fails. It carries no user token, so the body
+// must be signed with PAYMENT_WEBHOOK_SECRET instead.
+func (h *PaymentHandler) HandlePostWebhookv1(ctx *fiber.Ctx) error {
+	secret := os.Getenv("PAYMENT_WEBHOOK_SECRET")
+	if !payments.VerifySignature(secret, ctx.Body(), ctx.Get(payments.SignatureHeader)) {
+		return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid signature"})
+	}
+
+	event := payments.Event{}
+	if err := json.Unmarshal(ctx.Body(), &event); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	reservations, err := h.processor.HandleEvent(ctx.Context(), event)
+	switch {
+	case errors.Is(err, payments.ErrInvalidEvent):
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, payments.ErrUnknownPayment):
+		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	case err != nil:
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := h.loyalty.Settle(ctx.Context(), reservations); err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return ctx.JSON(reservations)
+}
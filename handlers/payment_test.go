@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fabrizioperria/goflight/cancellation"
+	"github.com/fabrizioperria/goflight/db"
+	"github.com/fabrizioperria/goflight/loyalty"
+	"github.com/fabrizioperria/goflight/payments"
+	"github.com/fabrizioperria/goflight/pricing"
+	"github.com/fabrizioperria/goflight/types"
+	"github.com/fabrizioperria/goflight/waitlist"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+type testPaymentDb struct {
+	*testReservationDb
+	Gateway *payments.FakeGateway
+
+	reservationHandler *ReservationHandler
+	paymentHandler     *PaymentHandler
+}
+
+func setupPaymentDb() (*testPaymentDb, error) {
+	testDb, err := setupReservationDb("100", "100", "100")
+	if err != nil {
+		return nil, err
+	}
+	gateway := payments.NewFakeGateway()
+	processor := payments.NewProcessor(gateway, testDb.Store.Reservation, testDb.Store.Credit)
+	program := loyalty.NewProgram(*testDb.Store, loyalty.DefaultRules())
+	queue := waitlist.NewQueue(*testDb.Store, program, waitlist.LogNotifier{}, waitlist.DefaultOfferTTL)
+	settler := cancellation.NewSettler(*testDb.Store, processor, program, queue)
+	return &testPaymentDb{
+		testReservationDb:  testDb,
+		Gateway:            gateway,
+		reservationHandler: NewReservationHandler(*testDb.Store, pricing.NewEngine(pricing.DefaultConfig()), pricing.DefaultExchangeRates(), processor, program, queue, settler),
+		paymentHandler:     NewPaymentHandler(processor, program),
+	}, nil
+}
+
+// as serves the webhook of the provider, and the reservations it pays for, to
+// user.
+func (testDb *testPaymentDb) as(user *types.User) *fiber.App {
+	app := fiber.New()
+	app.Post("/payments/webhook", testDb.paymentHandler.HandlePostWebhookv1)
+	app.Use(authenticateAs(user))
+	app.Post("/flights/:fid/seats/:sid/reservations", testDb.reservationHandler.HandlePostCreateReservationv1)
+	app.Get("/reservations/:rid", testDb.reservationHandler.HandleGetReservationv1)
+	return app
+}
+
+func notify(t *testing.T, app *fiber.App, event payments.Event, secret string) int {
+	payload, err := json.Marshal(event)
+	assert.NoError(t, err)
+	req := httptest.NewRequest("POST", "/payments/webhook", bytes.NewReader(payload))
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add(payments.SignatureHeader, payments.Sign(secret, payload))
+	response, err := app.Test(req)
+	if !assert.NoError(t, err) {
+		return 0
+	}
+	return response.StatusCode
+}
+
+func TestReservationPaymentv1(t *testing.T) {
+	t.Setenv("PAYMENT_WEBHOOK_SECRET", "secret")
+	testDb, err := setupPaymentDb()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer teardownReservationDb(t, testDb.testReservationDb)
+	app := testDb.as(testDb.Owner)
+
+	status, reservation := reserve(t, app, testDb.Seats[0], nil)
+	assert.Equal(t, fiber.StatusCreated, status)
+	assert.Equal(t, types.ReservationConfirmed, reservation.Status)
+	assert.Equal(t, types.PaymentCaptured, reservation.Payment.Status)
+
+	// a declined payment gives the seat back
+	status, _ = reserve(t, app, testDb.Seats[1], types.ReservationBody{PaymentMethod: payments.FakeDeclinedMethod})
+	assert.Equal(t, fiber.StatusPaymentRequired, status)
+	seat, err := testDb.Store.Seat.GetSeat(context.Background(), db.SeatFilter{Id: testDb.Seats[1].Id})
+	assert.NoError(t, err)
+	assert.True(t, seat.Available)
+
+	// an asynchronous payment keeps the reservation pending until the
+	// provider calls back
+	status, reservation = reserve(t, app, testDb.Seats[2], types.ReservationBody{PaymentMethod: payments.FakeAsyncMethod})
+	assert.Equal(t, fiber.StatusAccepted, status)
+	assert.Equal(t, types.ReservationPending, reservation.Status)
+	event, err := testDb.Gateway.Settle(reservation.Payment.Reference, true)
+	assert.NoError(t, err)
+	assert.Equal(t, fiber.StatusUnauthorized, notify(t, app, event, "wrong"))
+	assert.Equal(t, fiber.StatusNotFound, notify(t, app, payments.Event{Reference: "fake_42", Status: types.PaymentCaptured}, "secret"))
+	assert.Equal(t, fiber.StatusBadRequest, notify(t, app, payments.Event{Reference: event.Reference, Status: "paid"}, "secret"))
+	assert.Equal(t, fiber.StatusOK, notify(t, app, event, "secret"))
+	fetched := &types.Reservation{}
+	assert.Equal(t, fiber.StatusOK, send(t, app, "GET", "/reservations/"+reservation.Id.Hex(), nil, fetched))
+	assert.Equal(t, types.ReservationConfirmed, fetched.Status)
+	assert.Equal(t, types.PaymentCaptured, fetched.Payment.Status)
+}
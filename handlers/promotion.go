@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/fabrizioperria/goflight/db"
+	"github.com/fabrizioperria/goflight/types"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type PromotionHandler struct {
+	store db.Store
+}
+
+func NewPromotionHandler(store db.Store) *PromotionHandler {
+	return &PromotionHandler{
+		store: store,
+	}
+}
+
+// parsePromotionParams reads and validates the promotion in the request body.
+// It returns the status code and body to reply with when they are invalid.
+func parsePromotionParams(ctx *fiber.Ctx) (types.PromotionParams, int, fiber.Map) {
+	params := types.PromotionParams{}
+	if err := ctx.BodyParser(&params); err != nil {
+		return params, fiber.StatusBadRequest, fiber.Map{"error": err.Error()}
+	}
+	if errors := params.Validate(); len(errors) > 0 {
+		return params, fiber.StatusBadRequest, fiber.Map{"errors": errors}
+	}
+	return params, fiber.StatusOK, nil
+}
+
+func (h *PromotionHandler) HandlePostCreatePromotionv1(ctx *fiber.Ctx) error {
+	params, status, reply := parsePromotionParams(ctx)
+	if reply != nil {
+		return ctx.Status(status).JSON(reply)
+	}
+	promotion := &types.Promotion{CreatedAt: time.Now().UTC()}
+	params.Apply(promotion)
+	promotion, err := h.store.Promotion.CreatePromotion(ctx.Context(), promotion)
+	if err != nil {
+		return ctx.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	return ctx.Status(fiber.StatusCreated).JSON(promotion)
+}
+
+func (h *PromotionHandler) HandleGetPromotionsv1(ctx *fiber.Ctx) error {
+	pagination := db.Pagination{
+		Page:  ctx.Query("page"),
+		Limit: ctx.Query("limit"),
+	}
+	promotions, err := h.store.Promotion.GetPromotions(ctx.Context(), &pagination)
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return ctx.JSON(promotions)
+}
+
+func (h *PromotionHandler) HandleGetPromotionv1(ctx *fiber.Ctx) error {
+	pid, err := primitive.ObjectIDFromHex(ctx.Params("pid"))
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	promotion, err := h.store.Promotion.GetPromotion(ctx.Context(), db.PromotionFilter{Id: pid})
+	if err != nil {
+		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	return ctx.JSON(promotion)
+}
+
+// HandlePutPromotionv1 replaces the fields of a promotion set by admins. The
+// reservations already made with it keep their discount.
+func (h *PromotionHandler) HandlePutPromotionv1(ctx *fiber.Ctx) error {
+	pid, err := primitive.ObjectIDFromHex(ctx.Params("pid"))
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	params, status, reply := parsePromotionParams(ctx)
+	if reply != nil {
+		return ctx.Status(status).JSON(reply)
+	}
+	filter := db.PromotionFilter{Id: pid}
+	if _, err := h.store.Promotion.GetPromotion(ctx.Context(), filter); err != nil {
+		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	promotion, err := h.store.Promotion.UpdatePromotion(ctx.Context(), filter, params)
+	if err != nil {
+		return ctx.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	return ctx.JSON(promotion)
+}
+
+func (h *PromotionHandler) HandleDeletePromotionv1(ctx *fiber.Ctx) error {
+	pid, err := primitive.ObjectIDFromHex(ctx.Params("pid"))
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := h.store.Promotion.DeletePromotion(ctx.Context(), db.PromotionFilter{Id: pid}); err != nil {
+		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	return ctx.Status(fiber.StatusOK).SendString("Promotion deleted: " + pid.Hex())
+}
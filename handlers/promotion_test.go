@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fabrizioperria/goflight/cancellation"
+	"github.com/fabrizioperria/goflight/handlers/middleware"
+	"github.com/fabrizioperria/goflight/loyalty"
+	"github.com/fabrizioperria/goflight/payments"
+	"github.com/fabrizioperria/goflight/pricing"
+	"github.com/fabrizioperria/goflight/types"
+	"github.com/fabrizioperria/goflight/waitlist"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+type testPromotionDb struct {
+	*testReservationDb
+
+	reservationHandler *ReservationHandler
+	promotionHandler   *PromotionHandler
+}
+
+func setupPromotionDb() (*testPromotionDb, error) {
+	testDb, err := setupReservationDb("200", "200", "200")
+	if err != nil {
+		return nil, err
+	}
+	processor := payments.NewProcessor(payments.NewFakeGateway(), testDb.Store.Reservation, testDb.Store.Credit)
+	program := loyalty.NewProgram(*testDb.Store, loyalty.DefaultRules())
+	queue := waitlist.NewQueue(*testDb.Store, program, waitlist.LogNotifier{}, waitlist.DefaultOfferTTL)
+	settler := cancellation.NewSettler(*testDb.Store, processor, program, queue)
+	return &testPromotionDb{
+		testReservationDb:  testDb,
+		reservationHandler: NewReservationHandler(*testDb.Store, pricing.NewEngine(pricing.DefaultConfig()), pricing.DefaultExchangeRates(), processor, program, queue, settler),
+		promotionHandler:   NewPromotionHandler(*testDb.Store),
+	}, nil
+}
+
+// as serves the promotions, and the reservations that redeem them, to user.
+func (testDb *testPromotionDb) as(user *types.User) *fiber.App {
+	app := fiber.New()
+	app.Use(authenticateAs(user))
+	admin := app.Group("/admin", middleware.AdminOnly())
+	admin.Post("/promotions", testDb.promotionHandler.HandlePostCreatePromotionv1)
+	admin.Get("/promotions", testDb.promotionHandler.HandleGetPromotionsv1)
+	admin.Get("/promotions/:pid", testDb.promotionHandler.HandleGetPromotionv1)
+	admin.Put("/promotions/:pid", testDb.promotionHandler.HandlePutPromotionv1)
+	admin.Delete("/promotions/:pid", testDb.promotionHandler.HandleDeletePromotionv1)
+	app.Post("/flights/:fid/seats/:sid/reservations", testDb.reservationHandler.HandlePostCreateReservationv1)
+	return app
+}
+
+func TestPromotionsv1(t *testing.T) {
+	testDb, err := setupPromotionDb()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer teardownReservationDb(t, testDb.testReservationDb)
+	admin, passenger := testDb.as(testDb.Admin), testDb.as(testDb.Owner)
+	reserveWith := func(seat *types.Seat, code string) (int, *types.Reservation) {
+		return reserve(t, passenger, seat, types.ReservationBody{PromoCode: code})
+	}
+	seats := testDb.Seats
+
+	invalid := []types.PromotionParams{
+		{DiscountType: types.DiscountPercentage, Percent: 10},
+		{Code: "SALE", DiscountType: "bogo"},
+		{Code: "SALE", DiscountType: types.DiscountPercentage, Percent: 120},
+		{Code: "SALE", DiscountType: types.DiscountFixed},
+		{Code: "SALE", DiscountType: types.DiscountFixed, Amount: types.MustParseMoney("20", "USD"), MaxPerUser: -1},
+		{Code: "SALE", DiscountType: types.DiscountPercentage, Percent: 10, ValidFrom: time.Now(), ValidUntil: time.Now().Add(-time.Hour)},
+	}
+	for _, params := range invalid {
+		assert.Equal(t, fiber.StatusBadRequest, send(t, admin, "POST", "/admin/promotions", params, nil), params)
+	}
+	params := types.PromotionParams{Code: "sale", DiscountType: types.DiscountPercentage, Percent: 25, Routes: []string{"jfk-lax"}, Classes: []types.SeatClass{types.Business}, MaxPerUser: 1}
+	assert.Equal(t, fiber.StatusUnauthorized, send(t, passenger, "POST", "/admin/promotions", params, nil))
+	promotion := &types.Promotion{}
+	assert.Equal(t, fiber.StatusCreated, send(t, admin, "POST", "/admin/promotions", params, promotion))
+	assert.Equal(t, "SALE", promotion.Code)
+	assert.Equal(t, []string{"JFK-LAX"}, promotion.Routes)
+	assert.Equal(t, fiber.StatusConflict, send(t, admin, "POST", "/admin/promotions", params, nil))
+
+	// the promotion only applies to the seats it is scoped to
+	status, _ := reserveWith(seats[0], "SALE")
+	assert.Equal(t, fiber.StatusBadRequest, status)
+	status, _ = reserveWith(seats[0], "NOSALE")
+	assert.Equal(t, fiber.StatusBadRequest, status)
+	params.Classes = nil
+	assert.Equal(t, fiber.StatusOK, send(t, admin, "PUT", "/admin/promotions/"+promotion.Id.Hex(), params, nil))
+	status, reservation := reserveWith(seats[0], "sale")
+	assert.Equal(t, fiber.StatusCreated, status)
+	if assert.NotNil(t, reservation.Promotion) {
+		assert.True(t, types.MustParseMoney("50", "USD").Equal(reservation.Promotion.Discount), reservation.Promotion.Discount)
+	}
+	assert.True(t, types.MustParseMoney("150", "USD").Equal(reservation.AmountDue()), reservation.AmountDue())
+	status, _ = reserveWith(seats[1], "SALE")
+	assert.Equal(t, fiber.StatusConflict, status)
+	status, _ = reserveWith(seats[1], "")
+	assert.Equal(t, fiber.StatusCreated, status)
+
+	assert.Equal(t, fiber.StatusOK, send(t, admin, "GET", "/admin/promotions/"+promotion.Id.Hex(), nil, promotion))
+	assert.Equal(t, 1, promotion.Redemptions)
+	promotions := []*types.Promotion{}
+	assert.Equal(t, fiber.StatusOK, send(t, admin, "GET", "/admin/promotions", nil, &promotions))
+	assert.Len(t, promotions, 1)
+
+	assert.Equal(t, fiber.StatusOK, send(t, admin, "DELETE", "/admin/promotions/"+promotion.Id.Hex(), nil, nil))
+	assert.Equal(t, fiber.StatusNotFound, send(t, admin, "DELETE", "/admin/promotions/"+promotion.Id.Hex(), nil, nil))
+	assert.Equal(t, fiber.StatusNotFound, send(t, admin, "GET", "/admin/promotions/"+promotion.Id.Hex(), nil, nil))
+	assert.Equal(t, fiber.StatusNotFound, send(t, admin, "PUT", "/admin/promotions/"+promotion.Id.Hex(), params, nil))
+}
@@ -1,66 +1,423 @@
 package handlers
 
 import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/fabrizioperria/goflight/cancellation"
 	"github.com/fabrizioperria/goflight/db"
+	"github.com/fabrizioperria/goflight/loyalty"
+	"github.com/fabrizioperria/goflight/payments"
+	"github.com/fabrizioperria/goflight/pricing"
 	"github.com/fabrizioperria/goflight/types"
+	"github.com/fabrizioperria/goflight/waitlist"
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type ReservationHandler struct {
-	store db.Store
+	store     db.Store
+	rates     pricing.ExchangeRates
+	refunder  pricing.Refunder
+	processor *payments.Processor
+	loyalty   *loyalty.Program
+	waitlist  *waitlist.Queue
+	settler   *cancellation.Settler
 }
 
-func NewReservationHandler(store db.Store) *ReservationHandler {
+func NewReservationHandler(store db.Store, refunder pricing.Refunder, rates pricing.ExchangeRates, processor *payments.Processor, program *loyalty.Program, queue *waitlist.Queue, settler *cancellation.Settler) *ReservationHandler {
 	return &ReservationHandler{
-		store: store,
+		store:     store,
+		rates:     rates,
+		refunder:  refunder,
+		processor: processor,
+		loyalty:   program,
+		waitlist:  queue,
+		settler:   settler,
 	}
 }
 
+// checkout pays for the reservations just made and returns them along with
+// the status code to reply with: created once paid, accepted while the
+// payment is pending, and payment required when it failed. The loyalty
+// points of the reservations confirmed are given, and the ones spent on the
+// reservations cancelled given back.
+func (h *ReservationHandler) checkout(ctx *fiber.Ctx, reservations []*types.Reservation, method string) ([]*types.Reservation, int, error) {
+	paid, err := h.processor.Checkout(ctx.Context(), reservations, method)
+	if settleErr := h.loyalty.Settle(ctx.Context(), paid); settleErr != nil && err == nil {
+		err = settleErr
+	}
+	var declinedErr *payments.DeclinedError
+	switch {
+	case errors.As(err, &declinedErr):
+		return nil, fiber.StatusPaymentRequired, err
+	case err != nil:
+		return nil, fiber.StatusInternalServerError, err
+	}
+	for _, reservation := range paid {
+		if reservation.CurrentStatus() == types.ReservationPending {
+			return paid, fiber.StatusAccepted, nil
+		}
+	}
+	return paid, fiber.StatusCreated, nil
+}
+
+// spending reads what the user asked in body to spend on the reservation
+// they make, the credit and the loyalty points, or nil when nothing.
+func (h *ReservationHandler) spending(ctx *fiber.Ctx, body types.ReservationBody) (*db.Spending, error) {
+	if body.LoyaltyPoints < 0 {
+		return nil, fmt.Errorf("loyalty_points must not be negative")
+	}
+	if body.CreditId == "" && body.LoyaltyPoints == 0 {
+		return nil, nil
+	}
+	spending := &db.Spending{Points: body.LoyaltyPoints, PointValue: h.loyalty.PointValue()}
+	if body.CreditId != "" {
+		cid, err := primitive.ObjectIDFromHex(body.CreditId)
+		if err != nil {
+			return nil, err
+		}
+		user := ctx.Context().UserValue("user").(*types.User)
+		spending.Credit = &db.CreditFilter{Id: cid, UserId: user.Id}
+	}
+	return spending, nil
+}
+
+// checkFlightBookable returns the status code and error to reply with when
+// no seat of flight can be reserved anymore. Seats are available as
+// HandleGetSeatsv1 lists them, including those whose hold expired before the
+// sweeper released them.
+func (h *ReservationHandler) checkFlightBookable(ctx *fiber.Ctx, flight *types.Flight) (int, error) {
+	if time.Now().After(flight.DepartureTime) {
+		return fiber.StatusNotFound, fmt.Errorf("Flight already departed")
+	}
+
+	available := true
+	seats, err := h.store.Seat.GetSeats(ctx.Context(), db.SeatFilter{FlightId: flight.Id, Available: &available}, &db.Pagination{Limit: "1"})
+	if err != nil {
+		return fiber.StatusInternalServerError, err
+	}
+	if len(seats) == 0 {
+		return fiber.StatusNotFound, fmt.Errorf("No seats available")
+	}
+	return fiber.StatusOK, nil
+}
+
+// passengerFor validates passenger for flight. A nil passenger is the user
+// travelling themselves.
+func passengerFor(passenger *types.Passenger, user *types.User, flight *types.Flight) (*types.Passenger, map[string]string) {
+	if passenger == nil {
+		return types.PassengerFromUser(user), nil
+	}
+	// ages are counted on the local date of departure
+	if errors := passenger.Validate(flight.LocalDepartureTime()); len(errors) > 0 {
+		return nil, errors
+	}
+	return passenger, nil
+}
+
+// parseReservationBody reads the passenger of a single seat reservation from
+// the optional request body.
+func parseReservationBody(ctx *fiber.Ctx) (types.ReservationBody, error) {
+	body := types.ReservationBody{}
+	if len(ctx.Body()) == 0 {
+		return body, nil
+	}
+	err := ctx.BodyParser(&body)
+	return body, err
+}
+
 func (h *ReservationHandler) HandlePostCreateReservationv1(ctx *fiber.Ctx) error {
 	flightID := ctx.Params("fid")
 	fid, err := primitive.ObjectIDFromHex(flightID)
 	if err != nil {
 		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
-	filter := db.Map{"_id": fid}
+	filter := db.FlightFilter{Id: fid}
 	flight, err := h.store.Flight.GetFlight(ctx.Context(), filter)
 	if err != nil {
 		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	if len(flight.Seats) == 0 {
-		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "No seats available"})
+	if status, err := h.checkFlightBookable(ctx, flight); err != nil {
+		return ctx.Status(status).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	dateFrom, err := time.Parse(time.RFC3339, flight.DepartureTime)
+	seatID := ctx.Params("sid")
+	sid, err := primitive.ObjectIDFromHex(seatID)
 	if err != nil {
 		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
-	dateTo, err := time.Parse(time.RFC3339, flight.ArrivalTime)
+
+	body, err := parseReservationBody(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	user := ctx.Context().UserValue("user").(*types.User)
+	passenger, errors := passengerFor(body.Passenger, user, flight)
+	if len(errors) > 0 {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors})
+	}
+	spending, err := h.spending(ctx, body)
 	if err != nil {
 		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	if time.Now().After(dateFrom) || time.Now().After(dateTo) {
+	reservation, err := h.store.Reservation.CreateReservation(ctx.Context(), db.SeatFilter{Id: sid, FlightId: fid}, user.Id, passenger, body.PromoCode, spending)
+	if err != nil {
+		return ctx.Status(reservationStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	paid, status, err := h.checkout(ctx, []*types.Reservation{reservation}, body.PaymentMethod)
+	if err != nil {
+		return ctx.Status(status).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return ctx.Status(status).JSON(paid[0])
+}
+
+// HandlePostCreateUnassignedReservationv1 reserves a seat of a class on a
+// flight with none left in it, within the overbooking allowance of the
+// flight. The seat is assigned when the passenger checks in.
+func (h *ReservationHandler) HandlePostCreateUnassignedReservationv1(ctx *fiber.Ctx) error {
+	fid, err := primitive.ObjectIDFromHex(ctx.Params("fid"))
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	flight, err := h.store.Flight.GetFlight(ctx.Context(), db.FlightFilter{Id: fid})
+	if err != nil {
+		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	if time.Now().After(flight.DepartureTime) {
 		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Flight already departed"})
 	}
 
-	seatID := ctx.Params("sid")
-	sid, err := primitive.ObjectIDFromHex(seatID)
+	body := types.UnassignedReservationBody{}
+	if err := ctx.BodyParser(&body); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if errors := body.Validate(); len(errors) > 0 {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors})
+	}
+	user := ctx.Context().UserValue("user").(*types.User)
+	passenger, errors := passengerFor(body.Passenger, user, flight)
+	if len(errors) > 0 {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors})
+	}
+
+	spending, err := h.spending(ctx, body.ReservationBody)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	reservation, err := h.store.Reservation.CreateUnassignedReservation(ctx.Context(), fid, body.Class, user.Id, passenger, body.PromoCode, spending)
+	if err != nil {
+		return ctx.Status(reservationStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	paid, status, err := h.checkout(ctx, []*types.Reservation{reservation}, body.PaymentMethod)
+	if err != nil {
+		return ctx.Status(status).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return ctx.Status(status).JSON(paid[0])
+}
+
+func (h *ReservationHandler) HandlePostCreateHoldv1(ctx *fiber.Ctx) error {
+	fid, err := primitive.ObjectIDFromHex(ctx.Params("fid"))
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	sid, err := primitive.ObjectIDFromHex(ctx.Params("sid"))
 	if err != nil {
 		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	params := types.CreateHoldParams{}
+	if len(ctx.Body()) > 0 {
+		if err := ctx.BodyParser(&params); err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+	errors := params.Validate()
+	if len(errors) > 0 {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors})
+	}
+
+	flight, err := h.store.Flight.GetFlight(ctx.Context(), db.FlightFilter{Id: fid})
+	if err != nil {
+		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	if status, err := h.checkFlightBookable(ctx, flight); err != nil {
+		return ctx.Status(status).JSON(fiber.Map{"error": err.Error()})
+	}
+
 	user := ctx.Context().UserValue("user").(*types.User)
-	reservation, err := h.store.Reservation.CreateReservation(ctx.Context(), db.Map{"_id": sid}, user.Id)
+	seat, err := h.store.Reservation.HoldSeat(ctx.Context(), db.SeatFilter{Id: sid, FlightId: fid}, user.Id, time.Now().Add(params.TTL()))
+	if err != nil {
+		return ctx.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(seat)
+}
+
+func (h *ReservationHandler) HandlePostConfirmHoldv1(ctx *fiber.Ctx) error {
+	fid, err := primitive.ObjectIDFromHex(ctx.Params("fid"))
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	sid, err := primitive.ObjectIDFromHex(ctx.Params("sid"))
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	body, err := parseReservationBody(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	flight, err := h.store.Flight.GetFlight(ctx.Context(), db.FlightFilter{Id: fid})
 	if err != nil {
 		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
 	}
+	user := ctx.Context().UserValue("user").(*types.User)
+	passenger, errors := passengerFor(body.Passenger, user, flight)
+	if len(errors) > 0 {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors})
+	}
+
+	spending, err := h.spending(ctx, body)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	reservation, err := h.store.Reservation.ConfirmHold(ctx.Context(), db.SeatFilter{Id: sid, FlightId: fid}, user.Id, passenger, spending)
+	if err != nil {
+		return ctx.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := h.waitlist.Booked(ctx.Context(), reservation); err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	paid, status, err := h.checkout(ctx, []*types.Reservation{reservation}, body.PaymentMethod)
+	if err != nil {
+		return ctx.Status(status).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return ctx.Status(status).JSON(paid[0])
+}
+
+func (h *ReservationHandler) HandlePostCreateBookingv1(ctx *fiber.Ctx) error {
+	params := types.CreateBookingParams{}
+	if err := ctx.BodyParser(&params); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	errors := params.Validate()
+	if len(errors) > 0 {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors})
+	}
+
+	user := ctx.Context().UserValue("user").(*types.User)
+	seats := []db.PassengerSeat{}
+	flights := map[primitive.ObjectID]*types.Flight{}
+	for i, seat := range params.Seats {
+		flight, ok := flights[seat.FlightId]
+		if !ok {
+			var err error
+			flight, err = h.store.Flight.GetFlight(ctx.Context(), db.FlightFilter{Id: seat.FlightId})
+			if err != nil {
+				return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+			}
+			if status, err := h.checkFlightBookable(ctx, flight); err != nil {
+				return ctx.Status(status).JSON(fiber.Map{"error": err.Error()})
+			}
+			flights[seat.FlightId] = flight
+		}
+		passenger, errors := passengerFor(seat.Passenger, user, flight)
+		if len(errors) > 0 {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors, "seat": i})
+		}
+		seats = append(seats, db.PassengerSeat{
+			Seat:      db.SeatFilter{Id: seat.SeatId, FlightId: seat.FlightId},
+			Passenger: passenger,
+		})
+	}
+
+	booking, err := h.store.Reservation.CreateBooking(ctx.Context(), seats, user.Id)
+	if err != nil {
+		return ctx.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	paid, status, err := h.checkout(ctx, booking.Reservations, params.PaymentMethod)
+	if err != nil {
+		return ctx.Status(status).JSON(fiber.Map{"error": err.Error()})
+	}
+	booking.Reservations = paid
+
+	return ctx.Status(status).JSON(booking)
+}
+
+func (h *ReservationHandler) HandleGetBookingv1(ctx *fiber.Ctx) error {
+	bid, err := primitive.ObjectIDFromHex(ctx.Params("bid"))
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	booking, err := h.store.Reservation.GetBooking(ctx.Context(), db.BookingFilter{Id: bid})
+	if err != nil {
+		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	user := ctx.Context().UserValue("user").(*types.User)
+	if booking.UserId != user.Id && !user.IsAdmin {
+		return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	if err := convertReservations(ctx, h.rates, booking.Reservations...); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return ctx.JSON(booking)
+}
+
+// travelsAs reports whether lastName is the last name of the passenger of
+// reservation, or of its owner when it has no passenger.
+func (h *ReservationHandler) travelsAs(ctx *fiber.Ctx, reservation *types.Reservation, lastName string) bool {
+	if reservation.Passenger != nil {
+		return strings.EqualFold(reservation.Passenger.LastName, lastName)
+	}
+	user, err := h.store.User.GetUser(ctx.Context(), db.UserFilter{Id: reservation.UserId})
+	return err == nil && strings.EqualFold(user.LastName, lastName)
+}
+
+// HandleGetReservationLookupv1 lets a customer without an account token
+// retrieve a reservation, or a whole booking, from its record locator and the
+// last name of one of its passengers. Mismatches are all reported as not
+// found so that the endpoint does not tell which locators exist.
+func (h *ReservationHandler) HandleGetReservationLookupv1(ctx *fiber.Ctx) error {
+	locator := types.NormalizeLocator(ctx.Query("locator"))
+	lastName := strings.TrimSpace(ctx.Query("last_name"))
+	if !types.IsValidLocator(locator) || lastName == "" {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "a valid locator and last_name are required"})
+	}
 
-	return ctx.Status(fiber.StatusCreated).JSON(reservation)
+	reservation, err := h.store.Reservation.GetReservation(ctx.Context(), db.ReservationFilter{Locator: locator})
+	if err == nil && h.travelsAs(ctx, reservation, lastName) {
+		if err := convertReservations(ctx, h.rates, reservation); err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		return ctx.JSON(reservation)
+	}
+
+	booking, err := h.store.Reservation.GetBooking(ctx.Context(), db.BookingFilter{Locator: locator})
+	if err == nil {
+		for _, reservation := range booking.Reservations {
+			if h.travelsAs(ctx, reservation, lastName) {
+				if err := convertReservations(ctx, h.rates, booking.Reservations...); err != nil {
+					return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+				}
+				return ctx.JSON(booking)
+			}
+		}
+	}
+	return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Reservation not found"})
 }
 
 func (h *ReservationHandler) HandleGetAllReservationsv1(ctx *fiber.Ctx) error {
@@ -68,7 +425,7 @@ func (h *ReservationHandler) HandleGetAllReservationsv1(ctx *fiber.Ctx) error {
 		Page:  ctx.Query("page"),
 		Limit: ctx.Query("limit"),
 	}
-	reservations, err := h.store.Reservation.GetReservations(ctx.Context(), db.Map{}, &pagination)
+	reservations, err := h.store.Reservation.GetReservations(ctx.Context(), db.ReservationFilter{}, &pagination)
 	if err != nil {
 		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -76,6 +433,9 @@ func (h *ReservationHandler) HandleGetAllReservationsv1(ctx *fiber.Ctx) error {
 	if !user.IsAdmin {
 		return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
 	}
+	if err := convertReservations(ctx, h.rates, reservations...); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
 
 	return ctx.JSON(reservations)
 }
@@ -86,25 +446,53 @@ func (h *ReservationHandler) HandleGetMyReservationsv1(ctx *fiber.Ctx) error {
 		Page:  ctx.Query("page"),
 		Limit: ctx.Query("limit"),
 	}
-	reservations, err := h.store.Reservation.GetReservations(ctx.Context(), db.Map{"user_id": user.Id}, &pagination)
+	reservations, err := h.store.Reservation.GetReservations(ctx.Context(), db.ReservationFilter{UserId: user.Id}, &pagination)
 	if err != nil {
 		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
+	if err := convertReservations(ctx, h.rates, reservations...); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
 
 	return ctx.JSON(reservations)
 }
 
-func (h *ReservationHandler) authenticateUser(ctx *fiber.Ctx, filter db.Map) error {
+// authenticateUser returns the reservation matching filter, or the status
+// code and error to reply with when the user cannot access it.
+func (h *ReservationHandler) authenticateUser(ctx *fiber.Ctx, filter db.ReservationFilter) (*types.Reservation, int, error) {
 	reservation, err := h.store.Reservation.GetReservation(ctx.Context(), filter)
 	if err != nil {
-		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		return nil, fiber.StatusNotFound, err
 	}
 
 	user := ctx.Context().UserValue("user").(*types.User)
 	if reservation.UserId != user.Id && !user.IsAdmin {
-		return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		return nil, fiber.StatusUnauthorized, fmt.Errorf("Unauthorized")
+	}
+	return reservation, fiber.StatusOK, nil
+}
+
+// reservationStatus is the status code to reply with when err comes from
+// reserving a seat.
+func reservationStatus(err error) int {
+	switch {
+	case errors.Is(err, types.ErrPromotionExhausted), errors.Is(err, types.ErrSeatsAvailable), errors.Is(err, types.ErrOverbookingExhausted),
+		errors.Is(err, types.ErrCreditUnavailable), errors.Is(err, types.ErrPointsUnavailable):
+		return fiber.StatusConflict
+	case errors.Is(err, types.ErrPromotionNotApplicable):
+		return fiber.StatusBadRequest
 	}
-	return nil
+	return fiber.StatusNotFound
+}
+
+// transitionStatus is the status code to reply with when err comes from a
+// reservation status change.
+func transitionStatus(err error) int {
+	var transitionErr *types.TransitionError
+	if errors.As(err, &transitionErr) || errors.Is(err, types.ErrNoSeatToAssign) {
+		return fiber.StatusConflict
+	}
+	return fiber.StatusNotFound
 }
 
 func (h *ReservationHandler) HandleGetReservationv1(ctx *fiber.Ctx) error {
@@ -113,12 +501,13 @@ func (h *ReservationHandler) HandleGetReservationv1(ctx *fiber.Ctx) error {
 	if err != nil {
 		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
-	filter := db.Map{"_id": rid}
-	err = h.authenticateUser(ctx, filter)
+	reservation, status, err := h.authenticateUser(ctx, db.ReservationFilter{Id: rid})
 	if err != nil {
-		return err
+		return ctx.Status(status).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := convertReservations(ctx, h.rates, reservation); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
-	reservation, _ := h.store.Reservation.GetReservation(ctx.Context(), filter)
 	return ctx.JSON(reservation)
 }
 
@@ -128,13 +517,291 @@ func (h *ReservationHandler) HandleDeleteReservationv1(ctx *fiber.Ctx) error {
 	if err != nil {
 		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
-	filter := db.Map{"_id": rid}
-	err = h.authenticateUser(ctx, filter)
+	filter := db.ReservationFilter{Id: rid}
+	reservation, status, err := h.authenticateUser(ctx, filter)
+	if err != nil {
+		return ctx.Status(status).JSON(fiber.Map{"error": err.Error()})
+	}
+	params := types.CancelReservationParams{}
+	if len(ctx.Body()) > 0 {
+		if err := ctx.BodyParser(&params); err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
+	refund, credit, status, err := h.refundFor(ctx, reservation, params)
+	if err != nil {
+		return ctx.Status(status).JSON(fiber.Map{"error": err.Error()})
+	}
+	if credit != nil {
+		credit.Id = primitive.NewObjectID()
+		refund.CreditId = credit.Id
+	}
+	cancelled, err := h.store.Reservation.CancelReservation(ctx.Context(), filter, refund, credit)
+	if err != nil {
+		return ctx.Status(transitionStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return h.settle(ctx, cancelled)
+}
+
+// settle settles reservation, just ended, and replies with it. The
+// reservation is ended either way, and what failed to settle is retried
+// later: a refund the provider failed is reported as a bad gateway.
+func (h *ReservationHandler) settle(ctx *fiber.Ctx, reservation *types.Reservation) error {
+	settled, err := h.settler.Settle(ctx.Context(), reservation, time.Now())
+	var refundErr *cancellation.RefundError
+	switch {
+	case errors.As(err, &refundErr):
+		return ctx.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": err.Error()})
+	case err != nil:
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return ctx.JSON(settled)
+}
+
+// offerSeat offers the seat with seatId, just given back to the flight, to
+// the first user waiting for it. The reservations without a seat give none
+// back, and their seatId is unset.
+func (h *ReservationHandler) offerSeat(ctx *fiber.Ctx, seatId primitive.ObjectID) error {
+	if seatId.IsZero() {
+		return nil
+	}
+	seat, err := h.store.Seat.GetSeat(ctx.Context(), db.SeatFilter{Id: seatId})
 	if err != nil {
 		return err
 	}
-	if err = h.store.Reservation.DeleteReservation(ctx.Context(), filter); err != nil {
+	_, err = h.waitlist.Offer(ctx.Context(), seat, time.Now())
+	return err
+}
+
+// HandlePutReservationSeatv1 moves a reservation to another seat of its
+// flight, giving its seat back, and prices it like the new seat. The fare
+// difference is charged first when the new seat costs more, and the seat is
+// not changed when the charge fails; it is refunded on the payment of the
+// reservation when the new seat costs less. The seat given back is offered
+// to the users waiting for one.
+func (h *ReservationHandler) HandlePutReservationSeatv1(ctx *fiber.Ctx) error {
+	rid, err := primitive.ObjectIDFromHex(ctx.Params("rid"))
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	filter := db.ReservationFilter{Id: rid}
+	reservation, status, err := h.authenticateUser(ctx, filter)
+	if err != nil {
+		return ctx.Status(status).JSON(fiber.Map{"error": err.Error()})
+	}
+	params := types.ChangeSeatParams{}
+	if err := ctx.BodyParser(&params); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if errors := params.Validate(); len(errors) > 0 {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors})
+	}
+
+	flight, err := h.store.Flight.GetFlight(ctx.Context(), db.FlightFilter{Id: reservation.FlightId})
+	if err != nil {
+		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	if time.Now().After(flight.DepartureTime) {
+		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Flight already departed"})
+	}
+	if !reservation.CurrentStatus().CanChangeSeat() {
+		return ctx.Status(fiber.StatusConflict).JSON(fiber.Map{"error": types.ErrSeatNotChangeable.Error()})
+	}
+	seatFilter := db.SeatFilter{Id: params.SeatId, FlightId: reservation.FlightId}
+	seat, err := h.store.Seat.GetSeat(ctx.Context(), seatFilter)
+	if err != nil {
+		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	difference, err := reservation.FareDifference(seat)
+	if err != nil {
+		return ctx.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var charge *types.Payment
+	if difference.IsPos() {
+		charge, err = h.processor.ChargeSeatChange(ctx.Context(), difference, params.PaymentMethod)
+		var declinedErr *payments.DeclinedError
+		switch {
+		case errors.As(err, &declinedErr):
+			return ctx.Status(fiber.StatusPaymentRequired).JSON(fiber.Map{"error": err.Error()})
+		case err != nil:
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+	changed, err := h.store.Reservation.ChangeSeat(ctx.Context(), filter, seatFilter, charge)
+	if err != nil {
+		if charge != nil {
+			if refundErr := h.processor.RefundSeatChangeCharge(ctx.Context(), charge); refundErr != nil {
+				err = fmt.Errorf("%w, then refunding the charge: %v", err, refundErr)
+				return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+			}
+		}
+		status := fiber.StatusNotFound
+		if errors.Is(err, types.ErrSeatNotChangeable) || errors.Is(err, types.ErrFareChanged) {
+			status = fiber.StatusConflict
+		}
+		return ctx.Status(status).JSON(fiber.Map{"error": err.Error()})
+	}
+	changed, err = h.processor.RefundSeatChange(ctx.Context(), changed)
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	// the new seat may be the one offered to the user from the waitlist
+	if err := h.waitlist.Booked(ctx.Context(), changed); err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := h.offerSeat(ctx, reservation.SeatId); err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return ctx.JSON(changed)
+}
+
+// HandlePostDenyBoardingv1 denies boarding to the passenger of a reservation
+// left behind by an overbooked flight. Everything paid for it is refunded,
+// and the passenger compensated with a credit as the denied boarding policy
+// of the flight says.
+func (h *ReservationHandler) HandlePostDenyBoardingv1(ctx *fiber.Ctx) error {
+	rid, err := primitive.ObjectIDFromHex(ctx.Params("rid"))
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	filter := db.ReservationFilter{Id: rid}
+	reservation, err := h.store.Reservation.GetReservation(ctx.Context(), filter)
+	if err != nil {
+		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	flight, err := h.store.Flight.GetFlight(ctx.Context(), db.FlightFilter{Id: reservation.FlightId})
+	if err != nil {
 		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
 	}
-	return ctx.Status(fiber.StatusOK).SendString("Reservation deleted")
+	miles, err := db.FlightMiles(ctx.Context(), h.store.Airport, flight)
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	refund, credit, err := h.refunder.Compensate(flight, reservation, int(miles), time.Now())
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	// the credit of the reservations not paid for is only found from its
+	// IssuedFor
+	if credit != nil {
+		credit.Id = primitive.NewObjectID()
+		if refund != nil {
+			refund.CreditId = credit.Id
+		}
+	}
+
+	denied, err := h.store.Reservation.DenyBoarding(ctx.Context(), filter, refund, credit)
+	if err != nil {
+		return ctx.Status(transitionStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return h.settle(ctx, denied)
+}
+
+// refundFor returns what to refund of reservation were it cancelled now:
+// what the cancellation policy of its flight says, along with the credit it
+// gives for the rest, or the amount set by an admin instead. Reservations
+// that were not paid for have no refund.
+func (h *ReservationHandler) refundFor(ctx *fiber.Ctx, reservation *types.Reservation, params types.CancelReservationParams) (*types.Refund, *types.Credit, int, error) {
+	user := ctx.Context().UserValue("user").(*types.User)
+	if params.RefundAmount != nil && !user.IsAdmin {
+		return nil, nil, fiber.StatusUnauthorized, fmt.Errorf("Unauthorized")
+	}
+	paid := reservation.AmountRefundable()
+	if !paid.IsPos() {
+		return nil, nil, fiber.StatusOK, nil
+	}
+	now := time.Now()
+	if params.RefundAmount != nil {
+		refund, err := types.OverrideRefund(paid, *params.RefundAmount, user.Id, now)
+		if err != nil {
+			return nil, nil, fiber.StatusBadRequest, err
+		}
+		return refund, nil, fiber.StatusOK, nil
+	}
+
+	flight, err := h.store.Flight.GetFlight(ctx.Context(), db.FlightFilter{Id: reservation.FlightId})
+	if err != nil {
+		return nil, nil, fiber.StatusNotFound, err
+	}
+	refund, err := h.refunder.Refund(flight, reservation, now)
+	if err != nil {
+		return nil, nil, fiber.StatusInternalServerError, err
+	}
+	return refund, h.refunder.Credit(flight, reservation, refund, now), fiber.StatusOK, nil
+}
+
+// HandlePutReservationStatusv1 moves a reservation through ticketing,
+// check-in and boarding, or marks it a no-show. Cancellations go through
+// HandleDeleteReservationv1, which refunds them.
+func (h *ReservationHandler) HandlePutReservationStatusv1(ctx *fiber.Ctx) error {
+	rid, err := primitive.ObjectIDFromHex(ctx.Params("rid"))
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	params := types.UpdateReservationStatusParams{}
+	if err := ctx.BodyParser(&params); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if errors := params.Validate(); len(errors) > 0 {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors})
+	}
+
+	reservation, err := h.store.Reservation.UpdateReservationStatus(ctx.Context(), db.ReservationFilter{Id: rid}, params.Status)
+	if err != nil {
+		return ctx.Status(transitionStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := h.loyalty.Settle(ctx.Context(), []*types.Reservation{reservation}); err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return ctx.JSON(reservation)
+}
+
+func (h *ReservationHandler) HandleGetFlightManifestv1(ctx *fiber.Ctx) error {
+	fid, err := primitive.ObjectIDFromHex(ctx.Params("fid"))
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if _, err := h.store.Flight.GetFlight(ctx.Context(), db.FlightFilter{Id: fid}); err != nil {
+		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	reservations, err := h.store.Reservation.GetReservations(ctx.Context(), db.ReservationFilter{FlightId: fid}, &db.Pagination{Limit: "0"})
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	seats, err := h.store.Seat.GetSeats(ctx.Context(), db.SeatFilter{FlightId: fid}, &db.Pagination{Limit: "0"})
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	seatsById := map[primitive.ObjectID]*types.Seat{}
+	for _, seat := range seats {
+		seatsById[seat.Id] = seat
+	}
+
+	manifest := []types.ManifestEntry{}
+	for _, reservation := range reservations {
+		if !reservation.CurrentStatus().IsOnBoard() {
+			continue
+		}
+		// the reservations sold beyond the seats have none until check-in
+		entry := types.ManifestEntry{
+			ReservationId: reservation.Id,
+			UserId:        reservation.UserId,
+			SeatId:        reservation.SeatId,
+			Class:         reservation.Class,
+			Passenger:     reservation.Passenger,
+		}
+		if seat, ok := seatsById[reservation.SeatId]; ok {
+			entry.SeatNumber = seat.Number
+			entry.Seat = seat.Designator
+			entry.Class = seat.Class
+		}
+		manifest = append(manifest, entry)
+	}
+	slices.SortFunc(manifest, func(a, b types.ManifestEntry) int {
+		return cmp.Compare(a.SeatNumber, b.SeatNumber)
+	})
+	return ctx.JSON(manifest)
 }
@@ -0,0 +1,613 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fabrizioperria/goflight/cancellation"
+	"github.com/fabrizioperria/goflight/db"
+	"github.com/fabrizioperria/goflight/db/memory"
+	"github.com/fabrizioperria/goflight/handlers/middleware"
+	"github.com/fabrizioperria/goflight/loyalty"
+	"github.com/fabrizioperria/goflight/payments"
+	"github.com/fabrizioperria/goflight/pricing"
+	"github.com/fabrizioperria/goflight/types"
+	"github.com/fabrizioperria/goflight/waitlist"
+	"github.com/gofiber/fiber/v2"
+	"github.com/govalues/decimal"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type testReservationDb struct {
+	Store  *db.Store
+	Owner  *types.User
+	Other  *types.User
+	Admin  *types.User
+	Flight *types.Flight
+	Seats  []*types.Seat
+}
+
+// setupReservationDb stores two users, an admin and a flight from JFK to LAX
+// in two months with an economy seat at each of prices, in USD.
+func setupReservationDb(prices ...string) (*testReservationDb, error) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	users := []*types.User{
+		{FirstName: "Frank", LastName: "Potato", Email: "fp@test.com"},
+		{FirstName: "Jane", LastName: "Tomato", Email: "jt@test.com"},
+		{FirstName: "Ada", LastName: "Admin", Email: "admin@test.com", IsAdmin: true},
+	}
+	for _, user := range users {
+		if _, err := store.User.CreateUser(ctx, user); err != nil {
+			return nil, err
+		}
+	}
+	seats := make([]*types.Seat, 0, len(prices))
+	for i, price := range prices {
+		seats = append(seats, &types.Seat{Number: i + 1, Class: types.Economy, Price: types.MustParseMoney(price, "USD"), Available: true})
+	}
+	departure := time.Now().AddDate(0, 2, 0).UTC()
+	flight, err := store.Flight.CreateFlightWithSeats(ctx, &types.Flight{
+		Airline:       "Delta",
+		Departure:     "JFK",
+		Arrival:       "LAX",
+		DepartureTime: departure,
+		ArrivalTime:   departure.Add(6 * time.Hour),
+	}, seats)
+	if err != nil {
+		return nil, err
+	}
+	return &testReservationDb{
+		Store:  store,
+		Owner:  users[0],
+		Other:  users[1],
+		Admin:  users[2],
+		Flight: flight,
+		Seats:  seats,
+	}, nil
+}
+
+func teardownReservationDb(t *testing.T, testDb *testReservationDb) {
+	stores := []db.Dropper{
+		testDb.Store.User,
+		testDb.Store.Flight,
+		testDb.Store.Seat,
+		testDb.Store.Reservation,
+		testDb.Store.Credit,
+		testDb.Store.Promotion,
+		testDb.Store.Loyalty,
+		testDb.Store.Waitlist,
+	}
+	for _, store := range stores {
+		if err := store.Drop(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// authenticateAs stands in for the JWT middleware and lets every request in
+// as user.
+func authenticateAs(user *types.User) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Context().SetUserValue("user", user)
+		return c.Next()
+	}
+}
+
+// send sends body, unless it is nil, as JSON to target and decodes the
+// response into out, unless it is nil or the request failed.
+func send(t *testing.T, app *fiber.App, method, target string, body, out any) int {
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+		assert.NoError(t, err)
+	}
+	req := httptest.NewRequest(method, target, bytes.NewReader(payload))
+	req.Header.Add("Content-Type", "application/json")
+	response, err := app.Test(req)
+	if !assert.NoError(t, err) {
+		return 0
+	}
+	if out != nil && response.StatusCode < fiber.StatusBadRequest {
+		assert.NoError(t, json.NewDecoder(response.Body).Decode(out))
+	}
+	return response.StatusCode
+}
+
+// reserve reserves seat through app with body, which may be nil.
+func reserve(t *testing.T, app *fiber.App, seat *types.Seat, body any) (int, *types.Reservation) {
+	reservation := &types.Reservation{}
+	status := send(t, app, "POST", "/flights/"+seat.FlightId.Hex()+"/seats/"+seat.Id.Hex()+"/reservations", body, reservation)
+	return status, reservation
+}
+
+func TestReservationPassengersAndManifestv1(t *testing.T) {
+	testDb, err := setupReservationDb("100", "100", "100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer teardownReservationDb(t, testDb)
+	processor := payments.NewProcessor(payments.NewFakeGateway(), testDb.Store.Reservation, testDb.Store.Credit)
+	program := loyalty.NewProgram(*testDb.Store, loyalty.DefaultRules())
+	queue := waitlist.NewQueue(*testDb.Store, program, waitlist.LogNotifier{}, waitlist.DefaultOfferTTL)
+	settler := cancellation.NewSettler(*testDb.Store, processor, program, queue)
+	reservationHandler := NewReservationHandler(*testDb.Store, pricing.NewEngine(pricing.DefaultConfig()), pricing.DefaultExchangeRates(), processor, program, queue, settler)
+	as := func(user *types.User) *fiber.App {
+		app := fiber.New()
+		app.Use(authenticateAs(user))
+		app.Post("/flights/:fid/seats/:sid/reservations", reservationHandler.HandlePostCreateReservationv1)
+		app.Get("/admin/flights/:fid/manifest", middleware.AdminOnly(), reservationHandler.HandleGetFlightManifestv1)
+		return app
+	}
+	app := as(testDb.Owner)
+	seats := testDb.Seats
+
+	child := types.Passenger{FirstName: "Jane", LastName: "Potato", DateOfBirth: testDb.Flight.DepartureTime.AddDate(-5, 0, 0).Format(time.DateOnly), Type: types.Child}
+	status, _ := reserve(t, app, seats[0], nil)
+	assert.Equal(t, fiber.StatusCreated, status)
+	status, _ = reserve(t, app, seats[1], types.ReservationBody{Passenger: &child})
+	assert.Equal(t, fiber.StatusCreated, status)
+
+	// a five year old is not an adult
+	adult := child
+	adult.Type = types.Adult
+	status, _ = reserve(t, app, seats[2], types.ReservationBody{Passenger: &adult})
+	assert.Equal(t, fiber.StatusBadRequest, status)
+
+	manifest := []types.ManifestEntry{}
+	assert.Equal(t, fiber.StatusOK, send(t, as(testDb.Admin), "GET", "/admin/flights/"+testDb.Flight.Id.Hex()+"/manifest", nil, &manifest))
+	if !assert.Len(t, manifest, 2) {
+		return
+	}
+	assert.Equal(t, seats[0].Id, manifest[0].SeatId)
+	assert.Equal(t, "Frank", manifest[0].Passenger.FirstName)
+	assert.Equal(t, types.Adult, manifest[0].Passenger.Type)
+	assert.Equal(t, seats[1].Id, manifest[1].SeatId)
+	assert.Equal(t, child, *manifest[1].Passenger)
+	assert.Equal(t, testDb.Owner.Id, manifest[1].UserId)
+}
+
+func TestReservationLookupv1(t *testing.T) {
+	testDb, err := setupReservationDb("100", "100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer teardownReservationDb(t, testDb)
+	ctx := context.Background()
+	reservation, err := testDb.Store.Reservation.CreateReservation(ctx, db.SeatFilter{Id: testDb.Seats[0].Id}, testDb.Owner.Id, nil, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	booking, err := testDb.Store.Reservation.CreateBooking(ctx, []db.PassengerSeat{
+		{Seat: db.SeatFilter{Id: testDb.Seats[1].Id}, Passenger: &types.Passenger{FirstName: "Jane", LastName: "Tomato", Type: types.Adult}},
+	}, testDb.Owner.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := setupRoutes(*testDb.Store)
+	lookups := []struct {
+		locator  string
+		lastName string
+		status   int
+		expected string
+	}{
+		{reservation.Locator, "Potato", fiber.StatusOK, reservation.Id.Hex()},
+		{strings.ToLower(reservation.Locator), "POTATO", fiber.StatusOK, reservation.Id.Hex()},
+		{booking.Locator, "tomato", fiber.StatusOK, booking.Id.Hex()},
+		{reservation.Locator, "Tomato", fiber.StatusNotFound, ""},
+		{booking.Locator, "Potato", fiber.StatusNotFound, ""},
+		{"ABC", "Potato", fiber.StatusBadRequest, ""},
+		{reservation.Locator, "", fiber.StatusBadRequest, ""},
+	}
+	for _, lookup := range lookups {
+		query := url.Values{"locator": {lookup.locator}, "last_name": {lookup.lastName}}
+		body := struct {
+			Id string `json:"id"`
+		}{}
+		status := send(t, app, "GET", "/api/v1/reservations/lookup?"+query.Encode(), nil, &body)
+		assert.Equal(t, lookup.status, status, query.Encode())
+		if lookup.status == fiber.StatusOK {
+			assert.Equal(t, lookup.expected, body.Id)
+		}
+	}
+}
+
+func TestDeleteReservationv1(t *testing.T) {
+	testDb, err := setupReservationDb("100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer teardownReservationDb(t, testDb)
+	ctx := context.Background()
+	reservation, err := testDb.Store.Reservation.CreateReservation(ctx, db.SeatFilter{Id: testDb.Seats[0].Id}, testDb.Owner.Id, nil, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	processor := payments.NewProcessor(payments.NewFakeGateway(), testDb.Store.Reservation, testDb.Store.Credit)
+	program := loyalty.NewProgram(*testDb.Store, loyalty.DefaultRules())
+	queue := waitlist.NewQueue(*testDb.Store, program, waitlist.LogNotifier{}, waitlist.DefaultOfferTTL)
+	settler := cancellation.NewSettler(*testDb.Store, processor, program, queue)
+	reservationHandler := NewReservationHandler(*testDb.Store, pricing.NewEngine(pricing.DefaultConfig()), pricing.DefaultExchangeRates(), processor, program, queue, settler)
+	deleteAs := func(user *types.User) int {
+		app := fiber.New()
+		app.Use(authenticateAs(user))
+		app.Delete("/reservations/:rid", reservationHandler.HandleDeleteReservationv1)
+		return send(t, app, "DELETE", "/reservations/"+reservation.Id.Hex(), nil, nil)
+	}
+
+	assert.Equal(t, fiber.StatusUnauthorized, deleteAs(testDb.Other))
+	fetched, err := testDb.Store.Reservation.GetReservation(ctx, db.ReservationFilter{Id: reservation.Id})
+	assert.NoError(t, err)
+	assert.Equal(t, types.ReservationPending, fetched.Status)
+
+	assert.Equal(t, fiber.StatusOK, deleteAs(testDb.Owner))
+	assert.Equal(t, fiber.StatusConflict, deleteAs(testDb.Owner))
+}
+
+func TestReserveExpiredHoldv1(t *testing.T) {
+	testDb, err := setupReservationDb("100", "100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer teardownReservationDb(t, testDb)
+	ctx := context.Background()
+	held, expired := testDb.Seats[0], testDb.Seats[1]
+	_, err = testDb.Store.Reservation.HoldSeat(ctx, db.SeatFilter{Id: held.Id}, testDb.Other.Id, time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	_, err = testDb.Store.Reservation.HoldSeat(ctx, db.SeatFilter{Id: expired.Id}, testDb.Other.Id, time.Now().Add(-time.Minute))
+	assert.NoError(t, err)
+	processor := payments.NewProcessor(payments.NewFakeGateway(), testDb.Store.Reservation, testDb.Store.Credit)
+	program := loyalty.NewProgram(*testDb.Store, loyalty.DefaultRules())
+	queue := waitlist.NewQueue(*testDb.Store, program, waitlist.LogNotifier{}, waitlist.DefaultOfferTTL)
+	settler := cancellation.NewSettler(*testDb.Store, processor, program, queue)
+	reservationHandler := NewReservationHandler(*testDb.Store, pricing.NewEngine(pricing.DefaultConfig()), pricing.DefaultExchangeRates(), processor, program, queue, settler)
+	app := fiber.New()
+	app.Use(authenticateAs(testDb.Owner))
+	app.Post("/flights/:fid/seats/:sid/reservations", reservationHandler.HandlePostCreateReservationv1)
+
+	// the flight lists no seat, but the one whose hold expired can be reserved
+	// before the sweeper releases it
+	status, _ := reserve(t, app, expired, nil)
+	assert.Equal(t, fiber.StatusCreated, status)
+	status, _ = reserve(t, app, held, nil)
+	assert.Equal(t, fiber.StatusNotFound, status)
+}
+
+func TestPutReservationStatusv1(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	seat := &types.Seat{Available: true}
+	departure := time.Now().AddDate(0, 1, 0).UTC()
+	_, err := store.Flight.CreateFlightWithSeats(ctx, &types.Flight{Departure: "JFK", Arrival: "LAX", DepartureTime: departure, ArrivalTime: departure.Add(6 * time.Hour)}, []*types.Seat{seat})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reservation, err := store.Reservation.CreateReservation(ctx, db.SeatFilter{Id: seat.Id}, primitive.NewObjectID(), nil, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter := db.ReservationFilter{Id: reservation.Id}
+	if _, err := store.Reservation.UpdateReservationStatus(ctx, filter, types.ReservationConfirmed); err != nil {
+		t.Fatal(err)
+	}
+
+	reservationHandler := NewReservationHandler(*store, pricing.NewEngine(pricing.DefaultConfig()), pricing.DefaultExchangeRates(), nil, loyalty.NewProgram(*store, loyalty.DefaultRules()), nil, nil)
+	app := fiber.New()
+	app.Put("/reservations/:rid/status", reservationHandler.HandlePutReservationStatusv1)
+	setStatus := func(status types.ReservationStatus) int {
+		return send(t, app, "PUT", "/reservations/"+reservation.Id.Hex()+"/status", types.UpdateReservationStatusParams{Status: status}, nil)
+	}
+
+	// the other statuses follow from holds, payments, cancellations and
+	// denied boardings
+	for _, status := range []types.ReservationStatus{types.ReservationHeld, types.ReservationPending, types.ReservationConfirmed, types.ReservationCancelled, types.ReservationDeniedBoarding, types.ReservationRefunded, "lost"} {
+		assert.Equal(t, fiber.StatusBadRequest, setStatus(status), status)
+	}
+	assert.Equal(t, fiber.StatusOK, setStatus(types.ReservationTicketed))
+	assert.Equal(t, fiber.StatusConflict, setStatus(types.ReservationTicketed))
+	assert.Equal(t, fiber.StatusOK, setStatus(types.ReservationCheckedIn))
+	fetched, err := store.Reservation.GetReservation(ctx, filter)
+	assert.NoError(t, err)
+	assert.Equal(t, types.ReservationCheckedIn, fetched.Status)
+}
+
+func TestCancelReservationRefundv1(t *testing.T) {
+	testDb, err := setupReservationDb("100", "100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer teardownReservationDb(t, testDb)
+	processor := payments.NewProcessor(payments.NewFakeGateway(), testDb.Store.Reservation, testDb.Store.Credit)
+	program := loyalty.NewProgram(*testDb.Store, loyalty.DefaultRules())
+	queue := waitlist.NewQueue(*testDb.Store, program, waitlist.LogNotifier{}, waitlist.DefaultOfferTTL)
+	settler := cancellation.NewSettler(*testDb.Store, processor, program, queue)
+	reservationHandler := NewReservationHandler(*testDb.Store, pricing.NewEngine(pricing.DefaultConfig()), pricing.DefaultExchangeRates(), processor, program, queue, settler)
+	as := func(user *types.User) *fiber.App {
+		app := fiber.New()
+		app.Use(authenticateAs(user))
+		app.Post("/flights/:fid/seats/:sid/reservations", reservationHandler.HandlePostCreateReservationv1)
+		app.Delete("/reservations/:rid", reservationHandler.HandleDeleteReservationv1)
+		return app
+	}
+	owner, admin := testDb.Owner, testDb.Admin
+	paid := func(seat *types.Seat) *types.Reservation {
+		status, reservation := reserve(t, as(owner), seat, nil)
+		assert.Equal(t, fiber.StatusCreated, status)
+		return reservation
+	}
+	cancelAs := func(user *types.User, reservation *types.Reservation, body any) (int, *types.Reservation) {
+		cancelled := &types.Reservation{}
+		status := send(t, as(user), "DELETE", "/reservations/"+reservation.Id.Hex(), body, cancelled)
+		return status, cancelled
+	}
+	refund := func(amount string) types.CancelReservationParams {
+		money := types.MustParseMoney(amount, "USD")
+		return types.CancelReservationParams{RefundAmount: &money}
+	}
+
+	// cancelled right after being made, it is refunded in full
+	status, cancelled := cancelAs(owner, paid(testDb.Seats[0]), nil)
+	assert.Equal(t, fiber.StatusOK, status)
+	assert.Equal(t, types.ReservationRefunded, cancelled.Status)
+	if assert.NotNil(t, cancelled.Refund) {
+		assert.Equal(t, types.RefundFreeWindow, cancelled.Refund.Policy)
+		assert.True(t, types.MustParseMoney("100", "USD").Equal(cancelled.Refund.Amount))
+	}
+
+	// only admins may refund another amount
+	reservation := paid(testDb.Seats[1])
+	status, _ = cancelAs(owner, reservation, refund("10"))
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+	status, _ = cancelAs(admin, reservation, refund("110"))
+	assert.Equal(t, fiber.StatusBadRequest, status)
+	status, cancelled = cancelAs(admin, reservation, refund("10"))
+	assert.Equal(t, fiber.StatusOK, status)
+	if assert.NotNil(t, cancelled.Refund) {
+		assert.Equal(t, types.RefundOverride, cancelled.Refund.Policy)
+		assert.Equal(t, admin.Id, cancelled.Refund.OverriddenBy)
+		assert.True(t, types.MustParseMoney("10", "USD").Equal(cancelled.Refund.Amount))
+		assert.True(t, types.MustParseMoney("90", "USD").Equal(cancelled.Refund.Fee))
+	}
+}
+
+func TestOverbookingv1(t *testing.T) {
+	testDb, err := setupReservationDb("100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer teardownReservationDb(t, testDb)
+	processor := payments.NewProcessor(payments.NewFakeGateway(), testDb.Store.Reservation, testDb.Store.Credit)
+	program := loyalty.NewProgram(*testDb.Store, loyalty.DefaultRules())
+	queue := waitlist.NewQueue(*testDb.Store, program, waitlist.LogNotifier{}, waitlist.DefaultOfferTTL)
+	settler := cancellation.NewSettler(*testDb.Store, processor, program, queue)
+	engine := pricing.NewEngine(pricing.DefaultConfig())
+	reservationHandler := NewReservationHandler(*testDb.Store, engine, pricing.DefaultExchangeRates(), processor, program, queue, settler)
+	flightHandler := NewFlightHandler(*testDb.Store, engine, pricing.DefaultExchangeRates())
+	as := func(user *types.User) *fiber.App {
+		app := fiber.New()
+		app.Use(authenticateAs(user))
+		admin := app.Group("/admin", middleware.AdminOnly())
+		admin.Put("/flights/:fid/overbooking", flightHandler.HandlePutOverbookingv1)
+		admin.Put("/reservations/:rid/status", reservationHandler.HandlePutReservationStatusv1)
+		admin.Post("/reservations/:rid/denied-boarding", reservationHandler.HandlePostDenyBoardingv1)
+		app.Post("/flights/:fid/reservations", reservationHandler.HandlePostCreateUnassignedReservationv1)
+		app.Post("/flights/:fid/seats/:sid/reservations", reservationHandler.HandlePostCreateReservationv1)
+		return app
+	}
+	passenger, admin := as(testDb.Other), as(testDb.Admin)
+	overbooking := "/admin/flights/" + testDb.Flight.Id.Hex() + "/overbooking"
+	oversell := func() (int, *types.Reservation) {
+		reservation := &types.Reservation{}
+		status := send(t, passenger, "POST", "/flights/"+testDb.Flight.Id.Hex()+"/reservations", types.UnassignedReservationBody{Class: types.Economy}, reservation)
+		return status, reservation
+	}
+
+	assert.Equal(t, fiber.StatusBadRequest, send(t, admin, "PUT", overbooking, types.OverbookingParams{Overbooking: -1}, nil))
+	updated := &types.Flight{}
+	assert.Equal(t, fiber.StatusOK, send(t, admin, "PUT", overbooking, types.OverbookingParams{Overbooking: 1}, updated))
+	assert.Equal(t, 1, updated.Overbooking)
+
+	// the flight is only oversold once its seats are gone
+	status, _ := oversell()
+	assert.Equal(t, fiber.StatusConflict, status)
+	status, _ = reserve(t, as(testDb.Owner), testDb.Seats[0], nil)
+	assert.Equal(t, fiber.StatusCreated, status)
+	status = send(t, passenger, "POST", "/flights/"+testDb.Flight.Id.Hex()+"/reservations", types.UnassignedReservationBody{Class: 9}, nil)
+	assert.Equal(t, fiber.StatusBadRequest, status)
+	status, oversold := oversell()
+	assert.Equal(t, fiber.StatusCreated, status)
+	assert.False(t, oversold.IsAssigned())
+	assert.Equal(t, types.Economy, oversold.Class)
+	assert.Equal(t, types.ReservationConfirmed, oversold.Status)
+	status, _ = oversell()
+	assert.Equal(t, fiber.StatusConflict, status)
+
+	// without a seat left, the passenger cannot check in and is denied boarding
+	target := "/admin/reservations/" + oversold.Id.Hex()
+	assert.Equal(t, fiber.StatusOK, send(t, admin, "PUT", target+"/status", types.UpdateReservationStatusParams{Status: types.ReservationTicketed}, nil))
+	assert.Equal(t, fiber.StatusConflict, send(t, admin, "PUT", target+"/status", types.UpdateReservationStatusParams{Status: types.ReservationCheckedIn}, nil))
+	denied := &types.Reservation{}
+	assert.Equal(t, fiber.StatusOK, send(t, admin, "POST", target+"/denied-boarding", nil, denied))
+	assert.Equal(t, types.ReservationRefunded, denied.Status)
+	if assert.NotNil(t, denied.Refund) {
+		assert.Equal(t, types.RefundDeniedBoarding, denied.Refund.Policy)
+		assert.True(t, types.MustParseMoney("100", "USD").Equal(denied.Refund.Amount), denied.Refund.Amount)
+
+		// and compensated with a credit, by the distance of the flight
+		credit, err := testDb.Store.Credit.GetCredit(context.Background(), db.CreditFilter{Id: denied.Refund.CreditId})
+		if assert.NoError(t, err) {
+			assert.Equal(t, testDb.Other.Id, credit.UserId)
+			assert.Equal(t, denied.Id, credit.IssuedFor)
+			assert.True(t, types.MustParseMoney("400", "USD").Equal(credit.Balance), credit.Balance)
+		}
+	}
+	assert.Equal(t, fiber.StatusConflict, send(t, admin, "POST", target+"/denied-boarding", nil, nil))
+
+	// which gives its place back to the allowance
+	status, _ = oversell()
+	assert.Equal(t, fiber.StatusCreated, status)
+}
+
+func TestChangeSeatv1(t *testing.T) {
+	testDb, err := setupReservationDb("100", "150", "120")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer teardownReservationDb(t, testDb)
+	ctx := context.Background()
+	waiting, err := testDb.Store.User.CreateUser(ctx, &types.User{FirstName: "Ada", LastName: "Lemon", Email: "al@test.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	processor := payments.NewProcessor(payments.NewFakeGateway(), testDb.Store.Reservation, testDb.Store.Credit)
+	program := loyalty.NewProgram(*testDb.Store, loyalty.DefaultRules())
+	queue := waitlist.NewQueue(*testDb.Store, program, waitlist.LogNotifier{}, waitlist.DefaultOfferTTL)
+	settler := cancellation.NewSettler(*testDb.Store, processor, program, queue)
+	reservationHandler := NewReservationHandler(*testDb.Store, pricing.NewEngine(pricing.DefaultConfig()), pricing.DefaultExchangeRates(), processor, program, queue, settler)
+	as := func(user *types.User) *fiber.App {
+		app := fiber.New()
+		app.Use(authenticateAs(user))
+		app.Post("/flights/:fid/seats/:sid/reservations", reservationHandler.HandlePostCreateReservationv1)
+		app.Put("/reservations/:rid/seat", reservationHandler.HandlePutReservationSeatv1)
+		app.Delete("/reservations/:rid", reservationHandler.HandleDeleteReservationv1)
+		return app
+	}
+	owner, passenger, seats := testDb.Owner, testDb.Other, testDb.Seats
+	reserveAs := func(user *types.User, seat *types.Seat) *types.Reservation {
+		status, reservation := reserve(t, as(user), seat, nil)
+		assert.Equal(t, fiber.StatusCreated, status)
+		return reservation
+	}
+	changeSeatWith := func(user *types.User, reservation *types.Reservation, seat *types.Seat, method string) (int, *types.Reservation) {
+		changed := &types.Reservation{}
+		status := send(t, as(user), "PUT", "/reservations/"+reservation.Id.Hex()+"/seat", types.ChangeSeatParams{SeatId: seat.Id, PaymentMethod: method}, changed)
+		return status, changed
+	}
+	changeSeat := func(user *types.User, reservation *types.Reservation, seat *types.Seat) (int, *types.Reservation) {
+		return changeSeatWith(user, reservation, seat, "")
+	}
+
+	reservation := reserveAs(owner, seats[0])
+	assert.Equal(t, fiber.StatusBadRequest, send(t, as(owner), "PUT", "/reservations/"+reservation.Id.Hex()+"/seat", types.ChangeSeatParams{}, nil))
+	status, _ := changeSeat(passenger, reservation, seats[1])
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+
+	// a dearer seat is only taken once the difference is charged
+	status, _ = changeSeatWith(owner, reservation, seats[1], payments.FakeDeclinedMethod)
+	assert.Equal(t, fiber.StatusPaymentRequired, status)
+	status, _ = changeSeatWith(owner, reservation, seats[1], payments.FakeAsyncMethod)
+	assert.Equal(t, fiber.StatusPaymentRequired, status)
+	fetched, err := testDb.Store.Reservation.GetReservation(ctx, db.ReservationFilter{Id: reservation.Id})
+	if assert.NoError(t, err) {
+		assert.Equal(t, seats[0].Id, fetched.SeatId)
+		assert.Empty(t, fetched.SeatChanges)
+	}
+	status, changed := changeSeat(owner, reservation, seats[1])
+	assert.Equal(t, fiber.StatusOK, status)
+	assert.Equal(t, seats[1].Id, changed.SeatId)
+	if assert.Len(t, changed.SeatChanges, 1) && assert.NotNil(t, changed.SeatChanges[0].Payment) {
+		assert.True(t, types.MustParseMoney("50", "USD").Equal(changed.SeatChanges[0].Difference), changed.SeatChanges[0].Difference)
+		assert.Equal(t, types.PaymentCaptured, changed.SeatChanges[0].Payment.Status)
+		assert.True(t, types.MustParseMoney("50", "USD").Equal(changed.SeatChanges[0].Payment.Amount))
+	}
+
+	// a cheaper seat is refunded the difference on the payment
+	status, changed = changeSeat(owner, reservation, seats[2])
+	assert.Equal(t, fiber.StatusOK, status)
+	if assert.Len(t, changed.SeatChanges, 2) && assert.NotNil(t, changed.Payment) {
+		assert.Nil(t, changed.SeatChanges[1].Payment)
+		assert.True(t, types.MustParseMoney("70", "USD").Equal(changed.Payment.Amount), changed.Payment.Amount)
+	}
+	status, changed = changeSeat(owner, reservation, seats[1])
+	assert.Equal(t, fiber.StatusOK, status)
+	assert.Equal(t, seats[1].Id, changed.SeatId)
+
+	// the seat given back goes to the first user waiting for one, who can
+	// move their reservation onto it
+	other := reserveAs(passenger, seats[0])
+	status, _ = changeSeat(passenger, other, seats[1])
+	assert.Equal(t, fiber.StatusNotFound, status)
+	reserveAs(owner, seats[2])
+	for _, user := range []*types.User{passenger, waiting} {
+		_, err = testDb.Store.Waitlist.JoinWaitlist(ctx, &types.WaitlistEntry{
+			FlightId: testDb.Flight.Id,
+			Class:    types.Economy,
+			UserId:   user.Id,
+			Status:   types.WaitlistWaiting,
+			JoinedAt: time.Now(),
+		})
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, fiber.StatusOK, send(t, as(owner), "DELETE", "/reservations/"+reservation.Id.Hex(), nil, nil))
+	status, changed = changeSeat(passenger, other, seats[1])
+	assert.Equal(t, fiber.StatusOK, status)
+	assert.Equal(t, seats[1].Id, changed.SeatId)
+	booked, err := testDb.Store.Waitlist.GetWaitlistEntry(ctx, db.WaitlistFilter{UserId: passenger.Id})
+	if assert.NoError(t, err) {
+		assert.Equal(t, types.WaitlistBooked, booked.Status)
+	}
+	offered, err := testDb.Store.Waitlist.GetWaitlistEntry(ctx, db.WaitlistFilter{UserId: waiting.Id})
+	if assert.NoError(t, err) && assert.NotNil(t, offered.Offer) {
+		assert.Equal(t, types.WaitlistOffered, offered.Status)
+		assert.Equal(t, seats[0].Id, offered.Offer.SeatId)
+	}
+
+	// the cancelled reservations keep their seat
+	status, _ = changeSeat(owner, reservation, seats[0])
+	assert.Equal(t, fiber.StatusConflict, status)
+}
+
+func TestGetReservationCurrencyv1(t *testing.T) {
+	testDb, err := setupReservationDb("100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer teardownReservationDb(t, testDb)
+	processor := payments.NewProcessor(payments.NewFakeGateway(), testDb.Store.Reservation, testDb.Store.Credit)
+	program := loyalty.NewProgram(*testDb.Store, loyalty.DefaultRules())
+	queue := waitlist.NewQueue(*testDb.Store, program, waitlist.LogNotifier{}, waitlist.DefaultOfferTTL)
+	settler := cancellation.NewSettler(*testDb.Store, processor, program, queue)
+	rates := pricing.ExchangeRates{Base: "USD", Rates: map[string]decimal.Decimal{"EUR": decimal.MustParse("0.9")}}
+	reservationHandler := NewReservationHandler(*testDb.Store, pricing.NewEngine(pricing.DefaultConfig()), rates, processor, program, queue, settler)
+	as := func(user *types.User) *fiber.App {
+		app := fiber.New()
+		app.Use(authenticateAs(user))
+		app.Post("/flights/:fid/seats/:sid/reservations", reservationHandler.HandlePostCreateReservationv1)
+		app.Get("/reservations/:rid", reservationHandler.HandleGetReservationv1)
+		app.Delete("/reservations/:rid", reservationHandler.HandleDeleteReservationv1)
+		return app
+	}
+	status, reservation := reserve(t, as(testDb.Owner), testDb.Seats[0], nil)
+	assert.Equal(t, fiber.StatusCreated, status)
+	amount := types.MustParseMoney("10", "USD")
+	status = send(t, as(testDb.Admin), "DELETE", "/reservations/"+reservation.Id.Hex(), types.CancelReservationParams{RefundAmount: &amount}, nil)
+	assert.Equal(t, fiber.StatusOK, status)
+
+	// every amount is converted, not only the price
+	converted := &types.Reservation{}
+	status = send(t, as(testDb.Owner), "GET", "/reservations/"+reservation.Id.Hex()+"?currency=EUR", nil, converted)
+	assert.Equal(t, fiber.StatusOK, status)
+	assert.True(t, types.MustParseMoney("90", "EUR").Equal(converted.Price))
+	if assert.NotNil(t, converted.Payment) {
+		assert.True(t, types.MustParseMoney("90", "EUR").Equal(converted.Payment.Amount))
+	}
+	if assert.NotNil(t, converted.Refund) {
+		assert.True(t, types.MustParseMoney("9", "EUR").Equal(converted.Refund.Amount))
+		assert.True(t, types.MustParseMoney("81", "EUR").Equal(converted.Refund.Fee))
+	}
+
+	// the stored reservation is left in USD
+	stored, err := testDb.Store.Reservation.GetReservation(context.Background(), db.ReservationFilter{Id: reservation.Id})
+	assert.NoError(t, err)
+	assert.True(t, types.MustParseMoney("100", "USD").Equal(stored.Payment.Amount))
+	assert.True(t, types.MustParseMoney("10", "USD").Equal(stored.Refund.Amount))
+}
@@ -25,7 +25,7 @@ func (h *UserHandler) HandleGetUserv1(ctx *fiber.Ctx) error {
 	if err != nil {
 		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
-	filter := db.Map{"_id": oid}
+	filter := db.UserFilter{Id: oid}
 
 	user, err := h.store.User.GetUser(ctx.Context(), filter)
 	if err != nil {
@@ -101,7 +101,7 @@ func (h *UserHandler) HandleDeleteUserv1(ctx *fiber.Ctx) error {
 	if err != nil {
 		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
-	filter := db.Map{"_id": oid}
+	filter := db.UserFilter{Id: oid}
 
 	id, err := h.store.User.DeleteUser(ctx.Context(), filter)
 	if err != nil {
@@ -124,7 +124,7 @@ func (h *UserHandler) HandlePutUserv1(ctx *fiber.Ctx) error {
 	if err != nil {
 		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
-	filter := db.Map{"_id": oid}
+	filter := db.UserFilter{Id: oid}
 
 	values := types.UpdateUserParams{}
 	err = ctx.BodyParser(&values)
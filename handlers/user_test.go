@@ -11,43 +11,43 @@ import (
 	"testing"
 
 	"github.com/brianvoe/gofakeit/v7"
+	"github.com/fabrizioperria/goflight/cancellation"
 	"github.com/fabrizioperria/goflight/db"
 	"github.com/fabrizioperria/goflight/db/fixtures"
+	"github.com/fabrizioperria/goflight/db/memory"
+	"github.com/fabrizioperria/goflight/loyalty"
+	"github.com/fabrizioperria/goflight/payments"
+	"github.com/fabrizioperria/goflight/pricing"
+	"github.com/fabrizioperria/goflight/search"
 	"github.com/fabrizioperria/goflight/types"
+	"github.com/fabrizioperria/goflight/waitlist"
 	"github.com/gofiber/fiber/v2"
 	"github.com/stretchr/testify/assert"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
-)
-
-const (
-	uri    = "mongodb://localhost:27017"
-	dbName = "goflight_test"
 )
 
 type testUserDb struct {
-	Store  db.Store
-	Client *mongo.Client
+	Store db.Store
 }
 
 func setupUsersDb() (*testUserDb, error) {
-	client, err := mongo.Connect(context.TODO(), options.Client().ApplyURI(uri))
-	if err != nil {
-		return nil, err
-	}
-	userStore := db.NewMongoDbUserStore(client)
-	userStore.Drop(context.Background())
-	mainStore := db.Store{User: userStore}
-	return &testUserDb{Store: mainStore, Client: client}, nil
+	mainStore := db.Store{User: memory.NewUserStore()}
+	return &testUserDb{Store: mainStore}, nil
 }
 
 func teardownUsersDb(t *testing.T, db *testUserDb) {
 	if err := db.Store.User.Drop(context.Background()); err != nil {
 		t.Fatal(err)
 	}
-	if err := db.Client.Disconnect(context.TODO()); err != nil {
-		t.Fatal(err)
-	}
+}
+
+// setupRoutes serves the API on store, with the services main runs it with.
+func setupRoutes(store db.Store) *fiber.App {
+	processor := payments.NewProcessor(payments.NewFakeGateway(), store.Reservation, store.Credit)
+	program := loyalty.NewProgram(store, loyalty.DefaultRules())
+	queue := waitlist.NewQueue(store, program, waitlist.LogNotifier{}, waitlist.DefaultOfferTTL)
+	settler := cancellation.NewSettler(store, processor, program, queue)
+	engine := pricing.NewEngine(pricing.DefaultConfig())
+	return SetupRoutes(store, fiber.Config{}, engine, pricing.DefaultExchangeRates(), search.DefaultConfig(), processor, program, queue, settler)
 }
 
 func getInvalidUser() types.CreateUserParams {
@@ -84,7 +84,7 @@ func TestPostCreateValidUser(t *testing.T) {
 	assert.NoError(t, err)
 	defer teardownUsersDb(t, db)
 
-	app := SetupRoutes(db.Store, fiber.Config{})
+	app := setupRoutes(db.Store)
 
 	user := types.CreateUserParams{
 		FirstName:     "Frank",
@@ -116,7 +116,7 @@ func TestPostCreateInvalidUser(t *testing.T) {
 	assert.NoError(t, err)
 	defer teardownUsersDb(t, db)
 
-	app := SetupRoutes(db.Store, fiber.Config{})
+	app := setupRoutes(db.Store)
 
 	user := getInvalidUser()
 	response, err := createUser(app, user)
@@ -146,7 +146,7 @@ func TestGetUsersIfUnauthenticated(t *testing.T) {
 	assert.NoError(t, err)
 	defer teardownUsersDb(t, db)
 
-	app := SetupRoutes(db.Store, fiber.Config{})
+	app := setupRoutes(db.Store)
 
 	headers := map[string]string{
 		"Content-Type": "application/json",
@@ -161,7 +161,7 @@ func TestGetUsersNotEmpty(t *testing.T) {
 	assert.NoError(t, err)
 	defer teardownUsersDb(t, db)
 
-	app := SetupRoutes(db.Store, fiber.Config{})
+	app := setupRoutes(db.Store)
 
 	user, token := fixtures.AuthenticateUser(&db.Store)
 
@@ -193,7 +193,7 @@ func TestGetUserById(t *testing.T) {
 	assert.NoError(t, err)
 	defer teardownUsersDb(t, db)
 
-	app := SetupRoutes(db.Store, fiber.Config{})
+	app := setupRoutes(db.Store)
 
 	user, token := fixtures.AuthenticateUser(&db.Store)
 
@@ -223,7 +223,7 @@ func TestGetUserByIdNotFound(t *testing.T) {
 	assert.NoError(t, err)
 	defer teardownUsersDb(t, db)
 
-	app := SetupRoutes(db.Store, fiber.Config{})
+	app := setupRoutes(db.Store)
 	_, token := fixtures.AuthenticateUser(&db.Store)
 
 	req := httptest.NewRequest("GET", "/api/v1/users/16624e25e22069075acbb235", nil)
@@ -239,7 +239,7 @@ func TestDeleteUserById(t *testing.T) {
 	assert.NoError(t, err)
 	defer teardownUsersDb(t, db)
 
-	app := SetupRoutes(db.Store, fiber.Config{})
+	app := setupRoutes(db.Store)
 
 	user, token := fixtures.AuthenticateUser(&db.Store)
 
@@ -268,7 +268,7 @@ func TestDeleteUserByIdNotFound(t *testing.T) {
 	assert.NoError(t, err)
 	defer teardownUsersDb(t, db)
 
-	app := SetupRoutes(db.Store, fiber.Config{})
+	app := setupRoutes(db.Store)
 	_, token := fixtures.AuthenticateUser(&db.Store)
 
 	req := httptest.NewRequest("DELETE", "/api/v1/users/16624e25e22069075acbb235", nil)
@@ -284,7 +284,7 @@ func TestDeleteAllUsers(t *testing.T) {
 	assert.NoError(t, err)
 	defer teardownUsersDb(t, db)
 
-	app := SetupRoutes(db.Store, fiber.Config{})
+	app := setupRoutes(db.Store)
 
 	_, token := fixtures.AuthenticateUser(&db.Store)
 	fixtures.AddUser(&db.Store, gofakeit.Email(), "whocares", gofakeit.Phone(), gofakeit.FirstName(), gofakeit.LastName(), false)
@@ -325,7 +325,7 @@ func TestPutUser(t *testing.T) {
 	assert.NoError(t, err)
 	defer teardownUsersDb(t, db)
 
-	app := SetupRoutes(db.Store, fiber.Config{})
+	app := setupRoutes(db.Store)
 
 	user, token := fixtures.AuthenticateUser(&db.Store)
 	id := user.Id.Hex()
@@ -371,7 +371,7 @@ func TestPutUserNotFound(t *testing.T) {
 	assert.NoError(t, err)
 	defer teardownUsersDb(t, db)
 
-	app := SetupRoutes(db.Store, fiber.Config{})
+	app := setupRoutes(db.Store)
 	_, token := fixtures.AuthenticateUser(&db.Store)
 
 	updateUser := types.UpdateUserParams{
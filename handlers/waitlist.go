@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/fabrizioperria/goflight/db"
+	"github.com/fabrizioperria/goflight/types"
+	"github.com/fabrizioperria/goflight/waitlist"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type WaitlistHandler struct {
+	store    db.Store
+	waitlist *waitlist.Queue
+}
+
+func NewWaitlistHandler(store db.Store, queue *waitlist.Queue) *WaitlistHandler {
+	return &WaitlistHandler{
+		store:    store,
+		waitlist: queue,
+	}
+}
+
+// HandlePostJoinWaitlistv1 puts the user on the waitlist of a class of a
+// flight with no seat left in it.
+func (h *WaitlistHandler) HandlePostJoinWaitlistv1(ctx *fiber.Ctx) error {
+	fid, err := primitive.ObjectIDFromHex(ctx.Params("fid"))
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	params := types.JoinWaitlistParams{}
+	if err := ctx.BodyParser(&params); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	errors := params.Validate()
+	if len(errors) > 0 {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors})
+	}
+
+	flight, err := h.store.Flight.GetFlight(ctx.Context(), db.FlightFilter{Id: fid})
+	if err != nil {
+		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	now := time.Now()
+	if now.After(flight.DepartureTime) {
+		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Flight already departed"})
+	}
+
+	user := ctx.Context().UserValue("user").(*types.User)
+	entry, err := h.waitlist.Join(ctx.Context(), flight, params.Class, user.Id, now)
+	if err != nil {
+		return ctx.Status(waitlistStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return ctx.Status(fiber.StatusCreated).JSON(entry)
+}
+
+// waitlistStatus is the status code to reply with when err comes from
+// joining a waitlist.
+func waitlistStatus(err error) int {
+	switch {
+	case errors.Is(err, types.ErrSeatsAvailable), errors.Is(err, types.ErrAlreadyWaitlisted):
+		return fiber.StatusConflict
+	case errors.Is(err, types.ErrClassNotOffered):
+		return fiber.StatusNotFound
+	}
+	return fiber.StatusInternalServerError
+}
+
+// HandleGetWaitlistv1 lists the waitlist entries of the user on a flight,
+// and the whole waitlist of the flight to admins.
+func (h *WaitlistHandler) HandleGetWaitlistv1(ctx *fiber.Ctx) error {
+	fid, err := primitive.ObjectIDFromHex(ctx.Params("fid"))
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	pagination := db.Pagination{
+		Page:  ctx.Query("page"),
+		Limit: ctx.Query("limit"),
+	}
+	filter := db.WaitlistFilter{FlightId: fid}
+	user := ctx.Context().UserValue("user").(*types.User)
+	if !user.IsAdmin {
+		filter.UserId = user.Id
+	}
+
+	entries, err := h.waitlist.Entries(ctx.Context(), filter, &pagination)
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return ctx.JSON(entries)
+}
+
+// HandleDeleteWaitlistv1 takes the user off the waitlist of the class of a
+// flight given by the class query parameter. Seats already offered to them
+// stay held until they confirm them or the offer expires.
+func (h *WaitlistHandler) HandleDeleteWaitlistv1(ctx *fiber.Ctx) error {
+	fid, err := primitive.ObjectIDFromHex(ctx.Params("fid"))
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	params := types.JoinWaitlistParams{Class: types.SeatClass(ctx.QueryInt("class"))}
+	errors := params.Validate()
+	if len(errors) > 0 {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors})
+	}
+
+	user := ctx.Context().UserValue("user").(*types.User)
+	filter := db.WaitlistFilter{FlightId: fid, Class: params.Class, UserId: user.Id, Status: types.WaitlistWaiting}
+	if err := h.store.Waitlist.DeleteWaitlistEntry(ctx.Context(), filter); err != nil {
+		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	return ctx.SendString("Left the waitlist")
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fabrizioperria/goflight/cancellation"
+	"github.com/fabrizioperria/goflight/loyalty"
+	"github.com/fabrizioperria/goflight/payments"
+	"github.com/fabrizioperria/goflight/pricing"
+	"github.com/fabrizioperria/goflight/types"
+	"github.com/fabrizioperria/goflight/waitlist"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+type testWaitlistDb struct {
+	*testReservationDb
+
+	reservationHandler *ReservationHandler
+	waitlistHandler    *WaitlistHandler
+}
+
+func setupWaitlistDb() (*testWaitlistDb, error) {
+	testDb, err := setupReservationDb("10")
+	if err != nil {
+		return nil, err
+	}
+	processor := payments.NewProcessor(payments.NewFakeGateway(), testDb.Store.Reservation, testDb.Store.Credit)
+	program := loyalty.NewProgram(*testDb.Store, loyalty.DefaultRules())
+	queue := waitlist.NewQueue(*testDb.Store, program, waitlist.LogNotifier{}, waitlist.DefaultOfferTTL)
+	settler := cancellation.NewSettler(*testDb.Store, processor, program, queue)
+	return &testWaitlistDb{
+		testReservationDb:  testDb,
+		reservationHandler: NewReservationHandler(*testDb.Store, pricing.NewEngine(pricing.DefaultConfig()), pricing.DefaultExchangeRates(), processor, program, queue, settler),
+		waitlistHandler:    NewWaitlistHandler(*testDb.Store, queue),
+	}, nil
+}
+
+// as serves the waitlists, and the reservations whose seats they are offered,
+// to user.
+func (testDb *testWaitlistDb) as(user *types.User) *fiber.App {
+	app := fiber.New()
+	app.Use(authenticateAs(user))
+	app.Post("/flights/:fid/seats/:sid/reservations", testDb.reservationHandler.HandlePostCreateReservationv1)
+	app.Post("/flights/:fid/seats/:sid/holds/confirm", testDb.reservationHandler.HandlePostConfirmHoldv1)
+	app.Delete("/reservations/:rid", testDb.reservationHandler.HandleDeleteReservationv1)
+	app.Post("/flights/:fid/waitlist", testDb.waitlistHandler.HandlePostJoinWaitlistv1)
+	app.Get("/flights/:fid/waitlist", testDb.waitlistHandler.HandleGetWaitlistv1)
+	app.Delete("/flights/:fid/waitlist", testDb.waitlistHandler.HandleDeleteWaitlistv1)
+	return app
+}
+
+func TestWaitlistv1(t *testing.T) {
+	testDb, err := setupWaitlistDb()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer teardownReservationDb(t, testDb.testReservationDb)
+	other, err := testDb.Store.User.CreateUser(context.Background(), &types.User{FirstName: "Joe", LastName: "Carrot", Email: "jc@test.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner, waiter, seat := testDb.Owner, testDb.Other, testDb.Seats[0]
+	waitlist := "/flights/" + testDb.Flight.Id.Hex() + "/waitlist"
+	join := func(user *types.User, class types.SeatClass) (int, *types.WaitlistEntry) {
+		entry := &types.WaitlistEntry{}
+		status := send(t, testDb.as(user), "POST", waitlist, types.JoinWaitlistParams{Class: class}, entry)
+		return status, entry
+	}
+	list := func(user *types.User) []*types.WaitlistEntry {
+		entries := []*types.WaitlistEntry{}
+		assert.Equal(t, fiber.StatusOK, send(t, testDb.as(user), "GET", waitlist, nil, &entries))
+		return entries
+	}
+
+	status, _ := join(waiter, types.Economy)
+	assert.Equal(t, fiber.StatusConflict, status)
+	status, reservation := reserve(t, testDb.as(owner), seat, nil)
+	assert.Equal(t, fiber.StatusCreated, status)
+
+	status, entry := join(waiter, types.Economy)
+	assert.Equal(t, fiber.StatusCreated, status)
+	assert.Equal(t, 1, entry.Position)
+	assert.Equal(t, types.WaitlistWaiting, entry.Status)
+	status, _ = join(waiter, types.Economy)
+	assert.Equal(t, fiber.StatusConflict, status)
+	status, _ = join(waiter, types.First)
+	assert.Equal(t, fiber.StatusNotFound, status)
+	status, _ = join(waiter, types.SeatClass(9))
+	assert.Equal(t, fiber.StatusBadRequest, status)
+	status, entry = join(other, types.Economy)
+	assert.Equal(t, fiber.StatusCreated, status)
+	assert.Equal(t, 2, entry.Position)
+
+	assert.Len(t, list(waiter), 1)
+	assert.Len(t, list(testDb.Admin), 2)
+
+	// leaving gives the place up
+	assert.Equal(t, fiber.StatusOK, send(t, testDb.as(other), "DELETE", waitlist+"?class=1", nil, nil))
+	assert.Equal(t, fiber.StatusNotFound, send(t, testDb.as(other), "DELETE", waitlist+"?class=1", nil, nil))
+	assert.Empty(t, list(other))
+
+	// the cancelled seat is held for the waiting user, who confirms it
+	assert.Equal(t, fiber.StatusOK, send(t, testDb.as(owner), "DELETE", "/reservations/"+reservation.Id.Hex(), nil, nil))
+	entries := list(waiter)
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, types.WaitlistOffered, entries[0].Status)
+		if assert.NotNil(t, entries[0].Offer) {
+			assert.Equal(t, seat.Id, entries[0].Offer.SeatId)
+		}
+	}
+	status, _ = reserve(t, testDb.as(other), seat, nil)
+	assert.NotEqual(t, fiber.StatusCreated, status)
+	confirm := "/flights/" + testDb.Flight.Id.Hex() + "/seats/" + seat.Id.Hex() + "/holds/confirm"
+	assert.Equal(t, fiber.StatusCreated, send(t, testDb.as(waiter), "POST", confirm, nil, nil))
+	entries = list(waiter)
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, types.WaitlistBooked, entries[0].Status)
+	}
+}
@@ -0,0 +1,142 @@
+// Package loyalty runs the frequent flyer program: the users earn points on
+// the distance they fly, more of them in the higher tiers, lose them when
+// they cancel and spend them on new reservations.
+package loyalty
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/fabrizioperria/goflight/db"
+	"github.com/fabrizioperria/goflight/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Tier is reached with MinPoints qualifying points. Its members earn Bonus
+// times the points of a flight on top of them.
+type Tier struct {
+	Name      types.LoyaltyTier `json:"name"`
+	MinPoints int               `json:"min_points"`
+	Bonus     float64           `json:"bonus"`
+}
+
+// Rules give PointsPerMile flown, and take PointValue off a reservation for
+// each point spent on it. The reservations in another currency than
+// PointValue cannot be paid with points. Tiers go from the least to the most
+// demanding, the first one being where every user starts.
+type Rules struct {
+	PointsPerMile float64     `json:"points_per_mile"`
+	PointValue    types.Money `json:"point_value"`
+	Tiers         []Tier      `json:"tiers"`
+}
+
+func DefaultRules() Rules {
+	return Rules{
+		PointsPerMile: 1,
+		PointValue:    types.MustParseMoney("0.01", "USD"),
+		Tiers: []Tier{
+			{Name: types.LoyaltyMember, MinPoints: 0},
+			{Name: types.LoyaltySilver, MinPoints: 25000, Bonus: 0.25},
+			{Name: types.LoyaltyGold, MinPoints: 75000, Bonus: 1},
+		},
+	}
+}
+
+// TierFor returns the tier reached with qualifying points.
+func (rules Rules) TierFor(qualifying int) Tier {
+	reached := rules.Tiers[0]
+	for _, tier := range rules.Tiers[1:] {
+		if qualifying >= tier.MinPoints {
+			reached = tier
+		}
+	}
+	return reached
+}
+
+// Program keeps the loyalty accounts of the users in step with their
+// reservations.
+type Program struct {
+	store db.Store
+	rules Rules
+}
+
+func NewProgram(store db.Store, rules Rules) *Program {
+	return &Program{
+		store: store,
+		rules: rules,
+	}
+}
+
+// Account returns the loyalty account of the user with userId, along with
+// their tier.
+func (p *Program) Account(ctx context.Context, userId primitive.ObjectID) (*types.LoyaltyAccount, error) {
+	account, err := p.store.Loyalty.GetLoyaltyAccount(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	return p.withTier(account), nil
+}
+
+func (p *Program) withTier(account *types.LoyaltyAccount) *types.LoyaltyAccount {
+	account.Tier = p.rules.TierFor(account.QualifyingPoints).Name
+	return account
+}
+
+// Settle gives the points of the reservations once they are confirmed, and
+// takes them back once they are cancelled or denied boarding, along with
+// giving back the points spent on them. Settling a reservation again changes nothing.
+func (p *Program) Settle(ctx context.Context, reservations []*types.Reservation) error {
+	for _, reservation := range reservations {
+		var err error
+		switch reservation.CurrentStatus() {
+		case types.ReservationConfirmed, types.ReservationTicketed, types.ReservationCheckedIn, types.ReservationBoarded:
+			err = p.earn(ctx, reservation)
+		case types.ReservationCancelled, types.ReservationDeniedBoarding, types.ReservationRefunded:
+			err = p.reverse(ctx, reservation)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Program) earn(ctx context.Context, reservation *types.Reservation) error {
+	miles, err := p.miles(ctx, reservation)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	_, err = p.store.Loyalty.UpdateLoyaltyAccount(ctx, reservation.UserId, func(account *types.LoyaltyAccount) (bool, error) {
+		bonus := p.rules.TierFor(account.QualifyingPoints).Bonus
+		points := int(math.Round(miles * p.rules.PointsPerMile * (1 + bonus)))
+		return account.Earn(points, reservation.Id, now), nil
+	})
+	return err
+}
+
+func (p *Program) reverse(ctx context.Context, reservation *types.Reservation) error {
+	now := time.Now()
+	_, err := p.store.Loyalty.UpdateLoyaltyAccount(ctx, reservation.UserId, func(account *types.LoyaltyAccount) (bool, error) {
+		reversed := account.Reverse(reservation.Id, now)
+		restored := account.Restore(reservation.Id, now)
+		return reversed || restored, nil
+	})
+	return err
+}
+
+// miles returns the distance flown on reservation, between the airports of
+// its flight.
+func (p *Program) miles(ctx context.Context, reservation *types.Reservation) (float64, error) {
+	flight, err := p.store.Flight.GetFlight(ctx, db.FlightFilter{Id: reservation.FlightId})
+	if err != nil {
+		return 0, err
+	}
+	return db.FlightMiles(ctx, p.store.Airport, flight)
+}
+
+// PointValue is what a loyalty point is worth when spent on a reservation.
+func (p *Program) PointValue() types.Money {
+	return p.rules.PointValue
+}
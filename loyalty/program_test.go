@@ -0,0 +1,155 @@
+package loyalty
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/fabrizioperria/goflight/db"
+	"github.com/fabrizioperria/goflight/db/memory"
+	"github.com/fabrizioperria/goflight/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func usd(amount string) types.Money {
+	return types.MustParseMoney(amount, "USD")
+}
+
+// reserve reserves a new seat on flight for each price, pending until paid
+// for.
+func reserve(t *testing.T, store *db.Store, flight *types.Flight, userId primitive.ObjectID, prices ...types.Money) []*types.Reservation {
+	ctx := context.Background()
+	reservations := []*types.Reservation{}
+	for _, price := range prices {
+		seat, err := store.Seat.CreateSeat(ctx, &types.Seat{FlightId: flight.Id, Price: price, Available: true})
+		require.NoError(t, err)
+		reservation, err := store.Reservation.CreateReservation(ctx, db.SeatFilter{Id: seat.Id}, userId, nil, "", nil)
+		require.NoError(t, err)
+		reservations = append(reservations, reservation)
+	}
+	return reservations
+}
+
+func setStatus(t *testing.T, store *db.Store, reservation *types.Reservation, status types.ReservationStatus) *types.Reservation {
+	updated, err := store.Reservation.UpdateReservationStatus(context.Background(), db.ReservationFilter{Id: reservation.Id}, status)
+	require.NoError(t, err)
+	return updated
+}
+
+func TestMilesTo(t *testing.T) {
+	store := memory.NewStore()
+	jfk, err := store.Airport.GetAirport(context.Background(), db.AirportFilter{IATA: "JFK"})
+	require.NoError(t, err)
+	lax, err := store.Airport.GetAirport(context.Background(), db.AirportFilter{IATA: "LAX"})
+	require.NoError(t, err)
+	assert.InDelta(t, 2475, jfk.MilesTo(*lax), 10)
+	assert.InDelta(t, jfk.MilesTo(*lax), lax.MilesTo(*jfk), 1e-9)
+	assert.Zero(t, jfk.MilesTo(*jfk))
+}
+
+func TestSettle(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	rules := DefaultRules()
+	rules.Tiers = []Tier{
+		{Name: types.LoyaltyMember},
+		{Name: types.LoyaltySilver, MinPoints: 4000, Bonus: 0.5},
+		{Name: types.LoyaltyGold, MinPoints: 100000, Bonus: 1},
+	}
+	program := NewProgram(*store, rules)
+	userId := primitive.NewObjectID()
+	flight, err := store.Flight.CreateFlight(ctx, &types.Flight{Airline: "Delta", Departure: "JFK", Arrival: "LAX"})
+	require.NoError(t, err)
+	miles, err := program.miles(ctx, &types.Reservation{FlightId: flight.Id})
+	require.NoError(t, err)
+	points := int(math.Round(miles))
+
+	// pending reservations earn nothing until confirmed, and only once
+	reservations := reserve(t, store, flight, userId, usd("100"), usd("100"), usd("100"))
+	require.NoError(t, program.Settle(ctx, reservations))
+	account, err := program.Account(ctx, userId)
+	require.NoError(t, err)
+	assert.Zero(t, account.Points)
+	assert.Equal(t, types.LoyaltyMember, account.Tier)
+	reservations[0] = setStatus(t, store, reservations[0], types.ReservationConfirmed)
+	require.NoError(t, program.Settle(ctx, reservations[:1]))
+	reservations[0] = setStatus(t, store, reservations[0], types.ReservationTicketed)
+	require.NoError(t, program.Settle(ctx, reservations[:1]))
+	account, err = program.Account(ctx, userId)
+	require.NoError(t, err)
+	assert.Equal(t, points, account.Points)
+	assert.Len(t, account.Activity, 1)
+
+	// the higher tiers earn a bonus
+	reservations[1] = setStatus(t, store, reservations[1], types.ReservationConfirmed)
+	reservations[2] = setStatus(t, store, reservations[2], types.ReservationConfirmed)
+	require.NoError(t, program.Settle(ctx, reservations[1:]))
+	account, err = program.Account(ctx, userId)
+	require.NoError(t, err)
+	bonus := int(math.Round(miles * 1.5))
+	assert.Equal(t, 2*points+bonus, account.Points)
+	assert.Equal(t, 2*points+bonus, account.QualifyingPoints)
+	assert.Equal(t, types.LoyaltySilver, account.Tier)
+
+	// cancelling takes the points back, once
+	cancelled, err := store.Reservation.CancelReservation(ctx, db.ReservationFilter{Id: reservations[2].Id}, nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, program.Settle(ctx, []*types.Reservation{cancelled}))
+	require.NoError(t, program.Settle(ctx, []*types.Reservation{cancelled}))
+	account, err = program.Account(ctx, userId)
+	require.NoError(t, err)
+	assert.Equal(t, 2*points, account.Points)
+	assert.Equal(t, types.LoyaltySilver, account.Tier)
+	last := account.Activity[len(account.Activity)-1]
+	assert.Equal(t, types.PointsReversed, last.Kind)
+	assert.Equal(t, -bonus, last.Points)
+	assert.Equal(t, cancelled.Id, last.ReservationId)
+}
+
+func TestSpend(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	program := NewProgram(*store, DefaultRules())
+	userId := primitive.NewObjectID()
+	flight, err := store.Flight.CreateFlight(ctx, &types.Flight{Airline: "Delta", Departure: "JFK", Arrival: "LAX"})
+	require.NoError(t, err)
+	_, err = store.Loyalty.UpdateLoyaltyAccount(ctx, userId, func(account *types.LoyaltyAccount) (bool, error) {
+		return account.Earn(15000, primitive.NewObjectID(), time.Now()), nil
+	})
+	require.NoError(t, err)
+	spend := func(price types.Money, points int) (*types.Reservation, error) {
+		seat, err := store.Seat.CreateSeat(ctx, &types.Seat{FlightId: flight.Id, Price: price, Available: true})
+		require.NoError(t, err)
+		return store.Reservation.CreateReservation(ctx, db.SeatFilter{Id: seat.Id}, userId, nil, "", &db.Spending{Points: points, PointValue: program.PointValue()})
+	}
+
+	// points pay for the reservation, no more than it costs
+	spent, err := spend(usd("100"), 20000)
+	require.NoError(t, err)
+	require.NotNil(t, spent.Loyalty)
+	assert.Equal(t, 10000, spent.Loyalty.Points)
+	assert.True(t, usd("100").Equal(spent.Loyalty.Amount), spent.Loyalty.Amount)
+	assert.True(t, spent.AmountDue().IsZero(), spent.AmountDue())
+
+	// and no more than the user has
+	spent, err = spend(usd("100"), 20000)
+	require.NoError(t, err)
+	assert.Equal(t, 5000, spent.Loyalty.Points)
+	assert.True(t, usd("50").Equal(spent.AmountDue()), spent.AmountDue())
+	_, err = spend(usd("100"), 100)
+	assert.ErrorIs(t, err, types.ErrPointsUnavailable)
+	_, err = spend(types.MustParseMoney("100", "EUR"), 100)
+	assert.ErrorIs(t, err, types.ErrPointsUnavailable)
+
+	// cancelling gives the points spent back
+	cancelled, err := store.Reservation.CancelReservation(ctx, db.ReservationFilter{Id: spent.Id}, nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, program.Settle(ctx, []*types.Reservation{cancelled}))
+	account, err := program.Account(ctx, userId)
+	require.NoError(t, err)
+	assert.Equal(t, 5000, account.Points)
+	assert.Equal(t, 15000, account.QualifyingPoints)
+}
@@ -4,11 +4,19 @@ import (
 	"context"
 	"log"
 	"os"
+	"time"
+	_ "time/tzdata"
 
 	_ "github.com/joho/godotenv/autoload"
 
+	"github.com/fabrizioperria/goflight/cancellation"
 	"github.com/fabrizioperria/goflight/db"
 	"github.com/fabrizioperria/goflight/handlers"
+	"github.com/fabrizioperria/goflight/loyalty"
+	"github.com/fabrizioperria/goflight/payments"
+	"github.com/fabrizioperria/goflight/pricing"
+	"github.com/fabrizioperria/goflight/search"
+	"github.com/fabrizioperria/goflight/waitlist"
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -37,10 +45,130 @@ func main() {
 		flightStore      = db.NewMongoDbFlightStore(client)
 		seatStore        = db.NewMongoDbSeatStore(client, *flightStore)
 		reservationStore = db.NewMongoDbReservationStore(client, *flightStore, *seatStore)
+		airportStore     = db.NewMongoDbAirportStore(client)
+		aircraftStore    = db.NewMongoDbAircraftStore(client)
+		creditStore      = db.NewMongoDbCreditStore(client)
+		promotionStore   = db.NewMongoDbPromotionStore(client)
+		loyaltyStore     = db.NewMongoDbLoyaltyStore(client)
+		waitlistStore    = db.NewMongoDbWaitlistStore(client)
 
-		mainStore = db.Store{User: userStore, Flight: flightStore, Seat: seatStore, Reservation: reservationStore}
+		mainStore = db.Store{User: userStore, Flight: flightStore, Seat: seatStore, Reservation: reservationStore, Airport: airportStore, Aircraft: aircraftStore, Credit: creditStore, Promotion: promotionStore, Loyalty: loyaltyStore, Waitlist: waitlistStore}
 	)
-	app := handlers.SetupRoutes(mainStore, config)
+	if err := flightStore.EnsureIndexes(context.TODO()); err != nil {
+		log.Fatal(err)
+	}
+	if err := seatStore.EnsureIndexes(context.TODO()); err != nil {
+		log.Fatal(err)
+	}
+	if err := reservationStore.EnsureIndexes(context.TODO()); err != nil {
+		log.Fatal(err)
+	}
+	if err := airportStore.EnsureIndexes(context.TODO()); err != nil {
+		log.Fatal(err)
+	}
+	if err := creditStore.EnsureIndexes(context.TODO()); err != nil {
+		log.Fatal(err)
+	}
+	if err := promotionStore.EnsureIndexes(context.TODO()); err != nil {
+		log.Fatal(err)
+	}
+	if err := loyaltyStore.EnsureIndexes(context.TODO()); err != nil {
+		log.Fatal(err)
+	}
+	if err := waitlistStore.EnsureIndexes(context.TODO()); err != nil {
+		log.Fatal(err)
+	}
+	if err := db.LoadBundledAirports(context.TODO(), airportStore); err != nil {
+		log.Fatal(err)
+	}
+	if err := db.LoadBundledAircraft(context.TODO(), aircraftStore); err != nil {
+		log.Fatal(err)
+	}
+	gateway, err := payments.GatewayFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	var (
+		engine    = pricing.NewEngine(pricing.ConfigFromEnv())
+		rates     = pricing.ExchangeRatesFromEnv()
+		processor = payments.NewProcessor(gateway, reservationStore, creditStore)
+		program   = loyalty.NewProgram(mainStore, loyalty.DefaultRules())
+		queue     = waitlist.NewQueue(mainStore, program, waitlist.LogNotifier{}, waitlist.DefaultOfferTTL)
+		settler   = cancellation.NewSettler(mainStore, processor, program, queue)
+	)
+	go sweepExpiredHolds(context.Background(), reservationStore, processor, queue, settler, holdSweepInterval())
+	repricer := pricing.NewRepricer(flightStore, seatStore, engine)
+	go repriceSeats(context.Background(), repricer, repricingInterval())
+
+	app := handlers.SetupRoutes(mainStore, config, engine, rates, search.ConfigFromEnv(rates), processor, program, queue, settler)
 	listenAddress := os.Getenv("HTTP_LISTEN_ADDR")
 	app.Listen(listenAddress)
 }
+
+const (
+	defaultHoldSweepInterval = 30 * time.Second
+	defaultRepricingInterval = 15 * time.Minute
+)
+
+func holdSweepInterval() time.Duration {
+	interval, err := time.ParseDuration(os.Getenv("HOLD_SWEEP_INTERVAL"))
+	if err != nil || interval <= 0 {
+		return defaultHoldSweepInterval
+	}
+	return interval
+}
+
+// sweepExpiredHolds periodically gives the seats whose hold expired back to
+// their flights, after offering the ones of expired waitlist offers to the
+// next users waiting for them. The reservations whose payment is still
+// pending past its expiry are cancelled, giving their seats back too. The
+// reservations that gave their seats back are then settled, the ones left
+// unsettled by a failure included.
+func sweepExpiredHolds(ctx context.Context, store db.ReservationStorer, processor *payments.Processor, queue *waitlist.Queue, settler *cancellation.Settler, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if _, err := queue.ExpireOffers(ctx, now); err != nil {
+				log.Println("expiring waitlist offers:", err)
+			}
+			if _, err := store.ReleaseExpiredHolds(ctx, now); err != nil {
+				log.Println("releasing expired holds:", err)
+			}
+			if _, err := processor.ExpirePayments(ctx, now); err != nil {
+				log.Println("expiring pending payments:", err)
+			}
+			if _, err := settler.SettlePending(ctx, now); err != nil {
+				log.Println("settling cancellations:", err)
+			}
+		}
+	}
+}
+
+func repricingInterval() time.Duration {
+	interval, err := time.ParseDuration(os.Getenv("REPRICING_INTERVAL"))
+	if err != nil || interval <= 0 {
+		return defaultRepricingInterval
+	}
+	return interval
+}
+
+// repriceSeats periodically updates the prices of the available seats of the
+// upcoming flights to the demand for them.
+func repriceSeats(ctx context.Context, repricer *pricing.Repricer, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if _, err := repricer.Reprice(ctx, now); err != nil {
+				log.Println("repricing seats:", err)
+			}
+		}
+	}
+}
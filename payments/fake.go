@@ -0,0 +1,152 @@
+package payments
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/fabrizioperria/goflight/types"
+)
+
+const fakeGatewayName = "fake"
+
+// The payment methods the fake gateway treats specially, like the test cards
+// of real providers. Any other method is authorized right away.
+const (
+	FakeDeclinedMethod = "fake_declined"
+	// FakeAsyncMethod leaves the payment pending until it is settled with
+	// FakeGateway.Settle.
+	FakeAsyncMethod = "fake_async"
+)
+
+const fakeDeclineReason = "card declined"
+
+// FakeGateway processes payments in memory, for development and tests. It
+// is deterministic: the outcome of a payment only depends on its method and
+// references are numbered in order.
+type FakeGateway struct {
+	mu       sync.Mutex
+	payments map[string]*fakePayment
+	count    int
+}
+
+type fakePayment struct {
+	status     types.PaymentStatus
+	authorized types.Money
+	captured   types.Money
+	refunded   types.Money
+}
+
+func NewFakeGateway() *FakeGateway {
+	return &FakeGateway{payments: map[string]*fakePayment{}}
+}
+
+func (g *FakeGateway) Name() string {
+	return fakeGatewayName
+}
+
+// find returns the payment with reference. The caller must hold g.mu.
+func (g *FakeGateway) find(reference string) (*fakePayment, error) {
+	payment, ok := g.payments[reference]
+	if !ok {
+		return nil, fmt.Errorf("%w %s", ErrUnknownPayment, reference)
+	}
+	return payment, nil
+}
+
+func (g *FakeGateway) Authorize(ctx context.Context, amount types.Money, method string) (Result, error) {
+	if !amount.IsPos() {
+		return Result{}, fmt.Errorf("cannot authorize %s", amount)
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.count++
+	result := Result{Reference: fmt.Sprintf("fake_%d", g.count), Status: types.PaymentAuthorized}
+	switch method {
+	case FakeDeclinedMethod:
+		result.Status, result.Reason = types.PaymentFailed, fakeDeclineReason
+	case FakeAsyncMethod:
+		result.Status = types.PaymentPending
+	}
+	g.payments[result.Reference] = &fakePayment{status: result.Status, authorized: amount}
+	return result, nil
+}
+
+func (g *FakeGateway) Capture(ctx context.Context, reference string, amount types.Money) (Result, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	payment, err := g.find(reference)
+	if err != nil {
+		return Result{}, err
+	}
+	if payment.status != types.PaymentAuthorized {
+		return Result{}, fmt.Errorf("payment %s is %s", reference, payment.status)
+	}
+	if cmp, err := amount.Cmp(payment.authorized); err != nil || cmp > 0 {
+		return Result{}, fmt.Errorf("cannot capture %s out of %s", amount, payment.authorized)
+	}
+	payment.status, payment.captured = types.PaymentCaptured, amount
+	return Result{Reference: reference, Status: payment.status}, nil
+}
+
+func (g *FakeGateway) Void(ctx context.Context, reference string) (Result, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	payment, err := g.find(reference)
+	if err != nil {
+		return Result{}, err
+	}
+	if !payment.status.IsAwaited() {
+		return Result{}, fmt.Errorf("payment %s is %s", reference, payment.status)
+	}
+	payment.status = types.PaymentVoided
+	return Result{Reference: reference, Status: payment.status}, nil
+}
+
+// Refund gives amount back out of what was captured. Successive refunds can
+// give it all back in parts.
+func (g *FakeGateway) Refund(ctx context.Context, reference string, amount types.Money) (Result, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	payment, err := g.find(reference)
+	if err != nil {
+		return Result{}, err
+	}
+	if payment.status != types.PaymentCaptured && payment.status != types.PaymentRefunded {
+		return Result{}, fmt.Errorf("payment %s is %s", reference, payment.status)
+	}
+	refunded, err := payment.refunded.Add(amount)
+	if err != nil {
+		return Result{}, err
+	}
+	if cmp, err := refunded.Cmp(payment.captured); err != nil || cmp > 0 || !amount.IsPos() {
+		return Result{}, fmt.Errorf("cannot refund %s out of %s", amount, payment.captured)
+	}
+	payment.status, payment.refunded = types.PaymentRefunded, refunded
+	return Result{Reference: reference, Status: payment.status}, nil
+}
+
+// Settle decides on a pending payment, authorizing it or failing it, and
+// returns the event the provider would send to the webhook about it.
+func (g *FakeGateway) Settle(reference string, authorized bool) (Event, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	payment, err := g.find(reference)
+	if err != nil {
+		return Event{}, err
+	}
+	if payment.status != types.PaymentPending {
+		return Event{}, fmt.Errorf("payment %s is %s", reference, payment.status)
+	}
+	event := Event{Reference: reference, Status: types.PaymentAuthorized}
+	if !authorized {
+		event.Status, event.Reason = types.PaymentFailed, fakeDeclineReason
+	}
+	payment.status = event.Status
+	return event, nil
+}
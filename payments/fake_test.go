@@ -0,0 +1,70 @@
+package payments
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fabrizioperria/goflight/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFakeGateway(t *testing.T) {
+	ctx := context.Background()
+	gateway := NewFakeGateway()
+
+	authorized, err := gateway.Authorize(ctx, usd("100"), "tok_visa")
+	require.NoError(t, err)
+	assert.Equal(t, Result{Reference: "fake_1", Status: types.PaymentAuthorized}, authorized)
+	_, err = gateway.Capture(ctx, authorized.Reference, usd("100.01"))
+	assert.Error(t, err)
+	_, err = gateway.Refund(ctx, authorized.Reference, usd("10"))
+	assert.Error(t, err)
+
+	captured, err := gateway.Capture(ctx, authorized.Reference, usd("90"))
+	require.NoError(t, err)
+	assert.Equal(t, types.PaymentCaptured, captured.Status)
+	_, err = gateway.Void(ctx, authorized.Reference)
+	assert.Error(t, err)
+
+	// refunds may give the captured amount back in parts, but not more
+	for _, amount := range []string{"40", "50"} {
+		refunded, err := gateway.Refund(ctx, authorized.Reference, usd(amount))
+		require.NoError(t, err, amount)
+		assert.Equal(t, types.PaymentRefunded, refunded.Status)
+	}
+	_, err = gateway.Refund(ctx, authorized.Reference, usd("0.01"))
+	assert.Error(t, err)
+
+	declined, err := gateway.Authorize(ctx, usd("100"), FakeDeclinedMethod)
+	require.NoError(t, err)
+	assert.Equal(t, Result{Reference: "fake_2", Status: types.PaymentFailed, Reason: fakeDeclineReason}, declined)
+	_, err = gateway.Capture(ctx, declined.Reference, usd("100"))
+	assert.Error(t, err)
+
+	pending, err := gateway.Authorize(ctx, usd("100"), FakeAsyncMethod)
+	require.NoError(t, err)
+	assert.Equal(t, types.PaymentPending, pending.Status)
+	voided, err := gateway.Void(ctx, pending.Reference)
+	require.NoError(t, err)
+	assert.Equal(t, types.PaymentVoided, voided.Status)
+	_, err = gateway.Settle(pending.Reference, true)
+	assert.Error(t, err)
+
+	_, err = gateway.Authorize(ctx, types.Money{}, "tok_visa")
+	assert.Error(t, err)
+	_, err = gateway.Capture(ctx, "fake_42", usd("1"))
+	assert.ErrorIs(t, err, ErrUnknownPayment)
+}
+
+func TestGatewayFromEnv(t *testing.T) {
+	for _, name := range []string{"", "fake"} {
+		t.Setenv("PAYMENT_GATEWAY", name)
+		gateway, err := GatewayFromEnv()
+		require.NoError(t, err)
+		assert.Equal(t, "fake", gateway.Name())
+	}
+	t.Setenv("PAYMENT_GATEWAY", "stripe")
+	_, err := GatewayFromEnv()
+	assert.Error(t, err)
+}
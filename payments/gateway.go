@@ -0,0 +1,52 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/fabrizioperria/goflight/types"
+)
+
+// Gateway is a payment provider. An amount is first authorized, setting it
+// aside on the customer's card or account, then either captured to actually
+// charge it or voided to let it go. A captured amount can be refunded.
+//
+// A payment the provider turns down is not an error: it comes back as a
+// Result with the failed status and the reason the provider gave. Errors are
+// the requests the provider could not process at all.
+type Gateway interface {
+	// Name identifies the provider on the payments it processed.
+	Name() string
+	// Authorize sets amount aside on method, a token the provider issued to
+	// the client for a card or an account. The result may also be pending
+	// while the provider waits on the customer or the bank, in which case
+	// it tells how the payment went through a webhook later.
+	Authorize(ctx context.Context, amount types.Money, method string) (Result, error)
+	Capture(ctx context.Context, reference string, amount types.Money) (Result, error)
+	Void(ctx context.Context, reference string) (Result, error)
+	Refund(ctx context.Context, reference string, amount types.Money) (Result, error)
+}
+
+// Result is the status of the payment with Reference at the provider after
+// a request, with the reason the provider gave when it failed.
+type Result struct {
+	Reference string
+	Status    types.PaymentStatus
+	Reason    string
+}
+
+var ErrUnknownPayment = errors.New("unknown payment")
+
+// GatewayFromEnv returns the gateway named by PAYMENT_GATEWAY. The fake one
+// is the only gateway for now and is used when it is unset. It fails on any
+// other name, rather than taking payments nobody collects.
+func GatewayFromEnv() (Gateway, error) {
+	switch name := os.Getenv("PAYMENT_GATEWAY"); name {
+	case "", fakeGatewayName:
+		return NewFakeGateway(), nil
+	default:
+		return nil, fmt.Errorf("payments: unknown gateway %q", name)
+	}
+}
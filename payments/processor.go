@@ -0,0 +1,387 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fabrizioperria/goflight/db"
+	"github.com/fabrizioperria/goflight/types"
+	"github.com/govalues/decimal"
+)
+
+// Processor pays for the reservations through a gateway and records how
+// their payments went, confirming them once captured and cancelling them,
+// which gives their seats back, when they fail. The credit spent on the
+// reservations it cancels is given back.
+type Processor struct {
+	gateway Gateway
+	store   db.ReservationStorer
+	credits db.CreditStorer
+}
+
+// PendingPaymentTTL is how long the reservations wait on a payment the
+// provider has not decided on, holding their seats, before giving up on it.
+const PendingPaymentTTL = 30 * time.Minute
+
+func NewProcessor(gateway Gateway, store db.ReservationStorer, credits db.CreditStorer) *Processor {
+	return &Processor{
+		gateway: gateway,
+		store:   store,
+		credits: credits,
+	}
+}
+
+// DeclinedError is returned when the payment for reservations failed, after
+// they were cancelled.
+type DeclinedError struct {
+	Reason string
+}
+
+func (err *DeclinedError) Error() string {
+	return "payment declined: " + err.Reason
+}
+
+// Checkout charges method for reservations, all pending, with a single
+// payment and returns them updated: confirmed once the payment is captured,
+// or still pending while the provider has not decided on it. When it fails
+// they are cancelled and a *DeclinedError is returned along with them.
+func (p *Processor) Checkout(ctx context.Context, reservations []*types.Reservation, method string) ([]*types.Reservation, error) {
+	amounts := []types.Money{}
+	for _, reservation := range reservations {
+		amounts = append(amounts, reservation.AmountDue())
+	}
+	total, err := types.Sum(amounts...)
+	if err != nil {
+		return p.decline(ctx, reservations, Result{Status: types.PaymentFailed, Reason: err.Error()})
+	}
+	if !total.IsPos() {
+		return p.confirm(ctx, reservations)
+	}
+
+	result, err := p.gateway.Authorize(ctx, total, method)
+	if err != nil {
+		result = Result{Status: types.PaymentFailed, Reason: err.Error()}
+	}
+	if result.Status == types.PaymentAuthorized {
+		result = p.capture(ctx, result.Reference, total)
+	}
+	if result.Status == types.PaymentFailed || result.Status == types.PaymentVoided {
+		return p.decline(ctx, reservations, result)
+	}
+	return p.record(ctx, reservations, result)
+}
+
+// HandleEvent records what the provider told about a payment on the
+// reservations it pays for, capturing it first when it was authorized. The
+// events about payments already settled are acknowledged and ignored, since
+// providers may send them more than once.
+func (p *Processor) HandleEvent(ctx context.Context, event Event) ([]*types.Reservation, error) {
+	if err := event.Validate(); err != nil {
+		return nil, err
+	}
+	reservations, err := p.store.GetReservations(ctx, db.ReservationFilter{PaymentReference: event.Reference}, &db.Pagination{Limit: "0"})
+	if err != nil {
+		return nil, err
+	}
+	if len(reservations) == 0 {
+		return nil, fmt.Errorf("%w %s", ErrUnknownPayment, event.Reference)
+	}
+
+	awaiting := []*types.Reservation{}
+	amounts := []types.Money{}
+	for _, reservation := range reservations {
+		if reservation.Payment.Status.IsAwaited() {
+			awaiting = append(awaiting, reservation)
+			amounts = append(amounts, reservation.Payment.Amount)
+		}
+	}
+	if len(awaiting) == 0 {
+		return reservations, nil
+	}
+
+	result := Result{Reference: event.Reference, Status: event.Status, Reason: event.Reason}
+	if result.Status == types.PaymentAuthorized {
+		total, err := types.Sum(amounts...)
+		if err != nil {
+			return nil, err
+		}
+		result = p.capture(ctx, event.Reference, total)
+	}
+	updated, err := p.record(ctx, awaiting, result)
+	if err != nil {
+		return nil, err
+	}
+	return updated, p.releaseCredits(ctx, updated)
+}
+
+// Refund gives back the refund of a cancelled reservation, moving it to
+// refunded, or lets its payment go when it was not captured yet and pays for
+// no other reservation still waiting on it, and gives back the share of the
+// credit spent on it that its refund gives back. The reservation is returned
+// as it is when there is nothing to give back.
+func (p *Processor) Refund(ctx context.Context, reservation *types.Reservation) (*types.Reservation, error) {
+	if err := p.releaseCredits(ctx, []*types.Reservation{reservation}); err != nil {
+		return nil, err
+	}
+	payment := reservation.Payment
+	if payment == nil {
+		return reservation, nil
+	}
+
+	var result Result
+	var err error
+	switch {
+	case payment.Status.IsAwaited():
+		shared, sharedErr := p.sharesPayment(ctx, reservation)
+		if sharedErr != nil {
+			return nil, sharedErr
+		}
+		if shared {
+			return reservation, nil
+		}
+		result, err = p.gateway.Void(ctx, payment.Reference)
+	case payment.Status == types.PaymentCaptured && reservation.Refund != nil && reservation.Refund.Amount.IsPos():
+		result, err = p.gateway.Refund(ctx, payment.Reference, reservation.Refund.Amount)
+	default:
+		return reservation, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	updated, err := p.record(ctx, []*types.Reservation{reservation}, result)
+	if err != nil {
+		return nil, err
+	}
+	return updated[0], nil
+}
+
+// ExpirePayments gives up on the payments still awaited past their expiry at
+// now, voiding them at the provider, and returns the reservations they paid
+// for, cancelled, which gives their seats back. The credit spent on them is
+// given back.
+func (p *Processor) ExpirePayments(ctx context.Context, now time.Time) ([]*types.Reservation, error) {
+	reservations, err := p.store.GetReservations(ctx, db.ReservationFilter{PaymentExpiredBy: now}, &db.Pagination{Limit: "0"})
+	if err != nil {
+		return nil, err
+	}
+	references := []string{}
+	byReference := map[string][]*types.Reservation{}
+	for _, reservation := range reservations {
+		reference := reservation.Payment.Reference
+		if _, ok := byReference[reference]; !ok {
+			references = append(references, reference)
+		}
+		byReference[reference] = append(byReference[reference], reservation)
+	}
+
+	expired := []*types.Reservation{}
+	errs := []error{}
+	for _, reference := range references {
+		// the provider may have decided on it in the meantime, the webhook
+		// tells how
+		if _, err := p.gateway.Void(ctx, reference); err != nil {
+			errs = append(errs, fmt.Errorf("voiding %s: %w", reference, err))
+			continue
+		}
+		cancelled, err := p.record(ctx, byReference[reference], Result{Reference: reference, Status: types.PaymentVoided, Reason: "payment expired"})
+		if err == nil {
+			err = p.releaseCredits(ctx, cancelled)
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		expired = append(expired, cancelled...)
+	}
+	return expired, errors.Join(errs...)
+}
+
+// ChargeSeatChange charges method for difference, what the new seat of a
+// reservation costs more, and returns the payment captured. It fails with a
+// *DeclinedError when the payment does not go through at once.
+func (p *Processor) ChargeSeatChange(ctx context.Context, difference types.Money, method string) (*types.Payment, error) {
+	result, err := p.gateway.Authorize(ctx, difference, method)
+	if err != nil {
+		result = Result{Status: types.PaymentFailed, Reason: err.Error()}
+	}
+	switch result.Status {
+	case types.PaymentAuthorized:
+		result = p.capture(ctx, result.Reference, difference)
+	case types.PaymentPending:
+		// the seat cannot wait on the provider to decide
+		if _, err := p.gateway.Void(ctx, result.Reference); err != nil {
+			return nil, err
+		}
+		result.Status, result.Reason = types.PaymentVoided, "seat changes must be paid at once"
+	}
+	if result.Status != types.PaymentCaptured {
+		return nil, &DeclinedError{Reason: result.Reason}
+	}
+	return &types.Payment{
+		Provider:  p.gateway.Name(),
+		Reference: result.Reference,
+		Status:    result.Status,
+		Amount:    difference,
+		UpdatedAt: time.Now().UTC(),
+	}, nil
+}
+
+// RefundSeatChangeCharge gives back charge, the payment of a seat change
+// that could not be made.
+func (p *Processor) RefundSeatChangeCharge(ctx context.Context, charge *types.Payment) error {
+	_, err := p.gateway.Refund(ctx, charge.Reference, charge.Amount)
+	return err
+}
+
+// RefundSeatChange refunds what the last seat change of reservation took off
+// its fare on its payment, no more than was paid for it, and returns it with
+// what is left paid. The reservation is returned as it is when the change
+// did not make it cheaper or nothing was captured for it.
+func (p *Processor) RefundSeatChange(ctx context.Context, reservation *types.Reservation) (*types.Reservation, error) {
+	if len(reservation.SeatChanges) == 0 {
+		return reservation, nil
+	}
+	difference := reservation.SeatChanges[len(reservation.SeatChanges)-1].Difference
+	paid := reservation.AmountPaid()
+	if !difference.IsNeg() || !paid.IsPos() || reservation.Payment.Status != types.PaymentCaptured {
+		return reservation, nil
+	}
+	amount, err := difference.Mul(decimal.MustNew(-1, 0))
+	if err != nil {
+		return nil, err
+	}
+	if cmp, err := amount.Cmp(paid); err != nil {
+		// the difference is in another currency than the payment
+		return reservation, nil
+	} else if cmp > 0 {
+		amount = paid
+	}
+	if _, err := p.gateway.Refund(ctx, reservation.Payment.Reference, amount); err != nil {
+		return nil, err
+	}
+	left, err := paid.Sub(amount)
+	if err != nil {
+		return nil, err
+	}
+	payment := *reservation.Payment
+	payment.Amount, payment.UpdatedAt = left, time.Now().UTC()
+	return p.store.UpdateReservationPayment(ctx, db.ReservationFilter{Id: reservation.Id}, &payment)
+}
+
+// releaseCredits gives back the credit spent on the reservations that were
+// cancelled or denied boarding, in the proportion their refund gives back,
+// or all of it when they have none. Credit already given back is not given
+// twice.
+func (p *Processor) releaseCredits(ctx context.Context, reservations []*types.Reservation) error {
+	for _, reservation := range reservations {
+		status := reservation.CurrentStatus()
+		if reservation.Credit == nil || (status != types.ReservationCancelled && status != types.ReservationDeniedBoarding && status != types.ReservationRefunded) {
+			continue
+		}
+		redemption := *reservation.Credit
+		if reservation.Refund != nil {
+			var err error
+			if redemption.Amount, err = reservation.Refund.Share(redemption.Amount); err != nil {
+				return err
+			}
+		}
+		if _, err := p.credits.RestoreCredit(ctx, &redemption); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sharesPayment reports whether the payment of reservation also pays for
+// other reservations still waiting on it.
+func (p *Processor) sharesPayment(ctx context.Context, reservation *types.Reservation) (bool, error) {
+	filter := db.ReservationFilter{PaymentReference: reservation.Payment.Reference}
+	reservations, err := p.store.GetReservations(ctx, filter, &db.Pagination{Limit: "0"})
+	if err != nil {
+		return false, err
+	}
+	for _, other := range reservations {
+		if other.Id != reservation.Id && other.CurrentStatus() == types.ReservationPending {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// capture charges the authorized payment with reference, voiding it when it
+// cannot be captured.
+func (p *Processor) capture(ctx context.Context, reference string, amount types.Money) Result {
+	result, err := p.gateway.Capture(ctx, reference, amount)
+	if err == nil && result.Status == types.PaymentCaptured {
+		return result
+	}
+	reason := result.Reason
+	if err != nil {
+		reason = err.Error()
+	}
+	if _, err := p.gateway.Void(ctx, reference); err != nil {
+		reason = fmt.Sprintf("%s, then voiding it: %v", reason, err)
+	}
+	return Result{Reference: reference, Status: types.PaymentVoided, Reason: reason}
+}
+
+// record stores the payment of result on reservations, each paying for its
+// own share of it.
+func (p *Processor) record(ctx context.Context, reservations []*types.Reservation, result Result) ([]*types.Reservation, error) {
+	updated := []*types.Reservation{}
+	now := time.Now().UTC()
+	for _, reservation := range reservations {
+		payment := &types.Payment{
+			Provider:  p.gateway.Name(),
+			Reference: result.Reference,
+			Status:    result.Status,
+			Amount:    reservation.AmountDue(),
+			Reason:    result.Reason,
+			UpdatedAt: now,
+		}
+		if reservation.Payment != nil {
+			payment.Amount = reservation.Payment.Amount
+		}
+		if result.Status.IsAwaited() {
+			payment.ExpiresAt = now.Add(PendingPaymentTTL)
+			if reservation.Payment != nil && !reservation.Payment.ExpiresAt.IsZero() {
+				payment.ExpiresAt = reservation.Payment.ExpiresAt
+			}
+		}
+		recorded, err := p.store.UpdateReservationPayment(ctx, db.ReservationFilter{Id: reservation.Id}, payment)
+		if err != nil {
+			return nil, err
+		}
+		updated = append(updated, recorded)
+	}
+	return updated, nil
+}
+
+func (p *Processor) decline(ctx context.Context, reservations []*types.Reservation, result Result) ([]*types.Reservation, error) {
+	if result.Status != types.PaymentVoided {
+		result.Status = types.PaymentFailed
+	}
+	updated, err := p.record(ctx, reservations, result)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.releaseCredits(ctx, updated); err != nil {
+		return nil, err
+	}
+	return updated, &DeclinedError{Reason: result.Reason}
+}
+
+// confirm confirms the reservations there is nothing to pay for.
+func (p *Processor) confirm(ctx context.Context, reservations []*types.Reservation) ([]*types.Reservation, error) {
+	updated := []*types.Reservation{}
+	for _, reservation := range reservations {
+		confirmed, err := p.store.UpdateReservationStatus(ctx, db.ReservationFilter{Id: reservation.Id}, types.ReservationConfirmed)
+		if err != nil {
+			return nil, err
+		}
+		updated = append(updated, confirmed)
+	}
+	return updated, nil
+}
@@ -0,0 +1,335 @@
+package payments
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fabrizioperria/goflight/db"
+	"github.com/fabrizioperria/goflight/db/memory"
+	"github.com/fabrizioperria/goflight/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func usd(amount string) types.Money {
+	return types.MustParseMoney(amount, "USD")
+}
+
+// reserve reserves a new seat for each price, pending until paid for.
+func reserve(t *testing.T, store *db.Store, prices ...types.Money) []*types.Reservation {
+	ctx := context.Background()
+	reservations := []*types.Reservation{}
+	for _, price := range prices {
+		seat, err := store.Seat.CreateSeat(ctx, &types.Seat{Price: price, Available: true})
+		require.NoError(t, err)
+		reservation, err := store.Reservation.CreateReservation(ctx, db.SeatFilter{Id: seat.Id}, primitive.NewObjectID(), nil, "", nil)
+		require.NoError(t, err)
+		require.Equal(t, types.ReservationPending, reservation.Status)
+		reservations = append(reservations, reservation)
+	}
+	return reservations
+}
+
+func TestCheckout(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	processor := NewProcessor(NewFakeGateway(), store.Reservation, store.Credit)
+
+	// a booking is paid for with a single payment
+	reservations := reserve(t, store, usd("100"), usd("50.25"))
+	reservations[1].Fare = &types.FareBreakdown{Total: usd("60.25")}
+	paid, err := processor.Checkout(ctx, reservations, "")
+	require.NoError(t, err)
+	require.Len(t, paid, 2)
+	for i, amount := range []types.Money{usd("100"), usd("60.25")} {
+		assert.Equal(t, types.ReservationConfirmed, paid[i].Status)
+		require.NotNil(t, paid[i].Payment)
+		assert.Equal(t, "fake", paid[i].Payment.Provider)
+		assert.Equal(t, "fake_1", paid[i].Payment.Reference)
+		assert.Equal(t, types.PaymentCaptured, paid[i].Payment.Status)
+		assert.True(t, amount.Equal(paid[i].Payment.Amount))
+	}
+
+	// a declined payment gives the seats back
+	reservations = reserve(t, store, usd("100"))
+	declined, err := processor.Checkout(ctx, reservations, FakeDeclinedMethod)
+	var declinedErr *DeclinedError
+	require.ErrorAs(t, err, &declinedErr)
+	assert.Equal(t, fakeDeclineReason, declinedErr.Reason)
+	assert.Equal(t, types.ReservationCancelled, declined[0].Status)
+	assert.Equal(t, types.PaymentFailed, declined[0].Payment.Status)
+	seat, err := store.Seat.GetSeat(ctx, db.SeatFilter{Id: reservations[0].SeatId})
+	require.NoError(t, err)
+	assert.True(t, seat.Available)
+
+	// so does a payment that cannot be made at all
+	reservations = reserve(t, store, usd("100"), types.MustParseMoney("100", "EUR"))
+	declined, err = processor.Checkout(ctx, reservations, "")
+	require.ErrorAs(t, err, &declinedErr)
+	for _, reservation := range declined {
+		assert.Equal(t, types.ReservationCancelled, reservation.Status)
+	}
+
+	// there is nothing to pay for seats without a price
+	free, err := processor.Checkout(ctx, reserve(t, store, types.Money{}), FakeDeclinedMethod)
+	require.NoError(t, err)
+	assert.Equal(t, types.ReservationConfirmed, free[0].Status)
+	assert.Nil(t, free[0].Payment)
+}
+
+func TestHandleEvent(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	gateway := NewFakeGateway()
+	processor := NewProcessor(gateway, store.Reservation, store.Credit)
+
+	pending, err := processor.Checkout(ctx, reserve(t, store, usd("100"), usd("20")), FakeAsyncMethod)
+	require.NoError(t, err)
+	for _, reservation := range pending {
+		assert.Equal(t, types.ReservationPending, reservation.Status)
+		assert.Equal(t, types.PaymentPending, reservation.Payment.Status)
+	}
+
+	event, err := gateway.Settle(pending[0].Payment.Reference, true)
+	require.NoError(t, err)
+	confirmed, err := processor.HandleEvent(ctx, event)
+	require.NoError(t, err)
+	require.Len(t, confirmed, 2)
+	for _, reservation := range confirmed {
+		assert.Equal(t, types.ReservationConfirmed, reservation.Status)
+		assert.Equal(t, types.PaymentCaptured, reservation.Payment.Status)
+	}
+	assert.True(t, usd("20").Equal(confirmed[1].Payment.Amount))
+
+	// providers may send an event again
+	again, err := processor.HandleEvent(ctx, Event{Reference: event.Reference, Status: types.PaymentFailed})
+	require.NoError(t, err)
+	assert.Equal(t, types.ReservationConfirmed, again[0].Status)
+	assert.Equal(t, types.PaymentCaptured, again[0].Payment.Status)
+
+	pending, err = processor.Checkout(ctx, reserve(t, store, usd("100")), FakeAsyncMethod)
+	require.NoError(t, err)
+	event, err = gateway.Settle(pending[0].Payment.Reference, false)
+	require.NoError(t, err)
+	failed, err := processor.HandleEvent(ctx, event)
+	require.NoError(t, err)
+	assert.Equal(t, types.ReservationCancelled, failed[0].Status)
+	assert.Equal(t, types.PaymentFailed, failed[0].Payment.Status)
+	assert.Equal(t, fakeDeclineReason, failed[0].Payment.Reason)
+
+	_, err = processor.HandleEvent(ctx, Event{Reference: "fake_42", Status: types.PaymentCaptured})
+	assert.ErrorIs(t, err, ErrUnknownPayment)
+	_, err = processor.HandleEvent(ctx, Event{Reference: event.Reference, Status: types.PaymentRefunded})
+	assert.ErrorIs(t, err, ErrInvalidEvent)
+	_, err = processor.HandleEvent(ctx, Event{Status: types.PaymentCaptured})
+	assert.ErrorIs(t, err, ErrInvalidEvent)
+}
+
+func TestVerifySignature(t *testing.T) {
+	payload := []byte(`{"reference":"fake_1","status":"captured"}`)
+	signature := Sign("secret", payload)
+	assert.True(t, VerifySignature("secret", payload, signature))
+	assert.False(t, VerifySignature("other", payload, signature))
+	assert.False(t, VerifySignature("secret", []byte(`{"reference":"fake_2","status":"captured"}`), signature))
+	assert.False(t, VerifySignature("", payload, Sign("", payload)))
+}
+
+func TestRefund(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	processor := NewProcessor(NewFakeGateway(), store.Reservation, store.Credit)
+
+	paid, err := processor.Checkout(ctx, reserve(t, store, usd("100"), usd("50")), "")
+	require.NoError(t, err)
+	refund, err := types.NewRefund(paid[0].AmountPaid(), usd("25"), types.RefundFeeSchedule, time.Now())
+	require.NoError(t, err)
+	cancelled, err := store.Reservation.CancelReservation(ctx, db.ReservationFilter{Id: paid[0].Id}, refund, nil)
+	require.NoError(t, err)
+	refunded, err := processor.Refund(ctx, cancelled)
+	require.NoError(t, err)
+	assert.Equal(t, types.ReservationRefunded, refunded.Status)
+	assert.Equal(t, types.PaymentRefunded, refunded.Payment.Status)
+	assert.True(t, usd("100").Equal(refunded.Payment.Amount))
+
+	// the rest of the payment can still be refunded, but no more than what was
+	// captured
+	refund, err = types.NewRefund(paid[1].AmountPaid(), usd("0"), types.RefundFreeWindow, time.Now())
+	require.NoError(t, err)
+	cancelled, err = store.Reservation.CancelReservation(ctx, db.ReservationFilter{Id: paid[1].Id}, refund, nil)
+	require.NoError(t, err)
+	refunded, err = processor.Refund(ctx, cancelled)
+	require.NoError(t, err)
+	assert.Equal(t, types.ReservationRefunded, refunded.Status)
+	cancelled.Refund.Amount = usd("25.01")
+	_, err = processor.Refund(ctx, cancelled)
+	assert.Error(t, err)
+
+	// a payment not captured yet is let go, once no other reservation waits
+	// on it
+	pending, err := processor.Checkout(ctx, reserve(t, store, usd("100"), usd("100")), FakeAsyncMethod)
+	require.NoError(t, err)
+	for i, reservation := range pending {
+		cancelled, err := store.Reservation.CancelReservation(ctx, db.ReservationFilter{Id: reservation.Id}, nil, nil)
+		require.NoError(t, err)
+		released, err := processor.Refund(ctx, cancelled)
+		require.NoError(t, err)
+		assert.Equal(t, types.ReservationCancelled, released.Status)
+		expected := []types.PaymentStatus{types.PaymentPending, types.PaymentVoided}[i]
+		assert.Equal(t, expected, released.Payment.Status)
+	}
+
+	// nor is anything refunded of free reservations
+	free, err := processor.Checkout(ctx, reserve(t, store, types.Money{}), "")
+	require.NoError(t, err)
+	cancelled, err = store.Reservation.CancelReservation(ctx, db.ReservationFilter{Id: free[0].Id}, nil, nil)
+	require.NoError(t, err)
+	released, err := processor.Refund(ctx, cancelled)
+	require.NoError(t, err)
+	assert.Equal(t, types.ReservationCancelled, released.Status)
+}
+
+func TestSpendCredit(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	processor := NewProcessor(NewFakeGateway(), store.Reservation, store.Credit)
+	credit, err := store.Credit.CreateCredit(ctx, &types.Credit{Balance: usd("150"), ExpiresAt: time.Now().AddDate(1, 0, 0)})
+	require.NoError(t, err)
+	balance := func() types.Money {
+		fetched, err := store.Credit.GetCredit(ctx, db.CreditFilter{Id: credit.Id})
+		require.NoError(t, err)
+		return fetched.Balance
+	}
+	spend := func(price types.Money) (*types.Reservation, error) {
+		seat, err := store.Seat.CreateSeat(ctx, &types.Seat{Price: price, Available: true})
+		require.NoError(t, err)
+		return store.Reservation.CreateReservation(ctx, db.SeatFilter{Id: seat.Id}, primitive.NewObjectID(), nil, "", &db.Spending{Credit: &db.CreditFilter{Id: credit.Id}})
+	}
+
+	// the credit pays for what it can, the rest is charged
+	reservation, err := spend(usd("100"))
+	require.NoError(t, err)
+	assert.True(t, usd("100").Equal(reservation.Credit.Amount))
+	paid, err := processor.Checkout(ctx, []*types.Reservation{reservation}, "")
+	require.NoError(t, err)
+	assert.Equal(t, types.ReservationConfirmed, paid[0].Status)
+	assert.Nil(t, paid[0].Payment)
+	reservation, err = spend(usd("100"))
+	require.NoError(t, err)
+	assert.True(t, usd("50").Equal(reservation.AmountDue()))
+	assert.True(t, balance().IsZero())
+	_, err = spend(usd("100"))
+	assert.ErrorIs(t, err, types.ErrCreditUnavailable)
+
+	// the credit spent on a reservation is given back when it is cancelled
+	declined, err := processor.Checkout(ctx, []*types.Reservation{reservation}, FakeDeclinedMethod)
+	var declinedErr *DeclinedError
+	require.ErrorAs(t, err, &declinedErr)
+	assert.True(t, usd("50").Equal(balance()))
+	_, err = processor.Refund(ctx, declined[0])
+	require.NoError(t, err)
+	assert.True(t, usd("50").Equal(balance()))
+	cancelled, err := store.Reservation.CancelReservation(ctx, db.ReservationFilter{Id: paid[0].Id}, nil, nil)
+	require.NoError(t, err)
+	_, err = processor.Refund(ctx, cancelled)
+	require.NoError(t, err)
+	assert.True(t, usd("150").Equal(balance()))
+
+	// only the share of the credit the refund gives back is restored
+	reservation, err = spend(usd("200"))
+	require.NoError(t, err)
+	paid, err = processor.Checkout(ctx, []*types.Reservation{reservation}, "")
+	require.NoError(t, err)
+	assert.True(t, usd("50").Equal(paid[0].AmountPaid()))
+	refund, err := types.NewRefund(usd("50"), usd("25"), types.RefundFeeSchedule, time.Now())
+	require.NoError(t, err)
+	cancelled, err = store.Reservation.CancelReservation(ctx, db.ReservationFilter{Id: paid[0].Id}, refund, nil)
+	require.NoError(t, err)
+	refunded, err := processor.Refund(ctx, cancelled)
+	require.NoError(t, err)
+	assert.Equal(t, types.ReservationRefunded, refunded.Status)
+	assert.True(t, usd("75").Equal(balance()), balance())
+}
+
+func TestSeatChange(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	processor := NewProcessor(NewFakeGateway(), store.Reservation, store.Credit)
+
+	// the difference is charged at once, or not at all
+	charge, err := processor.ChargeSeatChange(ctx, usd("30"), "")
+	require.NoError(t, err)
+	assert.Equal(t, types.PaymentCaptured, charge.Status)
+	assert.True(t, usd("30").Equal(charge.Amount))
+	require.NoError(t, processor.RefundSeatChangeCharge(ctx, charge))
+	var declinedErr *DeclinedError
+	_, err = processor.ChargeSeatChange(ctx, usd("30"), FakeDeclinedMethod)
+	assert.ErrorAs(t, err, &declinedErr)
+	_, err = processor.ChargeSeatChange(ctx, usd("30"), FakeAsyncMethod)
+	assert.ErrorAs(t, err, &declinedErr)
+
+	// a cheaper seat is refunded on the payment, no more than was paid
+	paid, err := processor.Checkout(ctx, reserve(t, store, usd("100")), "")
+	require.NoError(t, err)
+	cheaper, err := store.Seat.CreateSeat(ctx, &types.Seat{Price: usd("60"), Available: true})
+	require.NoError(t, err)
+	changed, err := store.Reservation.ChangeSeat(ctx, db.ReservationFilter{Id: paid[0].Id}, db.SeatFilter{Id: cheaper.Id}, nil)
+	require.NoError(t, err)
+	refunded, err := processor.RefundSeatChange(ctx, changed)
+	require.NoError(t, err)
+	assert.Equal(t, types.ReservationConfirmed, refunded.Status)
+	assert.True(t, usd("60").Equal(refunded.AmountPaid()), refunded.AmountPaid())
+	free, err := store.Seat.CreateSeat(ctx, &types.Seat{Price: usd("0"), Available: true})
+	require.NoError(t, err)
+	changed, err = store.Reservation.ChangeSeat(ctx, db.ReservationFilter{Id: paid[0].Id}, db.SeatFilter{Id: free.Id}, nil)
+	require.NoError(t, err)
+	refunded, err = processor.RefundSeatChange(ctx, changed)
+	require.NoError(t, err)
+	assert.True(t, refunded.AmountPaid().IsZero(), refunded.AmountPaid())
+}
+
+func TestExpirePayments(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	gateway := NewFakeGateway()
+	processor := NewProcessor(gateway, store.Reservation, store.Credit)
+	credit, err := store.Credit.CreateCredit(ctx, &types.Credit{Balance: usd("30"), ExpiresAt: time.Now().AddDate(1, 0, 0)})
+	require.NoError(t, err)
+	seat, err := store.Seat.CreateSeat(ctx, &types.Seat{Price: usd("100"), Available: true})
+	require.NoError(t, err)
+	spent, err := store.Reservation.CreateReservation(ctx, db.SeatFilter{Id: seat.Id}, primitive.NewObjectID(), nil, "", &db.Spending{Credit: &db.CreditFilter{Id: credit.Id}})
+	require.NoError(t, err)
+
+	// the payments left pending expire, not the ones the provider decided on
+	pending, err := processor.Checkout(ctx, append(reserve(t, store, usd("100")), spent), FakeAsyncMethod)
+	require.NoError(t, err)
+	settled, err := processor.Checkout(ctx, reserve(t, store, usd("50")), FakeAsyncMethod)
+	require.NoError(t, err)
+	event, err := gateway.Settle(settled[0].Payment.Reference, true)
+	require.NoError(t, err)
+	_, err = processor.HandleEvent(ctx, event)
+	require.NoError(t, err)
+	expiresAt := pending[0].Payment.ExpiresAt
+	assert.WithinDuration(t, time.Now().Add(PendingPaymentTTL), expiresAt, time.Minute)
+
+	expired, err := processor.ExpirePayments(ctx, expiresAt.Add(-time.Second))
+	require.NoError(t, err)
+	assert.Empty(t, expired)
+	expired, err = processor.ExpirePayments(ctx, expiresAt.Add(time.Second))
+	require.NoError(t, err)
+	require.Len(t, expired, 2)
+	for _, reservation := range expired {
+		assert.Equal(t, types.ReservationCancelled, reservation.Status)
+		assert.Equal(t, types.PaymentVoided, reservation.Payment.Status)
+	}
+	available, err := store.Seat.GetSeat(ctx, db.SeatFilter{Id: seat.Id})
+	require.NoError(t, err)
+	assert.True(t, available.Available)
+	restored, err := store.Credit.GetCredit(ctx, db.CreditFilter{Id: credit.Id})
+	require.NoError(t, err)
+	assert.True(t, usd("30").Equal(restored.Balance), restored.Balance)
+	expired, err = processor.ExpirePayments(ctx, expiresAt.Add(time.Second))
+	require.NoError(t, err)
+	assert.Empty(t, expired)
+}
@@ -0,0 +1,50 @@
+package payments
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/fabrizioperria/goflight/types"
+)
+
+// SignatureHeader carries the hex HMAC-SHA256 of the body of a webhook call,
+// keyed with the secret shared with the provider.
+const SignatureHeader = "X-Payment-Signature"
+
+// Event is what a provider tells the webhook about one of its payments.
+type Event struct {
+	Reference string              `json:"reference"`
+	Status    types.PaymentStatus `json:"status"`
+	Reason    string              `json:"reason,omitempty"`
+}
+
+var ErrInvalidEvent = errors.New("invalid payment event")
+
+func (event Event) Validate() error {
+	if event.Reference == "" {
+		return fmt.Errorf("%w: reference is required", ErrInvalidEvent)
+	}
+	switch event.Status {
+	case types.PaymentAuthorized, types.PaymentCaptured, types.PaymentFailed, types.PaymentVoided:
+		return nil
+	}
+	return fmt.Errorf("%w: unexpected status %q", ErrInvalidEvent, event.Status)
+}
+
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature reports whether signature is the one of payload. Nothing is
+// signed with an empty secret.
+func VerifySignature(secret string, payload []byte, signature string) bool {
+	if secret == "" {
+		return false
+	}
+	return hmac.Equal([]byte(Sign(secret, payload)), []byte(signature))
+}
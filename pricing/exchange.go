@@ -0,0 +1,123 @@
+package pricing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/fabrizioperria/goflight/types"
+	"github.com/govalues/decimal"
+	"github.com/govalues/money"
+)
+
+// ExchangeRates converts amounts between currencies for display. The rates
+// are the prices of one unit of Base in the other currencies, such as
+// {"base": "USD", "rates": {"EUR": "0.92"}}, and the conversions between two
+// currencies other than Base go through it.
+type ExchangeRates struct {
+	Base  string                     `json:"base"`
+	Rates map[string]decimal.Decimal `json:"rates"`
+}
+
+// DefaultExchangeRates has no rates, so amounts can only be shown in the
+// currency they are in.
+func DefaultExchangeRates() ExchangeRates {
+	return ExchangeRates{Base: "USD"}
+}
+
+func (rates ExchangeRates) Validate() error {
+	if _, err := money.ParseCurr(rates.Base); err != nil {
+		return fmt.Errorf("base currency %q: %w", rates.Base, err)
+	}
+	for currency, rate := range rates.Rates {
+		if _, err := money.ParseCurr(currency); err != nil {
+			return fmt.Errorf("currency %q: %w", currency, err)
+		}
+		if !rate.IsPos() {
+			return fmt.Errorf("rate of %s must be positive", currency)
+		}
+	}
+	return nil
+}
+
+// rate returns the price of one unit of Base in curr.
+func (rates ExchangeRates) rate(curr money.Currency) (decimal.Decimal, error) {
+	if curr.Code() == rates.Base {
+		return decimal.One, nil
+	}
+	rate, ok := rates.Rates[curr.Code()]
+	if !ok {
+		return decimal.Decimal{}, fmt.Errorf("no exchange rate for %s", curr.Code())
+	}
+	return rate, nil
+}
+
+// Convert returns amount in currency, rounded to its minor unit. Amounts
+// already in currency and unset amounts are returned as they are.
+func (rates ExchangeRates) Convert(amount types.Money, currency string) (types.Money, error) {
+	to, err := money.ParseCurr(currency)
+	if err != nil {
+		return types.Money{}, fmt.Errorf("currency %q: %w", currency, err)
+	}
+	if !amount.IsSet() || amount.Currency() == to.Code() {
+		return amount, nil
+	}
+	from := amount.Amount().Curr()
+	fromRate, err := rates.rate(from)
+	if err != nil {
+		return types.Money{}, err
+	}
+	toRate, err := rates.rate(to)
+	if err != nil {
+		return types.Money{}, err
+	}
+	rate, err := toRate.Quo(fromRate)
+	if err != nil {
+		return types.Money{}, err
+	}
+	exchange, err := money.NewExchRateFromDecimal(from, to, rate)
+	if err != nil {
+		return types.Money{}, err
+	}
+	converted, err := exchange.Conv(amount.Amount())
+	if err != nil {
+		return types.Money{}, err
+	}
+	return types.MoneyFromAmount(converted.RoundToCurr()), nil
+}
+
+// LoadExchangeRates reads a JSON table of rates, written as strings so that
+// they are exact.
+func LoadExchangeRates(path string) (ExchangeRates, error) {
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return ExchangeRates{}, err
+	}
+	rates := ExchangeRates{}
+	decoder := json.NewDecoder(bytes.NewReader(file))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&rates); err != nil {
+		return ExchangeRates{}, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if err := rates.Validate(); err != nil {
+		return ExchangeRates{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return rates, nil
+}
+
+// ExchangeRatesFromEnv loads the rates at EXCHANGE_RATES, falling back to the
+// default ones when it is unset or invalid.
+func ExchangeRatesFromEnv() ExchangeRates {
+	path := os.Getenv("EXCHANGE_RATES")
+	if path == "" {
+		return DefaultExchangeRates()
+	}
+	rates, err := LoadExchangeRates(path)
+	if err != nil {
+		log.Printf("pricing: using the default exchange rates: %v", err)
+		return DefaultExchangeRates()
+	}
+	return rates
+}
@@ -0,0 +1,58 @@
+package pricing
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fabrizioperria/goflight/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExchangeRates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"base": "USD", "rates": {"EUR": "0.8", "JPY": "150"}}`), 0o600))
+	rates, err := LoadExchangeRates(path)
+	require.NoError(t, err)
+
+	conversions := []struct {
+		amount   types.Money
+		currency string
+		expected string
+	}{
+		{usd("10.01"), "USD", "USD 10.01"},
+		{usd("10.01"), "EUR", "EUR 8.01"},
+		{usd("10.01"), "JPY", "JPY 1502"},
+		{types.MustParseMoney("8", "EUR"), "USD", "USD 10.00"},
+		{types.MustParseMoney("8", "EUR"), "JPY", "JPY 1500"},
+		{types.MustParseMoney("3000", "JPY"), "EUR", "EUR 16.00"},
+	}
+	for _, conversion := range conversions {
+		converted, err := rates.Convert(conversion.amount, conversion.currency)
+		require.NoError(t, err)
+		assert.Equal(t, conversion.expected, converted.String(), "%s to %s", conversion.amount, conversion.currency)
+	}
+
+	_, err = rates.Convert(usd("1"), "GBP")
+	assert.Error(t, err)
+	_, err = rates.Convert(types.MustParseMoney("1", "GBP"), "USD")
+	assert.Error(t, err)
+	_, err = rates.Convert(usd("1"), "dollars")
+	assert.Error(t, err)
+	unset, err := rates.Convert(types.Money{}, "EUR")
+	require.NoError(t, err)
+	assert.False(t, unset.IsSet())
+
+	invalid := []string{
+		`{"base": "ABC", "rates": {}}`,
+		`{"base": "USD", "rates": {"EUR": "0"}}`,
+		`{"base": "USD", "rates": {"EUR": 0.8}}`,
+		`{"base": "USD", "rate": {}}`,
+	}
+	for i, content := range invalid {
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		_, err := LoadExchangeRates(path)
+		assert.Error(t, err, i)
+	}
+}
@@ -0,0 +1,93 @@
+package pricing
+
+import (
+	"fmt"
+
+	"github.com/fabrizioperria/goflight/types"
+	"github.com/govalues/decimal"
+)
+
+// Charge is a tax, surcharge or fee paid on top of the price of a seat:
+// either a fixed Amount in the currency of the price, or a Rate of it.
+type Charge struct {
+	Code   string  `json:"code"`
+	Name   string  `json:"name"`
+	Amount float64 `json:"amount,omitempty"`
+	Rate   float64 `json:"rate,omitempty"`
+}
+
+// AirportTaxes are levied by an airport on the passengers departing from and
+// arriving at it.
+type AirportTaxes struct {
+	Departure []Charge `json:"departure,omitempty"`
+	Arrival   []Charge `json:"arrival,omitempty"`
+}
+
+func validateCharges(charges []Charge) error {
+	for _, charge := range charges {
+		if charge.Code == "" {
+			return fmt.Errorf("charge %q has no code", charge.Name)
+		}
+		if charge.Amount < 0 || charge.Rate < 0 || (charge.Amount == 0) == (charge.Rate == 0) {
+			return fmt.Errorf("charge %s must have either a positive amount or a positive rate", charge.Code)
+		}
+	}
+	return nil
+}
+
+// component returns what charge amounts to on top of price.
+func (charge Charge) component(price types.Money) (types.FareComponent, error) {
+	component := types.FareComponent{Code: charge.Code, Name: charge.Name}
+	if charge.Rate != 0 {
+		rate, err := decimal.NewFromFloat64(charge.Rate)
+		if err != nil {
+			return component, err
+		}
+		component.Amount, err = price.Mul(rate)
+		return component, err
+	}
+	amount, err := decimal.NewFromFloat64(charge.Amount)
+	if err != nil {
+		return component, err
+	}
+	component.Amount, err = types.NewMoney(amount, price.Currency())
+	return component, err
+}
+
+func components(charges []Charge, price types.Money) ([]types.FareComponent, error) {
+	components := make([]types.FareComponent, 0, len(charges))
+	for _, charge := range charges {
+		component, err := charge.component(price)
+		if err != nil {
+			return nil, fmt.Errorf("charge %s: %w", charge.Code, err)
+		}
+		components = append(components, component)
+	}
+	return components, nil
+}
+
+// Breakdown adds to price, the price of a seat of flight, the taxes of its
+// departure and arrival airports and the surcharges and fees of its rules.
+// Unset prices have no breakdown.
+func (engine *Engine) Breakdown(flight *types.Flight, price types.Money) (*types.FareBreakdown, error) {
+	if !price.IsSet() {
+		return nil, nil
+	}
+	rules := engine.config.RulesFor(flight)
+
+	charges := append([]Charge{}, engine.config.Taxes[flight.Departure].Departure...)
+	charges = append(charges, engine.config.Taxes[flight.Arrival].Arrival...)
+	taxes, err := components(charges, price)
+	if err != nil {
+		return nil, err
+	}
+	surcharges, err := components(rules.CarrierSurcharges, price)
+	if err != nil {
+		return nil, err
+	}
+	fees, err := components(rules.ServiceFees, price)
+	if err != nil {
+		return nil, err
+	}
+	return types.NewFareBreakdown(price, taxes, surcharges, fees)
+}
@@ -0,0 +1,134 @@
+package pricing
+
+import (
+	"time"
+
+	"github.com/fabrizioperria/goflight/types"
+	"github.com/govalues/decimal"
+	"github.com/govalues/money"
+)
+
+// Demand is what the price of a seat depends on besides the flight and the
+// seat themselves.
+type Demand struct {
+	Now time.Time
+	// LoadFactor is the share of the seats of the flight already sold or
+	// held, between 0 and 1.
+	LoadFactor float64
+}
+
+// Pricer prices the seats of flights.
+type Pricer interface {
+	Price(flight *types.Flight, seat *types.Seat, demand Demand) (types.Money, error)
+	// Breakdown adds the taxes, surcharges and fees of flight to the price
+	// of one of its seats.
+	Breakdown(flight *types.Flight, price types.Money) (*types.FareBreakdown, error)
+}
+
+// Engine is the Pricer applying the rules of a Config.
+type Engine struct {
+	config Config
+}
+
+func NewEngine(config Config) *Engine {
+	return &Engine{
+		config: config,
+	}
+}
+
+// Price computes the fare with decimals, taking the numbers of the rules as
+// they are written, so that 1.2 is 1.2 rather than the closest binary
+// fraction, and rounds it to the minor unit of the currency of the rules.
+func (engine *Engine) Price(flight *types.Flight, seat *types.Seat, demand Demand) (types.Money, error) {
+	rules := engine.config.RulesFor(flight)
+
+	daysToDeparture := int(flight.DepartureTime.Sub(demand.Now).Hours() / 24)
+	factors := []float64{
+		rules.BaseFare,
+		rules.ClassMultipliers.For(seat.Class),
+		rules.advanceMultiplier(daysToDeparture),
+		rules.loadMultiplier(demand.LoadFactor),
+	}
+	surcharges := []float64{}
+	switch seat.Location {
+	case types.Window:
+		surcharges = append(surcharges, rules.Surcharges.Window)
+	case types.Aisle:
+		surcharges = append(surcharges, rules.Surcharges.Aisle)
+	}
+	if seat.ExitRow {
+		surcharges = append(surcharges, rules.Surcharges.ExitRow)
+	}
+
+	fare := decimal.One
+	for _, factor := range factors {
+		d, err := decimal.NewFromFloat64(factor)
+		if err != nil {
+			return types.Money{}, err
+		}
+		if fare, err = fare.Mul(d); err != nil {
+			return types.Money{}, err
+		}
+	}
+	for _, surcharge := range surcharges {
+		d, err := decimal.NewFromFloat64(surcharge)
+		if err != nil {
+			return types.Money{}, err
+		}
+		if fare, err = fare.Add(d); err != nil {
+			return types.Money{}, err
+		}
+	}
+
+	curr, err := money.ParseCurr(rules.Currency)
+	if err != nil {
+		return types.Money{}, err
+	}
+	price, err := money.NewAmountFromDecimal(curr, fare)
+	if err != nil {
+		return types.Money{}, err
+	}
+	return types.MoneyFromAmount(price.RoundToCurr()), nil
+}
+
+// LoadFactor returns the share of seats that are not available at now.
+func LoadFactor(seats []*types.Seat, now time.Time) float64 {
+	if len(seats) == 0 {
+		return 0
+	}
+	sold := 0
+	for _, seat := range seats {
+		if !seat.IsAvailable(now) {
+			sold++
+		}
+	}
+	return float64(sold) / float64(len(seats))
+}
+
+// PriceSeats sets the price and the fare of the available seats of flight,
+// which are all the seats of the flight. It returns the seats whose price or
+// fare changed. The seats that are sold or held keep the ones they were taken
+// at.
+func PriceSeats(pricer Pricer, flight *types.Flight, seats []*types.Seat, now time.Time) ([]*types.Seat, error) {
+	demand := Demand{Now: now, LoadFactor: LoadFactor(seats, now)}
+	changed := []*types.Seat{}
+	for _, seat := range seats {
+		if !seat.IsAvailable(now) {
+			continue
+		}
+		price, err := pricer.Price(flight, seat, demand)
+		if err != nil {
+			return nil, err
+		}
+		fare, err := pricer.Breakdown(flight, price)
+		if err != nil {
+			return nil, err
+		}
+		if !price.Equal(seat.Price) || !fare.Equal(seat.Fare) {
+			seat.Price = price
+			seat.Fare = fare
+			changed = append(changed, seat)
+		}
+	}
+	return changed, nil
+}
@@ -0,0 +1,243 @@
+package pricing
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fabrizioperria/goflight/db"
+	"github.com/fabrizioperria/goflight/db/memory"
+	"github.com/fabrizioperria/goflight/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var now = time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func testConfig() Config {
+	return Config{
+		Default: Rules{
+			Currency:         "USD",
+			BaseFare:         100,
+			ClassMultipliers: &ClassMultipliers{Economy: 1, Business: 3, First: 5},
+			Surcharges:       &Surcharges{Window: 10, Aisle: 5, ExitRow: 20},
+			AdvanceTiers:     []AdvanceTier{{MinDays: 7, Multiplier: 1.2}, {MinDays: 30, Multiplier: 1}, {MinDays: 0, Multiplier: 1.5}},
+			LoadTiers:        []LoadTier{{MinLoadFactor: 0.5, Multiplier: 1.1}, {MinLoadFactor: 0.9, Multiplier: 1.5}},
+		},
+		Airlines: map[string]Rules{"Budget": {BaseFare: 50}, "Euro": {Currency: "EUR", BaseFare: 80.1}},
+		Routes:   map[string]Rules{"JFK-LAX": {Surcharges: &Surcharges{}}},
+	}
+}
+
+func usd(amount string) types.Money {
+	return types.MustParseMoney(amount, "USD")
+}
+
+func flightIn(days int, airline string) *types.Flight {
+	return &types.Flight{
+		Airline:       airline,
+		Departure:     "JFK",
+		Arrival:       "SFO",
+		DepartureTime: now.Add(time.Duration(days)*24*time.Hour + time.Hour),
+	}
+}
+
+func TestEnginePrice(t *testing.T) {
+	engine := NewEngine(testConfig())
+	middle := &types.Seat{Class: types.Economy, Location: types.Middle}
+
+	prices := []struct {
+		name     string
+		flight   *types.Flight
+		seat     *types.Seat
+		load     float64
+		expected types.Money
+	}{
+		{"base", flightIn(60, "Delta"), middle, 0, usd("100")},
+		{"business", flightIn(60, "Delta"), &types.Seat{Class: types.Business, Location: types.Middle}, 0, usd("300")},
+		{"window", flightIn(60, "Delta"), &types.Seat{Class: types.Economy, Location: types.Window}, 0, usd("110")},
+		{"aisle exit row", flightIn(60, "Delta"), &types.Seat{Class: types.First, Location: types.Aisle, ExitRow: true}, 0, usd("525")},
+		{"two weeks ahead", flightIn(14, "Delta"), middle, 0, usd("120")},
+		{"last minute", flightIn(2, "Delta"), middle, 0, usd("150")},
+		{"half full", flightIn(60, "Delta"), middle, 0.5, usd("110")},
+		{"almost full, last minute", flightIn(0, "Delta"), middle, 0.95, usd("225")},
+		{"airline", flightIn(60, "Budget"), &types.Seat{Class: types.Economy, Location: types.Window}, 0, usd("60")},
+		{"route", &types.Flight{Airline: "Budget", Departure: "JFK", Arrival: "LAX", DepartureTime: now.AddDate(0, 1, 1)}, &types.Seat{Class: types.Economy, Location: types.Window}, 0, usd("50")},
+		{"exact decimals", flightIn(14, "Euro"), &types.Seat{Class: types.Business, Location: types.Middle}, 0.5, types.MustParseMoney("317.20", "EUR")},
+	}
+	for _, p := range prices {
+		price, err := engine.Price(p.flight, p.seat, Demand{Now: now, LoadFactor: p.load})
+		require.NoError(t, err, p.name)
+		assert.Equal(t, p.expected, price, p.name)
+	}
+}
+
+func TestBreakdown(t *testing.T) {
+	config := testConfig()
+	config.Default.ServiceFees = []Charge{{Code: "OB", Name: "Booking fee", Amount: 7.5}}
+	config.Airlines["Delta"] = Rules{CarrierSurcharges: []Charge{{Code: "YQ", Name: "Fuel surcharge", Rate: 0.1}}}
+	config.Routes["JFK-LAX"] = Rules{ServiceFees: []Charge{}}
+	config.Taxes = map[string]AirportTaxes{
+		"JFK": {
+			Departure: []Charge{{Code: "US", Name: "Transportation tax", Rate: 0.075}, {Code: "XF", Name: "Facility charge", Amount: 4.5}},
+			Arrival:   []Charge{{Code: "XA", Name: "Inspection fee", Amount: 3.96}},
+		},
+		"SFO": {Departure: []Charge{{Code: "XF", Name: "Facility charge", Amount: 4.5}}},
+	}
+	engine := NewEngine(config)
+
+	fare, err := engine.Breakdown(flightIn(60, "Delta"), usd("199.99"))
+	require.NoError(t, err)
+	assert.Equal(t, usd("199.99"), fare.BaseFare)
+	assert.Equal(t, []types.FareComponent{
+		{Code: "US", Name: "Transportation tax", Amount: usd("15.00")},
+		{Code: "XF", Name: "Facility charge", Amount: usd("4.50")},
+	}, fare.Taxes)
+	assert.Equal(t, []types.FareComponent{{Code: "YQ", Name: "Fuel surcharge", Amount: usd("20.00")}}, fare.Surcharges)
+	assert.Equal(t, []types.FareComponent{{Code: "OB", Name: "Booking fee", Amount: usd("7.50")}}, fare.Fees)
+	assert.Equal(t, usd("246.99"), fare.Total)
+
+	// the route has no service fees, and the taxes of both airports apply
+	fare, err = engine.Breakdown(&types.Flight{Airline: "Budget", Departure: "JFK", Arrival: "LAX"}, usd("100"))
+	require.NoError(t, err)
+	assert.Len(t, fare.Taxes, 2)
+	assert.Empty(t, fare.Surcharges)
+	assert.Empty(t, fare.Fees)
+	assert.Equal(t, usd("112.00"), fare.Total)
+	fare, err = engine.Breakdown(&types.Flight{Airline: "Budget", Departure: "SFO", Arrival: "JFK"}, usd("100"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"XF", "XA"}, []string{fare.Taxes[0].Code, fare.Taxes[1].Code})
+	assert.Equal(t, usd("115.96"), fare.Total)
+
+	fare, err = engine.Breakdown(flightIn(60, "Delta"), types.Money{})
+	require.NoError(t, err)
+	assert.Nil(t, fare)
+}
+
+func TestPriceSeats(t *testing.T) {
+	engine := NewEngine(testConfig())
+	flight := flightIn(60, "Delta")
+	seats := []*types.Seat{}
+	for i := 0; i < 4; i++ {
+		seats = append(seats, &types.Seat{Id: primitive.NewObjectID(), Class: types.Economy, Location: types.Middle, Available: true, Price: usd("100")})
+	}
+	seats[0].Available = false
+	seats[0].Price = usd("70")
+	seats[1].Available = false
+	seats[1].Price = usd("80")
+
+	// half of the seats are taken, which the available ones pay for
+	changed, err := PriceSeats(engine, flight, seats, now)
+	require.NoError(t, err)
+	assert.Len(t, changed, 2)
+	assert.Equal(t, []types.Money{usd("70"), usd("80"), usd("110"), usd("110")}, []types.Money{seats[0].Price, seats[1].Price, seats[2].Price, seats[3].Price})
+	assert.Equal(t, usd("110"), seats[2].Fare.Total)
+	assert.Nil(t, seats[0].Fare)
+	changed, err = PriceSeats(engine, flight, seats, now)
+	require.NoError(t, err)
+	assert.Empty(t, changed)
+
+	// new fees change the fares but not the prices
+	config := testConfig()
+	config.Default.ServiceFees = []Charge{{Code: "OB", Name: "Booking fee", Amount: 5}}
+	changed, err = PriceSeats(NewEngine(config), flight, seats, now)
+	require.NoError(t, err)
+	assert.Len(t, changed, 2)
+	assert.Equal(t, usd("110"), seats[2].Price)
+	assert.Equal(t, usd("115"), seats[2].Fare.Total)
+}
+
+func TestRepricer(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	engine := NewEngine(testConfig())
+
+	upcoming := flightIn(60, "Delta")
+	_, err := store.Flight.CreateFlightWithSeats(ctx, upcoming, types.GenericSeatMap(primitive.NilObjectID, 4))
+	require.NoError(t, err)
+	departed := flightIn(-1, "Delta")
+	_, err = store.Flight.CreateFlightWithSeats(ctx, departed, types.GenericSeatMap(primitive.NilObjectID, 2))
+	require.NoError(t, err)
+
+	repricer := NewRepricer(store.Flight, store.Seat, engine)
+	repriced, err := repricer.Reprice(ctx, now)
+	require.NoError(t, err)
+	assert.Equal(t, 4, repriced)
+
+	user, err := store.User.CreateUser(ctx, &types.User{Email: "fp@test.com"})
+	require.NoError(t, err)
+	for _, seatId := range upcoming.Seats[:2] {
+		reservation, err := store.Reservation.CreateReservation(ctx, db.SeatFilter{Id: seatId}, user.Id, nil, "", nil)
+		require.NoError(t, err)
+		assert.True(t, reservation.Price.IsPos())
+	}
+
+	// the flight is now half full
+	repriced, err = repricer.Reprice(ctx, now)
+	require.NoError(t, err)
+	assert.Equal(t, 2, repriced)
+	seats, err := store.Seat.GetSeats(ctx, db.SeatFilter{FlightId: upcoming.Id}, &db.Pagination{})
+	require.NoError(t, err)
+	for _, seat := range seats {
+		// the reserved seats keep the price of an empty flight
+		demand := Demand{Now: now}
+		if seat.Available {
+			demand.LoadFactor = 0.5
+		}
+		price, err := engine.Price(upcoming, seat, demand)
+		require.NoError(t, err)
+		assert.Equal(t, price, seat.Price, seat.Number)
+	}
+
+	untouched, err := store.Seat.GetSeats(ctx, db.SeatFilter{FlightId: departed.Id}, &db.Pagination{})
+	require.NoError(t, err)
+	for _, seat := range untouched {
+		assert.False(t, seat.Price.IsSet())
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+
+	config, err := LoadConfig(write("partial.json", `{"default": {"base_fare": 80}, "routes": {"JFK-LAX": {"load_tiers": []}}}`))
+	require.NoError(t, err)
+	assert.Equal(t, 80.0, config.Default.BaseFare)
+	assert.Equal(t, DefaultConfig().Default.Surcharges, config.Default.Surcharges)
+	assert.Empty(t, config.RulesFor(&types.Flight{Departure: "JFK", Arrival: "LAX"}).LoadTiers)
+
+	invalid := []string{
+		`{"default": {"base_fare": -1}}`,
+		`{"airlines": {"Delta": {"class_multipliers": {"economy": 1}}}}`,
+		`{"routes": {"JFK-LAX": {"load_tiers": [{"min_load_factor": 2, "multiplier": 1}]}}}`,
+		`{"defaults": {}}`,
+		`{"airlines": {"Delta": {"currency": "ABC"}}}`,
+		`{"default": {"service_fees": [{"code": "OB", "amount": 5, "rate": 0.1}]}}`,
+		`{"routes": {"JFK-LAX": {"carrier_surcharges": [{"name": "Fuel", "rate": 0.1}]}}}`,
+		`{"taxes": {"JFK": {"departure": [{"code": "US", "amount": -1}]}}}`,
+		`{"taxes": {"New York": {}}}`,
+		`{"default": {"cancellation": {"free_window_hours": -1}}}`,
+		`{"airlines": {"Delta": {"cancellation": {"tiers": [{"min_days": 7, "rate": "1.5"}]}}}}`,
+		`{"airlines": {"Delta": {"cancellation": {"tiers": [{"min_days": 7, "fee": {"amount": "50", "currency": "EUR"}}]}}}}`,
+		`{"airlines": {"Delta": {"currency": "EUR"}}}`,
+		`{"default": {"denied_boarding": {"credit_validity_days": 365, "tiers": [{"min_miles": 0, "rate": "2", "min": {"amount": "500", "currency": "USD"}, "max": {"amount": "100", "currency": "USD"}}]}}}`,
+		`{"default": {"cancellation": {"credit_validity_days": -30}}}`,
+	}
+	for i, content := range invalid {
+		_, err := LoadConfig(write("invalid.json", content))
+		assert.Error(t, err, i)
+	}
+	_, err = LoadConfig(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+
+	config, err = LoadConfig(filepath.Join("..", "pricing.example.json"))
+	require.NoError(t, err)
+	assert.NotEmpty(t, config.Taxes)
+}
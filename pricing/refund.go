@@ -0,0 +1,291 @@
+package pricing
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/fabrizioperria/goflight/types"
+	"github.com/govalues/decimal"
+)
+
+// CancellationTier applies to the reservations cancelled at least MinDays
+// days before the departure. It keeps a fixed Fee, in the currency of the
+// rules, plus a Rate of the refundable part of what was paid.
+type CancellationTier struct {
+	MinDays int             `json:"min_days"`
+	Fee     types.Money     `json:"fee"`
+	Rate    decimal.Decimal `json:"rate"`
+}
+
+// CancellationPolicy decides how much of what was paid for a reservation is
+// refunded when it is cancelled. The reservations cancelled within
+// FreeWindowHours of being made are refunded in full. Past that, the
+// non-refundable fares, such as basic economy, keep everything but the
+// taxes, and the other fares keep the fee of the first matching tier. The
+// cancellations matching no tier, such as after the departure, keep
+// everything but the taxes too. The airport taxes are always refunded.
+// What the non-refundable fares keep is given back as a credit valid for
+// CreditValidityDays instead, when set.
+type CancellationPolicy struct {
+	FreeWindowHours    int                `json:"free_window_hours"`
+	NonRefundable      bool               `json:"non_refundable,omitempty"`
+	CreditValidityDays int                `json:"credit_validity_days,omitempty"`
+	Tiers              []CancellationTier `json:"tiers,omitempty"`
+}
+
+// validate checks the policy of rules in currency.
+func (policy CancellationPolicy) validate(currency string) error {
+	if policy.FreeWindowHours < 0 {
+		return fmt.Errorf("free window must not be negative")
+	}
+	if policy.CreditValidityDays < 0 {
+		return fmt.Errorf("credit validity must not be negative")
+	}
+	for _, tier := range policy.Tiers {
+		if tier.MinDays < 0 || tier.Fee.IsNeg() || tier.Rate.IsNeg() || tier.Rate.Cmp(decimal.One) > 0 {
+			return fmt.Errorf("invalid cancellation tier %+v", tier)
+		}
+		if tier.Fee.IsSet() && tier.Fee.Currency() != currency {
+			return fmt.Errorf("cancellation fee %s must be in %s", tier.Fee, currency)
+		}
+	}
+	return nil
+}
+
+// sorted returns the policy with the tiers from the most to the least
+// demanding, the order they are matched in.
+func (policy CancellationPolicy) sorted() *CancellationPolicy {
+	policy.Tiers = slices.Clone(policy.Tiers)
+	slices.SortFunc(policy.Tiers, func(a, b CancellationTier) int { return b.MinDays - a.MinDays })
+	return &policy
+}
+
+func (policy CancellationPolicy) tier(days int) (CancellationTier, bool) {
+	for _, tier := range policy.Tiers {
+		if days >= tier.MinDays {
+			return tier, true
+		}
+	}
+	return CancellationTier{}, false
+}
+
+// fee returns what the tier keeps out of refundable, at most all of it. The
+// fixed fee cannot be kept out of an amount in another currency.
+func (tier CancellationTier) fee(refundable types.Money) (types.Money, error) {
+	share, err := refundable.Mul(tier.Rate)
+	if err != nil {
+		return types.Money{}, err
+	}
+	fee, err := share.Add(tier.Fee)
+	if err != nil {
+		return types.Money{}, err
+	}
+	if cmp, err := fee.Cmp(refundable); err != nil || cmp <= 0 {
+		return fee, err
+	}
+	return refundable, nil
+}
+
+// CompensationTier applies to the flights of at least MinMiles. It gives a
+// Rate of the base fare, no less than Min and no more than Max when set, in
+// the currency of the rules.
+type CompensationTier struct {
+	MinMiles int             `json:"min_miles"`
+	Rate     decimal.Decimal `json:"rate"`
+	Min      types.Money     `json:"min"`
+	Max      types.Money     `json:"max"`
+}
+
+// DeniedBoardingPolicy decides how the passengers left behind by an
+// overbooked flight are compensated. They are refunded in full, and given a
+// credit valid for CreditValidityDays of what the first matching tier says.
+// The flights matching no tier give no credit.
+type DeniedBoardingPolicy struct {
+	CreditValidityDays int                `json:"credit_validity_days"`
+	Tiers              []CompensationTier `json:"tiers,omitempty"`
+}
+
+// validate checks the policy of rules in currency.
+func (policy DeniedBoardingPolicy) validate(currency string) error {
+	if policy.CreditValidityDays <= 0 {
+		return fmt.Errorf("credit validity must be positive")
+	}
+	for _, tier := range policy.Tiers {
+		if tier.MinMiles < 0 || tier.Rate.IsNeg() || tier.Min.IsNeg() || tier.Max.IsNeg() {
+			return fmt.Errorf("invalid compensation tier %+v", tier)
+		}
+		for _, bound := range []types.Money{tier.Min, tier.Max} {
+			if bound.IsSet() && bound.Currency() != currency {
+				return fmt.Errorf("compensation bound %s must be in %s", bound, currency)
+			}
+		}
+		if tier.Min.IsSet() && tier.Max.IsSet() {
+			if cmp, err := tier.Max.Cmp(tier.Min); err != nil || cmp < 0 {
+				return fmt.Errorf("invalid compensation tier %+v", tier)
+			}
+		}
+	}
+	return nil
+}
+
+// sorted returns the policy with the tiers from the longest to the shortest
+// flights, the order they are matched in.
+func (policy DeniedBoardingPolicy) sorted() *DeniedBoardingPolicy {
+	policy.Tiers = slices.Clone(policy.Tiers)
+	slices.SortFunc(policy.Tiers, func(a, b CompensationTier) int { return b.MinMiles - a.MinMiles })
+	return &policy
+}
+
+func (policy DeniedBoardingPolicy) tier(miles int) (CompensationTier, bool) {
+	for _, tier := range policy.Tiers {
+		if miles >= tier.MinMiles {
+			return tier, true
+		}
+	}
+	return CompensationTier{}, false
+}
+
+// compensation returns what the tier gives for a base fare of base. The
+// bounds cannot apply to a base fare in another currency.
+func (tier CompensationTier) compensation(base types.Money) (types.Money, error) {
+	amount, err := base.Mul(tier.Rate)
+	if err != nil {
+		return types.Money{}, err
+	}
+	if tier.Min.IsSet() {
+		if cmp, err := amount.Cmp(tier.Min); err != nil || cmp < 0 {
+			return tier.Min, err
+		}
+	}
+	if tier.Max.IsSet() {
+		if cmp, err := amount.Cmp(tier.Max); err != nil || cmp > 0 {
+			return tier.Max, err
+		}
+	}
+	return amount, nil
+}
+
+// Refunder decides what is refunded of a reservation cancelled at now, and
+// the credit issued for what is not, and how the passengers denied boarding
+// are compensated.
+type Refunder interface {
+	Refund(flight *types.Flight, reservation *types.Reservation, now time.Time) (*types.Refund, error)
+	Credit(flight *types.Flight, reservation *types.Reservation, refund *types.Refund, now time.Time) *types.Credit
+	Compensate(flight *types.Flight, reservation *types.Reservation, miles int, now time.Time) (*types.Refund, *types.Credit, error)
+}
+
+// Refund applies the cancellation policy of the rules of flight to what is
+// refundable of reservation. The reservations that were not paid for, in
+// money or credit, have no refund.
+func (engine *Engine) Refund(flight *types.Flight, reservation *types.Reservation, now time.Time) (*types.Refund, error) {
+	paid := reservation.AmountRefundable()
+	if !paid.IsPos() {
+		return nil, nil
+	}
+	policy := engine.config.RulesFor(flight).Cancellation
+	if policy == nil {
+		policy = &CancellationPolicy{}
+	}
+
+	taxes := types.Money{}
+	if reservation.Fare != nil {
+		var err error
+		for _, tax := range reservation.Fare.Taxes {
+			if taxes, err = taxes.Add(tax.Amount); err != nil {
+				return nil, err
+			}
+		}
+	}
+	// the fare may have been paid in another currency than it was priced in
+	if taxes.Currency() != paid.Currency() {
+		taxes = types.Money{}
+	}
+	refundable, err := paid.Sub(taxes)
+	if err != nil {
+		return nil, err
+	}
+
+	free := now.Sub(reservation.ReservationDate) < time.Duration(policy.FreeWindowHours)*time.Hour
+	daysToDeparture := int(flight.DepartureTime.Sub(now).Hours() / 24)
+	tier, ok := policy.tier(daysToDeparture)
+	switch {
+	case free:
+		return types.NewRefund(paid, zero(paid), types.RefundFreeWindow, now)
+	case policy.NonRefundable:
+		return types.NewRefund(paid, refundable, types.RefundNonRefundable, now)
+	case !ok || flight.DepartureTime.Before(now):
+		return types.NewRefund(paid, refundable, types.RefundFeeSchedule, now)
+	}
+	fee, err := tier.fee(refundable)
+	if err != nil {
+		return nil, err
+	}
+	return types.NewRefund(paid, fee, types.RefundFeeSchedule, now)
+}
+
+// Credit returns the credit for the fee kept by refund when reservation is
+// cancelled at now, owned by the user of reservation. Only the
+// non-refundable fares are given credit, when their policy says for how
+// long.
+func (engine *Engine) Credit(flight *types.Flight, reservation *types.Reservation, refund *types.Refund, now time.Time) *types.Credit {
+	policy := engine.config.RulesFor(flight).Cancellation
+	if policy == nil || policy.CreditValidityDays == 0 || refund == nil || refund.Policy != types.RefundNonRefundable || !refund.Fee.IsPos() {
+		return nil
+	}
+	return &types.Credit{
+		UserId:      reservation.UserId,
+		Balance:     refund.Fee,
+		ExpiresAt:   now.AddDate(0, 0, policy.CreditValidityDays).UTC(),
+		IssuedFor:   reservation.Id,
+		CreatedAt:   now.UTC(),
+		Redemptions: []types.CreditRedemption{},
+	}
+}
+
+// Compensate applies the denied boarding policy of the rules of flight, of
+// miles, to reservation denied boarding at now. Everything paid for it is
+// refunded, when anything was, and the credit is owned by the user of
+// reservation. Without a policy, or a tier for the flight, there is no
+// credit.
+func (engine *Engine) Compensate(flight *types.Flight, reservation *types.Reservation, miles int, now time.Time) (*types.Refund, *types.Credit, error) {
+	var refund *types.Refund
+	if paid := reservation.AmountPaid(); paid.IsPos() {
+		var err error
+		if refund, err = types.NewRefund(paid, zero(paid), types.RefundDeniedBoarding, now); err != nil {
+			return nil, nil, err
+		}
+	}
+	policy := engine.config.RulesFor(flight).DeniedBoarding
+	if policy == nil {
+		return refund, nil, nil
+	}
+	tier, ok := policy.tier(miles)
+	if !ok {
+		return refund, nil, nil
+	}
+	amount, err := tier.compensation(reservation.BaseFare())
+	if err != nil {
+		return nil, nil, err
+	}
+	if !amount.IsPos() {
+		return refund, nil, nil
+	}
+	return refund, &types.Credit{
+		UserId:      reservation.UserId,
+		Balance:     amount,
+		ExpiresAt:   now.AddDate(0, 0, policy.CreditValidityDays).UTC(),
+		IssuedFor:   reservation.Id,
+		CreatedAt:   now.UTC(),
+		Redemptions: []types.CreditRedemption{},
+	}, nil
+}
+
+// zero returns no amount in the currency of m.
+func zero(m types.Money) types.Money {
+	z, err := types.NewMoney(decimal.Zero, m.Currency())
+	if err != nil {
+		return types.Money{}
+	}
+	return z
+}
@@ -0,0 +1,172 @@
+package pricing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fabrizioperria/goflight/types"
+	"github.com/govalues/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRefund(t *testing.T) {
+	config := testConfig()
+	config.Default.Cancellation = &CancellationPolicy{
+		FreeWindowHours: 24,
+		Tiers:           []CancellationTier{{MinDays: 0, Fee: usd("50"), Rate: decimal.MustParse("0.5")}, {MinDays: 30}, {MinDays: 7, Fee: usd("50")}},
+	}
+	config.Airlines["Budget"] = Rules{Cancellation: &CancellationPolicy{FreeWindowHours: 24, NonRefundable: true, CreditValidityDays: 365}}
+	config.Routes["JFK-LAX"] = Rules{Cancellation: &CancellationPolicy{Tiers: []CancellationTier{{MinDays: 0, Fee: usd("500")}}}}
+	engine := NewEngine(config)
+
+	paid := func(bookedBefore time.Duration) *types.Reservation {
+		return &types.Reservation{
+			ReservationDate: now.Add(-bookedBefore),
+			Price:           usd("170"),
+			Fare:            &types.FareBreakdown{Taxes: []types.FareComponent{{Code: "US", Amount: usd("15")}}, Total: usd("200")},
+			Payment:         &types.Payment{Status: types.PaymentCaptured, Amount: usd("200")},
+		}
+	}
+	lastWeek := paid(7 * 24 * time.Hour)
+	refunds := []struct {
+		name        string
+		flight      *types.Flight
+		reservation *types.Reservation
+		amount      types.Money
+		policy      types.RefundPolicy
+	}{
+		{"well ahead", flightIn(60, "Delta"), lastWeek, usd("200"), types.RefundFeeSchedule},
+		{"two weeks ahead", flightIn(14, "Delta"), lastWeek, usd("150"), types.RefundFeeSchedule},
+		{"last minute", flightIn(2, "Delta"), lastWeek, usd("57.50"), types.RefundFeeSchedule},
+		{"just booked", flightIn(2, "Delta"), paid(time.Hour), usd("200"), types.RefundFreeWindow},
+		{"non-refundable", flightIn(60, "Budget"), lastWeek, usd("15"), types.RefundNonRefundable},
+		{"non-refundable just booked", flightIn(60, "Budget"), paid(time.Hour), usd("200"), types.RefundFreeWindow},
+		{"departed", &types.Flight{Airline: "Delta", DepartureTime: now.Add(-time.Hour)}, lastWeek, usd("15"), types.RefundFeeSchedule},
+		{"fee above the fare", &types.Flight{Departure: "JFK", Arrival: "LAX", DepartureTime: now.AddDate(0, 1, 0)}, lastWeek, usd("15"), types.RefundFeeSchedule},
+	}
+	for _, r := range refunds {
+		refund, err := engine.Refund(r.flight, r.reservation, now)
+		require.NoError(t, err, r.name)
+		assert.True(t, r.amount.Equal(refund.Amount), "%s: %s", r.name, refund.Amount)
+		fee, err := usd("200").Sub(r.amount)
+		require.NoError(t, err)
+		assert.True(t, fee.Equal(refund.Fee), "%s: %s", r.name, refund.Fee)
+		assert.Equal(t, r.policy, refund.Policy, r.name)
+		assert.Equal(t, now, refund.CreatedAt, r.name)
+	}
+
+	// nothing is refunded of what was not paid
+	pending := paid(7 * 24 * time.Hour)
+	pending.Payment.Status = types.PaymentPending
+	refund, err := engine.Refund(flightIn(60, "Delta"), pending, now)
+	require.NoError(t, err)
+	assert.Nil(t, refund)
+	refund, err = engine.Refund(flightIn(60, "Delta"), &types.Reservation{Price: usd("100")}, now)
+	require.NoError(t, err)
+	assert.Nil(t, refund)
+
+	// the policy applies to the credit spent when nothing was charged
+	credited := paid(7 * 24 * time.Hour)
+	credited.Payment = nil
+	credited.Credit = &types.CreditRedemption{Amount: usd("200")}
+	refund, err = engine.Refund(flightIn(14, "Delta"), credited, now)
+	require.NoError(t, err)
+	require.NotNil(t, refund)
+	assert.True(t, usd("150").Equal(refund.Amount), refund.Amount)
+	assert.True(t, usd("50").Equal(refund.Fee), refund.Fee)
+}
+
+func TestCredit(t *testing.T) {
+	config := testConfig()
+	config.Default.Cancellation = &CancellationPolicy{NonRefundable: true}
+	config.Airlines["Budget"] = Rules{Cancellation: &CancellationPolicy{NonRefundable: true, CreditValidityDays: 365}}
+	engine := NewEngine(config)
+	reservation := &types.Reservation{
+		Id:      primitive.NewObjectID(),
+		UserId:  primitive.NewObjectID(),
+		Fare:    &types.FareBreakdown{Taxes: []types.FareComponent{{Code: "US", Amount: usd("15")}}, Total: usd("200")},
+		Payment: &types.Payment{Status: types.PaymentCaptured, Amount: usd("200")},
+	}
+
+	// what a non-refundable fare keeps is given back as credit
+	budget := flightIn(60, "Budget")
+	refund, err := engine.Refund(budget, reservation, now)
+	require.NoError(t, err)
+	credit := engine.Credit(budget, reservation, refund, now)
+	require.NotNil(t, credit)
+	assert.True(t, usd("185").Equal(credit.Balance), credit.Balance)
+	assert.Equal(t, reservation.UserId, credit.UserId)
+	assert.Equal(t, reservation.Id, credit.IssuedFor)
+	assert.Equal(t, now.AddDate(1, 0, 0), credit.ExpiresAt)
+
+	// unless the policy gives no credit
+	delta := flightIn(60, "Delta")
+	refund, err = engine.Refund(delta, reservation, now)
+	require.NoError(t, err)
+	assert.Nil(t, engine.Credit(delta, reservation, refund, now))
+	// nor do the refunds of the other fares
+	refund, err = types.NewRefund(usd("200"), usd("50"), types.RefundFeeSchedule, now)
+	require.NoError(t, err)
+	assert.Nil(t, engine.Credit(budget, reservation, refund, now))
+	assert.Nil(t, engine.Credit(budget, reservation, nil, now))
+}
+
+func TestCompensate(t *testing.T) {
+	config := testConfig()
+	config.Default.DeniedBoarding = &DeniedBoardingPolicy{
+		CreditValidityDays: 365,
+		Tiers:              []CompensationTier{{MinMiles: 0, Rate: decimal.MustParse("2"), Max: usd("150")}, {MinMiles: 1000, Rate: decimal.MustParse("4"), Min: usd("500")}},
+	}
+	config.Airlines["Budget"] = Rules{DeniedBoarding: &DeniedBoardingPolicy{CreditValidityDays: 30, Tiers: []CompensationTier{{MinMiles: 500, Rate: decimal.One}}}}
+	engine := NewEngine(config)
+	reservation := &types.Reservation{
+		Id:      primitive.NewObjectID(),
+		UserId:  primitive.NewObjectID(),
+		Fare:    &types.FareBreakdown{BaseFare: usd("100"), Taxes: []types.FareComponent{{Code: "US", Amount: usd("15")}}, Total: usd("200")},
+		Payment: &types.Payment{Status: types.PaymentCaptured, Amount: usd("200")},
+	}
+
+	compensations := []struct {
+		name   string
+		flight *types.Flight
+		miles  int
+		credit types.Money
+	}{
+		{"short flight, at most the max", flightIn(1, "Delta"), 400, usd("150")},
+		{"long flight, at least the min", flightIn(1, "Delta"), 2500, usd("500")},
+		{"airline policy", flightIn(1, "Budget"), 800, usd("100")},
+	}
+	for _, c := range compensations {
+		refund, credit, err := engine.Compensate(c.flight, reservation, c.miles, now)
+		require.NoError(t, err, c.name)
+		// everything paid is refunded
+		assert.True(t, usd("200").Equal(refund.Amount), "%s: %s", c.name, refund.Amount)
+		assert.True(t, refund.Fee.IsZero(), c.name)
+		assert.Equal(t, types.RefundDeniedBoarding, refund.Policy, c.name)
+		require.NotNil(t, credit, c.name)
+		assert.True(t, c.credit.Equal(credit.Balance), "%s: %s", c.name, credit.Balance)
+		assert.Equal(t, reservation.UserId, credit.UserId, c.name)
+		assert.Equal(t, reservation.Id, credit.IssuedFor, c.name)
+	}
+
+	// the credit is valid as long as the policy says
+	_, credit, err := engine.Compensate(flightIn(1, "Budget"), reservation, 800, now)
+	require.NoError(t, err)
+	assert.Equal(t, now.AddDate(0, 0, 30), credit.ExpiresAt)
+
+	// the flights matching no tier give no credit
+	refund, credit, err := engine.Compensate(flightIn(1, "Budget"), reservation, 400, now)
+	require.NoError(t, err)
+	assert.NotNil(t, refund)
+	assert.Nil(t, credit)
+
+	// nor does a policy that is not set, and nothing is refunded of what was
+	// not paid
+	engine = NewEngine(testConfig())
+	refund, credit, err = engine.Compensate(flightIn(1, "Delta"), &types.Reservation{Price: usd("100")}, 2500, now)
+	require.NoError(t, err)
+	assert.Nil(t, refund)
+	assert.Nil(t, credit)
+}
@@ -0,0 +1,61 @@
+package pricing
+
+import (
+	"context"
+	"time"
+
+	"github.com/fabrizioperria/goflight/db"
+	"github.com/fabrizioperria/goflight/types"
+)
+
+// Repricer keeps the stored prices of the available seats up to date with
+// the demand for their flights.
+type Repricer struct {
+	flights db.FlightStorer
+	seats   db.SeatStorer
+	pricer  Pricer
+}
+
+func NewRepricer(flights db.FlightStorer, seats db.SeatStorer, pricer Pricer) *Repricer {
+	return &Repricer{
+		flights: flights,
+		seats:   seats,
+		pricer:  pricer,
+	}
+}
+
+// RepriceFlight updates the prices and fares of the available seats of
+// flight and returns how many changed.
+func (r *Repricer) RepriceFlight(ctx context.Context, flight *types.Flight, now time.Time) (int, error) {
+	seats, err := r.seats.GetSeats(ctx, db.SeatFilter{FlightId: flight.Id}, &db.Pagination{Limit: "0"})
+	if err != nil {
+		return 0, err
+	}
+	changed, err := PriceSeats(r.pricer, flight, seats, now)
+	if err != nil {
+		return 0, err
+	}
+	if err := r.seats.UpdateSeatPrices(ctx, changed); err != nil {
+		return 0, err
+	}
+	return len(changed), nil
+}
+
+// Reprice updates the prices of the seats of the flights that have not
+// departed at now and returns how many changed.
+func (r *Repricer) Reprice(ctx context.Context, now time.Time) (int, error) {
+	filter := db.FlightFilter{DepartureBetween: db.TimeRange{From: now}}
+	flights, err := r.flights.GetFlights(ctx, filter, db.SortByNone, &db.Pagination{Limit: "0"})
+	if err != nil {
+		return 0, err
+	}
+	repriced := 0
+	for _, flight := range flights {
+		changed, err := r.RepriceFlight(ctx, flight, now)
+		if err != nil {
+			return repriced, err
+		}
+		repriced += changed
+	}
+	return repriced, nil
+}
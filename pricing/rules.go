@@ -0,0 +1,329 @@
+// Package pricing computes seat fares out of a base fare adjusted for the
+// cabin class, the seat location and the demand for the flight.
+package pricing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+
+	"github.com/fabrizioperria/goflight/types"
+	"github.com/govalues/decimal"
+	"github.com/govalues/money"
+)
+
+type ClassMultipliers struct {
+	Economy  float64 `json:"economy"`
+	Business float64 `json:"business"`
+	First    float64 `json:"first"`
+}
+
+func (m ClassMultipliers) For(class types.SeatClass) float64 {
+	switch class {
+	case types.Business:
+		return m.Business
+	case types.First:
+		return m.First
+	default:
+		return m.Economy
+	}
+}
+
+// Surcharges are added to the fare of the seats by a window, by an aisle or
+// in an exit row.
+type Surcharges struct {
+	Window  float64 `json:"window"`
+	Aisle   float64 `json:"aisle"`
+	ExitRow float64 `json:"exit_row"`
+}
+
+// AdvanceTier applies to the seats sold at least MinDays days before the
+// departure.
+type AdvanceTier struct {
+	MinDays    int     `json:"min_days"`
+	Multiplier float64 `json:"multiplier"`
+}
+
+// LoadTier applies to the flights with at least MinLoadFactor of their seats
+// sold.
+type LoadTier struct {
+	MinLoadFactor float64 `json:"min_load_factor"`
+	Multiplier    float64 `json:"multiplier"`
+}
+
+// Rules price a seat as
+//
+//	base fare × class multiplier × advance multiplier × load multiplier + surcharges
+//
+// The advance and load multipliers are the ones of the first matching tier,
+// and 1 when no tier matches. The base fare and the surcharges are amounts in
+// Currency.
+//
+// The carrier surcharges and the service fees are charged on top of the
+// price of the seat, along with the taxes of the airports. The cancellation
+// policy decides what is refunded of it all, and the denied boarding policy
+// how the passengers left behind by an overbooked flight are compensated.
+type Rules struct {
+	Currency          string                `json:"currency,omitempty"`
+	BaseFare          float64               `json:"base_fare"`
+	ClassMultipliers  *ClassMultipliers     `json:"class_multipliers,omitempty"`
+	Surcharges        *Surcharges           `json:"surcharges,omitempty"`
+	AdvanceTiers      []AdvanceTier         `json:"advance_tiers,omitempty"`
+	LoadTiers         []LoadTier            `json:"load_tiers,omitempty"`
+	CarrierSurcharges []Charge              `json:"carrier_surcharges,omitempty"`
+	ServiceFees       []Charge              `json:"service_fees,omitempty"`
+	Cancellation      *CancellationPolicy   `json:"cancellation,omitempty"`
+	DeniedBoarding    *DeniedBoardingPolicy `json:"denied_boarding,omitempty"`
+}
+
+func (rules Rules) advanceMultiplier(days int) float64 {
+	for _, tier := range rules.AdvanceTiers {
+		if days >= tier.MinDays {
+			return tier.Multiplier
+		}
+	}
+	return 1
+}
+
+func (rules Rules) loadMultiplier(loadFactor float64) float64 {
+	for _, tier := range rules.LoadTiers {
+		if loadFactor >= tier.MinLoadFactor {
+			return tier.Multiplier
+		}
+	}
+	return 1
+}
+
+// override returns rules with the parts set in other replaced.
+func (rules Rules) override(other Rules) Rules {
+	if other.Currency != "" {
+		rules.Currency = other.Currency
+	}
+	if other.BaseFare != 0 {
+		rules.BaseFare = other.BaseFare
+	}
+	if other.ClassMultipliers != nil {
+		rules.ClassMultipliers = other.ClassMultipliers
+	}
+	if other.Surcharges != nil {
+		rules.Surcharges = other.Surcharges
+	}
+	if other.AdvanceTiers != nil {
+		rules.AdvanceTiers = other.AdvanceTiers
+	}
+	if other.LoadTiers != nil {
+		rules.LoadTiers = other.LoadTiers
+	}
+	if other.CarrierSurcharges != nil {
+		rules.CarrierSurcharges = other.CarrierSurcharges
+	}
+	if other.ServiceFees != nil {
+		rules.ServiceFees = other.ServiceFees
+	}
+	if other.Cancellation != nil {
+		rules.Cancellation = other.Cancellation
+	}
+	if other.DeniedBoarding != nil {
+		rules.DeniedBoarding = other.DeniedBoarding
+	}
+	return rules
+}
+
+// sorted returns the rules with the tiers from the most to the least
+// demanding, the order they are matched in.
+func (rules Rules) sorted() Rules {
+	rules.AdvanceTiers = slices.Clone(rules.AdvanceTiers)
+	slices.SortFunc(rules.AdvanceTiers, func(a, b AdvanceTier) int { return b.MinDays - a.MinDays })
+	rules.LoadTiers = slices.Clone(rules.LoadTiers)
+	slices.SortFunc(rules.LoadTiers, func(a, b LoadTier) int {
+		switch {
+		case a.MinLoadFactor > b.MinLoadFactor:
+			return -1
+		case a.MinLoadFactor < b.MinLoadFactor:
+			return 1
+		}
+		return 0
+	})
+	if rules.Cancellation != nil {
+		rules.Cancellation = rules.Cancellation.sorted()
+	}
+	if rules.DeniedBoarding != nil {
+		rules.DeniedBoarding = rules.DeniedBoarding.sorted()
+	}
+	return rules
+}
+
+func (rules Rules) validate() error {
+	if _, err := money.ParseCurr(rules.Currency); err != nil {
+		return fmt.Errorf("currency %q: %w", rules.Currency, err)
+	}
+	if rules.BaseFare <= 0 {
+		return fmt.Errorf("base fare must be positive")
+	}
+	if m := rules.ClassMultipliers; m == nil || m.Economy <= 0 || m.Business <= 0 || m.First <= 0 {
+		return fmt.Errorf("class multipliers must be positive")
+	}
+	if s := rules.Surcharges; s == nil || s.Window < 0 || s.Aisle < 0 || s.ExitRow < 0 {
+		return fmt.Errorf("surcharges must not be negative")
+	}
+	for _, tier := range rules.AdvanceTiers {
+		if tier.MinDays < 0 || tier.Multiplier <= 0 {
+			return fmt.Errorf("invalid advance tier %+v", tier)
+		}
+	}
+	for _, tier := range rules.LoadTiers {
+		if tier.MinLoadFactor < 0 || tier.MinLoadFactor > 1 || tier.Multiplier <= 0 {
+			return fmt.Errorf("invalid load tier %+v", tier)
+		}
+	}
+	if err := validateCharges(rules.CarrierSurcharges); err != nil {
+		return fmt.Errorf("carrier surcharges: %w", err)
+	}
+	if err := validateCharges(rules.ServiceFees); err != nil {
+		return fmt.Errorf("service fees: %w", err)
+	}
+	if rules.Cancellation != nil {
+		if err := rules.Cancellation.validate(rules.Currency); err != nil {
+			return fmt.Errorf("cancellation policy: %w", err)
+		}
+	}
+	if rules.DeniedBoarding != nil {
+		if err := rules.DeniedBoarding.validate(rules.Currency); err != nil {
+			return fmt.Errorf("denied boarding policy: %w", err)
+		}
+	}
+	return nil
+}
+
+// Config holds the default rules and the overrides for airlines and routes.
+// Routes are keyed by the departure and arrival codes, such as "JFK-LAX",
+// and take precedence over airlines. An override only replaces the parts of
+// the rules it sets. Taxes are keyed by airport code.
+type Config struct {
+	Default  Rules                   `json:"default"`
+	Airlines map[string]Rules        `json:"airlines,omitempty"`
+	Routes   map[string]Rules        `json:"routes,omitempty"`
+	Taxes    map[string]AirportTaxes `json:"taxes,omitempty"`
+}
+
+func RouteKey(departure, arrival string) string {
+	return departure + "-" + arrival
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Default: Rules{
+			Currency:         "USD",
+			BaseFare:         100,
+			ClassMultipliers: &ClassMultipliers{Economy: 1, Business: 3, First: 6},
+			Surcharges:       &Surcharges{Window: 10, Aisle: 8, ExitRow: 25},
+			AdvanceTiers: []AdvanceTier{
+				{MinDays: 60, Multiplier: 0.85},
+				{MinDays: 21, Multiplier: 1},
+				{MinDays: 7, Multiplier: 1.2},
+				{MinDays: 0, Multiplier: 1.5},
+			},
+			LoadTiers: []LoadTier{
+				{MinLoadFactor: 0.9, Multiplier: 1.4},
+				{MinLoadFactor: 0.75, Multiplier: 1.2},
+				{MinLoadFactor: 0.5, Multiplier: 1.05},
+			},
+			Cancellation: &CancellationPolicy{
+				FreeWindowHours:    24,
+				CreditValidityDays: 365,
+				Tiers: []CancellationTier{
+					{MinDays: 30},
+					{MinDays: 7, Fee: types.MustParseMoney("50", "USD")},
+					{MinDays: 0, Fee: types.MustParseMoney("50", "USD"), Rate: decimal.MustParse("0.5")},
+				},
+			},
+			DeniedBoarding: &DeniedBoardingPolicy{
+				CreditValidityDays: 365,
+				Tiers: []CompensationTier{
+					{MinMiles: 2175, Rate: decimal.MustParse("4"), Max: types.MustParseMoney("1550", "USD")},
+					{MinMiles: 932, Rate: decimal.MustParse("3"), Max: types.MustParseMoney("1100", "USD")},
+					{MinMiles: 0, Rate: decimal.MustParse("2"), Max: types.MustParseMoney("775", "USD")},
+				},
+			},
+		},
+	}
+}
+
+// Validate checks the rules that result from every override.
+func (config Config) Validate() error {
+	if err := config.Default.validate(); err != nil {
+		return fmt.Errorf("default rules: %w", err)
+	}
+	for airline, rules := range config.Airlines {
+		if err := config.Default.override(rules).validate(); err != nil {
+			return fmt.Errorf("rules of airline %s: %w", airline, err)
+		}
+	}
+	for route, rules := range config.Routes {
+		if err := config.Default.override(rules).validate(); err != nil {
+			return fmt.Errorf("rules of route %s: %w", route, err)
+		}
+	}
+	for airport, taxes := range config.Taxes {
+		if !types.IsValidIATACode(airport) {
+			return fmt.Errorf("taxes of airport %q: invalid airport code", airport)
+		}
+		if err := validateCharges(taxes.Departure); err != nil {
+			return fmt.Errorf("departure taxes of airport %s: %w", airport, err)
+		}
+		if err := validateCharges(taxes.Arrival); err != nil {
+			return fmt.Errorf("arrival taxes of airport %s: %w", airport, err)
+		}
+	}
+	return nil
+}
+
+// RulesFor returns the rules applying to flight.
+func (config Config) RulesFor(flight *types.Flight) Rules {
+	rules := config.Default
+	if airline, ok := config.Airlines[flight.Airline]; ok {
+		rules = rules.override(airline)
+	}
+	if route, ok := config.Routes[RouteKey(flight.Departure, flight.Arrival)]; ok {
+		rules = rules.override(route)
+	}
+	return rules.sorted()
+}
+
+// LoadConfig reads a JSON config. The default rules it leaves unset are the
+// ones of DefaultConfig.
+func LoadConfig(path string) (Config, error) {
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	config := Config{}
+	decoder := json.NewDecoder(bytes.NewReader(file))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return Config{}, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	config.Default = DefaultConfig().Default.override(config.Default)
+	if err := config.Validate(); err != nil {
+		return Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return config, nil
+}
+
+// ConfigFromEnv loads the config at PRICING_CONFIG, falling back to the
+// default one when it is unset or invalid.
+func ConfigFromEnv() Config {
+	path := os.Getenv("PRICING_CONFIG")
+	if path == "" {
+		return DefaultConfig()
+	}
+	config, err := LoadConfig(path)
+	if err != nil {
+		log.Printf("pricing: using the default config: %v", err)
+		return DefaultConfig()
+	}
+	return config
+}
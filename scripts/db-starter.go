@@ -58,17 +58,31 @@ func SeedFlights(client *mongo.Client, store *db.Store) {
 	store.Seat.Drop(context.Background())
 	store.Reservation.Drop(context.Background())
 
+	airports, err := store.Airport.GetAirports(context.Background(), db.AirportFilter{}, &db.Pagination{Limit: "0"})
+	if err != nil || len(airports) < 2 {
+		log.Fatal("no airports to seed flights between: ", err)
+	}
+
 	fmt.Println("Seeding flights")
 	for i := 0; i < 10; i++ {
+		departure := airports[gofakeit.Number(0, len(airports)-1)]
+		arrival := departure
+		for arrival == departure {
+			arrival = airports[gofakeit.Number(0, len(airports)-1)]
+		}
 
 		numberSeats := gofakeit.Number(1, 100)
-		newflight, _ := fixtures.AddFlight(store,
+		newflight, err := fixtures.AddFlight(store,
 			gofakeit.Company(),
-			gofakeit.City(),
-			gofakeit.City(),
+			departure.IATA,
+			arrival.IATA,
 			time.Now().AddDate(0, 0, gofakeit.Number(1, 30)).Format(time.RFC3339),
 			time.Now().AddDate(0, 0, gofakeit.Number(31, 60)).Format(time.RFC3339),
 			numberSeats)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
 
 		newSeats := []primitive.ObjectID{}
 		for j := 0; j < numberSeats; j++ {
@@ -82,7 +96,7 @@ func SeedFlights(client *mongo.Client, store *db.Store) {
 				newflight.Id)
 			newSeats = append(newSeats, seat.Id)
 		}
-		err := fixtures.AddSeatsToFlight(store, newflight.Id, newSeats)
+		err = fixtures.AddSeatsToFlight(store, newflight.Id, newSeats)
 		if err != nil {
 			fmt.Println(err)
 			// should delete the flight, but oh well
@@ -119,9 +133,36 @@ func main() {
 	flightDb := db.NewMongoDbFlightStore(client)
 	seatDb := db.NewMongoDbSeatStore(client, *flightDb)
 	reservationDb := db.NewMongoDbReservationStore(client, *flightDb, *seatDb)
-
-	store := db.NewStore(userDb, flightDb, seatDb, reservationDb)
+	airportDb := db.NewMongoDbAirportStore(client)
+	aircraftDb := db.NewMongoDbAircraftStore(client)
+	creditDb := db.NewMongoDbCreditStore(client)
+	promotionDb := db.NewMongoDbPromotionStore(client)
+	loyaltyDb := db.NewMongoDbLoyaltyStore(client)
+	waitlistDb := db.NewMongoDbWaitlistStore(client)
+
+	store := db.NewStore(userDb, flightDb, seatDb, reservationDb, airportDb, aircraftDb, creditDb, promotionDb, loyaltyDb, waitlistDb)
+	fmt.Println("Loading airports and aircraft")
+	if err := db.LoadBundledAirports(context.Background(), airportDb); err != nil {
+		log.Fatal(err)
+	}
+	if err := db.LoadBundledAircraft(context.Background(), aircraftDb); err != nil {
+		log.Fatal(err)
+	}
 	SeedUsers(client, store)
 	SeedFlights(client, store)
 	SeedReservations(client, store)
+
+	// dropping the collections above also dropped their indexes
+	if err := flightDb.EnsureIndexes(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+	if err := seatDb.EnsureIndexes(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+	if err := reservationDb.EnsureIndexes(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+	if err := airportDb.EnsureIndexes(context.Background()); err != nil {
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"github.com/fabrizioperria/goflight/db"
+	_ "github.com/joho/godotenv/autoload"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func main() {
+	ctx := context.Background()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(os.Getenv("MONGO_URL")))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Disconnect(ctx)
+
+	database := client.Database(os.Getenv("DB_NAME"))
+	if err := db.MigrateStringTimestamps(ctx, database); err != nil {
+		log.Fatal(err)
+	}
+	// the prices stored as plain numbers were all in dollars
+	if err := db.MigrateFloatPrices(ctx, database, "USD"); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,235 @@
+// Package search builds multi-leg itineraries out of the flights in a store.
+package search
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/fabrizioperria/goflight/db"
+	"github.com/fabrizioperria/goflight/pricing"
+	"github.com/fabrizioperria/goflight/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultMinLayover = 45 * time.Minute
+	defaultMaxLayover = 6 * time.Hour
+	MaxStops          = 2
+
+	// maxLegDuration bounds how far past the search date a connecting leg
+	// can depart, so that only a window of flights has to be loaded.
+	maxLegDuration = 24 * time.Hour
+)
+
+// Rates convert the prices of the legs of an itinerary to the currency of
+// its first leg when they differ.
+type Config struct {
+	MinLayover time.Duration
+	MaxLayover time.Duration
+	Rates      pricing.ExchangeRates
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MinLayover: defaultMinLayover,
+		MaxLayover: defaultMaxLayover,
+		Rates:      pricing.DefaultExchangeRates(),
+	}
+}
+
+// ConfigFromEnv reads ITINERARY_MIN_LAYOVER and ITINERARY_MAX_LAYOVER as Go
+// durations, falling back to the defaults when they are unset or invalid,
+// along with rates.
+func ConfigFromEnv(rates pricing.ExchangeRates) Config {
+	config := DefaultConfig()
+	config.Rates = rates
+	if layover, err := time.ParseDuration(os.Getenv("ITINERARY_MIN_LAYOVER")); err == nil {
+		config.MinLayover = layover
+	}
+	if layover, err := time.ParseDuration(os.Getenv("ITINERARY_MAX_LAYOVER")); err == nil {
+		config.MaxLayover = layover
+	}
+	return config
+}
+
+type Itinerary struct {
+	Legs         []*types.Flight `json:"legs"`
+	Stops        int             `json:"stops"`
+	TotalMinutes int             `json:"total_minutes"`
+	LowestPrice  types.Money     `json:"lowest_price"`
+}
+
+var ErrInvalidQuery = errors.New("invalid itinerary query")
+
+type ItineraryQuery struct {
+	From     string
+	To       string
+	Date     time.Time
+	MaxStops int
+}
+
+type ItinerarySearcher struct {
+	flights db.FlightStorer
+	seats   db.SeatStorer
+	config  Config
+}
+
+func NewItinerarySearcher(flights db.FlightStorer, seats db.SeatStorer, config Config) *ItinerarySearcher {
+	return &ItinerarySearcher{
+		flights: flights,
+		seats:   seats,
+		config:  config,
+	}
+}
+
+// leg is a flight with its times parsed, a node of the route graph.
+type leg struct {
+	flight    *types.Flight
+	departure time.Time
+	arrival   time.Time
+}
+
+func (s *ItinerarySearcher) Search(ctx context.Context, query ItineraryQuery) ([]*Itinerary, error) {
+	if query.From == "" || query.To == "" || query.From == query.To {
+		return nil, fmt.Errorf("%w: from and to must be two different airports", ErrInvalidQuery)
+	}
+	if query.MaxStops < 0 || query.MaxStops > MaxStops {
+		return nil, fmt.Errorf("%w: max stops must be between 0 and %d", ErrInvalidQuery, MaxStops)
+	}
+
+	// the first leg departs on the date in the time zone of its airport,
+	// which is up to 14 hours ahead of UTC and 12 hours behind
+	day := time.Date(query.Date.Year(), query.Date.Month(), query.Date.Day(), 0, 0, 0, 0, time.UTC)
+	window := db.TimeRange{
+		From: day.Add(-14 * time.Hour),
+		To:   day.Add(36*time.Hour + time.Duration(query.MaxStops)*(maxLegDuration+s.config.MaxLayover)),
+	}
+	flights, err := s.flights.GetFlights(ctx, db.FlightFilter{DepartureBetween: window, MinAvailableSeats: 1}, db.SortByDepartureTime, &db.Pagination{Limit: "0"})
+	if err != nil {
+		return nil, err
+	}
+
+	routes := map[string][]leg{}
+	for _, flight := range flights {
+		if !flight.ArrivalTime.After(flight.DepartureTime) {
+			continue
+		}
+		routes[flight.Departure] = append(routes[flight.Departure], leg{flight: flight, departure: flight.DepartureTime, arrival: flight.ArrivalTime})
+	}
+
+	connections := [][]leg{}
+	var walk func(path []leg, visited map[string]bool)
+	walk = func(path []leg, visited map[string]bool) {
+		last := path[len(path)-1]
+		if last.flight.Arrival == query.To {
+			connections = append(connections, slices.Clone(path))
+			return
+		}
+		if len(path) > query.MaxStops {
+			return
+		}
+		for _, next := range routes[last.flight.Arrival] {
+			layover := next.departure.Sub(last.arrival)
+			if layover < s.config.MinLayover || layover > s.config.MaxLayover || visited[next.flight.Arrival] {
+				continue
+			}
+			visited[next.flight.Arrival] = true
+			walk(append(path, next), visited)
+			delete(visited, next.flight.Arrival)
+		}
+	}
+	for _, first := range routes[query.From] {
+		year, month, date := first.flight.LocalDepartureTime().Date()
+		if year != day.Year() || month != day.Month() || date != day.Day() {
+			continue
+		}
+		walk([]leg{first}, map[string]bool{query.From: true, first.flight.Arrival: true})
+	}
+
+	flightIds := []primitive.ObjectID{}
+	for _, connection := range connections {
+		for _, l := range connection {
+			if !slices.Contains(flightIds, l.flight.Id) {
+				flightIds = append(flightIds, l.flight.Id)
+			}
+		}
+	}
+	prices, err := s.lowestPrices(ctx, flightIds)
+	if err != nil {
+		return nil, err
+	}
+
+	itineraries := []*Itinerary{}
+connections:
+	for _, connection := range connections {
+		itinerary := &Itinerary{
+			Stops:        len(connection) - 1,
+			TotalMinutes: int(connection[len(connection)-1].arrival.Sub(connection[0].departure).Minutes()),
+		}
+		for _, l := range connection {
+			price := prices[l.flight.Id]
+			if !price.IsSet() {
+				continue connections
+			}
+			if itinerary.LowestPrice.IsSet() {
+				if price, err = s.config.Rates.Convert(price, itinerary.LowestPrice.Currency()); err != nil {
+					return nil, err
+				}
+			}
+			itinerary.Legs = append(itinerary.Legs, l.flight)
+			if itinerary.LowestPrice, err = itinerary.LowestPrice.Add(price); err != nil {
+				return nil, err
+			}
+		}
+		itineraries = append(itineraries, itinerary)
+	}
+	if len(itineraries) == 0 {
+		return itineraries, nil
+	}
+
+	// itineraries starting with legs priced in different currencies are
+	// compared in a single one
+	currency := itineraries[0].LowestPrice.Currency()
+	comparable := map[*Itinerary]types.Money{}
+	for _, itinerary := range itineraries {
+		if comparable[itinerary], err = s.config.Rates.Convert(itinerary.LowestPrice, currency); err != nil {
+			return nil, err
+		}
+	}
+	slices.SortStableFunc(itineraries, func(a, b *Itinerary) int {
+		return cmp.Or(
+			cmp.Compare(a.TotalMinutes, b.TotalMinutes),
+			comparable[a].Decimal().Cmp(comparable[b].Decimal()),
+		)
+	})
+	return itineraries, nil
+}
+
+// lowestPrices returns the cheapest price among the available seats of each
+// of the flights, which is unset when none of them has one.
+func (s *ItinerarySearcher) lowestPrices(ctx context.Context, flightIds []primitive.ObjectID) (map[primitive.ObjectID]types.Money, error) {
+	prices := map[primitive.ObjectID]types.Money{}
+	if len(flightIds) == 0 {
+		return prices, nil
+	}
+	available := true
+	seats, err := s.seats.GetSeats(ctx, db.SeatFilter{FlightIds: flightIds, Available: &available}, &db.Pagination{Limit: "0"})
+	if err != nil {
+		return nil, err
+	}
+	for _, seat := range seats {
+		if !seat.Price.IsSet() {
+			continue
+		}
+		lowest := prices[seat.FlightId]
+		if cmp, err := seat.Price.Cmp(lowest); !lowest.IsSet() || (err == nil && cmp < 0) {
+			prices[seat.FlightId] = seat.Price
+		}
+	}
+	return prices, nil
+}
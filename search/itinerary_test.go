@@ -0,0 +1,159 @@
+package search
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fabrizioperria/goflight/db"
+	"github.com/fabrizioperria/goflight/db/memory"
+	"github.com/fabrizioperria/goflight/pricing"
+	"github.com/fabrizioperria/goflight/types"
+	"github.com/govalues/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var day = time.Date(2030, 5, 10, 0, 0, 0, 0, time.UTC)
+
+func addFlight(t *testing.T, store *db.Store, from, to string, departure, arrival time.Duration, prices ...string) *types.Flight {
+	ctx := context.Background()
+	flight, err := store.Flight.CreateFlight(ctx, &types.Flight{
+		Airline:       "Delta",
+		Departure:     from,
+		Arrival:       to,
+		DepartureTime: day.Add(departure),
+		ArrivalTime:   day.Add(arrival),
+		Seats:         []primitive.ObjectID{},
+	})
+	require.NoError(t, err)
+
+	seatIds := []primitive.ObjectID{}
+	for i, price := range prices {
+		seat, err := store.Seat.CreateSeat(ctx, &types.Seat{FlightId: flight.Id, Number: i, Price: types.MustParseMoney(price, "USD"), Available: true})
+		require.NoError(t, err)
+		seatIds = append(seatIds, seat.Id)
+	}
+	flight.Seats = seatIds
+	return flight
+}
+
+func legIds(itinerary *Itinerary) []primitive.ObjectID {
+	ids := []primitive.ObjectID{}
+	for _, leg := range itinerary.Legs {
+		ids = append(ids, leg.Id)
+	}
+	return ids
+}
+
+func TestSearchConnections(t *testing.T) {
+	store := memory.NewStore()
+	searcher := NewItinerarySearcher(store.Flight, store.Seat, Config{MinLayover: time.Hour, MaxLayover: 4 * time.Hour})
+
+	direct := addFlight(t, store, "JFK", "LAX", 8*time.Hour, 14*time.Hour, "400", "300")
+	jfkOrd := addFlight(t, store, "JFK", "ORD", 6*time.Hour, 8*time.Hour, "100")
+	ordLax := addFlight(t, store, "ORD", "LAX", 10*time.Hour, 14*time.Hour, "120", "150")
+	// layover at ORD too short
+	addFlight(t, store, "ORD", "LAX", 8*time.Hour+30*time.Minute, 12*time.Hour, "50")
+	// layover at ORD too long
+	addFlight(t, store, "ORD", "LAX", 13*time.Hour, 17*time.Hour, "50")
+	ordDen := addFlight(t, store, "ORD", "DEN", 9*time.Hour, 11*time.Hour, "60")
+	denLax := addFlight(t, store, "DEN", "LAX", 13*time.Hour, 15*time.Hour, "70")
+	// sold out
+	addFlight(t, store, "JFK", "LAX", 7*time.Hour, 12*time.Hour)
+	// next day first legs are out of the search date
+	addFlight(t, store, "JFK", "LAX", 30*time.Hour, 36*time.Hour, "10")
+
+	itineraries, err := searcher.Search(context.Background(), ItineraryQuery{From: "JFK", To: "LAX", Date: day, MaxStops: 2})
+	require.NoError(t, err)
+	require.Len(t, itineraries, 3)
+
+	assert.Equal(t, []primitive.ObjectID{direct.Id}, legIds(itineraries[0]))
+	assert.Equal(t, 0, itineraries[0].Stops)
+	assert.Equal(t, 360, itineraries[0].TotalMinutes)
+	assert.Equal(t, "USD 300.00", itineraries[0].LowestPrice.String())
+
+	assert.Equal(t, []primitive.ObjectID{jfkOrd.Id, ordLax.Id}, legIds(itineraries[1]))
+	assert.Equal(t, 1, itineraries[1].Stops)
+	assert.Equal(t, 480, itineraries[1].TotalMinutes)
+	assert.Equal(t, "USD 220.00", itineraries[1].LowestPrice.String())
+
+	assert.Equal(t, []primitive.ObjectID{jfkOrd.Id, ordDen.Id, denLax.Id}, legIds(itineraries[2]))
+	assert.Equal(t, 2, itineraries[2].Stops)
+	assert.Equal(t, 540, itineraries[2].TotalMinutes)
+	assert.Equal(t, "USD 230.00", itineraries[2].LowestPrice.String())
+
+	itineraries, err = searcher.Search(context.Background(), ItineraryQuery{From: "JFK", To: "LAX", Date: day, MaxStops: 1})
+	require.NoError(t, err)
+	assert.Len(t, itineraries, 2)
+
+	itineraries, err = searcher.Search(context.Background(), ItineraryQuery{From: "JFK", To: "DEN", Date: day, MaxStops: 0})
+	require.NoError(t, err)
+	assert.Empty(t, itineraries)
+}
+
+func TestSearchRejectsInvalidQueries(t *testing.T) {
+	store := memory.NewStore()
+	searcher := NewItinerarySearcher(store.Flight, store.Seat, DefaultConfig())
+
+	_, err := searcher.Search(context.Background(), ItineraryQuery{From: "JFK", To: "JFK", Date: day})
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+	_, err = searcher.Search(context.Background(), ItineraryQuery{From: "JFK", To: "LAX", Date: day, MaxStops: 3})
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+}
+
+func addZonedFlight(t *testing.T, store *db.Store, from, zone string, departure time.Duration, price types.Money) *types.Flight {
+	flight, err := store.Flight.CreateFlightWithSeats(context.Background(), &types.Flight{
+		Airline:           "Delta",
+		Departure:         from,
+		Arrival:           "LAX",
+		DepartureTime:     day.Add(departure),
+		ArrivalTime:       day.Add(departure + 6*time.Hour),
+		DepartureTimeZone: zone,
+		ArrivalTimeZone:   "America/Los_Angeles",
+	}, []*types.Seat{{Price: price, Available: true}})
+	require.NoError(t, err)
+	return flight
+}
+
+func TestSearchDateIsLocalToDeparture(t *testing.T) {
+	store := memory.NewStore()
+	searcher := NewItinerarySearcher(store.Flight, store.Seat, DefaultConfig())
+
+	// 04:00 of the date in Tokyo, the evening before in UTC
+	tokyo := addZonedFlight(t, store, "NRT", "Asia/Tokyo", -5*time.Hour, types.MustParseMoney("500", "USD"))
+	// 23:00 of the day before the date in Tokyo
+	addZonedFlight(t, store, "NRT", "Asia/Tokyo", -10*time.Hour, types.MustParseMoney("500", "USD"))
+	// 19:00 of the date in Honolulu, the day after in UTC
+	honolulu := addZonedFlight(t, store, "HNL", "Pacific/Honolulu", 29*time.Hour, types.MustParseMoney("300", "USD"))
+	// 00:30 of the day after the date in Honolulu
+	addZonedFlight(t, store, "HNL", "Pacific/Honolulu", 34*time.Hour+30*time.Minute, types.MustParseMoney("300", "USD"))
+
+	itineraries, err := searcher.Search(context.Background(), ItineraryQuery{From: "NRT", To: "LAX", Date: day})
+	require.NoError(t, err)
+	require.Len(t, itineraries, 1)
+	assert.Equal(t, []primitive.ObjectID{tokyo.Id}, legIds(itineraries[0]))
+
+	itineraries, err = searcher.Search(context.Background(), ItineraryQuery{From: "HNL", To: "LAX", Date: day})
+	require.NoError(t, err)
+	require.Len(t, itineraries, 1)
+	assert.Equal(t, []primitive.ObjectID{honolulu.Id}, legIds(itineraries[0]))
+}
+
+func TestSearchSortsPricesInOneCurrency(t *testing.T) {
+	store := memory.NewStore()
+	config := DefaultConfig()
+	config.Rates = pricing.ExchangeRates{Base: "USD", Rates: map[string]decimal.Decimal{"EUR": decimal.MustParse("0.9")}}
+	searcher := NewItinerarySearcher(store.Flight, store.Seat, config)
+
+	// EUR 100 is USD 111.11, more than USD 105 despite the smaller amount
+	euros := addZonedFlight(t, store, "CDG", "UTC", 8*time.Hour, types.MustParseMoney("100", "EUR"))
+	dollars := addZonedFlight(t, store, "CDG", "UTC", 9*time.Hour, types.MustParseMoney("105", "USD"))
+
+	itineraries, err := searcher.Search(context.Background(), ItineraryQuery{From: "CDG", To: "LAX", Date: day})
+	require.NoError(t, err)
+	require.Len(t, itineraries, 2)
+	assert.Equal(t, []primitive.ObjectID{dollars.Id}, legIds(itineraries[0]))
+	assert.Equal(t, []primitive.ObjectID{euros.Id}, legIds(itineraries[1]))
+}
@@ -0,0 +1,167 @@
+package types
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CabinZone is a block of consecutive rows sharing class and layout.
+// The layout lists the seat letters from the left window to the right one,
+// with a '-' for each aisle, such as "ABC-DEF".
+type CabinZone struct {
+	Class   SeatClass `json:"class" bson:"class"`
+	FromRow int       `json:"from_row" bson:"from_row"`
+	ToRow   int       `json:"to_row" bson:"to_row"`
+	Layout  string    `json:"layout" bson:"layout"`
+}
+
+// Aircraft is an aircraft type along with the seat-map template its flights
+// get their seats from. Blocked seats, such as the ones taken by crew rests,
+// are not sold.
+type Aircraft struct {
+	Code         string      `json:"code" bson:"_id"`
+	Name         string      `json:"name" bson:"name"`
+	Zones        []CabinZone `json:"zones" bson:"zones"`
+	ExitRows     []int       `json:"exit_rows" bson:"exit_rows"`
+	BlockedSeats []string    `json:"blocked_seats" bson:"blocked_seats"`
+}
+
+const aisle = '-'
+
+func SeatDesignator(row int, letter string) string {
+	return strconv.Itoa(row) + letter
+}
+
+// layoutLocation tells where the seat at position i of layout is: next to a
+// window, next to an aisle or in between.
+func layoutLocation(layout string, i int) SeatLocation {
+	switch {
+	case i == 0 || i == len(layout)-1:
+		return Window
+	case layout[i-1] == aisle || layout[i+1] == aisle:
+		return Aisle
+	default:
+		return Middle
+	}
+}
+
+func (zone CabinZone) validate() error {
+	if zone.Class < Economy || zone.Class > First {
+		return fmt.Errorf("invalid class %d", zone.Class)
+	}
+	if zone.FromRow < 1 || zone.ToRow < zone.FromRow {
+		return fmt.Errorf("invalid rows %d to %d", zone.FromRow, zone.ToRow)
+	}
+	layout := zone.Layout
+	if layout == "" || layout[0] == aisle || layout[len(layout)-1] == aisle {
+		return fmt.Errorf("invalid layout %q", layout)
+	}
+	letters := map[rune]bool{}
+	for i, r := range layout {
+		if r == aisle {
+			if layout[i-1] == aisle {
+				return fmt.Errorf("invalid layout %q", layout)
+			}
+			continue
+		}
+		if r < 'A' || r > 'Z' || letters[r] {
+			return fmt.Errorf("invalid layout %q", layout)
+		}
+		letters[r] = true
+	}
+	return nil
+}
+
+func (aircraft *Aircraft) Validate() error {
+	if aircraft.Code == "" {
+		return fmt.Errorf("aircraft code is required")
+	}
+	if len(aircraft.Zones) == 0 {
+		return fmt.Errorf("aircraft %s has no cabin zones", aircraft.Code)
+	}
+	zones := slices.Clone(aircraft.Zones)
+	slices.SortFunc(zones, func(a, b CabinZone) int { return a.FromRow - b.FromRow })
+	for i, zone := range zones {
+		if err := zone.validate(); err != nil {
+			return fmt.Errorf("aircraft %s: %w", aircraft.Code, err)
+		}
+		if i > 0 && zone.FromRow <= zones[i-1].ToRow {
+			return fmt.Errorf("aircraft %s: zones overlap at row %d", aircraft.Code, zone.FromRow)
+		}
+	}
+
+	for _, row := range aircraft.ExitRows {
+		if !slices.ContainsFunc(zones, func(zone CabinZone) bool { return row >= zone.FromRow && row <= zone.ToRow }) {
+			return fmt.Errorf("aircraft %s: exit row %d is not in a cabin zone", aircraft.Code, row)
+		}
+	}
+	unblocked := *aircraft
+	unblocked.BlockedSeats = nil
+	seats := map[string]bool{}
+	for _, seat := range unblocked.SeatMap(primitive.NilObjectID) {
+		seats[seat.Designator] = true
+	}
+	for _, blocked := range aircraft.BlockedSeats {
+		if !seats[blocked] {
+			return fmt.Errorf("aircraft %s: blocked seat %s is not in the seat map", aircraft.Code, blocked)
+		}
+	}
+	return nil
+}
+
+// SeatMap returns the seats of a flight of flightId flown by the aircraft,
+// row by row from the front and from the left window in each row, without
+// the blocked seats. The seats are available, numbered in that order and
+// left for the pricing to price.
+func (aircraft *Aircraft) SeatMap(flightId primitive.ObjectID) []*Seat {
+	zones := slices.Clone(aircraft.Zones)
+	slices.SortFunc(zones, func(a, b CabinZone) int { return a.FromRow - b.FromRow })
+
+	seats := []*Seat{}
+	for _, zone := range zones {
+		for row := zone.FromRow; row <= zone.ToRow; row++ {
+			for i := 0; i < len(zone.Layout); i++ {
+				if zone.Layout[i] == aisle {
+					continue
+				}
+				letter := zone.Layout[i : i+1]
+				designator := SeatDesignator(row, letter)
+				if slices.Contains(aircraft.BlockedSeats, designator) {
+					continue
+				}
+				seats = append(seats, &Seat{
+					FlightId:   flightId,
+					Number:     len(seats),
+					Row:        row,
+					Letter:     letter,
+					Designator: designator,
+					ExitRow:    slices.Contains(aircraft.ExitRows, row),
+					Class:      zone.Class,
+					Location:   layoutLocation(zone.Layout, i),
+					Available:  true,
+				})
+			}
+		}
+	}
+	return seats
+}
+
+// GenericSeatMap returns n seats for a flight of flightId flown by no
+// aircraft in particular, cycling through classes and locations. The seats
+// are left for the pricing to price.
+func GenericSeatMap(flightId primitive.ObjectID, n int) []*Seat {
+	seats := []*Seat{}
+	for i := 0; i < n; i++ {
+		seats = append(seats, &Seat{
+			FlightId:  flightId,
+			Number:    i,
+			Class:     SeatClass(i%3 + 1),
+			Location:  SeatLocation(i%3 + 1),
+			Available: true,
+		})
+	}
+	return seats
+}
@@ -0,0 +1,132 @@
+package types
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Airport struct {
+	IATA      string  `json:"iata" bson:"_id"`
+	ICAO      string  `json:"icao" bson:"icao"`
+	Name      string  `json:"name" bson:"name"`
+	City      string  `json:"city" bson:"city"`
+	Country   string  `json:"country" bson:"country"`
+	Latitude  float64 `json:"latitude" bson:"latitude"`
+	Longitude float64 `json:"longitude" bson:"longitude"`
+	TimeZone  string  `json:"time_zone" bson:"time_zone"`
+}
+
+// NormalizeAirportCode upper-cases an IATA or ICAO code and trims the spaces
+// around it.
+func NormalizeAirportCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func IsValidIATACode(code string) bool {
+	return len(code) == 3 && isUpperAlpha(code)
+}
+
+func IsValidICAOCode(code string) bool {
+	return len(code) == 4 && isUpperAlpha(code)
+}
+
+func isUpperAlpha(code string) bool {
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+func (airport Airport) Validate() error {
+	if !IsValidIATACode(airport.IATA) {
+		return fmt.Errorf("invalid IATA code %q", airport.IATA)
+	}
+	if airport.ICAO != "" && !IsValidICAOCode(airport.ICAO) {
+		return fmt.Errorf("invalid ICAO code %q for %s", airport.ICAO, airport.IATA)
+	}
+	if airport.Name == "" {
+		return fmt.Errorf("missing name for %s", airport.IATA)
+	}
+	if airport.Latitude < -90 || airport.Latitude > 90 || airport.Longitude < -180 || airport.Longitude > 180 {
+		return fmt.Errorf("invalid coordinates for %s", airport.IATA)
+	}
+	if _, err := time.LoadLocation(airport.TimeZone); err != nil || airport.TimeZone == "" {
+		return fmt.Errorf("unknown time zone %q for %s", airport.TimeZone, airport.IATA)
+	}
+	return nil
+}
+
+// earthRadiusMiles is the mean radius of the Earth.
+const earthRadiusMiles = 3958.8
+
+// MilesTo returns the great-circle distance to other, in statute miles.
+func (airport Airport) MilesTo(other Airport) float64 {
+	lat1 := airport.Latitude * math.Pi / 180
+	lat2 := other.Latitude * math.Pi / 180
+	dLat := lat2 - lat1
+	dLon := (other.Longitude - airport.Longitude) * math.Pi / 180
+	h := math.Pow(math.Sin(dLat/2), 2) + math.Cos(lat1)*math.Cos(lat2)*math.Pow(math.Sin(dLon/2), 2)
+	return 2 * earthRadiusMiles * math.Asin(math.Sqrt(h))
+}
+
+var airportColumns = []string{"iata", "icao", "name", "city", "country", "latitude", "longitude", "time_zone"}
+
+// ReadAirportsCSV reads airports from a CSV with a header row and the columns
+// iata, icao, name, city, country, latitude, longitude and time_zone.
+func ReadAirportsCSV(r io.Reader) ([]*Airport, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = len(airportColumns)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading airports header: %w", err)
+	}
+	for i, column := range airportColumns {
+		if header[i] != column {
+			return nil, fmt.Errorf("unexpected airports column %q, want %q", header[i], column)
+		}
+	}
+
+	airports := []*Airport{}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return airports, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading airports: %w", err)
+		}
+
+		latitude, err := strconv.ParseFloat(record[5], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid latitude %q for %s", record[5], record[0])
+		}
+		longitude, err := strconv.ParseFloat(record[6], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid longitude %q for %s", record[6], record[0])
+		}
+		airport := &Airport{
+			IATA:      NormalizeAirportCode(record[0]),
+			ICAO:      NormalizeAirportCode(record[1]),
+			Name:      record[2],
+			City:      record[3],
+			Country:   record[4],
+			Latitude:  latitude,
+			Longitude: longitude,
+			TimeZone:  record[7],
+		}
+		if err := airport.Validate(); err != nil {
+			return nil, err
+		}
+		airports = append(airports, airport)
+	}
+}
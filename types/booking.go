@@ -0,0 +1,55 @@
+package types
+
+import (
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Booking struct {
+	Id             primitive.ObjectID   `json:"id,omitempty" bson:"_id,omitempty"`
+	Locator        string               `json:"locator,omitempty" bson:"locator,omitempty"`
+	UserId         primitive.ObjectID   `json:"user_id" bson:"user_id"`
+	ReservationIds []primitive.ObjectID `json:"reservation_ids" bson:"reservation_ids"`
+	BookingDate    time.Time            `json:"booking_date" bson:"booking_date"`
+	Reservations   []*Reservation       `json:"reservations,omitempty" bson:"-"`
+}
+
+type BookingSeatParams struct {
+	FlightId  primitive.ObjectID `json:"flight_id"`
+	SeatId    primitive.ObjectID `json:"seat_id"`
+	Passenger *Passenger         `json:"passenger"`
+}
+
+// CreateBookingParams reserves all the seats with a single payment charged
+// to PaymentMethod.
+type CreateBookingParams struct {
+	Seats         []BookingSeatParams `json:"seats"`
+	PaymentMethod string              `json:"payment_method"`
+}
+
+const maxSeatsPerBooking = 9
+
+func (params CreateBookingParams) Validate() map[string]string {
+	errors := make(map[string]string)
+	if len(params.Seats) == 0 {
+		errors["seats"] = "at least one seat is required"
+	}
+	if len(params.Seats) > maxSeatsPerBooking {
+		errors["seats"] = fmt.Sprintf("at most %d seats can be booked together", maxSeatsPerBooking)
+	}
+
+	seen := map[primitive.ObjectID]bool{}
+	for i, seat := range params.Seats {
+		if seat.FlightId.IsZero() || seat.SeatId.IsZero() {
+			errors[fmt.Sprintf("seats.%d", i)] = "flight_id and seat_id are required"
+			continue
+		}
+		if seen[seat.SeatId] {
+			errors[fmt.Sprintf("seats.%d", i)] = fmt.Sprintf("seat %s is booked more than once", seat.SeatId.Hex())
+		}
+		seen[seat.SeatId] = true
+	}
+	return errors
+}
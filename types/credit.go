@@ -0,0 +1,99 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Credit is travel credit a user spends on new reservations, issued instead
+// of a refund when a non-refundable fare is cancelled. Its Balance is what is
+// left of it and Redemptions what was spent, each on a reservation.
+type Credit struct {
+	Id          primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	UserId      primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Balance     Money              `json:"balance" bson:"balance"`
+	ExpiresAt   time.Time          `json:"expires_at" bson:"expires_at"`
+	IssuedFor   primitive.ObjectID `json:"issued_for,omitempty" bson:"issued_for,omitempty"`
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+	Redemptions []CreditRedemption `json:"redemptions" bson:"redemptions"`
+}
+
+// ErrCreditUnavailable is returned when a credit cannot be spent: it expired,
+// nothing is left of it or it is in another currency than what it pays for.
+var ErrCreditUnavailable = errors.New("credit not available")
+
+// IsUsable reports whether anything is left of the credit at now.
+func (credit *Credit) IsUsable(now time.Time) bool {
+	return now.Before(credit.ExpiresAt) && credit.Balance.IsPos()
+}
+
+// CreditRedemption is the Amount of a credit spent on a reservation, and
+// what was Restored of it once the reservation was cancelled, unset until
+// then.
+type CreditRedemption struct {
+	CreditId      primitive.ObjectID `json:"credit_id" bson:"credit_id"`
+	ReservationId primitive.ObjectID `json:"reservation_id" bson:"reservation_id"`
+	Amount        Money              `json:"amount" bson:"amount"`
+	Restored      Money              `json:"restored" bson:"restored"`
+	CreatedAt     time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// Redeem spends up to amount of the credit, no more than its balance, on the
+// reservation with reservationId and returns what was spent.
+func (credit *Credit) Redeem(amount Money, reservationId primitive.ObjectID, now time.Time) (*CreditRedemption, error) {
+	if !credit.IsUsable(now) || credit.Balance.Currency() != amount.Currency() || !amount.IsPos() {
+		return nil, ErrCreditUnavailable
+	}
+	spent := amount
+	if cmp, err := amount.Cmp(credit.Balance); err != nil {
+		return nil, err
+	} else if cmp > 0 {
+		spent = credit.Balance
+	}
+	balance, err := credit.Balance.Sub(spent)
+	if err != nil {
+		return nil, err
+	}
+	redemption := CreditRedemption{
+		CreditId:      credit.Id,
+		ReservationId: reservationId,
+		Amount:        spent,
+		CreatedAt:     now.UTC(),
+	}
+	credit.Balance = balance
+	credit.Redemptions = append(credit.Redemptions, redemption)
+	return &redemption, nil
+}
+
+// Restore gives back up to amount of what was spent of the credit on the
+// reservation with reservationId, no more than was. It reports false when
+// nothing was, or it was given back already.
+func (credit *Credit) Restore(reservationId primitive.ObjectID, amount Money) (bool, error) {
+	i := slices.IndexFunc(credit.Redemptions, func(redemption CreditRedemption) bool {
+		return redemption.ReservationId == reservationId && !redemption.Restored.IsSet()
+	})
+	if i < 0 {
+		return false, nil
+	}
+	if amount.IsNeg() {
+		return false, fmt.Errorf("cannot restore %s", amount)
+	}
+	redemption := &credit.Redemptions[i]
+	restored := amount
+	if cmp, err := amount.Cmp(redemption.Amount); err != nil {
+		return false, err
+	} else if cmp > 0 {
+		restored = redemption.Amount
+	}
+	balance, err := credit.Balance.Add(restored)
+	if err != nil {
+		return false, err
+	}
+	credit.Balance = balance
+	redemption.Restored = restored
+	return true, nil
+}
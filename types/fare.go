@@ -0,0 +1,99 @@
+package types
+
+// FareComponent is one of the amounts paid on top of a base fare, such as the
+// "US" transportation tax or a booking fee.
+type FareComponent struct {
+	Code   string `json:"code" bson:"code"`
+	Name   string `json:"name" bson:"name"`
+	Amount Money  `json:"amount" bson:"amount"`
+}
+
+// FareBreakdown is what a passenger pays for a seat: its base fare, the taxes
+// levied by the airports, the surcharges of the carrier and the service fees.
+// Total is the sum of them all.
+type FareBreakdown struct {
+	BaseFare   Money           `json:"base_fare" bson:"base_fare"`
+	Taxes      []FareComponent `json:"taxes" bson:"taxes"`
+	Surcharges []FareComponent `json:"surcharges" bson:"surcharges"`
+	Fees       []FareComponent `json:"fees" bson:"fees"`
+	Total      Money           `json:"total" bson:"total"`
+}
+
+// NewFareBreakdown adds up a breakdown whose amounts must all be in the
+// currency of baseFare.
+func NewFareBreakdown(baseFare Money, taxes, surcharges, fees []FareComponent) (*FareBreakdown, error) {
+	fare := &FareBreakdown{
+		BaseFare:   baseFare,
+		Taxes:      taxes,
+		Surcharges: surcharges,
+		Fees:       fees,
+	}
+	if fare.Taxes == nil {
+		fare.Taxes = []FareComponent{}
+	}
+	if fare.Surcharges == nil {
+		fare.Surcharges = []FareComponent{}
+	}
+	if fare.Fees == nil {
+		fare.Fees = []FareComponent{}
+	}
+	amounts := []Money{baseFare}
+	for _, component := range fare.components() {
+		amounts = append(amounts, component.Amount)
+	}
+	total, err := Sum(amounts...)
+	if err != nil {
+		return nil, err
+	}
+	fare.Total = total
+	return fare, nil
+}
+
+func (fare *FareBreakdown) components() []FareComponent {
+	components := append([]FareComponent{}, fare.Taxes...)
+	components = append(components, fare.Surcharges...)
+	return append(components, fare.Fees...)
+}
+
+// Convert returns a copy of the breakdown with every amount but the total
+// passed through convert, such as an exchange to another currency, and the
+// total added up again so that the breakdown still adds up.
+func (fare *FareBreakdown) Convert(convert func(Money) (Money, error)) (*FareBreakdown, error) {
+	baseFare, err := convert(fare.BaseFare)
+	if err != nil {
+		return nil, err
+	}
+	converted := [3][]FareComponent{}
+	for i, components := range [3][]FareComponent{fare.Taxes, fare.Surcharges, fare.Fees} {
+		converted[i] = make([]FareComponent, 0, len(components))
+		for _, component := range components {
+			if component.Amount, err = convert(component.Amount); err != nil {
+				return nil, err
+			}
+			converted[i] = append(converted[i], component)
+		}
+	}
+	return NewFareBreakdown(baseFare, converted[0], converted[1], converted[2])
+}
+
+// Equal reports whether both breakdowns are made of the same amounts. Two nil
+// breakdowns are equal.
+func (fare *FareBreakdown) Equal(other *FareBreakdown) bool {
+	if fare == nil || other == nil {
+		return fare == other
+	}
+	if !fare.BaseFare.Equal(other.BaseFare) || !fare.Total.Equal(other.Total) {
+		return false
+	}
+	components, otherComponents := fare.components(), other.components()
+	if len(fare.Taxes) != len(other.Taxes) || len(fare.Surcharges) != len(other.Surcharges) || len(components) != len(otherComponents) {
+		return false
+	}
+	for i, component := range components {
+		other := otherComponents[i]
+		if component.Code != other.Code || component.Name != other.Name || !component.Amount.Equal(other.Amount) {
+			return false
+		}
+	}
+	return true
+}
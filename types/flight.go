@@ -1,39 +1,180 @@
 package types
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
 
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Flight times are stored in UTC. The time zones are the IANA names of the
+// departure and arrival airports' zones, used to present local times.
 type Flight struct {
-	Departure     string               `json:"departure" bson:"departure"`
-	Arrival       string               `json:"arrival" bson:"arrival"`
-	Airline       string               `json:"airline" bson:"airline"`
-	DepartureTime string               `json:"departure_time" bson:"departure_time"`
-	ArrivalTime   string               `json:"arrival_time" bson:"arrival_time"`
-	Seats         []primitive.ObjectID `json:"seats" bson:"seats"`
-	Id            primitive.ObjectID   `json:"id,omitempty" bson:"_id,omitempty"`
+	Departure         string               `json:"departure" bson:"departure"`
+	Arrival           string               `json:"arrival" bson:"arrival"`
+	Airline           string               `json:"airline" bson:"airline"`
+	DepartureTime     time.Time            `json:"departure_time" bson:"departure_time"`
+	ArrivalTime       time.Time            `json:"arrival_time" bson:"arrival_time"`
+	DepartureTimeZone string               `json:"departure_time_zone" bson:"departure_time_zone"`
+	ArrivalTimeZone   string               `json:"arrival_time_zone" bson:"arrival_time_zone"`
+	Aircraft          string               `json:"aircraft,omitempty" bson:"aircraft,omitempty"`
+	Seats             []primitive.ObjectID `json:"seats" bson:"seats"`
+	// Overbooking is how many reservations may be sold beyond the seats of
+	// the flight, without a seat until check-in, and Oversold how many of
+	// them are still waiting for one.
+	Overbooking int                `json:"overbooking,omitempty" bson:"overbooking,omitempty"`
+	Oversold    int                `json:"oversold,omitempty" bson:"oversold,omitempty"`
+	Id          primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+}
+
+var (
+	// ErrOverbookingExhausted is returned when a reservation is sold beyond
+	// the seats of a flight whose overbooking allowance is used up.
+	ErrOverbookingExhausted = errors.New("overbooking allowance exhausted")
+	// ErrNoSeatToAssign is returned when a reservation sold beyond the seats
+	// of its flight checks in and no seat of its class is left.
+	ErrNoSeatToAssign = errors.New("no seat left to assign")
+)
+
+var locations sync.Map
+
+// loadLocation is time.LoadLocation with a cache, falling back to UTC for
+// unknown zones.
+func loadLocation(name string) *time.Location {
+	if location, ok := locations.Load(name); ok {
+		return location.(*time.Location)
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+	locations.Store(name, location)
+	return location
+}
+
+func (flight *Flight) LocalDepartureTime() time.Time {
+	return flight.DepartureTime.In(loadLocation(flight.DepartureTimeZone))
+}
+
+func (flight *Flight) LocalArrivalTime() time.Time {
+	return flight.ArrivalTime.In(loadLocation(flight.ArrivalTimeZone))
+}
+
+func (flight *Flight) Duration() time.Duration {
+	return flight.ArrivalTime.Sub(flight.DepartureTime)
 }
 
+// MarshalJSON adds the local departure and arrival times to the UTC ones.
+func (flight Flight) MarshalJSON() ([]byte, error) {
+	type utcFlight Flight
+	utc := utcFlight(flight)
+	utc.DepartureTime = flight.DepartureTime.UTC()
+	utc.ArrivalTime = flight.ArrivalTime.UTC()
+	return json.Marshal(struct {
+		utcFlight
+		LocalDepartureTime time.Time `json:"local_departure_time"`
+		LocalArrivalTime   time.Time `json:"local_arrival_time"`
+	}{utc, flight.LocalDepartureTime(), flight.LocalArrivalTime()})
+}
+
+// CreateFlightParams takes the times either as RFC3339 timestamps or as
+// local times without offset, which are read in the matching time zone.
+// Time zones default to UTC. Flights with an aircraft get its seat map,
+// otherwise NumberOfSeats generic seats.
 type CreateFlightParams struct {
-	Departure     string `json:"departure" bson:"departure"`
-	Arrival       string `json:"arrival" bson:"arrival"`
-	Airline       string `json:"airline" bson:"airline"`
-	DepartureTime string `json:"departure_time" bson:"departure_time"`
-	ArrivalTime   string `json:"arrival_time" bson:"arrival_time"`
-	NumberOfSeats int    `json:"number_of_seats" bson:"number_of_seats"`
+	Departure         string `json:"departure" bson:"departure"`
+	Arrival           string `json:"arrival" bson:"arrival"`
+	Airline           string `json:"airline" bson:"airline"`
+	DepartureTime     string `json:"departure_time" bson:"departure_time"`
+	ArrivalTime       string `json:"arrival_time" bson:"arrival_time"`
+	DepartureTimeZone string `json:"departure_time_zone" bson:"departure_time_zone"`
+	ArrivalTimeZone   string `json:"arrival_time_zone" bson:"arrival_time_zone"`
+	Aircraft          string `json:"aircraft" bson:"aircraft"`
+	NumberOfSeats     int    `json:"number_of_seats" bson:"number_of_seats"`
+	Overbooking       int    `json:"overbooking" bson:"overbooking"`
 }
 
 type UpdateFlightParams struct {
-	DepartureTime string               `json:"departure_time,omitempty" bson:"departure_time,omitempty"`
-	ArrivalTime   string               `json:"arrival_time,omitempty" bson:"arrival_time,omitempty"`
+	DepartureTime time.Time            `json:"departure_time,omitempty" bson:"departure_time,omitempty"`
+	ArrivalTime   time.Time            `json:"arrival_time,omitempty" bson:"arrival_time,omitempty"`
 	Seats         []primitive.ObjectID `json:"seats,omitempty" bson:"seats,omitempty"`
+	Overbooking   *int                 `json:"overbooking,omitempty" bson:"overbooking,omitempty"`
+}
+
+// OverbookingParams set the overbooking allowance of a flight.
+type OverbookingParams struct {
+	Overbooking int `json:"overbooking"`
+}
+
+func (params OverbookingParams) Validate() map[string]string {
+	errors := make(map[string]string)
+	if params.Overbooking < 0 {
+		errors["overbooking"] = "overbooking must not be negative"
+	}
+	return errors
+}
+
+var localTimeLayouts = []string{"2006-01-02T15:04:05", "2006-01-02T15:04"}
+
+// ParseFlightTime reads value as an RFC3339 timestamp, or as a local time in
+// the IANA time zone named zone.
+func ParseFlightTime(value string, zone string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), nil
+	}
+	location, err := time.LoadLocation(zone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unknown time zone %q", zone)
+	}
+	for _, layout := range localTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, location); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", value)
 }
 
 func NewFlightFromParams(params CreateFlightParams) (*Flight, error) {
+	if params.DepartureTimeZone == "" {
+		params.DepartureTimeZone = "UTC"
+	}
+	if params.ArrivalTimeZone == "" {
+		params.ArrivalTimeZone = "UTC"
+	}
+	for _, zone := range []string{params.DepartureTimeZone, params.ArrivalTimeZone} {
+		if _, err := time.LoadLocation(zone); err != nil {
+			return nil, fmt.Errorf("unknown time zone %q", zone)
+		}
+	}
+
+	departureTime, err := ParseFlightTime(params.DepartureTime, params.DepartureTimeZone)
+	if err != nil {
+		return nil, err
+	}
+	arrivalTime, err := ParseFlightTime(params.ArrivalTime, params.ArrivalTimeZone)
+	if err != nil {
+		return nil, err
+	}
+	if !arrivalTime.After(departureTime) {
+		return nil, fmt.Errorf("arrival time must be after departure time")
+	}
+	if params.Overbooking < 0 {
+		return nil, fmt.Errorf("overbooking must not be negative")
+	}
+
 	return &Flight{
-		Arrival:       params.Arrival,
-		Departure:     params.Departure,
-		Airline:       params.Airline,
-		DepartureTime: params.DepartureTime,
-		ArrivalTime:   params.ArrivalTime,
-		Seats:         []primitive.ObjectID{},
+		Arrival:           params.Arrival,
+		Departure:         params.Departure,
+		Airline:           params.Airline,
+		DepartureTime:     departureTime,
+		ArrivalTime:       arrivalTime,
+		DepartureTimeZone: params.DepartureTimeZone,
+		ArrivalTimeZone:   params.ArrivalTimeZone,
+		Aircraft:          params.Aircraft,
+		Seats:             []primitive.ObjectID{},
+		Overbooking:       params.Overbooking,
 	}, nil
 }
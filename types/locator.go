@@ -0,0 +1,43 @@
+package types
+
+import (
+	"crypto/rand"
+	"math/big"
+	"strings"
+)
+
+// Record locators leave out the letters and digits that are easily confused
+// when read over the phone.
+const (
+	locatorAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	LocatorLength   = 6
+)
+
+func NewLocator() string {
+	locator := make([]byte, LocatorLength)
+	max := big.NewInt(int64(len(locatorAlphabet)))
+	for i := range locator {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			panic(err)
+		}
+		locator[i] = locatorAlphabet[n.Int64()]
+	}
+	return string(locator)
+}
+
+func NormalizeLocator(locator string) string {
+	return strings.ToUpper(strings.TrimSpace(locator))
+}
+
+func IsValidLocator(locator string) bool {
+	if len(locator) != LocatorLength {
+		return false
+	}
+	for _, c := range locator {
+		if !strings.ContainsRune(locatorAlphabet, c) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,184 @@
+package types
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/govalues/decimal"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type LoyaltyTier string
+
+const (
+	LoyaltyMember LoyaltyTier = "member"
+	LoyaltySilver LoyaltyTier = "silver"
+	LoyaltyGold   LoyaltyTier = "gold"
+)
+
+// Rank orders the tiers, the higher ranks first.
+func (tier LoyaltyTier) Rank() int {
+	switch tier {
+	case LoyaltyGold:
+		return 2
+	case LoyaltySilver:
+		return 1
+	}
+	return 0
+}
+
+type LoyaltyEntryKind string
+
+const (
+	PointsEarned   LoyaltyEntryKind = "earned"
+	PointsReversed LoyaltyEntryKind = "reversed"
+	PointsRedeemed LoyaltyEntryKind = "redeemed"
+	PointsRestored LoyaltyEntryKind = "restored"
+)
+
+// ErrPointsUnavailable is returned when loyalty points cannot be spent: the
+// user has not that many, already spent some on the reservation or the
+// reservation is in another currency than the points are worth.
+var ErrPointsUnavailable = errors.New("loyalty points not available")
+
+// LoyaltyAccount holds the loyalty points of a user. Points is what they can
+// spend, and QualifyingPoints what they earned flying, less what was taken
+// back, which decides their Tier in the loyalty program. Activity lists every change of the points,
+// the oldest first.
+//
+// The points taken back for a cancelled reservation may leave Points
+// negative when they were spent already, until more are earned.
+type LoyaltyAccount struct {
+	Id               primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	UserId           primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Points           int                `json:"points" bson:"points"`
+	QualifyingPoints int                `json:"qualifying_points" bson:"qualifying_points"`
+	Tier             LoyaltyTier        `json:"tier" bson:"-"`
+	Activity         []LoyaltyEntry     `json:"activity" bson:"activity"`
+	CreatedAt        time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// LoyaltyEntry is a change of Points to a loyalty account, for a
+// reservation.
+type LoyaltyEntry struct {
+	Kind          LoyaltyEntryKind   `json:"kind" bson:"kind"`
+	Points        int                `json:"points" bson:"points"`
+	ReservationId primitive.ObjectID `json:"reservation_id" bson:"reservation_id"`
+	CreatedAt     time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// NewLoyaltyAccount returns the account of a user who has no points yet.
+func NewLoyaltyAccount(userId primitive.ObjectID, now time.Time) *LoyaltyAccount {
+	return &LoyaltyAccount{
+		UserId:    userId,
+		Activity:  []LoyaltyEntry{},
+		CreatedAt: now.UTC(),
+	}
+}
+
+func (account *LoyaltyAccount) entry(kind LoyaltyEntryKind, reservationId primitive.ObjectID) *LoyaltyEntry {
+	i := slices.IndexFunc(account.Activity, func(entry LoyaltyEntry) bool {
+		return entry.Kind == kind && entry.ReservationId == reservationId
+	})
+	if i < 0 {
+		return nil
+	}
+	return &account.Activity[i]
+}
+
+func (account *LoyaltyAccount) record(kind LoyaltyEntryKind, points int, reservationId primitive.ObjectID, now time.Time) {
+	account.Points += points
+	account.Activity = append(account.Activity, LoyaltyEntry{
+		Kind:          kind,
+		Points:        points,
+		ReservationId: reservationId,
+		CreatedAt:     now.UTC(),
+	})
+}
+
+// Earn adds points for flying on the reservation with reservationId. It
+// reports false when the reservation earned its points already.
+func (account *LoyaltyAccount) Earn(points int, reservationId primitive.ObjectID, now time.Time) bool {
+	if points <= 0 || account.entry(PointsEarned, reservationId) != nil {
+		return false
+	}
+	account.record(PointsEarned, points, reservationId, now)
+	account.QualifyingPoints += points
+	return true
+}
+
+// Reverse takes back the points earned on the reservation with
+// reservationId. It reports false when it earned none, or they were taken
+// back already.
+func (account *LoyaltyAccount) Reverse(reservationId primitive.ObjectID, now time.Time) bool {
+	earned := account.entry(PointsEarned, reservationId)
+	if earned == nil || account.entry(PointsReversed, reservationId) != nil {
+		return false
+	}
+	points := earned.Points
+	account.record(PointsReversed, -points, reservationId, now)
+	account.QualifyingPoints -= points
+	return true
+}
+
+// Redeem spends points on the reservation with reservationId, once per
+// reservation.
+func (account *LoyaltyAccount) Redeem(points int, reservationId primitive.ObjectID, now time.Time) error {
+	if points <= 0 || points > account.Points || account.entry(PointsRedeemed, reservationId) != nil {
+		return ErrPointsUnavailable
+	}
+	account.record(PointsRedeemed, -points, reservationId, now)
+	return nil
+}
+
+// Pay spends up to points on the reservation with reservationId, no more
+// than the account has nor than it takes to pay due with points worth value
+// each, and returns what they took off it. It fails with
+// ErrPointsUnavailable when none can be spent.
+func (account *LoyaltyAccount) Pay(points int, value Money, due Money, reservationId primitive.ObjectID, now time.Time) (*LoyaltyRedemption, error) {
+	if !due.IsPos() || due.Currency() != value.Currency() {
+		return nil, ErrPointsUnavailable
+	}
+	needed, err := due.Decimal().Quo(value.Decimal())
+	if err != nil {
+		return nil, err
+	}
+	if whole, _, ok := needed.Ceil(0).Int64(0); ok && whole < int64(points) {
+		points = int(whole)
+	}
+	spent := min(points, account.Points)
+	amount, err := value.Mul(decimal.MustNew(int64(spent), 0))
+	if err != nil {
+		return nil, err
+	}
+	if cmp, err := amount.Cmp(due); err != nil {
+		return nil, err
+	} else if cmp > 0 {
+		amount = due
+	}
+	if err := account.Redeem(spent, reservationId, now); err != nil {
+		return nil, err
+	}
+	return &LoyaltyRedemption{Points: spent, Amount: amount, CreatedAt: now.UTC()}, nil
+}
+
+// Restore gives back the points spent on the reservation with
+// reservationId. It reports false when none were, or they were given back
+// already.
+func (account *LoyaltyAccount) Restore(reservationId primitive.ObjectID, now time.Time) bool {
+	redeemed := account.entry(PointsRedeemed, reservationId)
+	if redeemed == nil || account.entry(PointsRestored, reservationId) != nil {
+		return false
+	}
+	account.record(PointsRestored, -redeemed.Points, reservationId, now)
+	return true
+}
+
+// LoyaltyRedemption is the Points spent on a reservation and the Amount they
+// took off it.
+type LoyaltyRedemption struct {
+	Points    int       `json:"points" bson:"points"`
+	Amount    Money     `json:"amount" bson:"amount"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
@@ -0,0 +1,235 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/govalues/decimal"
+	"github.com/govalues/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Money is an exact decimal amount in an ISO 4217 currency. It is encoded as
+// {"amount": "123.45", "currency": "USD"} in JSON, and in BSON as a document
+// with a decimal128 amount so that the database can compare amounts.
+//
+// The zero Money is unset: it has no currency, is encoded as null and adds
+// to the amounts in any currency, so totals can start from it.
+type Money struct {
+	amount money.Amount
+	set    bool
+}
+
+func NewMoney(amount decimal.Decimal, currency string) (Money, error) {
+	curr, err := money.ParseCurr(currency)
+	if err != nil {
+		return Money{}, fmt.Errorf("currency %q: %w", currency, err)
+	}
+	a, err := money.NewAmountFromDecimal(curr, amount)
+	if err != nil {
+		return Money{}, err
+	}
+	return MoneyFromAmount(a), nil
+}
+
+// ParseMoney parses an amount such as "123.45" in currency.
+func ParseMoney(amount, currency string) (Money, error) {
+	d, err := decimal.Parse(amount)
+	if err != nil {
+		return Money{}, fmt.Errorf("amount %q: %w", amount, err)
+	}
+	return NewMoney(d, currency)
+}
+
+// MustParseMoney is like ParseMoney but panics when amount or currency is
+// invalid.
+func MustParseMoney(amount, currency string) Money {
+	m, err := ParseMoney(amount, currency)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func MoneyFromAmount(amount money.Amount) Money {
+	return Money{amount: amount, set: true}
+}
+
+func (m Money) Amount() money.Amount {
+	return m.amount
+}
+
+func (m Money) Decimal() decimal.Decimal {
+	return m.amount.Decimal()
+}
+
+// Currency returns the ISO 4217 code of the currency, or "" when m is unset.
+func (m Money) Currency() string {
+	if !m.set {
+		return ""
+	}
+	return m.amount.Curr().Code()
+}
+
+func (m Money) IsSet() bool {
+	return m.set
+}
+
+func (m Money) IsZero() bool {
+	return m.amount.IsZero()
+}
+
+func (m Money) IsNeg() bool {
+	return m.amount.IsNeg()
+}
+
+func (m Money) IsPos() bool {
+	return m.amount.IsPos()
+}
+
+func (m Money) String() string {
+	if !m.set {
+		return ""
+	}
+	return m.amount.String()
+}
+
+// Equal reports whether m and other are the same amount in the same
+// currency, whatever the number of decimals they are written with.
+func (m Money) Equal(other Money) bool {
+	if m.set != other.set {
+		return false
+	}
+	cmp, err := m.amount.Cmp(other.amount)
+	return err == nil && cmp == 0
+}
+
+// Cmp compares two amounts in the same currency.
+func (m Money) Cmp(other Money) (int, error) {
+	return m.amount.Cmp(other.amount)
+}
+
+// Add returns m + other. It fails when both are set in different currencies.
+func (m Money) Add(other Money) (Money, error) {
+	switch {
+	case !other.set:
+		return m, nil
+	case !m.set:
+		return other, nil
+	}
+	sum, err := m.amount.Add(other.amount)
+	if err != nil {
+		return Money{}, err
+	}
+	return MoneyFromAmount(sum), nil
+}
+
+// Sub returns m - other. It fails when both are set in different currencies.
+func (m Money) Sub(other Money) (Money, error) {
+	switch {
+	case !other.set:
+		return m, nil
+	case !m.set:
+		return MoneyFromAmount(other.amount.Neg()), nil
+	}
+	difference, err := m.amount.Sub(other.amount)
+	if err != nil {
+		return Money{}, err
+	}
+	return MoneyFromAmount(difference), nil
+}
+
+// Mul returns m times factor, such as a tax rate or the share of a fare to
+// refund, rounded to the minor unit of the currency.
+func (m Money) Mul(factor decimal.Decimal) (Money, error) {
+	if !m.set {
+		return m, nil
+	}
+	product, err := m.amount.Mul(factor)
+	if err != nil {
+		return Money{}, err
+	}
+	return MoneyFromAmount(product.RoundToCurr()), nil
+}
+
+// Sum adds up amounts that are all in the same currency. The sum of no
+// amounts is unset.
+func Sum(amounts ...Money) (Money, error) {
+	total := Money{}
+	for _, amount := range amounts {
+		var err error
+		if total, err = total.Add(amount); err != nil {
+			return Money{}, err
+		}
+	}
+	return total, nil
+}
+
+// MarshalJSON writes the amount as a string so that clients parsing JSON
+// numbers as floats do not round it.
+func (m Money) MarshalJSON() ([]byte, error) {
+	if !m.set {
+		return []byte("null"), nil
+	}
+	return json.Marshal(struct {
+		Amount   string `json:"amount"`
+		Currency string `json:"currency"`
+	}{m.amount.Decimal().String(), m.Currency()})
+}
+
+// UnmarshalJSON accepts the amount either as a string or as a number.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		*m = Money{}
+		return nil
+	}
+	value := struct {
+		Amount   json.Number `json:"amount"`
+		Currency string      `json:"currency"`
+	}{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	parsed, err := ParseMoney(value.Amount.String(), value.Currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+type moneyBSON struct {
+	Amount   primitive.Decimal128 `bson:"amount"`
+	Currency string               `bson:"currency"`
+}
+
+func (m Money) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	if !m.set {
+		return bson.TypeNull, nil, nil
+	}
+	amount, err := primitive.ParseDecimal128(m.amount.Decimal().String())
+	if err != nil {
+		return 0, nil, err
+	}
+	return bson.MarshalValue(moneyBSON{Amount: amount, Currency: m.Currency()})
+}
+
+func (m *Money) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	if t == bson.TypeNull || t == bson.TypeUndefined {
+		*m = Money{}
+		return nil
+	}
+	value := moneyBSON{}
+	if err := bson.UnmarshalValue(t, data, &value); err != nil {
+		return err
+	}
+	parsed, err := ParseMoney(value.Amount.String(), value.Currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
@@ -0,0 +1,103 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/govalues/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestMoneyArithmetic(t *testing.T) {
+	fare := MustParseMoney("199.99", "USD")
+
+	tax, err := fare.Mul(decimal.MustParse("0.075"))
+	require.NoError(t, err)
+	assert.Equal(t, "USD 15.00", tax.String())
+
+	total, err := Sum(fare, tax, MustParseMoney("0.01", "USD"))
+	require.NoError(t, err)
+	assert.Equal(t, "USD 215.00", total.String())
+
+	refund, err := total.Sub(MustParseMoney("50", "USD"))
+	require.NoError(t, err)
+	assert.True(t, refund.Equal(MustParseMoney("165", "USD")))
+
+	_, err = fare.Add(MustParseMoney("10", "EUR"))
+	assert.Error(t, err)
+	_, err = Sum(fare, MustParseMoney("10", "EUR"))
+	assert.Error(t, err)
+
+	// the zero Money adds to any currency
+	unset, err := Sum()
+	require.NoError(t, err)
+	assert.False(t, unset.IsSet())
+	sum, err := unset.Add(MustParseMoney("1000", "JPY"))
+	require.NoError(t, err)
+	assert.Equal(t, "JPY 1000", sum.String())
+
+	_, err = ParseMoney("12.5", "XYZ")
+	assert.Error(t, err)
+	_, err = ParseMoney("twelve", "USD")
+	assert.Error(t, err)
+}
+
+func TestMoneyEncoding(t *testing.T) {
+	type priced struct {
+		Price Money `json:"price" bson:"price"`
+	}
+	price := priced{Price: MustParseMoney("0.10", "EUR")}
+
+	encoded, err := json.Marshal(price)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"price": {"amount": "0.10", "currency": "EUR"}}`, string(encoded))
+	decoded := priced{}
+	require.NoError(t, json.Unmarshal([]byte(`{"price": {"amount": 0.1, "currency": "EUR"}}`), &decoded))
+	assert.Equal(t, price, decoded)
+	assert.Error(t, json.Unmarshal([]byte(`{"price": {"amount": "0.1", "currency": "euro"}}`), &decoded))
+
+	raw, err := bson.Marshal(price)
+	require.NoError(t, err)
+	amount, err := bson.Raw(raw).LookupErr("price", "amount")
+	require.NoError(t, err)
+	assert.Equal(t, bson.TypeDecimal128, amount.Type)
+	decoded = priced{}
+	require.NoError(t, bson.Unmarshal(raw, &decoded))
+	assert.Equal(t, price, decoded)
+
+	// unset prices are null
+	encoded, err = json.Marshal(priced{})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"price": null}`, string(encoded))
+	raw, err = bson.Marshal(priced{})
+	require.NoError(t, err)
+	decoded = priced{Price: MustParseMoney("1", "USD")}
+	require.NoError(t, bson.Unmarshal(raw, &decoded))
+	assert.False(t, decoded.Price.IsSet())
+}
+
+func TestFareBreakdown(t *testing.T) {
+	tax := []FareComponent{{Code: "US", Name: "Transportation tax", Amount: MustParseMoney("7.50", "USD")}}
+	fee := []FareComponent{{Code: "OB", Name: "Booking fee", Amount: MustParseMoney("5", "USD")}}
+	fare, err := NewFareBreakdown(MustParseMoney("100", "USD"), tax, nil, fee)
+	require.NoError(t, err)
+	assert.Equal(t, "USD 112.50", fare.Total.String())
+	assert.NotNil(t, fare.Surcharges)
+
+	_, err = NewFareBreakdown(MustParseMoney("100", "EUR"), tax, nil, nil)
+	assert.Error(t, err)
+
+	// the converted total adds up the converted amounts
+	third := decimal.MustParse("0.333")
+	converted, err := fare.Convert(func(amount Money) (Money, error) { return amount.Mul(third) })
+	require.NoError(t, err)
+	assert.Equal(t, "USD 33.30", converted.BaseFare.String())
+	assert.Equal(t, "USD 37.46", converted.Total.String())
+	assert.Equal(t, "USD 112.50", fare.Total.String())
+	assert.False(t, fare.Equal(converted))
+	assert.True(t, fare.Equal(fare))
+	assert.True(t, (*FareBreakdown)(nil).Equal(nil))
+	assert.False(t, fare.Equal(nil))
+}
@@ -0,0 +1,121 @@
+package types
+
+import (
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type PassengerType string
+
+const (
+	Adult  PassengerType = "adult"
+	Child  PassengerType = "child"
+	Infant PassengerType = "infant"
+)
+
+const (
+	minChildAge = 2
+	minAdultAge = 12
+)
+
+func (t PassengerType) IsValid() bool {
+	switch t {
+	case Adult, Child, Infant:
+		return true
+	}
+	return false
+}
+
+// PassengerTypeAt returns the type of a passenger born on dateOfBirth who
+// travels on date.
+func PassengerTypeAt(dateOfBirth time.Time, date time.Time) PassengerType {
+	age := date.Year() - dateOfBirth.Year()
+	if date.Month() < dateOfBirth.Month() || (date.Month() == dateOfBirth.Month() && date.Day() < dateOfBirth.Day()) {
+		age--
+	}
+	switch {
+	case age < minChildAge:
+		return Infant
+	case age < minAdultAge:
+		return Child
+	default:
+		return Adult
+	}
+}
+
+type TravelDocument struct {
+	Type           string `json:"type" bson:"type"`
+	Number         string `json:"number" bson:"number"`
+	IssuingCountry string `json:"issuing_country" bson:"issuing_country"`
+	ExpiryDate     string `json:"expiry_date" bson:"expiry_date"`
+}
+
+// Passenger is who travels on a reserved seat, which is not necessarily the
+// user who owns the reservation.
+type Passenger struct {
+	FirstName   string          `json:"first_name" bson:"first_name"`
+	LastName    string          `json:"last_name" bson:"last_name"`
+	DateOfBirth string          `json:"date_of_birth,omitempty" bson:"date_of_birth,omitempty"`
+	Type        PassengerType   `json:"type" bson:"type"`
+	Document    *TravelDocument `json:"document,omitempty" bson:"document,omitempty"`
+}
+
+// PassengerFromUser is the passenger of a reservation made without passenger
+// details: the user travels on the seat themselves.
+func PassengerFromUser(user *User) *Passenger {
+	return &Passenger{
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Type:      Adult,
+	}
+}
+
+// Validate checks the passenger for a flight departing at departure. The
+// passenger type must match the age of the passenger on that day.
+func (passenger Passenger) Validate(departure time.Time) map[string]string {
+	errors := make(map[string]string)
+	if passenger.FirstName == "" {
+		errors["first_name"] = "first name is required"
+	}
+	if passenger.LastName == "" {
+		errors["last_name"] = "last name is required"
+	}
+	if !passenger.Type.IsValid() {
+		errors["type"] = fmt.Sprintf("type must be one of %s, %s or %s", Adult, Child, Infant)
+	}
+
+	dateOfBirth, err := time.Parse(time.DateOnly, passenger.DateOfBirth)
+	switch {
+	case err != nil:
+		errors["date_of_birth"] = "date of birth must be a YYYY-MM-DD date"
+	case dateOfBirth.After(departure):
+		errors["date_of_birth"] = "date of birth is after the departure"
+	case passenger.Type.IsValid() && PassengerTypeAt(dateOfBirth, departure) != passenger.Type:
+		errors["type"] = fmt.Sprintf("passenger is %s on the day of departure", PassengerTypeAt(dateOfBirth, departure))
+	}
+
+	if document := passenger.Document; document != nil {
+		if document.Type == "" || document.Number == "" || document.IssuingCountry == "" {
+			errors["document"] = "document type, number and issuing country are required"
+		} else if expiry, err := time.Parse(time.DateOnly, document.ExpiryDate); err != nil {
+			errors["document.expiry_date"] = "expiry date must be a YYYY-MM-DD date"
+		} else if expiry.Before(departure) {
+			errors["document.expiry_date"] = "document expires before the departure"
+		}
+	}
+	return errors
+}
+
+// ManifestEntry is a passenger on board of a flight along with the seat and
+// the reservation they travel with.
+type ManifestEntry struct {
+	ReservationId primitive.ObjectID `json:"reservation_id"`
+	UserId        primitive.ObjectID `json:"user_id"`
+	SeatId        primitive.ObjectID `json:"seat_id"`
+	SeatNumber    int                `json:"seat_number"`
+	Seat          string             `json:"seat,omitempty"`
+	Class         SeatClass          `json:"class"`
+	Passenger     *Passenger         `json:"passenger"`
+}
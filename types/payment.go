@@ -0,0 +1,65 @@
+package types
+
+import "time"
+
+type PaymentStatus string
+
+const (
+	// PaymentPending is a payment the provider has not decided on yet. It
+	// tells about it later through a webhook.
+	PaymentPending    PaymentStatus = "pending"
+	PaymentAuthorized PaymentStatus = "authorized"
+	PaymentCaptured   PaymentStatus = "captured"
+	PaymentFailed     PaymentStatus = "failed"
+	PaymentVoided     PaymentStatus = "voided"
+	PaymentRefunded   PaymentStatus = "refunded"
+)
+
+func (status PaymentStatus) IsValid() bool {
+	switch status {
+	case PaymentPending, PaymentAuthorized, PaymentCaptured, PaymentFailed, PaymentVoided, PaymentRefunded:
+		return true
+	}
+	return false
+}
+
+// IsAwaited reports whether a payment in status may still be captured.
+func (status PaymentStatus) IsAwaited() bool {
+	return status == PaymentPending || status == PaymentAuthorized
+}
+
+// ReservationStatus returns the status a reservation in from moves to once
+// its payment is in status, or "" when it stays in from. Reservations
+// awaiting their payment are confirmed or cancelled by it, and the cancelled
+// ones are refunded once their payment is.
+func (status PaymentStatus) ReservationStatus(from ReservationStatus) ReservationStatus {
+	switch {
+	case from == ReservationPending && status == PaymentCaptured:
+		return ReservationConfirmed
+	case from == ReservationPending && (status == PaymentFailed || status == PaymentVoided):
+		return ReservationCancelled
+	case (from == ReservationCancelled || from == ReservationNoShow || from == ReservationDeniedBoarding) && status == PaymentRefunded:
+		return ReservationRefunded
+	}
+	return ""
+}
+
+// Payment is how a reservation is paid for. The reservations of a booking
+// share a single payment, with the same Reference at the provider, and each
+// records the Amount of it that pays for its own seat. A payment still
+// awaited at ExpiresAt is given up on, cancelling its reservations.
+type Payment struct {
+	Provider  string        `json:"provider" bson:"provider"`
+	Reference string        `json:"reference" bson:"reference"`
+	Status    PaymentStatus `json:"status" bson:"status"`
+	Amount    Money         `json:"amount" bson:"amount"`
+	Reason    string        `json:"reason,omitempty" bson:"reason,omitempty"`
+	ExpiresAt time.Time     `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+	UpdatedAt time.Time     `json:"updated_at" bson:"updated_at"`
+}
+
+// IsExpired reports whether the payment is still awaited past its expiry at
+// now.
+func (payment *Payment) IsExpired(now time.Time) bool {
+	return payment.Status.IsAwaited() && !payment.ExpiresAt.IsZero() && !now.Before(payment.ExpiresAt)
+}
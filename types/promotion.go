@@ -0,0 +1,193 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/govalues/decimal"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type DiscountType string
+
+const (
+	DiscountPercentage DiscountType = "percentage"
+	DiscountFixed      DiscountType = "fixed"
+)
+
+var (
+	// ErrPromotionNotApplicable is returned for a promo code that does not
+	// exist, is not valid at the time or not for the seat.
+	ErrPromotionNotApplicable = errors.New("promo code not applicable")
+	// ErrPromotionExhausted is returned for a promo code redeemed as many
+	// times as it may be, overall or by the user.
+	ErrPromotionExhausted = errors.New("promo code exhausted")
+)
+
+// Promotion is a discount on the base fare of the seats reserved with its
+// Code. It takes Percent off the base fare, or a fixed Amount, never more
+// than the base fare. Routes, keyed like "JFK-LAX", Airlines and Classes
+// limit it to the seats they match, when set. It is valid from ValidFrom
+// until ValidUntil, when set, and may be redeemed at most MaxRedemptions
+// times, and MaxPerUser times by each user, when set.
+//
+// Redemptions counts the reservations made with it so far, and RedeemedBy
+// the ones made by each user, keyed by their hex id.
+type Promotion struct {
+	Id             primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	Code           string             `json:"code" bson:"code"`
+	DiscountType   DiscountType       `json:"discount_type" bson:"discount_type"`
+	Percent        float64            `json:"percent,omitempty" bson:"percent,omitempty"`
+	Amount         Money              `json:"amount" bson:"amount"`
+	Routes         []string           `json:"routes,omitempty" bson:"routes,omitempty"`
+	Airlines       []string           `json:"airlines,omitempty" bson:"airlines,omitempty"`
+	Classes        []SeatClass        `json:"classes,omitempty" bson:"classes,omitempty"`
+	ValidFrom      time.Time          `json:"valid_from,omitempty" bson:"valid_from,omitempty"`
+	ValidUntil     time.Time          `json:"valid_until,omitempty" bson:"valid_until,omitempty"`
+	MaxRedemptions int                `json:"max_redemptions,omitempty" bson:"max_redemptions,omitempty"`
+	MaxPerUser     int                `json:"max_per_user,omitempty" bson:"max_per_user,omitempty"`
+	Redemptions    int                `json:"redemptions" bson:"redemptions"`
+	RedeemedBy     map[string]int     `json:"redeemed_by,omitempty" bson:"redeemed_by,omitempty"`
+	CreatedAt      time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// NormalizePromoCode returns code the way it is stored: promo codes are
+// matched case-insensitively.
+func NormalizePromoCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Discount returns what the promotion takes off a seat of flight whose base
+// fare is base, when reserved by the user with userId at now.
+func (promotion *Promotion) Discount(flight *Flight, seat *Seat, base Money, userId primitive.ObjectID, now time.Time) (Money, error) {
+	if !promotion.ValidFrom.IsZero() && now.Before(promotion.ValidFrom) {
+		return Money{}, fmt.Errorf("%w: not valid yet", ErrPromotionNotApplicable)
+	}
+	if !promotion.ValidUntil.IsZero() && !now.Before(promotion.ValidUntil) {
+		return Money{}, fmt.Errorf("%w: expired", ErrPromotionNotApplicable)
+	}
+	route := flight.Departure + "-" + flight.Arrival
+	if len(promotion.Routes) > 0 && !slices.Contains(promotion.Routes, route) {
+		return Money{}, fmt.Errorf("%w: not valid on %s", ErrPromotionNotApplicable, route)
+	}
+	if len(promotion.Airlines) > 0 && !slices.Contains(promotion.Airlines, flight.Airline) {
+		return Money{}, fmt.Errorf("%w: not valid with %s", ErrPromotionNotApplicable, flight.Airline)
+	}
+	if len(promotion.Classes) > 0 && !slices.Contains(promotion.Classes, seat.Class) {
+		return Money{}, fmt.Errorf("%w: not valid in this class", ErrPromotionNotApplicable)
+	}
+	if promotion.MaxRedemptions > 0 && promotion.Redemptions >= promotion.MaxRedemptions {
+		return Money{}, ErrPromotionExhausted
+	}
+	if promotion.MaxPerUser > 0 && promotion.RedeemedBy[userId.Hex()] >= promotion.MaxPerUser {
+		return Money{}, fmt.Errorf("%w for this user", ErrPromotionExhausted)
+	}
+
+	if promotion.DiscountType == DiscountPercentage {
+		rate, err := decimal.NewFromFloat64(promotion.Percent / 100)
+		if err != nil {
+			return Money{}, err
+		}
+		return base.Mul(rate)
+	}
+	if promotion.Amount.Currency() != base.Currency() {
+		return Money{}, fmt.Errorf("%w: only valid in %s", ErrPromotionNotApplicable, promotion.Amount.Currency())
+	}
+	if cmp, err := promotion.Amount.Cmp(base); err != nil || cmp <= 0 {
+		return promotion.Amount, err
+	}
+	return base, nil
+}
+
+// Redeem counts a redemption of the promotion by the user with userId.
+func (promotion *Promotion) Redeem(userId primitive.ObjectID) {
+	if promotion.RedeemedBy == nil {
+		promotion.RedeemedBy = map[string]int{}
+	}
+	promotion.Redemptions++
+	promotion.RedeemedBy[userId.Hex()]++
+}
+
+// AppliedPromotion is the Discount a promotion took off a reservation.
+type AppliedPromotion struct {
+	PromotionId primitive.ObjectID `json:"promotion_id" bson:"promotion_id"`
+	Code        string             `json:"code" bson:"code"`
+	Discount    Money              `json:"discount" bson:"discount"`
+}
+
+// PromotionParams are the fields of a promotion set by admins, when creating
+// it and when updating it.
+type PromotionParams struct {
+	Code           string       `json:"code"`
+	DiscountType   DiscountType `json:"discount_type"`
+	Percent        float64      `json:"percent"`
+	Amount         Money        `json:"amount"`
+	Routes         []string     `json:"routes"`
+	Airlines       []string     `json:"airlines"`
+	Classes        []SeatClass  `json:"classes"`
+	ValidFrom      time.Time    `json:"valid_from"`
+	ValidUntil     time.Time    `json:"valid_until"`
+	MaxRedemptions int          `json:"max_redemptions"`
+	MaxPerUser     int          `json:"max_per_user"`
+}
+
+func (params PromotionParams) Validate() map[string]string {
+	errors := make(map[string]string)
+	if NormalizePromoCode(params.Code) == "" {
+		errors["code"] = "code is required"
+	}
+	switch params.DiscountType {
+	case DiscountPercentage:
+		if params.Percent <= 0 || params.Percent > 100 {
+			errors["percent"] = "percent must be more than 0 and at most 100"
+		}
+	case DiscountFixed:
+		if !params.Amount.IsPos() {
+			errors["amount"] = "amount must be positive"
+		}
+	default:
+		errors["discount_type"] = fmt.Sprintf("discount_type must be %s or %s", DiscountPercentage, DiscountFixed)
+	}
+	for _, class := range params.Classes {
+		if class < Economy || class > First {
+			errors["classes"] = fmt.Sprintf("invalid class %d", class)
+		}
+	}
+	if !params.ValidFrom.IsZero() && !params.ValidUntil.IsZero() && !params.ValidFrom.Before(params.ValidUntil) {
+		errors["valid_until"] = "valid_until must be after valid_from"
+	}
+	if params.MaxRedemptions < 0 {
+		errors["max_redemptions"] = "max_redemptions must not be negative"
+	}
+	if params.MaxPerUser < 0 {
+		errors["max_per_user"] = "max_per_user must not be negative"
+	}
+	return errors
+}
+
+// Apply sets the fields of params on promotion, leaving its redemptions as
+// they are.
+func (params PromotionParams) Apply(promotion *Promotion) {
+	promotion.Code = NormalizePromoCode(params.Code)
+	promotion.DiscountType = params.DiscountType
+	promotion.Percent = 0
+	promotion.Amount = Money{}
+	if params.DiscountType == DiscountPercentage {
+		promotion.Percent = params.Percent
+	} else {
+		promotion.Amount = params.Amount
+	}
+	promotion.Routes = []string{}
+	for _, route := range params.Routes {
+		promotion.Routes = append(promotion.Routes, strings.ToUpper(route))
+	}
+	promotion.Airlines = params.Airlines
+	promotion.Classes = params.Classes
+	promotion.ValidFrom = params.ValidFrom.UTC()
+	promotion.ValidUntil = params.ValidUntil.UTC()
+	promotion.MaxRedemptions = params.MaxRedemptions
+	promotion.MaxPerUser = params.MaxPerUser
+}
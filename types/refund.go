@@ -0,0 +1,98 @@
+package types
+
+import (
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RefundPolicy tells which rule decided the amount of a refund.
+type RefundPolicy string
+
+const (
+	// RefundFreeWindow refunds in full the reservations cancelled shortly
+	// after they were made, whatever their fare.
+	RefundFreeWindow RefundPolicy = "free_window"
+	// RefundFeeSchedule keeps a fee that depends on how long before the
+	// departure the reservation is cancelled.
+	RefundFeeSchedule   RefundPolicy = "fee_schedule"
+	RefundNonRefundable RefundPolicy = "non_refundable"
+	// RefundOverride is an amount set by an admin instead of the policy.
+	RefundOverride RefundPolicy = "override"
+	// RefundDeniedBoarding refunds in full the passengers denied boarding,
+	// who are compensated with a credit on top.
+	RefundDeniedBoarding RefundPolicy = "denied_boarding"
+)
+
+// Refund records what was given back of the amount paid for a reservation
+// when it was cancelled, and the Fee kept out of it. CreditId is the credit
+// issued for the fee, or as compensation for being denied boarding, if any.
+type Refund struct {
+	Amount       Money              `json:"amount" bson:"amount"`
+	Fee          Money              `json:"fee" bson:"fee"`
+	Policy       RefundPolicy       `json:"policy" bson:"policy"`
+	OverriddenBy primitive.ObjectID `json:"overridden_by,omitempty" bson:"overridden_by,omitempty"`
+	CreditId     primitive.ObjectID `json:"credit_id,omitempty" bson:"credit_id,omitempty"`
+	CreatedAt    time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// NewRefund returns the refund of paid that keeps fee.
+func NewRefund(paid, fee Money, policy RefundPolicy, at time.Time) (*Refund, error) {
+	if fee.IsNeg() {
+		return nil, fmt.Errorf("fee must not be negative")
+	}
+	amount, err := paid.Sub(fee)
+	if err != nil {
+		return nil, err
+	}
+	if amount.IsNeg() {
+		return nil, fmt.Errorf("fee %s is more than the %s paid", fee, paid)
+	}
+	return &Refund{Amount: amount, Fee: fee, Policy: policy, CreatedAt: at.UTC()}, nil
+}
+
+// Share is the part of amount the refund gives back, in the proportion of
+// what it refunds of what was paid. All of amount is given back when nothing
+// was paid.
+func (refund *Refund) Share(amount Money) (Money, error) {
+	paid, err := refund.Amount.Add(refund.Fee)
+	if err != nil {
+		return Money{}, err
+	}
+	if !paid.IsPos() {
+		return amount, nil
+	}
+	ratio, err := refund.Amount.Decimal().Quo(paid.Decimal())
+	if err != nil {
+		return Money{}, err
+	}
+	return amount.Mul(ratio)
+}
+
+// OverrideRefund returns the refund of amount out of paid set by the admin
+// with adminId.
+func OverrideRefund(paid, amount Money, adminId primitive.ObjectID, at time.Time) (*Refund, error) {
+	if amount.Currency() != paid.Currency() {
+		return nil, fmt.Errorf("refund must be in %s", paid.Currency())
+	}
+	if amount.IsNeg() {
+		return nil, fmt.Errorf("refund must not be negative")
+	}
+	fee, err := paid.Sub(amount)
+	if err != nil {
+		return nil, err
+	}
+	refund, err := NewRefund(paid, fee, RefundOverride, at)
+	if err != nil {
+		return nil, fmt.Errorf("refund of %s is more than the %s paid", amount, paid)
+	}
+	refund.OverriddenBy = adminId
+	return refund, nil
+}
+
+// CancelReservationParams is the optional body of a cancellation. Only admins
+// may set RefundAmount, to refund that instead of what the policy says.
+type CancelReservationParams struct {
+	RefundAmount *Money `json:"refund_amount"`
+}
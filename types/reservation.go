@@ -1,25 +1,174 @@
 package types
 
 import (
+	"fmt"
+	"time"
+
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Price is what the seat cost when it was reserved, or last changed, whatever
+// its price became afterwards, and Fare the breakdown of what was paid for it
+// then. SeatChanges records the moves from a seat to another.
+//
+// The reservations sold beyond the seats of an overbooked flight have no
+// seat, only the Class they are given one in at check-in.
 type Reservation struct {
-	ReservationDate  string             `json:"reservation_date,omitempty" bson:"reservation_date,omitempty"`
-	CancellationDate string             `json:"cancellation_date,omitempty" bson:"cancellation_date,omitempty"`
+	ReservationDate  time.Time          `json:"reservation_date" bson:"reservation_date"`
+	CancellationDate *time.Time         `json:"cancellation_date,omitempty" bson:"cancellation_date,omitempty"`
 	Id               primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	Locator          string             `json:"locator,omitempty" bson:"locator,omitempty"`
 	SeatId           primitive.ObjectID `json:"seat_id,omitempty" bson:"seat_id,omitempty"`
+	Class            SeatClass          `json:"class,omitempty" bson:"class,omitempty"`
+	FlightId         primitive.ObjectID `json:"flight_id,omitempty" bson:"flight_id,omitempty"`
 	UserId           primitive.ObjectID `json:"user_id,omitempty" bson:"user_id,omitempty"`
+	BookingId        primitive.ObjectID `json:"booking_id,omitempty" bson:"booking_id,omitempty"`
+	Passenger        *Passenger         `json:"passenger,omitempty" bson:"passenger,omitempty"`
+	Price            Money              `json:"price" bson:"price"`
+	Fare             *FareBreakdown     `json:"fare,omitempty" bson:"fare,omitempty"`
+	Payment          *Payment           `json:"payment,omitempty" bson:"payment,omitempty"`
+	Refund           *Refund            `json:"refund,omitempty" bson:"refund,omitempty"`
+	Promotion        *AppliedPromotion  `json:"promotion,omitempty" bson:"promotion,omitempty"`
+	Credit           *CreditRedemption  `json:"credit,omitempty" bson:"credit,omitempty"`
+	Loyalty          *LoyaltyRedemption `json:"loyalty,omitempty" bson:"loyalty,omitempty"`
+	SeatChanges      []SeatChange       `json:"seat_changes,omitempty" bson:"seat_changes,omitempty"`
+	Status           ReservationStatus  `json:"status" bson:"status"`
+	History          []StatusChange     `json:"history" bson:"history"`
+	// Unsettled tells that the reservation was cancelled or denied boarding
+	// but its refund, the points it earned and the offer of its seat to the
+	// waitlist are not all carried out yet.
+	Unsettled bool `json:"unsettled,omitempty" bson:"unsettled,omitempty"`
+}
+
+// CurrentStatus returns the status of the reservation, deriving it for the
+// reservations stored before statuses were recorded.
+func (reservation *Reservation) CurrentStatus() ReservationStatus {
+	switch {
+	case reservation.Status != "":
+		return reservation.Status
+	case reservation.CancellationDate != nil:
+		return ReservationCancelled
+	default:
+		return ReservationConfirmed
+	}
+}
+
+// IsAssigned reports whether the reservation has a seat.
+func (reservation *Reservation) IsAssigned() bool {
+	return !reservation.SeatId.IsZero()
+}
+
+// BaseFare is the base fare of the reservation, before its promotion: the
+// base of its fare, or its price when it has no breakdown.
+func (reservation *Reservation) BaseFare() Money {
+	if reservation.Fare != nil {
+		return reservation.Fare.BaseFare
+	}
+	return reservation.Price
+}
+
+// AmountDue is what the passenger pays for the reservation: the total of its
+// fare, or its price when it has no breakdown, less the discount of its
+// promotion and the credit and loyalty points spent on it.
+func (reservation *Reservation) AmountDue() Money {
+	due := reservation.Price
+	if reservation.Fare != nil {
+		due = reservation.Fare.Total
+	}
+	deductions := []Money{}
+	if reservation.Promotion != nil {
+		deductions = append(deductions, reservation.Promotion.Discount)
+	}
+	if reservation.Credit != nil {
+		deductions = append(deductions, reservation.Credit.Amount)
+	}
+	if reservation.Loyalty != nil {
+		deductions = append(deductions, reservation.Loyalty.Amount)
+	}
+	for _, deduction := range deductions {
+		left, err := due.Sub(deduction)
+		switch {
+		case err != nil:
+			// discounts, credit and points only apply in the currency of
+			// the reservation
+			continue
+		case left.IsNeg():
+			return Money{}
+		}
+		due = left
+	}
+	return due
+}
+
+// AmountPaid is what was charged for the reservation, unset until its
+// payment is captured.
+func (reservation *Reservation) AmountPaid() Money {
+	if reservation.Payment == nil {
+		return Money{}
+	}
+	switch reservation.Payment.Status {
+	case PaymentCaptured, PaymentRefunded:
+		return reservation.Payment.Amount
+	}
+	return Money{}
+}
+
+// AmountRefundable is what the cancellation policies apply to: what was
+// charged for the reservation, or the credit spent on it when nothing was.
+func (reservation *Reservation) AmountRefundable() Money {
+	if paid := reservation.AmountPaid(); paid.IsPos() || reservation.Credit == nil {
+		return paid
+	}
+	return reservation.Credit.Amount
 }
 
 type CreateReservationParams struct {
-	SeatId primitive.ObjectID `json:"seat_id" bson:"seat_id"`
-	UserId primitive.ObjectID `json:"user_id" bson:"user_id"`
+	SeatId    primitive.ObjectID `json:"seat_id" bson:"seat_id"`
+	Class     SeatClass          `json:"class" bson:"class"`
+	FlightId  primitive.ObjectID `json:"flight_id" bson:"flight_id"`
+	UserId    primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Passenger *Passenger         `json:"passenger" bson:"passenger"`
+	Price     Money              `json:"price" bson:"price"`
+	Fare      *FareBreakdown     `json:"fare" bson:"fare"`
 }
 
 func ReservationFromParams(params *CreateReservationParams) *Reservation {
 	return &Reservation{
-		SeatId: params.SeatId,
-		UserId: params.UserId,
+		SeatId:    params.SeatId,
+		Class:     params.Class,
+		FlightId:  params.FlightId,
+		UserId:    params.UserId,
+		Passenger: params.Passenger,
+		Price:     params.Price,
+		Fare:      params.Fare,
+	}
+}
+
+// ReservationBody is the optional body of the requests that reserve a single
+// seat. Without a passenger the user travels on the seat themselves.
+// PaymentMethod is the token of the card or account to charge, as issued by
+// the payment provider to the client, and CreditId the id of a credit of the
+// user to spend first. PromoCode is the code of a promotion to apply, and
+// LoyaltyPoints how many of their loyalty points to spend at most.
+type ReservationBody struct {
+	Passenger     *Passenger `json:"passenger"`
+	PaymentMethod string     `json:"payment_method"`
+	CreditId      string     `json:"credit_id"`
+	PromoCode     string     `json:"promo_code"`
+	LoyaltyPoints int        `json:"loyalty_points"`
+}
+
+// UnassignedReservationBody is the body of the requests that reserve a seat
+// of Class, yet to be assigned, on a flight with no seat left in it.
+type UnassignedReservationBody struct {
+	ReservationBody
+	Class SeatClass `json:"class"`
+}
+
+func (body UnassignedReservationBody) Validate() map[string]string {
+	errors := make(map[string]string)
+	if body.Class < Economy || body.Class > First {
+		errors["class"] = fmt.Sprintf("invalid class %d", body.Class)
 	}
+	return errors
 }
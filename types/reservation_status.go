@@ -0,0 +1,121 @@
+package types
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+type ReservationStatus string
+
+const (
+	ReservationHeld      ReservationStatus = "held"
+	ReservationPending   ReservationStatus = "pending_payment"
+	ReservationConfirmed ReservationStatus = "confirmed"
+	ReservationTicketed  ReservationStatus = "ticketed"
+	ReservationCheckedIn ReservationStatus = "checked_in"
+	ReservationBoarded   ReservationStatus = "boarded"
+	ReservationCancelled ReservationStatus = "cancelled"
+	ReservationNoShow    ReservationStatus = "no_show"
+	// ReservationDeniedBoarding is a passenger left behind by an overbooked
+	// flight.
+	ReservationDeniedBoarding ReservationStatus = "denied_boarding"
+	ReservationRefunded       ReservationStatus = "refunded"
+)
+
+// reservationTransitions lists the statuses a reservation can move to from
+// each status. Boarded and refunded reservations are final. New reservations
+// are pending until their payment is captured, and cancelled if it fails.
+var reservationTransitions = map[ReservationStatus][]ReservationStatus{
+	ReservationHeld:           {ReservationConfirmed, ReservationCancelled},
+	ReservationPending:        {ReservationConfirmed, ReservationCancelled},
+	ReservationConfirmed:      {ReservationTicketed, ReservationCancelled, ReservationDeniedBoarding},
+	ReservationTicketed:       {ReservationCheckedIn, ReservationCancelled, ReservationNoShow, ReservationDeniedBoarding},
+	ReservationCheckedIn:      {ReservationBoarded, ReservationCancelled, ReservationNoShow, ReservationDeniedBoarding},
+	ReservationBoarded:        {},
+	ReservationCancelled:      {ReservationRefunded},
+	ReservationNoShow:         {ReservationRefunded},
+	ReservationDeniedBoarding: {ReservationRefunded},
+	ReservationRefunded:       {},
+}
+
+func (status ReservationStatus) IsValid() bool {
+	_, ok := reservationTransitions[status]
+	return ok
+}
+
+func (status ReservationStatus) CanTransitionTo(next ReservationStatus) bool {
+	return slices.Contains(reservationTransitions[status], next)
+}
+
+// IsOnBoard reports whether a reservation in status still flies, or flew.
+func (status ReservationStatus) IsOnBoard() bool {
+	switch status {
+	case ReservationCancelled, ReservationNoShow, ReservationDeniedBoarding, ReservationRefunded:
+		return false
+	}
+	return true
+}
+
+// ReleasesSeat reports whether moving to status gives the seat back to the
+// flight, or the place of the reservations without a seat back to its
+// overbooking allowance.
+func (status ReservationStatus) ReleasesSeat() bool {
+	return status == ReservationCancelled || status == ReservationDeniedBoarding
+}
+
+// CanChangeSeat reports whether the seat of a reservation in status may still
+// be changed.
+func (status ReservationStatus) CanChangeSeat() bool {
+	switch status {
+	case ReservationPending, ReservationConfirmed, ReservationTicketed, ReservationCheckedIn:
+		return true
+	}
+	return false
+}
+
+// IsSetByAdmin reports whether reservations are moved to status by the
+// admins directly. The others follow from payments, cancellations and denied
+// boardings, which refund what they must.
+func (status ReservationStatus) IsSetByAdmin() bool {
+	switch status {
+	case ReservationTicketed, ReservationCheckedIn, ReservationBoarded, ReservationNoShow:
+		return true
+	}
+	return false
+}
+
+type StatusChange struct {
+	From ReservationStatus `json:"from,omitempty" bson:"from,omitempty"`
+	To   ReservationStatus `json:"to" bson:"to"`
+	At   time.Time         `json:"at" bson:"at"`
+}
+
+// TransitionError is returned when a reservation is asked to move to a
+// status it cannot reach from its current one.
+type TransitionError struct {
+	From ReservationStatus
+	To   ReservationStatus
+}
+
+func (err *TransitionError) Error() string {
+	if err.From == err.To {
+		return fmt.Sprintf("reservation already %s", err.To)
+	}
+	return fmt.Sprintf("reservation cannot go from %s to %s", err.From, err.To)
+}
+
+type UpdateReservationStatusParams struct {
+	Status ReservationStatus `json:"status"`
+}
+
+func (params UpdateReservationStatusParams) Validate() map[string]string {
+	errors := make(map[string]string)
+	switch {
+	case !params.Status.IsValid():
+		errors["status"] = fmt.Sprintf("unknown status %q", params.Status)
+	case !params.Status.IsSetByAdmin():
+		errors["status"] = fmt.Sprintf("status %q cannot be set directly", params.Status)
+	}
+	return errors
+}
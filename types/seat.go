@@ -1,6 +1,11 @@
 package types
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
 
 type SeatClass int
 
@@ -17,20 +22,82 @@ const (
 	_ SeatLocation = iota
 	Aisle
 	Middle
-	window
+	Window
 )
 
+// Row, Letter and Designator, such as "12C", place a seat in the seat map of
+// the aircraft. Seats of flights created without an aircraft have none.
+//
+// Price is the base fare of the seat, and Fare what a passenger pays for it
+// once the taxes and fees are added, both kept up to date by the pricing.
 type Seat struct {
-	Id        primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
-	FlightId  primitive.ObjectID `json:"flight_id" bson:"flight_id"`
-	Number    int                `json:"number" bson:"number"`
-	Price     float64            `json:"price" bson:"price"`
-	Class     SeatClass          `json:"class" bson:"class"`
-	Location  SeatLocation       `json:"location" bson:"location"`
-	Available bool               `json:"available" bson:"available"`
+	Id         primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	FlightId   primitive.ObjectID `json:"flight_id" bson:"flight_id"`
+	Number     int                `json:"number" bson:"number"`
+	Row        int                `json:"row,omitempty" bson:"row,omitempty"`
+	Letter     string             `json:"letter,omitempty" bson:"letter,omitempty"`
+	Designator string             `json:"designator,omitempty" bson:"designator,omitempty"`
+	ExitRow    bool               `json:"exit_row,omitempty" bson:"exit_row,omitempty"`
+	Price      Money              `json:"price" bson:"price"`
+	Fare       *FareBreakdown     `json:"fare,omitempty" bson:"fare,omitempty"`
+	Class      SeatClass          `json:"class" bson:"class"`
+	Location   SeatLocation       `json:"location" bson:"location"`
+	Available  bool               `json:"available" bson:"available"`
+	HeldBy     primitive.ObjectID `json:"-" bson:"held_by,omitempty"`
+	HeldUntil  *time.Time         `json:"held_until,omitempty" bson:"held_until,omitempty"`
+}
+
+// IsAvailable reports whether the seat can be taken at now: either nobody
+// took it or the hold on it has expired and is just waiting to be swept.
+func (seat *Seat) IsAvailable(now time.Time) bool {
+	return seat.Available || (seat.HeldUntil != nil && !now.Before(*seat.HeldUntil))
+}
+
+func (seat *Seat) IsHeldBy(userId primitive.ObjectID, now time.Time) bool {
+	return seat.HeldUntil != nil && now.Before(*seat.HeldUntil) && seat.HeldBy == userId
+}
+
+// PriciestSeat returns the seat of seats with the highest price, which the
+// reservations without a seat are priced like, or nil when there is none.
+func PriciestSeat(seats []*Seat) *Seat {
+	var priciest *Seat
+	for _, seat := range seats {
+		if priciest == nil {
+			priciest = seat
+			continue
+		}
+		if cmp, err := seat.Price.Cmp(priciest.Price); err == nil && cmp > 0 {
+			priciest = seat
+		}
+	}
+	return priciest
 }
 
 type UpdateSeatParams struct {
-	Price     float64 `json:"price" bson:"price"`
-	Available bool    `json:"available" bson:"available"`
+	Price     Money `json:"price" bson:"price"`
+	Available bool  `json:"available" bson:"available"`
+}
+
+const (
+	defaultHoldTTL = 5 * time.Minute
+	maxHoldTTL     = 15 * time.Minute
+)
+
+type CreateHoldParams struct {
+	TTLSeconds int `json:"ttl_seconds"`
+}
+
+func (params CreateHoldParams) Validate() map[string]string {
+	errors := make(map[string]string)
+	if params.TTLSeconds < 0 || time.Duration(params.TTLSeconds)*time.Second > maxHoldTTL {
+		errors["ttl_seconds"] = fmt.Sprintf("ttl must be between 1 and %d seconds", int(maxHoldTTL.Seconds()))
+	}
+	return errors
+}
+
+func (params CreateHoldParams) TTL() time.Duration {
+	if params.TTLSeconds == 0 {
+		return defaultHoldTTL
+	}
+	return time.Duration(params.TTLSeconds) * time.Second
 }
@@ -0,0 +1,83 @@
+package types
+
+import (
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrSeatNotChangeable is returned when the seat of a reservation is changed
+// once it cannot be anymore, such as after boarding or cancelling.
+var ErrSeatNotChangeable = errors.New("seat cannot be changed anymore")
+
+// ErrFareChanged is returned when a seat change is paid for another amount
+// than the difference between the fares, which moved in the meantime.
+var ErrFareChanged = errors.New("fare changed")
+
+// SeatChange records the move of a reservation from a seat to another of the
+// same flight, and the Difference between what the two cost, positive when
+// the new seat costs more. FromSeatId is unset for the reservations sold
+// beyond the seats of their flight. Payment is the charge of the Difference
+// when it is positive.
+type SeatChange struct {
+	FromSeatId primitive.ObjectID `json:"from_seat_id,omitempty" bson:"from_seat_id,omitempty"`
+	ToSeatId   primitive.ObjectID `json:"to_seat_id" bson:"to_seat_id"`
+	Difference Money              `json:"difference" bson:"difference"`
+	Payment    *Payment           `json:"payment,omitempty" bson:"payment,omitempty"`
+	At         time.Time          `json:"at" bson:"at"`
+}
+
+// FareDifference is what moving reservation to seat costs more, as seat is
+// priced now, or less when negative.
+func (reservation *Reservation) FareDifference(seat *Seat) (Money, error) {
+	before := reservation.Price
+	if reservation.Fare != nil {
+		before = reservation.Fare.Total
+	}
+	after := seat.Price
+	if seat.Fare != nil {
+		after = seat.Fare.Total
+	}
+	return after.Sub(before)
+}
+
+// ChangeSeat moves reservation to seat at at, pricing it like seat as it is
+// priced now, and returns the change. The discount of its promotion, and the
+// credit and points spent on it, are kept. payment is the charge of the fare
+// difference when seat costs more; it fails with ErrFareChanged when it is
+// missing or for another amount, or given when seat does not cost more.
+func (reservation *Reservation) ChangeSeat(seat *Seat, payment *Payment, at time.Time) (*SeatChange, error) {
+	difference, err := reservation.FareDifference(seat)
+	if err != nil {
+		return nil, err
+	}
+	if difference.IsPos() != (payment != nil) || (payment != nil && !payment.Amount.Equal(difference)) {
+		return nil, ErrFareChanged
+	}
+
+	change := SeatChange{FromSeatId: reservation.SeatId, ToSeatId: seat.Id, Difference: difference, Payment: payment, At: at.UTC()}
+	reservation.SeatId = seat.Id
+	if reservation.Class != 0 {
+		reservation.Class = seat.Class
+	}
+	reservation.Price = seat.Price
+	reservation.Fare = seat.Fare
+	reservation.SeatChanges = append(reservation.SeatChanges, change)
+	return &change, nil
+}
+
+// ChangeSeatParams are the body of the requests that move a reservation to
+// the seat with SeatId, charging PaymentMethod when it costs more.
+type ChangeSeatParams struct {
+	SeatId        primitive.ObjectID `json:"seat_id"`
+	PaymentMethod string             `json:"payment_method"`
+}
+
+func (params ChangeSeatParams) Validate() map[string]string {
+	errors := make(map[string]string)
+	if params.SeatId.IsZero() {
+		errors["seat_id"] = "seat_id is required"
+	}
+	return errors
+}
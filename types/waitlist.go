@@ -0,0 +1,81 @@
+package types
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type WaitlistStatus string
+
+const (
+	WaitlistWaiting WaitlistStatus = "waiting"
+	WaitlistOffered WaitlistStatus = "offered"
+	WaitlistBooked  WaitlistStatus = "booked"
+	WaitlistExpired WaitlistStatus = "expired"
+)
+
+var (
+	// ErrAlreadyWaitlisted is returned when a user joins a waitlist they are
+	// waiting on already.
+	ErrAlreadyWaitlisted = errors.New("already on the waitlist")
+	// ErrSeatsAvailable is returned when a user joins the waitlist of a class
+	// that still has seats to reserve.
+	ErrSeatsAvailable = errors.New("seats still available")
+	// ErrClassNotOffered is returned when a user joins the waitlist of a
+	// class the flight has no seats in.
+	ErrClassNotOffered = errors.New("class not offered on this flight")
+)
+
+// WaitlistEntry is a user waiting for a seat of Class on a sold-out flight.
+// The users waiting on a flight are offered the seats given back in the
+// order they joined, the higher loyalty tiers first when they joined at the
+// same time. Priority is the rank of their Tier when they joined.
+//
+// An Offer is a hold on a seat for the user, which they confirm like any
+// other hold before it expires.
+type WaitlistEntry struct {
+	Id       primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	FlightId primitive.ObjectID `json:"flight_id" bson:"flight_id"`
+	Class    SeatClass          `json:"class" bson:"class"`
+	UserId   primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Tier     LoyaltyTier        `json:"tier" bson:"tier"`
+	Priority int                `json:"-" bson:"priority"`
+	Status   WaitlistStatus     `json:"status" bson:"status"`
+	JoinedAt time.Time          `json:"joined_at" bson:"joined_at"`
+	Offer    *WaitlistOffer     `json:"offer,omitempty" bson:"offer,omitempty"`
+	// Position is the place of the entry in the queue when it is waiting,
+	// starting at 1.
+	Position int `json:"position,omitempty" bson:"-"`
+}
+
+type WaitlistOffer struct {
+	SeatId    primitive.ObjectID `json:"seat_id" bson:"seat_id"`
+	OfferedAt time.Time          `json:"offered_at" bson:"offered_at"`
+	ExpiresAt time.Time          `json:"expires_at" bson:"expires_at"`
+}
+
+// CompareWaitlistEntries orders the entries of a waitlist the way their
+// seats are offered.
+func CompareWaitlistEntries(a, b *WaitlistEntry) int {
+	return cmp.Or(
+		a.JoinedAt.Compare(b.JoinedAt),
+		cmp.Compare(b.Priority, a.Priority),
+		cmp.Compare(a.Id.Hex(), b.Id.Hex()),
+	)
+}
+
+type JoinWaitlistParams struct {
+	Class SeatClass `json:"class"`
+}
+
+func (params JoinWaitlistParams) Validate() map[string]string {
+	errors := make(map[string]string)
+	if params.Class < Economy || params.Class > First {
+		errors["class"] = fmt.Sprintf("invalid class %d", params.Class)
+	}
+	return errors
+}
@@ -0,0 +1,22 @@
+package waitlist
+
+import (
+	"context"
+	"log"
+
+	"github.com/fabrizioperria/goflight/types"
+)
+
+// Notifier tells users about the seats offered to them.
+type Notifier interface {
+	Notify(ctx context.Context, user *types.User, message string) error
+}
+
+// LogNotifier writes the notifications to the log, for lack of a mail
+// service to send them with.
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(ctx context.Context, user *types.User, message string) error {
+	log.Printf("notify %s: %s", user.Email, message)
+	return nil
+}
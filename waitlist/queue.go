@@ -0,0 +1,246 @@
+// Package waitlist queues the users for the seats of sold-out flights: a
+// seat given back by a cancellation is held for the first user waiting for
+// its class, who is notified and has until the hold expires to confirm it.
+package waitlist
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/fabrizioperria/goflight/db"
+	"github.com/fabrizioperria/goflight/loyalty"
+	"github.com/fabrizioperria/goflight/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// DefaultOfferTTL is how long the users have to confirm the seats offered
+// to them, longer than a hold since they did not ask for them just now.
+const DefaultOfferTTL = time.Hour
+
+type Queue struct {
+	store    db.Store
+	loyalty  *loyalty.Program
+	notifier Notifier
+	offerTTL time.Duration
+}
+
+func NewQueue(store db.Store, program *loyalty.Program, notifier Notifier, offerTTL time.Duration) *Queue {
+	return &Queue{
+		store:    store,
+		loyalty:  program,
+		notifier: notifier,
+		offerTTL: offerTTL,
+	}
+}
+
+// Join puts the user with userId on the waitlist of class on flight, behind
+// the users who joined before, unless a seat of class can still be
+// reserved.
+func (q *Queue) Join(ctx context.Context, flight *types.Flight, class types.SeatClass, userId primitive.ObjectID, now time.Time) (*types.WaitlistEntry, error) {
+	seats, err := q.store.Seat.GetSeats(ctx, db.SeatFilter{FlightId: flight.Id, Class: class}, &db.Pagination{Limit: "1"})
+	if err != nil {
+		return nil, err
+	}
+	if len(seats) == 0 {
+		return nil, types.ErrClassNotOffered
+	}
+	available := true
+	seats, err = q.store.Seat.GetSeats(ctx, db.SeatFilter{FlightId: flight.Id, Class: class, Available: &available}, &db.Pagination{Limit: "1"})
+	if err != nil {
+		return nil, err
+	}
+	if len(seats) > 0 {
+		return nil, types.ErrSeatsAvailable
+	}
+
+	account, err := q.loyalty.Account(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := q.store.Waitlist.JoinWaitlist(ctx, &types.WaitlistEntry{
+		FlightId: flight.Id,
+		Class:    class,
+		UserId:   userId,
+		Tier:     account.Tier,
+		Priority: account.Tier.Rank(),
+		Status:   types.WaitlistWaiting,
+		JoinedAt: now.UTC(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return q.withPosition(ctx, entry)
+}
+
+// Entries returns the entries matching filter, along with the positions of
+// the ones waiting.
+func (q *Queue) Entries(ctx context.Context, filter db.WaitlistFilter, pagination *db.Pagination) ([]*types.WaitlistEntry, error) {
+	entries, err := q.store.Waitlist.GetWaitlist(ctx, filter, pagination)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if _, err := q.withPosition(ctx, entry); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// withPosition sets the position of entry in its queue, when it is waiting.
+func (q *Queue) withPosition(ctx context.Context, entry *types.WaitlistEntry) (*types.WaitlistEntry, error) {
+	if entry.Status != types.WaitlistWaiting {
+		return entry, nil
+	}
+	filter := db.WaitlistFilter{FlightId: entry.FlightId, Class: entry.Class, Status: types.WaitlistWaiting}
+	queue, err := q.store.Waitlist.GetWaitlist(ctx, filter, &db.Pagination{Limit: "0"})
+	if err != nil {
+		return nil, err
+	}
+	for i, waiting := range queue {
+		if waiting.Id == entry.Id {
+			entry.Position = i + 1
+		}
+	}
+	return entry, nil
+}
+
+// Offer holds seat, just given back to its flight, for the first user
+// waiting for its class and notifies them. It returns their entry, or nil
+// when nobody is waiting, the flight departed or the seat was reserved by
+// someone else in the meantime. Seats are kept for the passengers sold a
+// reservation of their class beyond the seats of an overbooked flight, who
+// are assigned one at check-in, while there are any.
+func (q *Queue) Offer(ctx context.Context, seat *types.Seat, now time.Time) (*types.WaitlistEntry, error) {
+	filter := db.WaitlistFilter{FlightId: seat.FlightId, Class: seat.Class, Status: types.WaitlistWaiting}
+	queue, err := q.store.Waitlist.GetWaitlist(ctx, filter, &db.Pagination{Limit: "0"})
+	if err != nil || len(queue) == 0 {
+		return nil, err
+	}
+	flight, err := q.store.Flight.GetFlight(ctx, db.FlightFilter{Id: seat.FlightId})
+	if err != nil {
+		return nil, err
+	}
+	if !now.Before(flight.DepartureTime) {
+		return nil, nil
+	}
+	if oversold, err := q.oversold(ctx, flight, seat.Class); err != nil || oversold {
+		return nil, err
+	}
+
+	offer := &types.WaitlistOffer{SeatId: seat.Id, OfferedAt: now, ExpiresAt: now.Add(q.offerTTL)}
+	for _, entry := range queue {
+		offered, err := q.store.Waitlist.UpdateWaitlistEntry(ctx, entry.Id, types.WaitlistWaiting, types.WaitlistOffered, offer)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			// the user left or was offered another seat meanwhile
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		available := true
+		_, err = q.store.Reservation.HoldSeat(ctx, db.SeatFilter{Id: seat.Id, Available: &available}, entry.UserId, offer.ExpiresAt)
+		if err != nil {
+			// the user keeps their place for the next seat
+			if _, revertErr := q.store.Waitlist.UpdateWaitlistEntry(ctx, entry.Id, types.WaitlistOffered, types.WaitlistWaiting, nil); revertErr != nil {
+				return nil, revertErr
+			}
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		return offered, q.notify(ctx, offered, flight, seat)
+	}
+	return nil, nil
+}
+
+func (q *Queue) notify(ctx context.Context, entry *types.WaitlistEntry, flight *types.Flight, seat *types.Seat) error {
+	user, err := q.store.User.GetUser(ctx, db.UserFilter{Id: entry.UserId})
+	if err != nil {
+		return err
+	}
+	designator := seat.Designator
+	if designator == "" {
+		designator = strconv.Itoa(seat.Number)
+	}
+	message := fmt.Sprintf("Seat %s on the %s flight from %s to %s on %s is held for you until %s, confirm it to reserve it.",
+		designator, flight.Airline, flight.Departure, flight.Arrival,
+		flight.DepartureTime.Format(time.DateOnly), entry.Offer.ExpiresAt.Format(time.RFC3339))
+	return q.notifier.Notify(ctx, user, message)
+}
+
+// oversold reports whether a reservation of class on flight still waits for
+// a seat.
+func (q *Queue) oversold(ctx context.Context, flight *types.Flight, class types.SeatClass) (bool, error) {
+	if flight.Oversold == 0 {
+		return false, nil
+	}
+	reservations, err := q.store.Reservation.GetReservations(ctx, db.ReservationFilter{FlightId: flight.Id}, &db.Pagination{Limit: "0"})
+	if err != nil {
+		return false, err
+	}
+	for _, reservation := range reservations {
+		if !reservation.IsAssigned() && reservation.Class == class && reservation.CurrentStatus().IsOnBoard() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Booked closes the offer of the seat of reservation to its user, who just
+// confirmed their hold on it.
+func (q *Queue) Booked(ctx context.Context, reservation *types.Reservation) error {
+	filter := db.WaitlistFilter{UserId: reservation.UserId, SeatId: reservation.SeatId, Status: types.WaitlistOffered}
+	entry, err := q.store.Waitlist.GetWaitlistEntry(ctx, filter)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = q.store.Waitlist.UpdateWaitlistEntry(ctx, entry.Id, types.WaitlistOffered, types.WaitlistBooked, entry.Offer)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	}
+	return err
+}
+
+// ExpireOffers closes the offers not confirmed by now and offers their seats
+// to the next users waiting. It returns how many offers expired.
+func (q *Queue) ExpireOffers(ctx context.Context, now time.Time) (int, error) {
+	offered, err := q.store.Waitlist.GetWaitlist(ctx, db.WaitlistFilter{Status: types.WaitlistOffered}, &db.Pagination{Limit: "0"})
+	if err != nil {
+		return 0, err
+	}
+	expired := 0
+	for _, entry := range offered {
+		if now.Before(entry.Offer.ExpiresAt) {
+			continue
+		}
+		_, err := q.store.Waitlist.UpdateWaitlistEntry(ctx, entry.Id, types.WaitlistOffered, types.WaitlistExpired, entry.Offer)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			// confirmed meanwhile
+			continue
+		}
+		if err != nil {
+			return expired, err
+		}
+		expired++
+		seat, err := q.store.Seat.GetSeat(ctx, db.SeatFilter{Id: entry.Offer.SeatId})
+		if err != nil {
+			return expired, err
+		}
+		if !seat.IsAvailable(now) {
+			continue
+		}
+		if _, err := q.Offer(ctx, seat, now); err != nil {
+			return expired, err
+		}
+	}
+	return expired, nil
+}
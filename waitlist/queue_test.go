@@ -0,0 +1,115 @@
+package waitlist
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fabrizioperria/goflight/db"
+	"github.com/fabrizioperria/goflight/db/memory"
+	"github.com/fabrizioperria/goflight/loyalty"
+	"github.com/fabrizioperria/goflight/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// recorder keeps the emails of the users notified, in order.
+type recorder struct {
+	notified []string
+}
+
+func (r *recorder) Notify(ctx context.Context, user *types.User, message string) error {
+	r.notified = append(r.notified, user.Email)
+	return nil
+}
+
+func newUser(t *testing.T, store *db.Store, email string) *types.User {
+	user, err := store.User.CreateUser(context.Background(), &types.User{FirstName: "Frank", LastName: "Potato", Email: email})
+	require.NoError(t, err)
+	return user
+}
+
+func TestQueue(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	notifier := &recorder{}
+	queue := NewQueue(*store, loyalty.NewProgram(*store, loyalty.DefaultRules()), notifier, 50*time.Millisecond)
+	flight, err := store.Flight.CreateFlightWithSeats(ctx,
+		&types.Flight{Airline: "Delta", Departure: "JFK", Arrival: "LAX", DepartureTime: time.Now().Add(24 * time.Hour)},
+		[]*types.Seat{{Class: types.Economy, Available: true, Price: types.MustParseMoney("100", "USD")}})
+	require.NoError(t, err)
+	seat, err := store.Seat.GetSeat(ctx, db.SeatFilter{FlightId: flight.Id})
+	require.NoError(t, err)
+	holder := newUser(t, store, "holder@test.com")
+	member := newUser(t, store, "member@test.com")
+	gold := newUser(t, store, "gold@test.com")
+	_, err = store.Loyalty.UpdateLoyaltyAccount(ctx, gold.Id, func(account *types.LoyaltyAccount) (bool, error) {
+		return account.Earn(80000, primitive.NewObjectID(), time.Now()), nil
+	})
+	require.NoError(t, err)
+
+	// users only wait for the classes of the flight with no seat left
+	now := time.Now()
+	_, err = queue.Join(ctx, flight, types.Economy, member.Id, now)
+	assert.ErrorIs(t, err, types.ErrSeatsAvailable)
+	_, err = queue.Join(ctx, flight, types.First, member.Id, now)
+	assert.ErrorIs(t, err, types.ErrClassNotOffered)
+	reservation, err := store.Reservation.CreateReservation(ctx, db.SeatFilter{Id: seat.Id}, holder.Id, nil, "", nil)
+	require.NoError(t, err)
+
+	// the gold member joining at the same time goes first
+	entry, err := queue.Join(ctx, flight, types.Economy, member.Id, now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, entry.Position)
+	entry, err = queue.Join(ctx, flight, types.Economy, gold.Id, now)
+	require.NoError(t, err)
+	assert.Equal(t, types.LoyaltyGold, entry.Tier)
+	assert.Equal(t, 1, entry.Position)
+	entries, err := queue.Entries(ctx, db.WaitlistFilter{FlightId: flight.Id}, &db.Pagination{})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, gold.Id, entries[0].UserId)
+	assert.Equal(t, 2, entries[1].Position)
+
+	// the seat given back is held for the first user waiting, once
+	_, err = store.Reservation.CancelReservation(ctx, db.ReservationFilter{Id: reservation.Id}, nil, nil)
+	require.NoError(t, err)
+	offered, err := queue.Offer(ctx, seat, time.Now())
+	require.NoError(t, err)
+	require.NotNil(t, offered)
+	assert.Equal(t, gold.Id, offered.UserId)
+	assert.Equal(t, []string{"gold@test.com"}, notifier.notified)
+	held, err := store.Seat.GetSeat(ctx, db.SeatFilter{Id: seat.Id})
+	require.NoError(t, err)
+	assert.True(t, held.IsHeldBy(gold.Id, time.Now()))
+	offered, err = queue.Offer(ctx, seat, time.Now())
+	require.NoError(t, err)
+	assert.Nil(t, offered)
+	entries, err = queue.Entries(ctx, db.WaitlistFilter{FlightId: flight.Id, Status: types.WaitlistWaiting}, &db.Pagination{})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, member.Id, entries[0].UserId)
+	assert.Equal(t, 1, entries[0].Position)
+
+	// an offer not confirmed in time goes to the next user
+	expired, err := queue.ExpireOffers(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Zero(t, expired)
+	time.Sleep(60 * time.Millisecond)
+	expired, err = queue.ExpireOffers(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 1, expired)
+	assert.Equal(t, []string{"gold@test.com", "member@test.com"}, notifier.notified)
+	entry, err = store.Waitlist.GetWaitlistEntry(ctx, db.WaitlistFilter{UserId: gold.Id})
+	require.NoError(t, err)
+	assert.Equal(t, types.WaitlistExpired, entry.Status)
+
+	confirmed, err := store.Reservation.ConfirmHold(ctx, db.SeatFilter{Id: seat.Id}, member.Id, nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, queue.Booked(ctx, confirmed))
+	entry, err = store.Waitlist.GetWaitlistEntry(ctx, db.WaitlistFilter{UserId: member.Id})
+	require.NoError(t, err)
+	assert.Equal(t, types.WaitlistBooked, entry.Status)
+	assert.Equal(t, seat.Id, entry.Offer.SeatId)
+}